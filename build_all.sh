@@ -26,4 +26,11 @@ for service in "${SERVICES[@]}"; do
     cd ..
 done
 
+# 单进程入口：./remember all
+echo "进入目录 remember 编译 remember_main.go ..."
+cd remember
+go build -o remember remember_main.go
+echo "生成可执行文件：remember/remember"
+cd ..
+
 echo "=== 编译完成 ==="
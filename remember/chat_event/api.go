@@ -26,6 +26,25 @@ type Conversation struct {
 type UploadRequest struct {
 	SessionID    string        `json:"session_id"`
 	Conversations []Conversation `json:"conversations"` // 一轮完整的对话（多个对话对）
+	ClaimID      string        `json:"claim_id,omitempty"` // session_messages 中认领消息的 task_id，可为空
+}
+
+// BatchQueryRequest 批量查询接口请求体
+type BatchQueryRequest struct {
+	SessionIDs []string `json:"session_ids"`
+}
+
+// ImportRequest 导入接口请求体
+type ImportRequest struct {
+	SessionID string      `json:"session_id"`
+	Mode      string      `json:"mode"` // replace / merge / skip
+	Events    []ChatEvent `json:"events"`
+}
+
+// PurgeClaimRequest 删除批次事件接口请求体
+type PurgeClaimRequest struct {
+	SessionID string `json:"session_id"`
+	ClaimID   string `json:"claim_id"` // session_messages 中认领消息的 task_id
 }
 
 // UploadResponse 上传接口响应（统一格式）
@@ -76,7 +95,15 @@ func RegisterRoutes() http.Handler {
 
 	r.Post("/chat_event/upload", uploadHandler)               // 上传接口
 	r.Get("/chat_event/get/{sessionID}", queryHandler)        // 查询接口
+	r.Post("/chat_event/get_batch", batchQueryHandler)        // 批量查询接口
 	r.Delete("/chat_event/delete/{sessionID}", deleteHandler) // 删除接口
+	r.Get("/chat_event/task/{taskID}", taskStatusHandler)     // 任务状态查询接口
+	r.Get("/chat_event/export/{sessionID}", exportHandler)    // 导出接口
+	r.Post("/chat_event/import", importHandler)               // 导入接口
+	r.Post("/chat_event/purge_claim", purgeClaimHandler)      // 删除批次抽取出的事件（消息被修改后由主服务调用）
+	// 死信管理接口
+	DeadLetters.RegisterRoutes(r, "/chat_event")
+
 	return r
 }
 
@@ -97,31 +124,11 @@ func uploadHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if req.SessionID == "" || len(req.Conversations) == 0 {
-		resp := UploadResponse{
-			Code: -1,
-			Msg:  fmt.Sprintf("%s session_id and conversations are required", SERVER_NAME),
-			Data: struct{}{},
-		}
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(resp)
-		return
-	}
-
-	// 直接使用 conversations，保留对话对和时间戳信息
-	msg := QueueMessage{
-		TaskID:       GenerateUUID(),
-		SessionID:    req.SessionID,
-		Conversations: req.Conversations,
-		Timestamp:    time.Now().UTC().Unix(),
-		Retry:        0,
-	}
-
-	// 入队列
-	if _, err := MessageQueue.Enqueue(ctx, msg); err != nil {
+	taskID, err := SubmitTask(ctx, req.SessionID, req.ClaimID, req.Conversations)
+	if err != nil {
 		resp := UploadResponse{
 			Code: -1,
-			Msg:  fmt.Sprintf("failed to %s enqueue", SERVER_NAME),
+			Msg:  err.Error(),
 			Data: struct{}{},
 		}
 		w.Header().Set("Content-Type", "application/json")
@@ -133,7 +140,7 @@ func uploadHandler(w http.ResponseWriter, r *http.Request) {
 	resp := UploadResponse{
 		Code: 0,
 		Msg:  fmt.Sprintf("messages uploaded %s successfully", SERVER_NAME),
-		Data: map[string]string{"task_id": msg.TaskID},
+		Data: map[string]string{"task_id": taskID},
 	}
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(resp)
@@ -151,11 +158,11 @@ func queryHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	userPortrait, err := DBClient.GetSessionEvents(sessionID)
+	userPortrait, err := GetEvents(sessionID)
 	if err != nil {
 		json.NewEncoder(w).Encode(QueryResponse{
 			Code: -1,
-			Msg:  "failed to get user portrait: " + err.Error(),
+			Msg:  err.Error(),
 			Data: struct{}{},
 		})
 		return
@@ -168,6 +175,35 @@ func queryHandler(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// batchQueryHandler 批量查询关键事件，data 以 session_id 为 key
+func batchQueryHandler(w http.ResponseWriter, r *http.Request) {
+	var req BatchQueryRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		json.NewEncoder(w).Encode(QueryResponse{
+			Code: -1,
+			Msg:  "invalid request body",
+			Data: struct{}{},
+		})
+		return
+	}
+
+	events, err := GetEventsBatch(req.SessionIDs)
+	if err != nil {
+		json.NewEncoder(w).Encode(QueryResponse{
+			Code: -1,
+			Msg:  err.Error(),
+			Data: struct{}{},
+		})
+		return
+	}
+
+	json.NewEncoder(w).Encode(QueryResponse{
+		Code: 0,
+		Msg:  "success",
+		Data: events,
+	})
+}
+
 func deleteHandler(w http.ResponseWriter, r *http.Request) {
 	sessionID := chi.URLParam(r, "sessionID")
 	if sessionID == "" {
@@ -179,22 +215,41 @@ func deleteHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// 删除数据库记录
-	if err := DBClient.DeleteSessionEvents(sessionID); err != nil {
+	// 删除数据库记录及队列中的消息
+	if err := DeleteSession(r.Context(), sessionID); err != nil {
+		json.NewEncoder(w).Encode(QueryResponse{
+			Code: -1,
+			Msg:  err.Error(),
+			Data: struct{}{},
+		})
+		return
+	}
+
+	json.NewEncoder(w).Encode(QueryResponse{
+		Code: 0,
+		Msg:  "user portrait and queue messages deleted successfully",
+		Data: struct{}{},
+	})
+}
+
+// taskStatusHandler 查询任务状态
+func taskStatusHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	taskID := chi.URLParam(r, "taskID")
+	if taskID == "" {
 		json.NewEncoder(w).Encode(QueryResponse{
 			Code: -1,
-			Msg:  "failed to delete user portrait: " + err.Error(),
+			Msg:  "task_id is required",
 			Data: struct{}{},
 		})
 		return
 	}
 
-	// 删除队列中的消息
-	ctx := context.Background()
-	if err := MessageQueue.DeleteBySession(ctx, sessionID); err != nil {
+	status, err := GetTaskStatus(r.Context(), taskID)
+	if err != nil {
 		json.NewEncoder(w).Encode(QueryResponse{
 			Code: -1,
-			Msg:  "failed to delete messages from queue: " + err.Error(),
+			Msg:  err.Error(),
 			Data: struct{}{},
 		})
 		return
@@ -202,7 +257,84 @@ func deleteHandler(w http.ResponseWriter, r *http.Request) {
 
 	json.NewEncoder(w).Encode(QueryResponse{
 		Code: 0,
-		Msg:  "user portrait and queue messages deleted successfully",
-		Data: struct{}{},
+		Msg:  "success",
+		Data: status,
+	})
+}
+
+// exportHandler 导出会话的全部事件
+func exportHandler(w http.ResponseWriter, r *http.Request) {
+	events, err := ExportEvents(chi.URLParam(r, "sessionID"))
+	if err != nil {
+		json.NewEncoder(w).Encode(QueryResponse{
+			Code: -1,
+			Msg:  err.Error(),
+			Data: struct{}{},
+		})
+		return
+	}
+
+	json.NewEncoder(w).Encode(QueryResponse{
+		Code: 0,
+		Msg:  "success",
+		Data: events,
+	})
+}
+
+// importHandler 将事件导入会话
+func importHandler(w http.ResponseWriter, r *http.Request) {
+	var req ImportRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		json.NewEncoder(w).Encode(QueryResponse{
+			Code: -1,
+			Msg:  "invalid request body",
+			Data: struct{}{},
+		})
+		return
+	}
+
+	result, err := ImportEvents(req.SessionID, req.Mode, req.Events)
+	if err != nil {
+		json.NewEncoder(w).Encode(QueryResponse{
+			Code: -1,
+			Msg:  err.Error(),
+			Data: struct{}{},
+		})
+		return
+	}
+
+	json.NewEncoder(w).Encode(QueryResponse{
+		Code: 0,
+		Msg:  "success",
+		Data: result,
+	})
+}
+
+// purgeClaimHandler 删除 claim_id 批次抽取出的事件
+func purgeClaimHandler(w http.ResponseWriter, r *http.Request) {
+	var req PurgeClaimRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		json.NewEncoder(w).Encode(QueryResponse{
+			Code: -1,
+			Msg:  "invalid request body",
+			Data: struct{}{},
+		})
+		return
+	}
+
+	purged, err := PurgeClaim(r.Context(), req.SessionID, req.ClaimID)
+	if err != nil {
+		json.NewEncoder(w).Encode(QueryResponse{
+			Code: -1,
+			Msg:  err.Error(),
+			Data: struct{}{},
+		})
+		return
+	}
+
+	json.NewEncoder(w).Encode(QueryResponse{
+		Code: 0,
+		Msg:  "success",
+		Data: map[string]int64{"purged": purged},
 	})
 }
@@ -107,6 +107,56 @@ func (ec *EventClient) GetSessionEvents(sessionID string) (map[string][]*ChatEve
 	return res, nil
 }
 
+// GetSessionsEvents 批量查询多个会话的事件，一次聚合查询，每个会话各取最近五个已完成事件和待办事件
+func (ec *EventClient) GetSessionsEvents(sessionIDs []string) (map[string]map[string][]*ChatEvent, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// 按会话和事件类型分组，组内用 $topN 只保留执行时间最近的 5 条，不把整组事件放进内存（需要 MongoDB 5.2+）
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"session_id": bson.M{"$in": sessionIDs}, "event_type": bson.M{"$in": []int{1, 2}}}}},
+		{{Key: "$group", Value: bson.M{
+			"_id": bson.M{"session_id": "$session_id", "event_type": "$event_type"},
+			"events": bson.M{"$topN": bson.M{
+				"n":      5,
+				"sortBy": bson.D{{Key: "execution_time", Value: -1}},
+				"output": "$$ROOT",
+			}},
+		}}},
+	}
+
+	cur, err := ec.Collection.Aggregate(ctx, pipeline, options.Aggregate())
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+
+	var groups []struct {
+		ID struct {
+			SessionID string `bson:"session_id"`
+			EventType int    `bson:"event_type"`
+		} `bson:"_id"`
+		Events []*ChatEvent `bson:"events"`
+	}
+	if err := cur.All(ctx, &groups); err != nil {
+		return nil, err
+	}
+
+	// 每个会话都返回 completed / todo，没有事件时为空列表
+	res := make(map[string]map[string][]*ChatEvent, len(sessionIDs))
+	for _, sessionID := range sessionIDs {
+		res[sessionID] = map[string][]*ChatEvent{"completed": {}, "todo": {}}
+	}
+	for _, g := range groups {
+		key := "completed"
+		if g.ID.EventType == 2 {
+			key = "todo"
+		}
+		res[g.ID.SessionID][key] = g.Events
+	}
+	return res, nil
+}
+
 // DeleteSessionEvents 删除指定 sessionID 的所有 ChatEvent
 func (ec *EventClient) DeleteSessionEvents(sessionID string) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
@@ -124,3 +174,15 @@ func (ec *EventClient) DeleteSessionEvents(sessionID string) error {
 	}
 	return nil
 }
+
+// DeleteClaimEvents 删除会话中 claim_id 批次抽取出的事件，返回删除的条数
+func (ec *EventClient) DeleteClaimEvents(sessionID, claimID string) (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	res, err := ec.Collection.DeleteMany(ctx, bson.M{"session_id": sessionID, "claim_id": claimID})
+	if err != nil {
+		return 0, err
+	}
+	return res.DeletedCount, nil
+}
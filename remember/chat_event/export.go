@@ -0,0 +1,130 @@
+package chat_event
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// --------------------- 导出与导入：主服务 /memory/export、/memory/import 按会话迁移全部事件 -----------------------------
+// 事件保留原有的 created_at，导入后仍按 created_at 的 TTL 索引过期。
+
+// ImportResult 导入结果
+type ImportResult struct {
+	Imported int  `json:"imported"` // 写入的事件数
+	Skipped  bool `json:"skipped"`  // skip 模式下会话已有事件，未写入
+}
+
+// ExportEvents 导出会话的全部事件，按创建时间升序
+func ExportEvents(sessionID string) ([]ChatEvent, error) {
+	if sessionID == "" {
+		return nil, fmt.Errorf("%s session_id is required", SERVER_NAME)
+	}
+	events, err := DBClient.findSessionEvents(sessionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to export events: %w", err)
+	}
+	return events, nil
+}
+
+// ImportEvents 将事件导入会话，session_id 改为目标会话并重新生成 _id
+func ImportEvents(sessionID, mode string, events []ChatEvent) (*ImportResult, error) {
+	if sessionID == "" {
+		return nil, fmt.Errorf("%s session_id is required", SERVER_NAME)
+	}
+	if mode != ImportReplace && mode != ImportMerge && mode != ImportSkip {
+		return nil, fmt.Errorf("%s invalid import mode: %s", SERVER_NAME, mode)
+	}
+
+	result, err := DBClient.importEvents(sessionID, mode, events)
+	if err != nil {
+		return nil, fmt.Errorf("failed to import events: %w", err)
+	}
+	if result.Imported > 0 || mode == ImportReplace {
+		NotifyMemoryChanged(context.Background(), sessionID)
+	}
+	return result, nil
+}
+
+// eventKey merge 模式下判断事件是否已存在
+func eventKey(e ChatEvent) string {
+	return fmt.Sprintf("%d\x00%d\x00%s", e.EventType, e.ExecutionTime.UnixMilli(), e.Event)
+}
+
+// findSessionEvents 查询会话的全部事件
+func (ec *EventClient) findSessionEvents(sessionID string) ([]ChatEvent, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), ImportTimeout*time.Second)
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}})
+	cursor, err := ec.Collection.Find(ctx, bson.M{"session_id": sessionID}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	events := []ChatEvent{}
+	if err := cursor.All(ctx, &events); err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+func (ec *EventClient) importEvents(sessionID, mode string, events []ChatEvent) (*ImportResult, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), ImportTimeout*time.Second)
+	defer cancel()
+
+	filter := bson.M{"session_id": sessionID}
+	switch mode {
+	case ImportSkip:
+		count, err := ec.Collection.CountDocuments(ctx, filter)
+		if err != nil {
+			return nil, err
+		}
+		if count > 0 {
+			return &ImportResult{Skipped: true}, nil
+		}
+	case ImportReplace:
+		if _, err := ec.Collection.DeleteMany(ctx, filter); err != nil {
+			return nil, err
+		}
+	case ImportMerge:
+		existing, err := ec.findSessionEvents(sessionID)
+		if err != nil {
+			return nil, err
+		}
+		seen := make(map[string]bool, len(existing))
+		for _, e := range existing {
+			seen[eventKey(e)] = true
+		}
+		kept := events[:0:0]
+		for _, e := range events {
+			if key := eventKey(e); !seen[key] {
+				seen[key] = true
+				kept = append(kept, e)
+			}
+		}
+		events = kept
+	}
+
+	if len(events) == 0 {
+		return &ImportResult{}, nil
+	}
+	docs := make([]interface{}, 0, len(events))
+	for _, e := range events {
+		e.ID = GenerateUUID()
+		e.SessionID = sessionID
+		if e.CreatedAt.IsZero() {
+			e.CreatedAt = time.Now().UTC()
+		}
+		docs = append(docs, e)
+	}
+	if _, err := ec.Collection.InsertMany(ctx, docs); err != nil {
+		return nil, err
+	}
+	Info("%s imported %d events into session %s, mode=%s", SERVER_NAME, len(docs), sessionID, mode)
+	return &ImportResult{Imported: len(docs)}, nil
+}
@@ -9,4 +9,7 @@ type ChatEvent struct {
 	Event         string    `bson:"event"`          // 事件描述
 	ExecutionTime time.Time `bson:"execution_time"` // 根据语境推断的事件发生时间
 	EventType     int       `bson:"event_type"`     // 1: 已完成事件, 2: 代办事项
+
+	// 抽取该事件的批次（session_messages 中认领消息的 task_id），消息被修改后据此删除
+	ClaimID string `bson:"claim_id,omitempty" json:"claim_id,omitempty"`
 }
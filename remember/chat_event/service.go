@@ -0,0 +1,87 @@
+package chat_event
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// --------------------- service.go 关键事件的业务逻辑，HTTP 接口与单进程模式共用 -----------------------------
+
+// SubmitTask 将一轮对话放入任务队列，返回任务ID；claimID 为 session_messages 中认领这些消息的 task_id，可为空
+func SubmitTask(ctx context.Context, sessionID, claimID string, conversations []Conversation) (string, error) {
+	if sessionID == "" || len(conversations) == 0 {
+		return "", fmt.Errorf("%s session_id and conversations are required", SERVER_NAME)
+	}
+
+	// 直接使用 conversations，保留对话对和时间戳信息
+	msg := QueueMessage{
+		TaskID:        GenerateUUID(),
+		SessionID:     sessionID,
+		Conversations: conversations,
+		Timestamp:     time.Now().UTC().Unix(),
+		Retry:         0,
+		ClaimID:       claimID,
+	}
+
+	// 入队列
+	if _, err := MessageQueue.Enqueue(ctx, msg); err != nil {
+		return "", fmt.Errorf("failed to %s enqueue", SERVER_NAME)
+	}
+	return msg.TaskID, nil
+}
+
+// GetEvents 获取最近的已完成事件和待办事件
+func GetEvents(sessionID string) (map[string][]*ChatEvent, error) {
+	events, err := DBClient.GetSessionEvents(sessionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get chat events: %w", err)
+	}
+	return events, nil
+}
+
+// GetEventsBatch 批量获取多个会话的事件，以 session_id 为 key
+func GetEventsBatch(sessionIDs []string) (map[string]map[string][]*ChatEvent, error) {
+	if len(sessionIDs) == 0 || len(sessionIDs) > MaxBatchSessions {
+		return nil, fmt.Errorf("session_ids is required, at most %d", MaxBatchSessions)
+	}
+	events, err := DBClient.GetSessionsEvents(sessionIDs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get chat events: %w", err)
+	}
+	return events, nil
+}
+
+// DeleteSession 删除会话的全部事件及队列中的待处理任务
+func DeleteSession(ctx context.Context, sessionID string) error {
+	// 删除数据库记录
+	if err := DBClient.DeleteSessionEvents(sessionID); err != nil {
+		return fmt.Errorf("failed to delete chat events: %w", err)
+	}
+
+	// 删除队列中的消息
+	if err := MessageQueue.DeleteBySession(ctx, sessionID); err != nil {
+		return fmt.Errorf("failed to delete messages from queue: %w", err)
+	}
+	NotifyMemoryChanged(ctx, sessionID)
+	return nil
+}
+
+// PurgeClaim 删除 claim_id 批次抽取出的事件，返回删除的条数；
+// 先记录批次已清除，该批次仍在队列中或正在执行的任务完成后会丢弃结果
+func PurgeClaim(ctx context.Context, sessionID, claimID string) (int64, error) {
+	if sessionID == "" || claimID == "" {
+		return 0, fmt.Errorf("%s session_id and claim_id are required", SERVER_NAME)
+	}
+	if err := purgedClaims.Mark(ctx, claimID); err != nil {
+		return 0, fmt.Errorf("failed to mark claim purged: %w", err)
+	}
+	purged, err := DBClient.DeleteClaimEvents(sessionID, claimID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to purge chat events: %w", err)
+	}
+	if purged > 0 {
+		NotifyMemoryChanged(ctx, sessionID)
+	}
+	return purged, nil
+}
@@ -4,6 +4,8 @@ package chat_event
 
 import (
 	"fmt"
+
+	"remember/prompt"
 )
 
 // ----------------------------------- 基础事件抽取模版 ----------------------------------
@@ -24,7 +26,7 @@ You are an expert at sorting and extracting "minimal event units." Your task is
 - Events that do not fall within the critical event scope should not be recorded and should be skipped.
 
 ## Minimal Event Scope
-{event_scope}
+{{.event_scope}}
 
 Extract only the minimal events listed above; other events will not be recorded.
 
@@ -39,10 +41,10 @@ Lisa made breakfast for Kim
 The user scheduled a walk with Lisa on 2025-09-11 at 12:30 PM
 
 ## Current time
-{current_time}
+{{.current_time}}
 
 ## Historical conversations
-{messages_str}
+{{.messages_str}}
 
 ## Output format example
 The output is in JSON format. The key should be a time that conforms to the time format parsing rules, and the value should be a key event.
@@ -54,14 +56,14 @@ Person Action Place Time Result
 
 Use spaces to separate columns.
 
-{format_example}
+{{.format_example}}
 
 # Output example 1
 
-{output_example_1}
+{{.output_example_1}}
 
 # Language settings
-- Your task is to use {language}
+- Your task is to use {{.language}}
 
 # Generate JSON output
 `
@@ -78,23 +80,23 @@ var EventScope = `1. Walking together
 var ChatEventFormatExample = `
 当前时间: XXXX-XX-XX XX:XX 星期X
 生成json结果:
-{{
+{
  "2025-09-11" : ".......",
  "2025-09-11 12:30" : "......",
  "2025-09-11 14:00" : ".......",
  "2025-09-13 17:00" : "......." 
-}}`
+}`
 
 // 输出示例1
 var ChatEventOutputExample1 = `
 当前时间: 2025-09-11 12:30 星期一
 生成json结果：
-{{
+{
  "2025-09-11 08:30" : "Lisa 给 user 做早餐",
  "2025-09-11 12:30" : "kim 和 lisa 一起玩 真心话大冒险",
  "2025-09-11 14:00" : "lisa 输了， 给 kim 跳了 舞蹈",
  "2025-09-13 12:30" : "kim 约定 Lisa 在 2025-09-13 茶餐厅 吃个饭"
-}}
+}
  `
 
 // 语言设置
@@ -108,7 +110,7 @@ func init() {
 	Template = NewChatEventTemplate()
 }
 
-var ChatEventtaticVars = map[string]string{
+var ChatEventtaticVars = prompt.Vars{
 	"event_scope":      EventScope,
 	"format_example":   ChatEventFormatExample,
 	"output_example_1": ChatEventOutputExample1,
@@ -122,8 +124,8 @@ type ChatEventDynamicVars struct {
 }
 
 type ChatEventTemplate struct {
-	Template   string            // 静态变量已替换后的模板
-	StaticVars map[string]string // 静态变量
+	Template   string      // 模板（text/template 语法）
+	StaticVars prompt.Vars // 静态变量
 }
 
 func NewChatEventTemplate() *ChatEventTemplate {
@@ -133,22 +135,16 @@ func NewChatEventTemplate() *ChatEventTemplate {
 	}
 }
 func (c *ChatEventTemplate) BuildPrompt(dynamicVars *ChatEventDynamicVars) (string, error) {
-	// 先替换静态变量
-	finalTpl, err := SystemPromptComposeStatic(c.Template, c.StaticVars)
-	if err != nil {
-		return "", fmt.Errorf("静态模板组装失败: %v", err)
-	}
-
-	// 将动态变量转成 map[string]string
-	dynMap := map[string]string{
+	// 将动态变量转成 prompt.Vars
+	dynMap := prompt.Vars{
 		"current_time": dynamicVars.CurrentTime,
 		"messages_str": dynamicVars.MessagesStr,
 	}
 
-	// 替换动态变量
-	finalTpl, err = SystemPromptCompose(finalTpl, dynMap)
+	// 静态变量与动态变量一起渲染，缺少变量报错
+	finalTpl, err := prompt.Compose(c.Template, c.StaticVars, dynMap)
 	if err != nil {
-		return "", fmt.Errorf("动态模板组装失败: %v", err)
+		return "", fmt.Errorf("模板组装失败: %v", err)
 	}
 
 	return finalTpl, nil
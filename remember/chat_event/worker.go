@@ -5,6 +5,8 @@ import (
 	"fmt"
 	"log"
 	"time"
+
+	"remember/taskqueue"
 )
 
 // Worker 消费队列消息
@@ -64,28 +66,48 @@ func (w *Worker) processNext() {
 	}
 
 	log.Printf("Processing session_id=%s, task_id=%s, retry=%d", msg.SessionID, msg.TaskID, msg.Retry)
+	trackTask(ctx, msg, TaskRunning, nil)
 
 	if err := w.processMessages(msg); err != nil {
 		log.Printf("❌ Task failed, session_id=%s, task_id=%s, retry=%d, err=%v", msg.SessionID, msg.TaskID, msg.Retry, err)
+		msg.History = append(msg.History, RetryRecord{Retry: msg.Retry, Error: err.Error(), FailedAt: time.Now().UTC().Unix()})
 
-		// 判断是否需要重试
-		if msg.Retry < MaxRetry {
+		// 判断是否需要重试：临时错误（超时、限流、5xx）延迟重试，永久错误直接进入死信
+		if msg.Retry < MaxRetry && taskqueue.IsRetryable(err) {
+			delay := RetryDelay(msg.Retry)
 			msg.Retry++
-			if _, enqueueErr := w.Queue.Enqueue(ctx, *msg); enqueueErr != nil {
-				log.Printf("❌ Re-enqueue failed, task_id=%s, err=%v", msg.TaskID, enqueueErr)
-			} else {
-				log.Printf("🔁 Task re-enqueued, session_id=%s, task_id=%s, retry=%d", msg.SessionID, msg.TaskID, msg.Retry)
+			if scheduleErr := w.Queue.ScheduleRetry(ctx, *msg, delay); scheduleErr != nil {
+				log.Printf("❌ Schedule retry failed, task_id=%s, err=%v", msg.TaskID, scheduleErr)
+				return // 不 ACK，超过 ClaimIdle 秒后由其他 Worker 重新领取
 			}
+			log.Printf("🔁 Task scheduled for retry in %s, session_id=%s, task_id=%s, retry=%d", delay, msg.SessionID, msg.TaskID, msg.Retry)
+			trackTask(ctx, msg, TaskRetrying, err)
 		} else {
-			// 超过重试次数，发送飞书报警，并附上最新报错
+			// 超过重试次数或不可重试，发送飞书报警，并附上最新报错
 			alertText := fmt.Sprintf(
 				"*Task failed after %d retries!*\nTaskID: %s\nSessionID: %s\nConversations: %+v\nLastError: %v",
-				MaxRetry, msg.TaskID, msg.SessionID, msg.Conversations, err,
+				msg.Retry, msg.TaskID, msg.SessionID, msg.Conversations, err,
 			)
 			go SendFeishuMsgAsync(alertText)
 
-			log.Printf("⚠️ Task dropped after %d retries, task_id=%s, last error: %v", MaxRetry, msg.TaskID, err)
+			// 写入死信队列，写入失败时不 ACK，稍后重新领取
+			if dlErr := DeadLetters.Add(ctx, msg.TaskID, msg.SessionID, *msg, msg.History, err); dlErr != nil {
+				log.Printf("❌ Dead letter failed, task_id=%s, err=%v", msg.TaskID, dlErr)
+				return
+			}
+			log.Printf("⚠️ Task dead-lettered after %d retries, task_id=%s, last error: %v", msg.Retry, msg.TaskID, err)
+			trackTask(ctx, msg, TaskFailed, err)
+			ReportCompletion(ctx, msg, CompletionFailed, err)
 		}
+	} else {
+		trackTask(ctx, msg, TaskSucceeded, nil)
+		NotifyMemoryChanged(ctx, msg.SessionID)
+		ReportCompletion(ctx, msg, CompletionDone, nil)
+	}
+
+	// 成功、已安排重试或已进入死信的任务都需要 ACK
+	if err := w.Queue.Ack(ctx, msg); err != nil {
+		log.Printf("❌ Ack failed, task_id=%s, err=%v", msg.TaskID, err)
 	}
 }
 
@@ -102,7 +124,7 @@ func (w *Worker) processMessages(msg *QueueMessage) error {
 	}
 	systemPrompt, err := w.Template.BuildPrompt(dynamicVars)
 	if err != nil {
-		return fmt.Errorf("%s 生成系统提示词失败: %w", SERVER_NAME, err)
+		return taskqueue.Permanent(fmt.Errorf("%s 生成系统提示词失败: %w", SERVER_NAME, err))
 	}
 
 	// 3. 执行模型
@@ -118,6 +140,14 @@ func (w *Worker) processMessages(msg *QueueMessage) error {
 	}
 
 	log.Println("✅生成关键事件成功:", result.JSON)
+
+	// 4. 重试时先删除同一批次上次写入的事件
+	if msg.ClaimID != "" {
+		if _, err := w.DBClient.DeleteClaimEvents(msg.SessionID, msg.ClaimID); err != nil {
+			return fmt.Errorf("%s 删除批次旧事件失败: %w", SERVER_NAME, err)
+		}
+	}
+
 	if len(result.JSON) == 0 {
 		log.Printf("%s task_id=%s 关键事件为空, 跳过事件上传", SERVER_NAME, msg.TaskID)
 		return nil
@@ -148,6 +178,7 @@ func (w *Worker) processMessages(msg *QueueMessage) error {
 			Event:         fmt.Sprintf("%v", eventContent),
 			ExecutionTime: time.Now().UTC(),
 			EventType:     eventType,
+			ClaimID:       msg.ClaimID,
 		}
 
 		// 上传到数据库
@@ -161,5 +192,17 @@ func (w *Worker) processMessages(msg *QueueMessage) error {
 		}
 	}
 
+	// 6. 执行期间消息被修改、批次已被清除时，删除刚写入的事件
+	purged, err := purgedClaims.Purged(context.Background(), msg.ClaimID)
+	if err != nil {
+		return fmt.Errorf("%s 查询批次状态失败: %w", SERVER_NAME, err)
+	}
+	if purged {
+		if _, err := w.DBClient.DeleteClaimEvents(msg.SessionID, msg.ClaimID); err != nil {
+			return fmt.Errorf("%s 删除已清除批次的事件失败: %w", SERVER_NAME, err)
+		}
+		log.Printf("%s task_id=%s 批次 %s 已清除, 丢弃抽取结果", SERVER_NAME, msg.TaskID, msg.ClaimID)
+	}
+
 	return nil
 }
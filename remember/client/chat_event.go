@@ -0,0 +1,111 @@
+package client
+
+import (
+	"context"
+	"net/http"
+)
+
+// ChatEventClient 关键事件服务客户端
+type ChatEventClient struct {
+	svc *service
+}
+
+// Upload 提交关键事件抽取任务，返回任务ID
+func (c *ChatEventClient) Upload(ctx context.Context, req ChatEventUploadRequest) (string, error) {
+	var out TaskAccepted
+	if err := c.svc.do(ctx, http.MethodPost, "/chat_event/upload", nil, req, &out); err != nil {
+		return "", err
+	}
+	return out.TaskID, nil
+}
+
+// Get 获取最近的已完成事件和待办事件
+func (c *ChatEventClient) Get(ctx context.Context, sessionID string) (*SessionEvents, error) {
+	var out SessionEvents
+	if err := c.svc.do(ctx, http.MethodGet, "/chat_event/get/"+pathEscape(sessionID), nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GetBatch 批量获取多个会话的事件，以 session_id 为 key
+func (c *ChatEventClient) GetBatch(ctx context.Context, sessionIDs []string) (map[string]*SessionEvents, error) {
+	body := struct {
+		SessionIDs []string `json:"session_ids"`
+	}{sessionIDs}
+
+	var out map[string]*SessionEvents
+	if err := c.svc.do(ctx, http.MethodPost, "/chat_event/get_batch", nil, body, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// Delete 删除会话的全部事件及队列中的待处理任务
+func (c *ChatEventClient) Delete(ctx context.Context, sessionID string) error {
+	return c.svc.do(ctx, http.MethodDelete, "/chat_event/delete/"+pathEscape(sessionID), nil, nil, nil)
+}
+
+// Task 查询任务状态，task_id 由 Upload 返回
+func (c *ChatEventClient) Task(ctx context.Context, taskID string) (*TaskStatus, error) {
+	var out TaskStatus
+	if err := c.svc.do(ctx, http.MethodGet, "/chat_event/task/"+pathEscape(taskID), nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// Export 导出会话的全部事件，按创建时间升序
+func (c *ChatEventClient) Export(ctx context.Context, sessionID string) ([]ChatEvent, error) {
+	var out []ChatEvent
+	if err := c.svc.do(ctx, http.MethodGet, "/chat_event/export/"+pathEscape(sessionID), nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// Import 将事件导入会话，mode 为 ImportReplace / ImportMerge / ImportSkip
+func (c *ChatEventClient) Import(ctx context.Context, sessionID, mode string, events []ChatEvent) (*ImportResult, error) {
+	body := struct {
+		SessionID string      `json:"session_id"`
+		Mode      string      `json:"mode"`
+		Events    []ChatEvent `json:"events"`
+	}{sessionID, mode, events}
+
+	var out ImportResult
+	if err := c.svc.do(ctx, http.MethodPost, "/chat_event/import", nil, body, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// PurgeDeadLetters 清除会话的全部死信，返回清除的条数
+func (c *ChatEventClient) PurgeDeadLetters(ctx context.Context, sessionID string) (int64, error) {
+	body := struct {
+		SessionID string `json:"session_id"`
+	}{sessionID}
+
+	var out struct {
+		Purged int64 `json:"purged"`
+	}
+	if err := c.svc.do(ctx, http.MethodPost, "/chat_event/dead_letter/purge", nil, body, &out); err != nil {
+		return 0, err
+	}
+	return out.Purged, nil
+}
+
+// PurgeClaim 删除 claim_id 批次抽取出的事件，返回删除的条数
+func (c *ChatEventClient) PurgeClaim(ctx context.Context, sessionID, claimID string) (int64, error) {
+	body := struct {
+		SessionID string `json:"session_id"`
+		ClaimID   string `json:"claim_id"`
+	}{sessionID, claimID}
+
+	var out struct {
+		Purged int64 `json:"purged"`
+	}
+	if err := c.svc.do(ctx, http.MethodPost, "/chat_event/purge_claim", nil, body, &out); err != nil {
+		return 0, err
+	}
+	return out.Purged, nil
+}
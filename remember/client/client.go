@@ -0,0 +1,262 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// --------------------- client 包：RememberMe 各微服务的类型化 Go SDK -----------------------------
+//
+// 所有服务共用一个带连接池的 http.Transport，每个调用都需要传入 context，
+// 服务端的 {code, msg, data} 响应与 HTTP 状态码统一映射为 errors.go 中的类型化错误。
+
+const DefaultTimeout = 10 * time.Second // 默认单次请求超时
+
+// sharedTransport 所有 Client 共享的连接池
+var sharedTransport = &http.Transport{
+	Proxy: http.ProxyFromEnvironment,
+	DialContext: (&net.Dialer{
+		Timeout:   5 * time.Second,
+		KeepAlive: 30 * time.Second,
+	}).DialContext,
+	MaxIdleConns:          200,
+	MaxIdleConnsPerHost:   64,
+	IdleConnTimeout:       90 * time.Second,
+	TLSHandshakeTimeout:   5 * time.Second,
+	ExpectContinueTimeout: 1 * time.Second,
+}
+
+// Endpoint 单个服务的访问地址
+type Endpoint struct {
+	BaseURL string      // 例如 http://localhost:9120 或 https://portrait.internal，不带结尾的 /
+	Token   string      // 为空时使用 Config.Token
+	TLS     *tls.Config // 可选，自定义 CA / 客户端证书，为空时使用系统默认
+}
+
+// TLSOptions 从文件加载 TLS 配置
+type TLSOptions struct {
+	CAFile             string // 自定义 CA 证书
+	CertFile           string // 客户端证书（mTLS）
+	KeyFile            string // 客户端私钥（mTLS）
+	ServerName         string // 覆盖证书校验使用的主机名
+	InsecureSkipVerify bool   // 跳过证书校验，仅用于测试环境
+}
+
+// IsZero 是否未配置任何 TLS 选项
+func (o TLSOptions) IsZero() bool {
+	return o == TLSOptions{}
+}
+
+// LoadTLSConfig 根据 TLSOptions 构造 tls.Config
+func LoadTLSConfig(opts TLSOptions) (*tls.Config, error) {
+	cfg := &tls.Config{
+		ServerName:         opts.ServerName,
+		InsecureSkipVerify: opts.InsecureSkipVerify,
+		MinVersion:         tls.VersionTLS12,
+	}
+
+	if opts.CAFile != "" {
+		pem, err := os.ReadFile(opts.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("read ca_file failed: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in ca_file %s", opts.CAFile)
+		}
+		cfg.RootCAs = pool
+	}
+
+	if opts.CertFile != "" || opts.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(opts.CertFile, opts.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("load client certificate failed: %w", err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+
+	return cfg, nil
+}
+
+// Config 客户端配置
+type Config struct {
+	SessionMessages Endpoint
+	UserPortrait    Endpoint
+	TopicSummary    Endpoint
+	ChatEvent       Endpoint
+	Memory          Endpoint // 主服务 /memory/*
+
+	Token      string        // 默认 Bearer token
+	Timeout    time.Duration // 单次请求超时，0 时使用 DefaultTimeout
+	HTTPClient *http.Client  // 可选，自定义 http.Client 时不再使用共享连接池
+}
+
+// Client 聚合所有微服务的客户端
+type Client struct {
+	httpClient *http.Client
+	tlsClients map[*tls.Config]*http.Client // 自定义 TLS 的服务各自使用独立连接池
+
+	// 单进程模式下可替换为进程内实现
+	SessionMessages SessionMessagesService
+	UserPortrait    UserPortraitService
+	TopicSummary    TopicSummaryService
+	ChatEvent       ChatEventService
+	Memory          *MemoryClient
+}
+
+// New 创建 Client
+func New(cfg Config) *Client {
+	httpClient := cfg.HTTPClient
+	if httpClient == nil {
+		timeout := cfg.Timeout
+		if timeout == 0 {
+			timeout = DefaultTimeout
+		}
+		httpClient = &http.Client{Transport: sharedTransport, Timeout: timeout}
+	}
+
+	c := &Client{httpClient: httpClient, tlsClients: map[*tls.Config]*http.Client{}}
+	c.SessionMessages = &SessionMessagesClient{svc: c.service(ServiceSessionMessages, cfg.SessionMessages, cfg.Token)}
+	c.UserPortrait = &UserPortraitClient{svc: c.service(ServiceUserPortrait, cfg.UserPortrait, cfg.Token)}
+	c.TopicSummary = &TopicSummaryClient{svc: c.service(ServiceTopicSummary, cfg.TopicSummary, cfg.Token)}
+	c.ChatEvent = &ChatEventClient{svc: c.service(ServiceChatEvent, cfg.ChatEvent, cfg.Token)}
+	c.Memory = &MemoryClient{svc: c.service(ServiceMemory, cfg.Memory, cfg.Token)}
+	return c
+}
+
+// LocalEndpoint 按端口生成本机地址，兼容旧的 localhost:port 部署方式
+func LocalEndpoint(port int) Endpoint {
+	return Endpoint{BaseURL: fmt.Sprintf("http://localhost:%d", port)}
+}
+
+// 服务名，用于错误信息
+const (
+	ServiceSessionMessages = "session_messages"
+	ServiceUserPortrait    = "user_poritrait"
+	ServiceTopicSummary    = "topic_summary"
+	ServiceChatEvent       = "chat_event"
+	ServiceMemory          = "memory"
+)
+
+// service 单个服务的请求上下文
+type service struct {
+	name       string
+	baseURL    string
+	token      string
+	httpClient *http.Client
+}
+
+func (c *Client) service(name string, ep Endpoint, defaultToken string) *service {
+	token := ep.Token
+	if token == "" {
+		token = defaultToken
+	}
+	return &service{
+		name:       name,
+		baseURL:    strings.TrimRight(ep.BaseURL, "/"),
+		token:      token,
+		httpClient: c.clientFor(ep.TLS),
+	}
+}
+
+// clientFor 返回使用指定 TLS 配置的 http.Client，同一个 tls.Config 复用同一个连接池
+func (c *Client) clientFor(tlsConfig *tls.Config) *http.Client {
+	if tlsConfig == nil {
+		return c.httpClient
+	}
+	if hc, ok := c.tlsClients[tlsConfig]; ok {
+		return hc
+	}
+
+	base, ok := c.httpClient.Transport.(*http.Transport)
+	if !ok || base == nil {
+		base = sharedTransport
+	}
+	transport := base.Clone()
+	transport.TLSClientConfig = tlsConfig
+
+	hc := &http.Client{Transport: transport, Timeout: c.httpClient.Timeout}
+	c.tlsClients[tlsConfig] = hc
+	return hc
+}
+
+// envelope 所有服务统一的响应结构
+type envelope struct {
+	Code int             `json:"code"`
+	Msg  string          `json:"msg"`
+	Data json.RawMessage `json:"data"`
+}
+
+// do 发送请求并把 data 解析到 out（out 为 nil 时忽略 data）
+func (s *service) do(ctx context.Context, method, path string, query url.Values, body, out interface{}) error {
+	endpoint := s.baseURL + path
+	if len(query) > 0 {
+		endpoint += "?" + query.Encode()
+	}
+
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("%s %s: marshal request failed: %w", s.name, path, err)
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, endpoint, reader)
+	if err != nil {
+		return fmt.Errorf("%s %s: build request failed: %w", s.name, path, err)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if s.token != "" {
+		req.Header.Set("Authorization", "Bearer "+s.token)
+	}
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return &RequestError{Service: s.name, Method: method, Path: path, Err: err}
+	}
+	defer resp.Body.Close()
+
+	raw, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return &RequestError{Service: s.name, Method: method, Path: path, Err: err}
+	}
+
+	var env envelope
+	if err := json.Unmarshal(raw, &env); err != nil {
+		if resp.StatusCode != http.StatusOK {
+			return &APIError{Service: s.name, Path: path, StatusCode: resp.StatusCode, Code: -1, Msg: strings.TrimSpace(string(raw))}
+		}
+		return &DecodeError{Service: s.name, Path: path, Body: string(raw), Err: err}
+	}
+	if resp.StatusCode != http.StatusOK || env.Code != 0 {
+		return &APIError{Service: s.name, Path: path, StatusCode: resp.StatusCode, Code: env.Code, Msg: env.Msg}
+	}
+
+	if out == nil || len(env.Data) == 0 || string(env.Data) == "null" {
+		return nil
+	}
+	if err := json.Unmarshal(env.Data, out); err != nil {
+		return &DecodeError{Service: s.name, Path: path, Body: string(env.Data), Err: err}
+	}
+	return nil
+}
+
+// pathEscape 转义 URL 路径中的 session_id
+func pathEscape(s string) string {
+	return url.PathEscape(s)
+}
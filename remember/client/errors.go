@@ -0,0 +1,75 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// 可通过 errors.Is 判断的错误类别
+var (
+	ErrUnauthorized    = errors.New("client: unauthorized")        // 401，token 缺失或错误
+	ErrNotFound        = errors.New("client: not found")           // 404
+	ErrUnavailable     = errors.New("client: service unavailable") // 网络错误或 5xx
+	ErrRejected        = errors.New("client: request rejected")    // 服务返回 code != 0
+	ErrInvalidResponse = errors.New("client: invalid response")    // 响应无法解析
+)
+
+// APIError 服务端返回的错误（HTTP 状态码非 200 或 code != 0）
+type APIError struct {
+	Service    string
+	Path       string
+	StatusCode int
+	Code       int
+	Msg        string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("%s %s: status=%d code=%d msg=%s", e.Service, e.Path, e.StatusCode, e.Code, e.Msg)
+}
+
+// Unwrap 把状态码映射为错误类别
+func (e *APIError) Unwrap() error {
+	switch {
+	case e.StatusCode == http.StatusUnauthorized || e.StatusCode == http.StatusForbidden:
+		return ErrUnauthorized
+	case e.StatusCode == http.StatusNotFound:
+		return ErrNotFound
+	case e.StatusCode >= 500:
+		return ErrUnavailable
+	default:
+		return ErrRejected
+	}
+}
+
+// RequestError 请求没有拿到响应（构造请求失败、网络错误、超时、context 取消）
+type RequestError struct {
+	Service string
+	Method  string
+	Path    string
+	Err     error
+}
+
+func (e *RequestError) Error() string {
+	return fmt.Sprintf("%s %s %s: %v", e.Service, e.Method, e.Path, e.Err)
+}
+
+func (e *RequestError) Unwrap() []error {
+	return []error{ErrUnavailable, e.Err}
+}
+
+// DecodeError 响应体不是预期的 JSON
+type DecodeError struct {
+	Service string
+	Path    string
+	Body    string
+	Err     error
+}
+
+func (e *DecodeError) Error() string {
+	return fmt.Sprintf("%s %s: decode response failed: %v, body: %s", e.Service, e.Path, e.Err, e.Body)
+}
+
+func (e *DecodeError) Unwrap() []error {
+	return []error{ErrInvalidResponse, e.Err}
+}
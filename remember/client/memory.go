@@ -0,0 +1,235 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// MemoryClient 主服务 /memory/* 客户端
+type MemoryClient struct {
+	svc *service
+}
+
+// Upload 上传一轮对话，返回主服务的任务ID
+func (c *MemoryClient) Upload(ctx context.Context, req MemoryUploadRequest) (string, error) {
+	var out TaskAccepted
+	if err := c.svc.do(ctx, http.MethodPost, "/memory/upload", nil, req, &out); err != nil {
+		return "", err
+	}
+	return out.TaskID, nil
+}
+
+// Query 获取会话的全部记忆（画像、话题、事件、消息）
+func (c *MemoryClient) Query(ctx context.Context, req MemoryQueryRequest) (*MemoryQueryResult, error) {
+	var out MemoryQueryResult
+	if err := c.svc.do(ctx, http.MethodPost, "/memory/query", nil, req, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// QueryBatch 批量获取多个会话的记忆，结果与 items 顺序一致；单个会话失败不影响其他会话
+func (c *MemoryClient) QueryBatch(ctx context.Context, items []MemoryQueryBatchItem) ([]MemoryQueryBatchResult, error) {
+	body := struct {
+		Sessions []MemoryQueryBatchItem `json:"sessions"`
+	}{items}
+
+	var out struct {
+		Results []MemoryQueryBatchResult `json:"results"`
+	}
+	if err := c.svc.do(ctx, http.MethodPost, "/memory/query:batch", nil, body, &out); err != nil {
+		return nil, err
+	}
+	return out.Results, nil
+}
+
+// Messages 获取会话的历史消息
+func (c *MemoryClient) Messages(ctx context.Context, id SessionIdentity) ([]Message, error) {
+	var out struct {
+		Messages []Message `json:"messages"`
+	}
+	if err := c.svc.do(ctx, http.MethodPost, "/memory/messages", nil, id, &out); err != nil {
+		return nil, err
+	}
+	return out.Messages, nil
+}
+
+// MessagesPage 按游标分页获取会话的历史消息，默认最新的在前
+func (c *MemoryClient) MessagesPage(ctx context.Context, id SessionIdentity, q MessageQuery) (*MessagePage, error) {
+	body := struct {
+		SessionIdentity
+		Limit  int    `json:"limit,omitempty"`
+		Before string `json:"before,omitempty"`
+		After  string `json:"after,omitempty"`
+		Since  string `json:"since,omitempty"`
+		Until  string `json:"until,omitempty"`
+		Order  string `json:"order"`
+	}{SessionIdentity: id, Limit: q.Limit, Before: q.Before, After: q.After, Order: q.Order}
+	if !q.Since.IsZero() {
+		body.Since = q.Since.UTC().Format(time.RFC3339)
+	}
+	if !q.Until.IsZero() {
+		body.Until = q.Until.UTC().Format(time.RFC3339)
+	}
+	if body.Order == "" {
+		body.Order = MessageOrderDesc // 至少带一个参数，服务端才按分页返回
+	}
+
+	var out MessagePage
+	if err := c.svc.do(ctx, http.MethodPost, "/memory/messages", nil, body, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// messageEditBody /memory/message/* 请求体
+type messageEditBody struct {
+	SessionIdentity
+	MessageID        string  `json:"message_id,omitempty"`
+	UserContent      *string `json:"user_content,omitempty"`
+	AssistantContent *string `json:"assistant_content,omitempty"`
+}
+
+// EditMessage 编辑一轮消息的内容，为 nil 的内容不修改；message_id 取自 MessagesPage 返回的消息
+func (c *MemoryClient) EditMessage(ctx context.Context, id SessionIdentity, messageID string, userContent, assistantContent *string) (*MessageChange, error) {
+	var out MessageChange
+	body := messageEditBody{SessionIdentity: id, MessageID: messageID, UserContent: userContent, AssistantContent: assistantContent}
+	if err := c.svc.do(ctx, http.MethodPost, "/memory/message/edit", nil, body, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// DeleteRound 删除一轮消息
+func (c *MemoryClient) DeleteRound(ctx context.Context, id SessionIdentity, messageID string) (*MessageChange, error) {
+	var out MessageChange
+	body := messageEditBody{SessionIdentity: id, MessageID: messageID}
+	if err := c.svc.do(ctx, http.MethodPost, "/memory/message/delete", nil, body, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// Regenerate 用新的回复替换最后一轮的 assistant 回复，messageID 不为空时必须是最后一轮
+func (c *MemoryClient) Regenerate(ctx context.Context, id SessionIdentity, messageID, content string) (*MessageChange, error) {
+	var out MessageChange
+	body := messageEditBody{SessionIdentity: id, MessageID: messageID, AssistantContent: &content}
+	if err := c.svc.do(ctx, http.MethodPost, "/memory/message/regenerate", nil, body, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// Apply 将记忆填充进系统提示词，并返回历史消息
+func (c *MemoryClient) Apply(ctx context.Context, req MemoryApplyRequest) (*MemoryApplyResult, error) {
+	var out MemoryApplyResult
+	if err := c.svc.do(ctx, http.MethodPost, "/memory/apply", nil, req, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// ApplyBatch 批量 apply，结果与 reqs 顺序一致；单个会话失败不影响其他会话
+func (c *MemoryClient) ApplyBatch(ctx context.Context, reqs []MemoryApplyRequest) ([]MemoryApplyBatchResult, error) {
+	body := struct {
+		Sessions []MemoryApplyRequest `json:"sessions"`
+	}{reqs}
+
+	var out struct {
+		Results []MemoryApplyBatchResult `json:"results"`
+	}
+	if err := c.svc.do(ctx, http.MethodPost, "/memory/apply:batch", nil, body, &out); err != nil {
+		return nil, err
+	}
+	return out.Results, nil
+}
+
+// Delete 删除会话在所有微服务中的数据
+func (c *MemoryClient) Delete(ctx context.Context, sessionID string) ([]MemoryDeleteResult, error) {
+	body := map[string]string{"session_id": sessionID}
+
+	var out struct {
+		Results []MemoryDeleteResult `json:"results"`
+	}
+	if err := c.svc.do(ctx, http.MethodDelete, "/memory/delete", nil, body, &out); err != nil {
+		return nil, err
+	}
+	return out.Results, nil
+}
+
+// Task 查询主服务任务及其触发的下游任务的状态，task_id 由 Upload 返回
+func (c *MemoryClient) Task(ctx context.Context, taskID string) (*MemoryTaskStatus, error) {
+	var out MemoryTaskStatus
+	if err := c.svc.do(ctx, http.MethodGet, "/memory/task/"+pathEscape(taskID), nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// Sessions 按最后活跃时间倒序列出会话，可按 user_id、role_id、group_id 过滤
+func (c *MemoryClient) Sessions(ctx context.Context, f SessionFilter) (*SessionList, error) {
+	query := url.Values{}
+	for key, value := range map[string]string{"user_id": f.UserID, "role_id": f.RoleID, "group_id": f.GroupID} {
+		if value != "" {
+			query.Set(key, value)
+		}
+	}
+	if f.Limit > 0 {
+		query.Set("limit", strconv.Itoa(f.Limit))
+	}
+	if f.Skip > 0 {
+		query.Set("skip", strconv.Itoa(f.Skip))
+	}
+
+	var out SessionList
+	if err := c.svc.do(ctx, http.MethodGet, "/memory/sessions/list", query, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// Session 获取单个会话的记录
+func (c *MemoryClient) Session(ctx context.Context, sessionID string) (*SessionRecord, error) {
+	var out SessionRecord
+	if err := c.svc.do(ctx, http.MethodGet, "/memory/sessions/get", url.Values{"session_id": {sessionID}}, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// Export 导出会话的全部记忆，id 中 session_id 为空时由服务端根据 group/user/role 生成
+func (c *MemoryClient) Export(ctx context.Context, id SessionIdentity) (*MemoryBundle, error) {
+	query := url.Values{}
+	for key, value := range map[string]string{"session_id": id.SessionID, "group_id": id.GroupID, "user_id": id.UserID, "role_id": id.RoleID} {
+		if value != "" {
+			query.Set(key, value)
+		}
+	}
+
+	var out MemoryBundle
+	if err := c.svc.do(ctx, http.MethodGet, "/memory/export", query, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// Import 将导出包恢复到会话，有服务导入失败时返回错误
+func (c *MemoryClient) Import(ctx context.Context, req MemoryImportRequest) (*MemoryImportResult, error) {
+	var out MemoryImportResult
+	if err := c.svc.do(ctx, http.MethodPost, "/memory/import", nil, req, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// EraseUser 删除用户出现过的全部会话的数据，有数据未删除干净时返回错误
+func (c *MemoryClient) EraseUser(ctx context.Context, userID string) (*UserErasureResult, error) {
+	var out UserErasureResult
+	if err := c.svc.do(ctx, http.MethodDelete, "/memory/user/"+pathEscape(userID), nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
@@ -0,0 +1,535 @@
+package client
+
+import (
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// ---------------------------------- 通用 ----------------------------------
+
+// Message 聊天消息
+type Message struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+// StoredMessage session_messages 返回的消息，带存储时间
+type StoredMessage struct {
+	Role      string `json:"role"`
+	Content   string `json:"content"`
+	Timestamp string `json:"timestamp,omitempty"`  // 2006-01-02 15:04:05
+	CreatedAt string `json:"created_at,omitempty"` // RFC3339, UTC
+	MessageID string `json:"message_id,omitempty"` // 所在轮次的ID，同一轮的 user、assistant 相同，编辑、删除时使用
+}
+
+// Time 解析 CreatedAt，解析失败返回零值
+func (m StoredMessage) Time() time.Time {
+	t, err := time.Parse(time.RFC3339, m.CreatedAt)
+	if err != nil {
+		return time.Time{}
+	}
+	return t
+}
+
+// TaskAccepted 异步服务入队后返回的任务信息
+type TaskAccepted struct {
+	TaskID string `json:"task_id"`
+}
+
+// 任务状态
+const (
+	TaskQueued    = "queued"    // 已入队，等待处理
+	TaskRunning   = "running"   // 处理中
+	TaskSucceeded = "succeeded" // 处理成功
+	TaskRetrying  = "retrying"  // 本次处理失败，等待重试，retry 为下一次执行的重试次数
+	TaskFailed    = "failed"    // 重试耗尽或不可重试，已进入死信队列
+	TaskUnknown   = "unknown"   // 状态查询失败（仅出现在 MemoryTaskStatus.Tasks 中）
+)
+
+// 导入冲突处理方式，目标会话已有数据时生效
+const (
+	ImportReplace = "replace" // 删除现有数据后写入
+	ImportMerge   = "merge"   // 保留现有数据，只写入不存在的记录
+	ImportSkip    = "skip"    // 已有数据时跳过
+)
+
+// ImportResult 各服务导入接口的响应 data
+type ImportResult struct {
+	Imported int  `json:"imported"`
+	Skipped  bool `json:"skipped"`
+}
+
+// TaskStatus 异步任务的执行状态
+type TaskStatus struct {
+	TaskID    string    `json:"task_id"`
+	SessionID string    `json:"session_id"`
+	Status    string    `json:"status"`
+	Retry     int       `json:"retry"`
+	LastError string    `json:"last_error,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// ---------------------------------- session_messages ----------------------------------
+
+// SessionMessagesUploadRequest /session_messages/upload 请求体
+type SessionMessagesUploadRequest struct {
+	SessionID string    `json:"session_id"`
+	Messages  []Message `json:"messages"`
+	TaskID    string    `json:"task_id,omitempty"`
+}
+
+// SessionMessagesUploadResult /session_messages/upload 响应 data
+type SessionMessagesUploadResult struct {
+	MessageIDs []string `json:"message_ids"`
+	Count      int      `json:"count"`
+}
+
+// MessageQuery 分页查询条件，单位为一轮对话；游标取自上一页的 StartCursor / EndCursor
+type MessageQuery struct {
+	Limit  int       // 每页轮数，0 时使用服务端默认值 50，最大 200
+	Before string    // 只返回该游标之前的记录
+	After  string    // 只返回该游标之后的记录
+	Since  time.Time // created_at >= Since，零值不过滤
+	Until  time.Time // created_at < Until，零值不过滤
+	Order  string    // MessageOrderDesc（默认）/ MessageOrderAsc
+}
+
+// 分页查询的排序方式
+const (
+	MessageOrderDesc = "desc" // 最新的在前
+	MessageOrderAsc  = "asc"  // 最早的在前
+)
+
+// MessagePage 分页查询结果
+type MessagePage struct {
+	Messages    []StoredMessage `json:"messages"`
+	Total       int64           `json:"total"`        // 满足 Since / Until 的总轮数
+	HasMore     bool            `json:"has_more"`     // 沿翻页方向是否还有记录：Before 为更早、After 为更新，没有游标时为 Order 方向
+	StartCursor string          `json:"start_cursor"` // 本页第一轮的游标
+	EndCursor   string          `json:"end_cursor"`   // 本页最后一轮的游标，传给下一页的 Before（desc）或 After（asc）
+}
+
+// values 编码为 URL 参数
+func (q MessageQuery) values() url.Values {
+	values := url.Values{}
+	if q.Limit > 0 {
+		values.Set("limit", strconv.Itoa(q.Limit))
+	}
+	for key, value := range map[string]string{"before": q.Before, "after": q.After, "order": q.Order} {
+		if value != "" {
+			values.Set(key, value)
+		}
+	}
+	for key, t := range map[string]time.Time{"since": q.Since, "until": q.Until} {
+		if !t.IsZero() {
+			values.Set(key, t.UTC().Format(time.RFC3339))
+		}
+	}
+	if len(values) == 0 {
+		values.Set("order", MessageOrderDesc) // 至少带一个参数，服务端才按分页返回
+	}
+	return values
+}
+
+// MessageEdit 单条消息接口的请求体，为 nil 的内容不修改
+type MessageEdit struct {
+	SessionID        string  `json:"session_id"`
+	MessageID        string  `json:"message_id"`
+	UserContent      *string `json:"user_content,omitempty"`
+	AssistantContent *string `json:"assistant_content,omitempty"`
+}
+
+// MessageChange 单条消息接口的结果
+type MessageChange struct {
+	MessageID string            `json:"message_id"`
+	Requeued  map[string]int64  `json:"requeued"` // 以抽取器名称为 key，重新等待抽取的消息数
+	Claims    map[string]string `json:"claims"`   // 以抽取器名称为 key，重新排队的批次的 claim_id，该批次已抽取的结果需要删除
+}
+
+// MarkTaskRequest /session_messages/mark_task 请求体
+type MarkTaskRequest struct {
+	SessionID string `json:"session_id"`
+	Extractor string `json:"extractor,omitempty"`  // 抽取器名称
+	TaskIndex int    `json:"task_index,omitempty"` // 旧版任务序号，extractor 为空时使用：1 用户画像, 2 关键事件, 3 主题归纳, 4 预留
+	TaskID    string `json:"task_id"`
+}
+
+// TaskCompletion /session_messages/complete 请求体
+type TaskCompletion struct {
+	SessionID string `json:"session_id"`
+	Extractor string `json:"extractor"`
+	ClaimID   string `json:"claim_id"` // 认领消息时的 task_id
+	Status    string `json:"status"`   // MessageTaskDone / MessageTaskFailed
+	Error     string `json:"error,omitempty"`
+	TaskID    string `json:"task_id,omitempty"` // 执行抽取的任务ID，仅用于日志
+}
+
+// SessionMessageRecord session_messages 中的原始记录，导出、导入使用
+type SessionMessageRecord struct {
+	ID               string    `json:"ID"`
+	SessionID        string    `json:"SessionID"`
+	UserContent      string    `json:"UserContent"`
+	AssistantContent string    `json:"AssistantContent"`
+	CreatedAt        time.Time `json:"CreatedAt"`
+	MessagesID       string    `json:"MessagesID"`
+	Task1            string    `json:"Task1"`
+	Task2            string    `json:"Task2"`
+	Task3            string    `json:"Task3"`
+	Task4            string    `json:"Task4"`
+	Status           int       `json:"Status"`
+
+	TaskStates map[string]MessageTaskState `json:"TaskStates,omitempty"` // 各抽取器的状态，key 为抽取器名称
+}
+
+// MessageTaskState 消息在某个抽取器上的状态
+type MessageTaskState struct {
+	State     string    `json:"State"` // pending / claimed / done / failed
+	ClaimID   string    `json:"ClaimID"`
+	ClaimedAt time.Time `json:"ClaimedAt"`
+	UpdatedAt time.Time `json:"UpdatedAt"`
+	Error     string    `json:"Error,omitempty"`
+}
+
+// 消息的任务状态（MessageTaskState.State）
+const (
+	MessageTaskPending = "pending" // 未认领
+	MessageTaskClaimed = "claimed" // 已认领，等待下游任务完成
+	MessageTaskDone    = "done"    // 下游任务处理成功
+	MessageTaskFailed  = "failed"  // 下游任务进入死信
+)
+
+// 旧版任务索引，对应 session_messages 中的 taskN_id，新代码使用抽取器名称
+const (
+	TaskUserPortrait = 1
+	TaskChatEvent    = 2
+	TaskTopicSummary = 3
+)
+
+// ---------------------------------- user_poritrait ----------------------------------
+
+// UserPortrait 用户画像记录
+type UserPortrait struct {
+	ID           string                 `json:"ID"`
+	SessionID    string                 `json:"SessionID"`
+	UserPortrait map[string]interface{} `json:"UserPortrait"`
+	CreatedAt    time.Time              `json:"CreatedAt"`
+	UpdatedAt    time.Time              `json:"UpdatedAt"`
+}
+
+// ---------------------------------- topic_summary ----------------------------------
+
+// TopicRecord 话题记录
+type TopicRecord struct {
+	ID        string    `json:"ID"`
+	SessionID string    `json:"SessionID"`
+	Topic     string    `json:"Topic"`
+	Content   string    `json:"Content"`
+	Keywords  []string  `json:"Keywords"`
+	CreatedAt time.Time `json:"CreatedAt"`
+	UpdatedAt time.Time `json:"UpdatedAt"`
+	ClaimID   string    `json:"claim_id,omitempty"` // 抽取该话题记录的批次
+	Score     float64   `json:"score,omitempty"`
+}
+
+// TopicSearch 批量搜索中单个会话的查询条件
+type TopicSearch struct {
+	SessionID string `json:"session_id"`
+	Query     string `json:"query"`
+}
+
+// ActiveTopic 活跃话题
+type ActiveTopic struct {
+	Topic      string    `json:"Topic"`
+	LastActive time.Time `json:"LastActive"`
+}
+
+// TopicInfo 会话话题统计
+type TopicInfo struct {
+	SessionID    string        `json:"SessionID"`
+	TopicCount   int           `json:"TopicCount"`
+	ActiveTopics []ActiveTopic `json:"ActiveTopics"`
+	UpdatedAt    time.Time     `json:"UpdatedAt"`
+}
+
+// TopicExport /topic_summary/export 响应 data，Info 不存在时为 nil
+type TopicExport struct {
+	Topics []TopicRecord `json:"topics"`
+	Info   *TopicInfo    `json:"info"`
+}
+
+// ---------------------------------- chat_event ----------------------------------
+
+// Conversation 一个对话对（user + assistant）及其时间戳
+type Conversation struct {
+	Timestamp int64     `json:"timestamp"`
+	Messages  []Message `json:"messages"`
+}
+
+// ChatEventUploadRequest /chat_event/upload 请求体
+type ChatEventUploadRequest struct {
+	SessionID     string         `json:"session_id"`
+	Conversations []Conversation `json:"conversations"`
+	ClaimID       string         `json:"claim_id,omitempty"` // session_messages 中认领这些消息的 task_id，可为空
+}
+
+// ChatEvent 关键事件
+type ChatEvent struct {
+	ID            string    `json:"ID"`
+	SessionID     string    `json:"SessionID"`
+	CreatedAt     time.Time `json:"CreatedAt"`
+	Event         string    `json:"Event"`
+	ExecutionTime time.Time `json:"ExecutionTime"`
+	EventType     int       `json:"EventType"`          // 1: 已完成事件, 2: 待办事项
+	ClaimID       string    `json:"claim_id,omitempty"` // 抽取该事件的批次
+}
+
+// SessionEvents 会话的关键事件
+type SessionEvents struct {
+	Completed []ChatEvent `json:"completed"`
+	Todo      []ChatEvent `json:"todo"`
+}
+
+// ---------------------------------- 主服务 /memory/* ----------------------------------
+
+// SessionIdentity 会话标识，session_id 为空时由服务端根据 group/user/role 生成
+type SessionIdentity struct {
+	SessionID string `json:"session_id,omitempty"`
+	UserID    string `json:"user_id,omitempty"`
+	RoleID    string `json:"role_id,omitempty"`
+	GroupID   string `json:"group_id,omitempty"`
+}
+
+// MemoryUploadRequest /memory/upload 请求体
+type MemoryUploadRequest struct {
+	SessionIdentity
+	Messages []Message `json:"messages"`
+}
+
+// 记忆块查询状态
+const (
+	SectionOK       = "ok"       // 查询成功
+	SectionDegraded = "degraded" // 查询失败，使用了最近一次快照
+	SectionFailed   = "failed"   // 查询失败，没有可用数据
+)
+
+// SectionStatus /memory/query、/memory/apply 中单个记忆块的查询状态
+type SectionStatus struct {
+	Status     string     `json:"status"`
+	Error      string     `json:"error,omitempty"`
+	SnapshotAt *time.Time `json:"snapshot_at,omitempty"` // degraded 时使用的快照保存时间
+}
+
+// MemoryQueryRequest /memory/query 请求体
+type MemoryQueryRequest struct {
+	SessionID string `json:"session_id"`
+	Query     string `json:"query,omitempty"`
+	Strict    bool   `json:"strict,omitempty"`   // 有记忆块查询失败且没有快照可用时返回错误
+	Fallback  bool   `json:"fallback,omitempty"` // 查询失败时回退到最近一次快照
+}
+
+// TopicSummaryGroup 按话题聚合后的摘要
+type TopicSummaryGroup struct {
+	Topic   string   `json:"topic"`
+	Content []string `json:"content"`
+}
+
+// ChatEventsText 只保留事件描述的关键事件
+type ChatEventsText struct {
+	Completed []string `json:"completed"`
+	Todo      []string `json:"todo"`
+}
+
+// MemoryQueryResult /memory/query 响应 data
+type MemoryQueryResult struct {
+	UserPortrait    map[string]interface{}   `json:"user_portrait"`
+	TopicSummary    []TopicSummaryGroup      `json:"topic_summary"`
+	ChatEvents      ChatEventsText           `json:"chat_events"`
+	SessionMessages []Message                `json:"session_messages"`
+	CurrentTime     string                   `json:"current_time"`
+	Sections        map[string]SectionStatus `json:"sections"` // 以记忆块名为 key
+}
+
+// MemoryApplyRequest /memory/apply 请求体
+type MemoryApplyRequest struct {
+	SessionIdentity
+	RolePrompt string         `json:"role_prompt"`
+	Query      string         `json:"query"`
+	TemplateID string         `json:"template_id,omitempty"` // 为空时使用角色默认模板
+	Version    int            `json:"version,omitempty"`     // 为空时使用最新版本
+	MaxTokens  int            `json:"max_tokens,omitempty"`  // system_prompt + messages 的总预算，0 表示不限制
+	Budgets    map[string]int `json:"budgets,omitempty"`     // 单个记忆块的预算，key 为 messages / topic_summary / user_portrait / chat_events
+	Strict     bool           `json:"strict,omitempty"`      // 有记忆块查询失败且没有快照可用时返回错误
+	Fallback   bool           `json:"fallback,omitempty"`    // 查询失败时回退到最近一次快照
+	NoCache    bool           `json:"no_cache,omitempty"`    // 跳过缓存，重新查询并构建
+}
+
+// MemoryApplyResult /memory/apply 响应 data
+type MemoryApplyResult struct {
+	SystemPrompt    string                   `json:"system_prompt"`
+	Messages        []Message                `json:"messages"`
+	TemplateID      string                   `json:"template_id"`
+	TemplateVersion int                      `json:"template_version"`
+	Usage           ContextUsage             `json:"usage"`
+	Sections        map[string]SectionStatus `json:"sections"` // 以记忆块名为 key
+	Cached          bool                     `json:"cached"`   // 是否命中缓存
+}
+
+// SectionUsage 单个记忆块的 token 用量
+type SectionUsage struct {
+	Tokens    int  `json:"tokens"`
+	Kept      int  `json:"kept"`
+	Total     int  `json:"total"`
+	Truncated bool `json:"truncated"`
+}
+
+// ContextUsage /memory/apply 的 token 用量，Sections 以记忆块名为 key
+type ContextUsage struct {
+	MaxTokens    int                     `json:"max_tokens"`
+	SystemPrompt int                     `json:"system_prompt"`
+	Total        int                     `json:"total"`
+	Sections     map[string]SectionUsage `json:"sections"`
+}
+
+// MemoryQueryBatchItem /memory/query:batch 中的单个会话，session_id 为空时由服务端根据 group/user/role 生成
+type MemoryQueryBatchItem struct {
+	SessionIdentity
+	Query    string `json:"query,omitempty"`
+	Strict   bool   `json:"strict,omitempty"`
+	Fallback bool   `json:"fallback,omitempty"`
+}
+
+// MemoryQueryBatchResult /memory/query:batch 中单个会话的结果，Code 为 -1 时 Msg 为错误信息
+type MemoryQueryBatchResult struct {
+	SessionID string             `json:"session_id"`
+	Code      int                `json:"code"`
+	Msg       string             `json:"msg"`
+	Data      *MemoryQueryResult `json:"data,omitempty"`
+}
+
+// MemoryApplyBatchResult /memory/apply:batch 中单个会话的结果，Code 为 -1 时 Msg 为错误信息
+type MemoryApplyBatchResult struct {
+	SessionID string             `json:"session_id"`
+	Code      int                `json:"code"`
+	Msg       string             `json:"msg"`
+	Data      *MemoryApplyResult `json:"data,omitempty"`
+}
+
+// MemoryDeleteResult /memory/delete 中单个服务的删除结果
+type MemoryDeleteResult struct {
+	ServiceName string `json:"service_name"`
+	Success     bool   `json:"success"`
+	Message     string `json:"message"`
+}
+
+// MemoryTaskStatus /memory/task/{task_id} 响应 data，Tasks 以服务名为 key，只包含本轮触发的下游任务
+type MemoryTaskStatus struct {
+	TaskStatus
+	Tasks map[string]TaskStatus `json:"tasks"`
+}
+
+// SessionFilter /memory/sessions/list 的过滤条件，为空的字段不过滤；Limit 为 0 时使用服务端默认值 20
+type SessionFilter struct {
+	UserID  string
+	RoleID  string
+	GroupID string
+	Limit   int
+	Skip    int
+}
+
+// SessionRecord 会话记录，MemoryUpdatedAt 以记忆类型（messages、user_portrait、topic_summary、chat_events）为 key
+type SessionRecord struct {
+	SessionID       string               `json:"session_id"`
+	GroupID         string               `json:"group_id"`
+	UserID          string               `json:"user_id"`
+	RoleID          string               `json:"role_id"`
+	Scheme          string               `json:"scheme"`
+	CreatedAt       time.Time            `json:"created_at"`
+	LastActiveAt    time.Time            `json:"last_active_at"`
+	MessageCount    int64                `json:"message_count"`
+	RoundCount      int64                `json:"round_count"`
+	MemoryUpdatedAt map[string]time.Time `json:"memory_updated_at"`
+}
+
+// SessionList /memory/sessions/list 响应 data
+type SessionList struct {
+	Total int64           `json:"total"`
+	Items []SessionRecord `json:"items"`
+}
+
+// MemoryBundleSession 导出包中的会话信息
+type MemoryBundleSession struct {
+	SessionID string `json:"session_id"`
+	GroupID   string `json:"group_id"`
+	UserID    string `json:"user_id"`
+	RoleID    string `json:"role_id"`
+}
+
+// MemoryBundleData 导出包中的记忆数据，UserPortrait、TopicInfo 不存在时为 nil
+type MemoryBundleData struct {
+	Messages     []SessionMessageRecord `json:"messages"`
+	UserPortrait *UserPortrait          `json:"user_portrait"`
+	Topics       []TopicRecord          `json:"topics"`
+	TopicInfo    *TopicInfo             `json:"topic_info"`
+	ChatEvents   []ChatEvent            `json:"chat_events"`
+}
+
+// MemoryBundle /memory/export 响应 data，修改任何字段都会导致导入时校验和不一致
+type MemoryBundle struct {
+	Format     string              `json:"format"`
+	Version    int                 `json:"version"`
+	ExportedAt time.Time           `json:"exported_at"`
+	Session    MemoryBundleSession `json:"session"`
+	Data       MemoryBundleData    `json:"data"`
+	Checksum   string              `json:"checksum"`
+}
+
+// MemoryImportRequest /memory/import 请求体，目标会话为空时导入到导出包中的会话；Mode 为空时为 ImportSkip
+type MemoryImportRequest struct {
+	SessionIdentity
+	Mode   string       `json:"mode,omitempty"`
+	Bundle MemoryBundle `json:"bundle"`
+}
+
+// MemoryImportSection /memory/import 中单个服务的导入结果
+type MemoryImportSection struct {
+	Status   string `json:"status"` // ok / failed
+	Imported int    `json:"imported"`
+	Skipped  bool   `json:"skipped"`
+	Error    string `json:"error,omitempty"`
+}
+
+// MemoryImportResult /memory/import 响应 data，Results 以服务名为 key
+type MemoryImportResult struct {
+	SessionID string                         `json:"session_id"`
+	Mode      string                         `json:"mode"`
+	Results   map[string]MemoryImportSection `json:"results"`
+}
+
+// ErasureReport 用户数据删除后的核验报告，Collections、Redis 为剩余数量
+type ErasureReport struct {
+	Collections map[string]int64 `json:"collections"`
+	Redis       map[string]int64 `json:"redis"`
+	Clean       bool             `json:"clean"`
+	CheckedAt   time.Time        `json:"checked_at"`
+}
+
+// ErasureReceipt 删除凭证，只保存 user_id、session_id 的 sha256
+type ErasureReceipt struct {
+	Seq           int64          `json:"seq"`
+	SubjectHash   string         `json:"subject_hash"`
+	SessionHashes []string       `json:"session_hashes"`
+	Failures      map[string]int `json:"failures"`
+	Report        ErasureReport  `json:"report"`
+	CreatedAt     time.Time      `json:"created_at"`
+	PrevHash      string         `json:"prev_hash"`
+	Hash          string         `json:"hash"`
+}
+
+// UserErasureResult DELETE /memory/user/{user_id} 响应 data
+type UserErasureResult struct {
+	UserID   string         `json:"user_id"`
+	Sessions []string       `json:"sessions"`
+	Receipt  ErasureReceipt `json:"receipt"`
+}
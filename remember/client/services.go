@@ -0,0 +1,69 @@
+package client
+
+import "context"
+
+// --------------------- 服务接口：HTTP 客户端与单进程模式（remember all）的进程内实现共用 -----------------------------
+
+// SessionMessagesService 会话消息服务
+type SessionMessagesService interface {
+	Upload(ctx context.Context, req SessionMessagesUploadRequest) (*SessionMessagesUploadResult, error)
+	Get(ctx context.Context, sessionID string) ([]StoredMessage, error)
+	Page(ctx context.Context, sessionID string, q MessageQuery) (*MessagePage, error)
+	GetBatch(ctx context.Context, sessionIDs []string) (map[string][]StoredMessage, error)
+	Count(ctx context.Context, sessionID string) (int, error)
+	MarkTask(ctx context.Context, req MarkTaskRequest) ([]StoredMessage, error)
+	Complete(ctx context.Context, req TaskCompletion) (int64, error)
+	Clean(ctx context.Context, sessionID string, keep int, extractors []string) error
+	Delete(ctx context.Context, sessionID string) error
+	EditMessage(ctx context.Context, req MessageEdit) (*MessageChange, error)
+	DeleteRound(ctx context.Context, sessionID, messageID string) (*MessageChange, error)
+	Regenerate(ctx context.Context, sessionID, messageID, content string) (*MessageChange, error)
+	Export(ctx context.Context, sessionID string) ([]SessionMessageRecord, error)
+	Import(ctx context.Context, sessionID, mode string, messages []SessionMessageRecord) (*ImportResult, error)
+}
+
+// UserPortraitService 用户画像服务
+type UserPortraitService interface {
+	Upload(ctx context.Context, sessionID, claimID string, messages []Message) (string, error)
+	Get(ctx context.Context, sessionID string) (*UserPortrait, error)
+	GetBatch(ctx context.Context, sessionIDs []string) (map[string]*UserPortrait, error)
+	Delete(ctx context.Context, sessionID string) error
+	Task(ctx context.Context, taskID string) (*TaskStatus, error)
+	Export(ctx context.Context, sessionID string) (*UserPortrait, error)
+	Import(ctx context.Context, sessionID, mode string, portrait *UserPortrait) (*ImportResult, error)
+	PurgeDeadLetters(ctx context.Context, sessionID string) (int64, error)
+}
+
+// TopicSummaryService 主题归纳服务
+type TopicSummaryService interface {
+	Upload(ctx context.Context, sessionID, claimID string, messages []Message) (string, error)
+	Search(ctx context.Context, sessionID, query string) ([]TopicRecord, error)
+	SearchBatch(ctx context.Context, searches []TopicSearch) (map[string][]TopicRecord, error)
+	Active(ctx context.Context, sessionID string) (*TopicInfo, error)
+	Delete(ctx context.Context, sessionID string) error
+	Task(ctx context.Context, taskID string) (*TaskStatus, error)
+	Export(ctx context.Context, sessionID string) (*TopicExport, error)
+	Import(ctx context.Context, sessionID, mode string, data TopicExport) (*ImportResult, error)
+	PurgeDeadLetters(ctx context.Context, sessionID string) (int64, error)
+	PurgeClaim(ctx context.Context, sessionID, claimID string) (int64, error)
+}
+
+// ChatEventService 关键事件服务
+type ChatEventService interface {
+	Upload(ctx context.Context, req ChatEventUploadRequest) (string, error)
+	Get(ctx context.Context, sessionID string) (*SessionEvents, error)
+	GetBatch(ctx context.Context, sessionIDs []string) (map[string]*SessionEvents, error)
+	Delete(ctx context.Context, sessionID string) error
+	Task(ctx context.Context, taskID string) (*TaskStatus, error)
+	Export(ctx context.Context, sessionID string) ([]ChatEvent, error)
+	Import(ctx context.Context, sessionID, mode string, events []ChatEvent) (*ImportResult, error)
+	PurgeDeadLetters(ctx context.Context, sessionID string) (int64, error)
+	PurgeClaim(ctx context.Context, sessionID, claimID string) (int64, error)
+}
+
+var (
+	_ SessionMessagesService = (*SessionMessagesClient)(nil)
+	_ UserPortraitService    = (*UserPortraitClient)(nil)
+	_ TopicSummaryService    = (*TopicSummaryClient)(nil)
+	_ ChatEventService       = (*ChatEventClient)(nil)
+)
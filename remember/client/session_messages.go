@@ -0,0 +1,154 @@
+package client
+
+import (
+	"context"
+	"net/http"
+)
+
+// SessionMessagesClient 会话消息服务客户端
+type SessionMessagesClient struct {
+	svc *service
+}
+
+// Upload 上传一轮或多轮消息
+func (c *SessionMessagesClient) Upload(ctx context.Context, req SessionMessagesUploadRequest) (*SessionMessagesUploadResult, error) {
+	var out SessionMessagesUploadResult
+	if err := c.svc.do(ctx, http.MethodPost, "/session_messages/upload", nil, req, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// Get 获取会话的全部消息（按时间升序）
+func (c *SessionMessagesClient) Get(ctx context.Context, sessionID string) ([]StoredMessage, error) {
+	var out struct {
+		Messages []StoredMessage `json:"messages"`
+	}
+	if err := c.svc.do(ctx, http.MethodGet, "/session_messages/get/"+pathEscape(sessionID), nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return out.Messages, nil
+}
+
+// Page 按游标分页获取会话消息
+func (c *SessionMessagesClient) Page(ctx context.Context, sessionID string, q MessageQuery) (*MessagePage, error) {
+	var out MessagePage
+	if err := c.svc.do(ctx, http.MethodGet, "/session_messages/get/"+pathEscape(sessionID), q.values(), nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GetBatch 批量获取多个会话的消息，以 session_id 为 key
+func (c *SessionMessagesClient) GetBatch(ctx context.Context, sessionIDs []string) (map[string][]StoredMessage, error) {
+	body := struct {
+		SessionIDs []string `json:"session_ids"`
+	}{sessionIDs}
+
+	var out map[string][]StoredMessage
+	if err := c.svc.do(ctx, http.MethodPost, "/session_messages/get_batch", nil, body, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// Count 获取会话中的消息轮数
+func (c *SessionMessagesClient) Count(ctx context.Context, sessionID string) (int, error) {
+	var out struct {
+		Count int `json:"count"`
+	}
+	if err := c.svc.do(ctx, http.MethodGet, "/session_messages/count/"+pathEscape(sessionID), nil, nil, &out); err != nil {
+		return 0, err
+	}
+	return out.Count, nil
+}
+
+// MarkTask 认领抽取器未认领的消息，返回由 task_id 认领的全部消息（并发调用不会返回同一条消息）
+func (c *SessionMessagesClient) MarkTask(ctx context.Context, req MarkTaskRequest) ([]StoredMessage, error) {
+	var out struct {
+		Messages []StoredMessage `json:"messages"`
+	}
+	if err := c.svc.do(ctx, http.MethodPost, "/session_messages/mark_task", nil, req, &out); err != nil {
+		return nil, err
+	}
+	return out.Messages, nil
+}
+
+// Complete 上报抽取任务结果，更新由 claim_id 认领的消息的状态，返回更新的消息数
+func (c *SessionMessagesClient) Complete(ctx context.Context, req TaskCompletion) (int64, error) {
+	var out struct {
+		Updated int64 `json:"updated"`
+	}
+	if err := c.svc.do(ctx, http.MethodPost, "/session_messages/complete", nil, req, &out); err != nil {
+		return 0, err
+	}
+	return out.Updated, nil
+}
+
+// Clean 清理 extractors 都已完成的消息，保留最近 keep 条（keep <= 0 时使用服务端默认值，extractors 为空时为内置的三个抽取器）
+func (c *SessionMessagesClient) Clean(ctx context.Context, sessionID string, keep int, extractors []string) error {
+	body := struct {
+		SessionID  string   `json:"session_id"`
+		Keep       int      `json:"keep,omitempty"`
+		Extractors []string `json:"extractors,omitempty"`
+	}{sessionID, keep, extractors}
+	return c.svc.do(ctx, http.MethodPost, "/session_messages/clean", nil, body, nil)
+}
+
+// Delete 删除会话的全部消息
+func (c *SessionMessagesClient) Delete(ctx context.Context, sessionID string) error {
+	return c.svc.do(ctx, http.MethodDelete, "/session_messages/delete/"+pathEscape(sessionID), nil, nil, nil)
+}
+
+// EditMessage 编辑一轮消息的内容，认领过该消息的抽取任务重新排队
+func (c *SessionMessagesClient) EditMessage(ctx context.Context, req MessageEdit) (*MessageChange, error) {
+	var out MessageChange
+	if err := c.svc.do(ctx, http.MethodPost, "/session_messages/message/edit", nil, req, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// DeleteRound 删除一轮消息
+func (c *SessionMessagesClient) DeleteRound(ctx context.Context, sessionID, messageID string) (*MessageChange, error) {
+	var out MessageChange
+	req := MessageEdit{SessionID: sessionID, MessageID: messageID}
+	if err := c.svc.do(ctx, http.MethodPost, "/session_messages/message/delete", nil, req, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// Regenerate 替换最后一轮的 assistant 回复，messageID 不为空时必须是最后一轮
+func (c *SessionMessagesClient) Regenerate(ctx context.Context, sessionID, messageID, content string) (*MessageChange, error) {
+	var out MessageChange
+	req := MessageEdit{SessionID: sessionID, MessageID: messageID, AssistantContent: &content}
+	if err := c.svc.do(ctx, http.MethodPost, "/session_messages/message/regenerate", nil, req, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// Export 导出会话的全部原始记录，包含任务标记
+func (c *SessionMessagesClient) Export(ctx context.Context, sessionID string) ([]SessionMessageRecord, error) {
+	var out []SessionMessageRecord
+	if err := c.svc.do(ctx, http.MethodGet, "/session_messages/export/"+pathEscape(sessionID), nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// Import 将记录导入会话，mode 为 ImportReplace / ImportMerge / ImportSkip
+func (c *SessionMessagesClient) Import(ctx context.Context, sessionID, mode string, messages []SessionMessageRecord) (*ImportResult, error) {
+	body := struct {
+		SessionID string                 `json:"session_id"`
+		Mode      string                 `json:"mode"`
+		Messages  []SessionMessageRecord `json:"messages"`
+	}{sessionID, mode, messages}
+
+	var out ImportResult
+	if err := c.svc.do(ctx, http.MethodPost, "/session_messages/import", nil, body, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
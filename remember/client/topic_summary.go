@@ -0,0 +1,138 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+)
+
+// TopicSummaryClient 主题归纳服务客户端
+type TopicSummaryClient struct {
+	svc *service
+}
+
+// Upload 提交主题归纳任务，返回任务ID；claimID 为 session_messages 中认领这些消息的 task_id，任务完成后据此更新消息的任务状态，可为空
+func (c *TopicSummaryClient) Upload(ctx context.Context, sessionID, claimID string, messages []Message) (string, error) {
+	body := struct {
+		SessionID string    `json:"session_id"`
+		Messages  []Message `json:"messages"`
+		ClaimID   string    `json:"claim_id,omitempty"`
+	}{sessionID, messages, claimID}
+
+	var out TaskAccepted
+	if err := c.svc.do(ctx, http.MethodPost, "/topic_summary/upload", nil, body, &out); err != nil {
+		return "", err
+	}
+	return out.TaskID, nil
+}
+
+// Search 获取活跃话题，并按 query 关键词搜索非活跃话题，结果按更新时间从旧到新排列
+func (c *TopicSummaryClient) Search(ctx context.Context, sessionID, query string) ([]TopicRecord, error) {
+	params := url.Values{"q": []string{query}}
+
+	var raw json.RawMessage
+	if err := c.svc.do(ctx, http.MethodGet, "/topic_summary/search/"+pathEscape(sessionID), params, nil, &raw); err != nil {
+		return nil, err
+	}
+	if len(raw) == 0 || string(raw) == "{}" {
+		return []TopicRecord{}, nil
+	}
+
+	var out []TopicRecord
+	if err := json.Unmarshal(raw, &out); err != nil {
+		return nil, &DecodeError{Service: c.svc.name, Path: "/topic_summary/search", Body: string(raw), Err: err}
+	}
+	return out, nil
+}
+
+// SearchBatch 批量搜索多个会话的话题，以 session_id 为 key，规则与 Search 相同
+func (c *TopicSummaryClient) SearchBatch(ctx context.Context, searches []TopicSearch) (map[string][]TopicRecord, error) {
+	body := struct {
+		Sessions []TopicSearch `json:"sessions"`
+	}{searches}
+
+	var out map[string][]TopicRecord
+	if err := c.svc.do(ctx, http.MethodPost, "/topic_summary/search_batch", nil, body, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// Active 获取会话的话题统计和活跃话题
+func (c *TopicSummaryClient) Active(ctx context.Context, sessionID string) (*TopicInfo, error) {
+	var out TopicInfo
+	if err := c.svc.do(ctx, http.MethodGet, "/topic_summary/activate/"+pathEscape(sessionID), nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// Delete 删除会话的全部话题、话题统计及队列中的待处理任务
+func (c *TopicSummaryClient) Delete(ctx context.Context, sessionID string) error {
+	return c.svc.do(ctx, http.MethodDelete, "/topic_summary/delete/"+pathEscape(sessionID), nil, nil, nil)
+}
+
+// Task 查询任务状态，task_id 由 Upload 返回
+func (c *TopicSummaryClient) Task(ctx context.Context, taskID string) (*TaskStatus, error) {
+	var out TaskStatus
+	if err := c.svc.do(ctx, http.MethodGet, "/topic_summary/task/"+pathEscape(taskID), nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// Export 导出会话的全部话题记录及话题统计
+func (c *TopicSummaryClient) Export(ctx context.Context, sessionID string) (*TopicExport, error) {
+	var out TopicExport
+	if err := c.svc.do(ctx, http.MethodGet, "/topic_summary/export/"+pathEscape(sessionID), nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// Import 将话题记录及话题统计导入会话，mode 为 ImportReplace / ImportMerge / ImportSkip
+func (c *TopicSummaryClient) Import(ctx context.Context, sessionID, mode string, data TopicExport) (*ImportResult, error) {
+	body := struct {
+		SessionID string `json:"session_id"`
+		Mode      string `json:"mode"`
+		TopicExport
+	}{sessionID, mode, data}
+
+	var out ImportResult
+	if err := c.svc.do(ctx, http.MethodPost, "/topic_summary/import", nil, body, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// PurgeDeadLetters 清除会话的全部死信，返回清除的条数
+func (c *TopicSummaryClient) PurgeDeadLetters(ctx context.Context, sessionID string) (int64, error) {
+	body := struct {
+		SessionID string `json:"session_id"`
+	}{sessionID}
+
+	var out struct {
+		Purged int64 `json:"purged"`
+	}
+	if err := c.svc.do(ctx, http.MethodPost, "/topic_summary/dead_letter/purge", nil, body, &out); err != nil {
+		return 0, err
+	}
+	return out.Purged, nil
+}
+
+// PurgeClaim 删除 claim_id 批次抽取出的话题记录，返回删除的条数
+func (c *TopicSummaryClient) PurgeClaim(ctx context.Context, sessionID, claimID string) (int64, error) {
+	body := struct {
+		SessionID string `json:"session_id"`
+		ClaimID   string `json:"claim_id"`
+	}{sessionID, claimID}
+
+	var out struct {
+		Purged int64 `json:"purged"`
+	}
+	if err := c.svc.do(ctx, http.MethodPost, "/topic_summary/purge_claim", nil, body, &out); err != nil {
+		return 0, err
+	}
+	return out.Purged, nil
+}
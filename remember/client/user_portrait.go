@@ -0,0 +1,109 @@
+package client
+
+import (
+	"context"
+	"net/http"
+)
+
+// UserPortraitClient 用户画像服务客户端
+type UserPortraitClient struct {
+	svc *service
+}
+
+// Upload 提交用户画像抽取任务，返回任务ID；claimID 为 session_messages 中认领这些消息的 task_id，任务完成后据此更新消息的任务状态，可为空
+func (c *UserPortraitClient) Upload(ctx context.Context, sessionID, claimID string, messages []Message) (string, error) {
+	body := struct {
+		SessionID string    `json:"session_id"`
+		Messages  []Message `json:"messages"`
+		ClaimID   string    `json:"claim_id,omitempty"`
+	}{sessionID, messages, claimID}
+
+	var out TaskAccepted
+	if err := c.svc.do(ctx, http.MethodPost, "/user_poritrait/upload", nil, body, &out); err != nil {
+		return "", err
+	}
+	return out.TaskID, nil
+}
+
+// Get 获取用户画像，不存在时返回空画像
+func (c *UserPortraitClient) Get(ctx context.Context, sessionID string) (*UserPortrait, error) {
+	var out UserPortrait
+	if err := c.svc.do(ctx, http.MethodGet, "/user_poritrait/get/"+pathEscape(sessionID), nil, nil, &out); err != nil {
+		return nil, err
+	}
+	if out.UserPortrait == nil {
+		out.UserPortrait = map[string]interface{}{}
+	}
+	return &out, nil
+}
+
+// GetBatch 批量获取用户画像，以 session_id 为 key，不存在时返回空画像
+func (c *UserPortraitClient) GetBatch(ctx context.Context, sessionIDs []string) (map[string]*UserPortrait, error) {
+	body := struct {
+		SessionIDs []string `json:"session_ids"`
+	}{sessionIDs}
+
+	var out map[string]*UserPortrait
+	if err := c.svc.do(ctx, http.MethodPost, "/user_poritrait/get_batch", nil, body, &out); err != nil {
+		return nil, err
+	}
+	for _, p := range out {
+		if p != nil && p.UserPortrait == nil {
+			p.UserPortrait = map[string]interface{}{}
+		}
+	}
+	return out, nil
+}
+
+// Delete 删除用户画像及队列中的待处理任务
+func (c *UserPortraitClient) Delete(ctx context.Context, sessionID string) error {
+	return c.svc.do(ctx, http.MethodDelete, "/user_poritrait/delete/"+pathEscape(sessionID), nil, nil, nil)
+}
+
+// Task 查询任务状态，task_id 由 Upload 返回
+func (c *UserPortraitClient) Task(ctx context.Context, taskID string) (*TaskStatus, error) {
+	var out TaskStatus
+	if err := c.svc.do(ctx, http.MethodGet, "/user_poritrait/task/"+pathEscape(taskID), nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// Export 导出用户画像，不存在时返回 nil
+func (c *UserPortraitClient) Export(ctx context.Context, sessionID string) (*UserPortrait, error) {
+	var out *UserPortrait
+	if err := c.svc.do(ctx, http.MethodGet, "/user_poritrait/export/"+pathEscape(sessionID), nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// Import 将用户画像导入会话，mode 为 ImportReplace / ImportMerge / ImportSkip
+func (c *UserPortraitClient) Import(ctx context.Context, sessionID, mode string, portrait *UserPortrait) (*ImportResult, error) {
+	body := struct {
+		SessionID string        `json:"session_id"`
+		Mode      string        `json:"mode"`
+		Portrait  *UserPortrait `json:"portrait"`
+	}{sessionID, mode, portrait}
+
+	var out ImportResult
+	if err := c.svc.do(ctx, http.MethodPost, "/user_poritrait/import", nil, body, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// PurgeDeadLetters 清除会话的全部死信，返回清除的条数
+func (c *UserPortraitClient) PurgeDeadLetters(ctx context.Context, sessionID string) (int64, error) {
+	body := struct {
+		SessionID string `json:"session_id"`
+	}{sessionID}
+
+	var out struct {
+		Purged int64 `json:"purged"`
+	}
+	if err := c.svc.do(ctx, http.MethodPost, "/user_poritrait/dead_letter/purge", nil, body, &out); err != nil {
+		return 0, err
+	}
+	return out.Purged, nil
+}
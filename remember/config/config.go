@@ -2,6 +2,7 @@ package config
 
 import (
 	"log"
+	"os"
 
 	"github.com/spf13/viper"
 )
@@ -38,12 +39,38 @@ type FeishuConfig struct {
 	Webhook string
 }
 
+// TLSConfig 访问下游服务时使用的 TLS 配置
+type TLSConfig struct {
+	CAFile             string `mapstructure:"ca_file"`
+	CertFile           string `mapstructure:"cert_file"`
+	KeyFile            string `mapstructure:"key_file"`
+	ServerName         string `mapstructure:"server_name"`
+	InsecureSkipVerify bool   `mapstructure:"insecure_skip_verify"`
+}
+
+// EndpointConfig 单个服务的访问地址，url 为空时使用 http://localhost:{端口}
+type EndpointConfig struct {
+	URL   string    `mapstructure:"url"`   // 完整地址，例如 https://portrait.internal:9121
+	Token string    `mapstructure:"token"` // 为空时使用 auth.token
+	TLS   TLSConfig `mapstructure:"tls"`
+}
+
+// EndpointsConfig 各服务的访问地址（可选）
+type EndpointsConfig struct {
+	SessionMessages EndpointConfig `mapstructure:"session_messages"`
+	UserPortrait    EndpointConfig `mapstructure:"user_poritrait"`
+	TopicSummary    EndpointConfig `mapstructure:"topic_summary"`
+	ChatEvent       EndpointConfig `mapstructure:"chat_event"`
+	Main            EndpointConfig `mapstructure:"main"`
+}
+
 type ServerConfig struct {
-	SessionMessages int `mapstructure:"session_messages"`
-	UserPortrait    int `mapstructure:"user_poritrait"`
-	TopicSummary    int `mapstructure:"topic_summary"`
-	ChatEvent       int `mapstructure:"chat_event"`
-	Main            int `mapstructure:"main"`
+	SessionMessages int             `mapstructure:"session_messages"`
+	UserPortrait    int             `mapstructure:"user_poritrait"`
+	TopicSummary    int             `mapstructure:"topic_summary"`
+	ChatEvent       int             `mapstructure:"chat_event"`
+	Main            int             `mapstructure:"main"`
+	Endpoints       EndpointsConfig `mapstructure:"endpoints"` // 可选，覆盖上面的端口配置
 }
 type AppConfig struct {
 	Redis   RedisConfig
@@ -60,6 +87,9 @@ func init() {
 	viper.SetConfigName("config") // 不要带 .yaml
 	viper.SetConfigType("yaml")
 	viper.AddConfigPath(".") // 根目录
+	if path := os.Getenv("REMEMBER_CONFIG"); path != "" {
+		viper.SetConfigFile(path) // 环境变量指定配置文件路径时不再按名称查找
+	}
 	err := viper.ReadInConfig()
 	if err != nil {
 		log.Fatalf("Error reading config file: %v", err)
@@ -0,0 +1,637 @@
+package inprocess
+
+import (
+	"context"
+	"errors"
+
+	"remember/chat_event"
+	"remember/client"
+	"remember/session_messages"
+	"remember/topic_summary"
+	"remember/user_poritrait"
+)
+
+// --------------------- inprocess 包：单进程模式（remember all）下直接调用各服务的 Go 函数，不再走 HTTP -----------------------------
+//
+// 各类型实现 client 包中的服务接口，业务错误统一包装为 client.ErrRejected，
+// 与 HTTP 客户端的 code != 0 语义保持一致。
+
+// Attach 将客户端中的微服务调用替换为进程内实现
+func Attach(c *client.Client) {
+	c.SessionMessages = SessionMessages{}
+	c.UserPortrait = UserPortrait{}
+	c.TopicSummary = TopicSummary{}
+	c.ChatEvent = ChatEvent{}
+}
+
+var (
+	_ client.SessionMessagesService = SessionMessages{}
+	_ client.UserPortraitService    = UserPortrait{}
+	_ client.TopicSummaryService    = TopicSummary{}
+	_ client.ChatEventService       = ChatEvent{}
+)
+
+// rejected 将服务返回的错误包装为 client.ErrRejected
+func rejected(err error) error {
+	if err == nil {
+		return nil
+	}
+	return errors.Join(client.ErrRejected, err)
+}
+
+// ---------------------------------- session_messages ----------------------------------
+
+// SessionMessages 会话消息服务
+type SessionMessages struct{}
+
+// Upload 保存一轮或多轮消息
+func (SessionMessages) Upload(ctx context.Context, req client.SessionMessagesUploadRequest) (*client.SessionMessagesUploadResult, error) {
+	messages := make([]map[string]interface{}, 0, len(req.Messages))
+	for _, m := range req.Messages {
+		messages = append(messages, map[string]interface{}{"role": m.Role, "content": m.Content})
+	}
+
+	ids, err := session_messages.SaveMessages(req.SessionID, messages, req.TaskID)
+	if err != nil {
+		return nil, rejected(err)
+	}
+	return &client.SessionMessagesUploadResult{MessageIDs: ids, Count: len(ids)}, nil
+}
+
+// Get 获取会话的全部消息
+func (SessionMessages) Get(ctx context.Context, sessionID string) ([]client.StoredMessage, error) {
+	messages, err := session_messages.GetMessages(sessionID)
+	if err != nil {
+		return nil, rejected(err)
+	}
+	return toStoredMessages(messages), nil
+}
+
+// Page 按游标分页获取会话消息
+func (SessionMessages) Page(ctx context.Context, sessionID string, q client.MessageQuery) (*client.MessagePage, error) {
+	page, err := session_messages.GetMessagePage(sessionID, session_messages.MessageQuery{
+		Limit:  int64(q.Limit),
+		Before: q.Before,
+		After:  q.After,
+		Since:  q.Since,
+		Until:  q.Until,
+		Order:  q.Order,
+	})
+	if err != nil {
+		return nil, rejected(err)
+	}
+	return &client.MessagePage{
+		Messages:    toStoredMessages(page.Messages),
+		Total:       page.Total,
+		HasMore:     page.HasMore,
+		StartCursor: page.StartCursor,
+		EndCursor:   page.EndCursor,
+	}, nil
+}
+
+// GetBatch 批量获取多个会话的消息
+func (SessionMessages) GetBatch(ctx context.Context, sessionIDs []string) (map[string][]client.StoredMessage, error) {
+	sessions, err := session_messages.GetMessagesBatch(sessionIDs)
+	if err != nil {
+		return nil, rejected(err)
+	}
+	out := make(map[string][]client.StoredMessage, len(sessions))
+	for sessionID, messages := range sessions {
+		out[sessionID] = toStoredMessages(messages)
+	}
+	return out, nil
+}
+
+// Count 获取会话中的消息轮数
+func (SessionMessages) Count(ctx context.Context, sessionID string) (int, error) {
+	count, err := session_messages.CountMessages(sessionID)
+	if err != nil {
+		return 0, rejected(err)
+	}
+	return int(count), nil
+}
+
+// MarkTask 认领抽取器未认领的消息，返回由 task_id 认领的全部消息
+func (SessionMessages) MarkTask(ctx context.Context, req client.MarkTaskRequest) ([]client.StoredMessage, error) {
+	messages, err := session_messages.MarkTaskMessages(req.SessionID, req.Extractor, req.TaskIndex, req.TaskID)
+	if err != nil {
+		return nil, rejected(err)
+	}
+	return toStoredMessages(messages), nil
+}
+
+// Complete 上报抽取任务结果
+func (SessionMessages) Complete(ctx context.Context, req client.TaskCompletion) (int64, error) {
+	updated, err := session_messages.CompleteTask(ctx, session_messages.CompletionEvent{
+		SessionID: req.SessionID,
+		Extractor: req.Extractor,
+		ClaimID:   req.ClaimID,
+		Status:    req.Status,
+		Error:     req.Error,
+		TaskID:    req.TaskID,
+	})
+	if err != nil {
+		return 0, rejected(err)
+	}
+	return updated, nil
+}
+
+// Clean 清理 extractors 都已完成的消息
+func (SessionMessages) Clean(ctx context.Context, sessionID string, keep int, extractors []string) error {
+	return rejected(session_messages.CleanMessages(sessionID, keep, extractors))
+}
+
+// Delete 删除会话的全部消息
+func (SessionMessages) Delete(ctx context.Context, sessionID string) error {
+	return rejected(session_messages.DeleteMessages(sessionID))
+}
+
+// EditMessage 编辑一轮消息的内容
+func (SessionMessages) EditMessage(ctx context.Context, req client.MessageEdit) (*client.MessageChange, error) {
+	change, err := session_messages.EditMessage(ctx, req.SessionID, req.MessageID, req.UserContent, req.AssistantContent)
+	return toMessageChange(change, err)
+}
+
+// DeleteRound 删除一轮消息
+func (SessionMessages) DeleteRound(ctx context.Context, sessionID, messageID string) (*client.MessageChange, error) {
+	change, err := session_messages.DeleteRound(ctx, sessionID, messageID)
+	return toMessageChange(change, err)
+}
+
+// Regenerate 替换最后一轮的 assistant 回复
+func (SessionMessages) Regenerate(ctx context.Context, sessionID, messageID, content string) (*client.MessageChange, error) {
+	change, err := session_messages.RegenerateReply(ctx, sessionID, messageID, content)
+	return toMessageChange(change, err)
+}
+
+// Export 导出会话的全部原始记录
+func (SessionMessages) Export(ctx context.Context, sessionID string) ([]client.SessionMessageRecord, error) {
+	messages, err := session_messages.ExportMessages(sessionID)
+	if err != nil {
+		return nil, rejected(err)
+	}
+	out := make([]client.SessionMessageRecord, 0, len(messages))
+	for _, m := range messages {
+		out = append(out, toMessageRecord(m))
+	}
+	return out, nil
+}
+
+// Import 将记录导入会话
+func (SessionMessages) Import(ctx context.Context, sessionID, mode string, messages []client.SessionMessageRecord) (*client.ImportResult, error) {
+	in := make([]session_messages.MemoryMessage, 0, len(messages))
+	for _, m := range messages {
+		in = append(in, fromMessageRecord(m))
+	}
+	result, err := session_messages.ImportMessages(sessionID, mode, in)
+	if err != nil {
+		return nil, rejected(err)
+	}
+	out := client.ImportResult(*result)
+	return &out, nil
+}
+
+// toMessageRecord 原始记录转换为客户端类型，任务状态逐个转换
+func toMessageRecord(m session_messages.MemoryMessage) client.SessionMessageRecord {
+	out := client.SessionMessageRecord{
+		ID:               m.ID,
+		SessionID:        m.SessionID,
+		UserContent:      m.UserContent,
+		AssistantContent: m.AssistantContent,
+		CreatedAt:        m.CreatedAt,
+		MessagesID:       m.MessagesID,
+		Task1:            m.Task1,
+		Task2:            m.Task2,
+		Task3:            m.Task3,
+		Task4:            m.Task4,
+		Status:           m.Status,
+	}
+	if len(m.TaskStates) > 0 {
+		out.TaskStates = make(map[string]client.MessageTaskState, len(m.TaskStates))
+		for k, s := range m.TaskStates {
+			out.TaskStates[k] = client.MessageTaskState(s)
+		}
+	}
+	return out
+}
+
+// fromMessageRecord 客户端类型转换为原始记录
+func fromMessageRecord(m client.SessionMessageRecord) session_messages.MemoryMessage {
+	out := session_messages.MemoryMessage{
+		ID:               m.ID,
+		SessionID:        m.SessionID,
+		UserContent:      m.UserContent,
+		AssistantContent: m.AssistantContent,
+		CreatedAt:        m.CreatedAt,
+		MessagesID:       m.MessagesID,
+		Task1:            m.Task1,
+		Task2:            m.Task2,
+		Task3:            m.Task3,
+		Task4:            m.Task4,
+		Status:           m.Status,
+	}
+	if len(m.TaskStates) > 0 {
+		out.TaskStates = make(map[string]session_messages.TaskState, len(m.TaskStates))
+		for k, s := range m.TaskStates {
+			out.TaskStates[k] = session_messages.TaskState(s)
+		}
+	}
+	return out
+}
+
+func toStoredMessages(messages []map[string]string) []client.StoredMessage {
+	out := make([]client.StoredMessage, 0, len(messages))
+	for _, m := range messages {
+		out = append(out, client.StoredMessage{
+			Role:      m["role"],
+			Content:   m["content"],
+			Timestamp: m["timestamp"],
+			CreatedAt: m["created_at"],
+			MessageID: m["message_id"],
+		})
+	}
+	return out
+}
+
+// toMessageChange 转换单条消息接口的结果
+func toMessageChange(change *session_messages.MessageChange, err error) (*client.MessageChange, error) {
+	if err != nil {
+		return nil, rejected(err)
+	}
+	return &client.MessageChange{MessageID: change.MessageID, Requeued: change.Requeued, Claims: change.Claims}, nil
+}
+
+// ---------------------------------- user_poritrait ----------------------------------
+
+// UserPortrait 用户画像服务
+type UserPortrait struct{}
+
+// Upload 提交用户画像抽取任务，返回任务ID
+func (UserPortrait) Upload(ctx context.Context, sessionID, claimID string, messages []client.Message) (string, error) {
+	msgs := make([]user_poritrait.Message, 0, len(messages))
+	for _, m := range messages {
+		msgs = append(msgs, user_poritrait.Message{Role: m.Role, Content: m.Content})
+	}
+
+	taskID, err := user_poritrait.SubmitTask(ctx, sessionID, claimID, msgs)
+	if err != nil {
+		return "", rejected(err)
+	}
+	return taskID, nil
+}
+
+// Get 获取用户画像，不存在时返回空画像
+func (UserPortrait) Get(ctx context.Context, sessionID string) (*client.UserPortrait, error) {
+	portrait, err := user_poritrait.GetPortrait(sessionID)
+	if err != nil {
+		return nil, rejected(err)
+	}
+	return toUserPortrait(portrait), nil
+}
+
+// GetBatch 批量获取用户画像，不存在时返回空画像
+func (UserPortrait) GetBatch(ctx context.Context, sessionIDs []string) (map[string]*client.UserPortrait, error) {
+	portraits, err := user_poritrait.GetPortraits(sessionIDs)
+	if err != nil {
+		return nil, rejected(err)
+	}
+	out := make(map[string]*client.UserPortrait, len(portraits))
+	for sessionID, portrait := range portraits {
+		out[sessionID] = toUserPortrait(portrait)
+	}
+	return out, nil
+}
+
+func toUserPortrait(portrait *user_poritrait.UserPortrait) *client.UserPortrait {
+	out := &client.UserPortrait{
+		ID:           portrait.ID,
+		SessionID:    portrait.SessionID,
+		UserPortrait: portrait.UserPortrait,
+		CreatedAt:    portrait.CreatedAt,
+		UpdatedAt:    portrait.UpdatedAt,
+	}
+	if out.UserPortrait == nil {
+		out.UserPortrait = map[string]interface{}{}
+	}
+	return out
+}
+
+// Delete 删除用户画像及队列中的待处理任务
+func (UserPortrait) Delete(ctx context.Context, sessionID string) error {
+	return rejected(user_poritrait.DeleteSession(ctx, sessionID))
+}
+
+// Task 查询任务状态
+func (UserPortrait) Task(ctx context.Context, taskID string) (*client.TaskStatus, error) {
+	status, err := user_poritrait.GetTaskStatus(ctx, taskID)
+	if err != nil {
+		return nil, rejected(err)
+	}
+	out := client.TaskStatus(*status)
+	return &out, nil
+}
+
+// Export 导出用户画像，不存在时返回 nil
+func (UserPortrait) Export(ctx context.Context, sessionID string) (*client.UserPortrait, error) {
+	portrait, err := user_poritrait.ExportPortrait(sessionID)
+	if err != nil {
+		return nil, rejected(err)
+	}
+	if portrait == nil {
+		return nil, nil
+	}
+	return toUserPortrait(portrait), nil
+}
+
+// Import 将用户画像导入会话
+func (UserPortrait) Import(ctx context.Context, sessionID, mode string, portrait *client.UserPortrait) (*client.ImportResult, error) {
+	var in *user_poritrait.UserPortrait
+	if portrait != nil {
+		p := user_poritrait.UserPortrait(*portrait)
+		in = &p
+	}
+	result, err := user_poritrait.ImportPortrait(sessionID, mode, in)
+	if err != nil {
+		return nil, rejected(err)
+	}
+	out := client.ImportResult(*result)
+	return &out, nil
+}
+
+// PurgeDeadLetters 清除会话的全部死信
+func (UserPortrait) PurgeDeadLetters(ctx context.Context, sessionID string) (int64, error) {
+	purged, err := user_poritrait.DeadLetters.Purge(ctx, user_poritrait.DeadLetterFilter{SessionID: sessionID})
+	return purged, rejected(err)
+}
+
+// ---------------------------------- topic_summary ----------------------------------
+
+// TopicSummary 主题归纳服务
+type TopicSummary struct{}
+
+// Upload 提交主题归纳任务，返回任务ID
+func (TopicSummary) Upload(ctx context.Context, sessionID, claimID string, messages []client.Message) (string, error) {
+	msgs := make([]topic_summary.Message, 0, len(messages))
+	for _, m := range messages {
+		msgs = append(msgs, topic_summary.Message{Role: m.Role, Content: m.Content})
+	}
+
+	taskID, err := topic_summary.SubmitTask(ctx, sessionID, claimID, msgs)
+	if err != nil {
+		return "", rejected(err)
+	}
+	return taskID, nil
+}
+
+// Search 获取活跃话题，并按 query 关键词搜索非活跃话题
+func (TopicSummary) Search(ctx context.Context, sessionID, query string) ([]client.TopicRecord, error) {
+	records, err := topic_summary.SearchTopics(ctx, sessionID, query)
+	if err != nil {
+		return nil, rejected(err)
+	}
+	return toTopicRecords(records), nil
+}
+
+// SearchBatch 批量搜索多个会话的话题
+func (TopicSummary) SearchBatch(ctx context.Context, searches []client.TopicSearch) (map[string][]client.TopicRecord, error) {
+	in := make([]topic_summary.TopicSearch, 0, len(searches))
+	for _, s := range searches {
+		in = append(in, topic_summary.TopicSearch{SessionID: s.SessionID, Query: s.Query})
+	}
+
+	results, err := topic_summary.SearchTopicsBatch(ctx, in)
+	if err != nil {
+		return nil, rejected(err)
+	}
+	out := make(map[string][]client.TopicRecord, len(results))
+	for sessionID, records := range results {
+		out[sessionID] = toTopicRecords(records)
+	}
+	return out, nil
+}
+
+func toTopicRecords(records []topic_summary.TopicRecord) []client.TopicRecord {
+	out := make([]client.TopicRecord, 0, len(records))
+	for _, r := range records {
+		out = append(out, client.TopicRecord{
+			ID:        r.ID,
+			SessionID: r.SessionID,
+			Topic:     r.Topic,
+			Content:   r.Content,
+			Keywords:  r.Keywords,
+			CreatedAt: r.CreatedAt,
+			UpdatedAt: r.UpdatedAt,
+			ClaimID:   r.ClaimID,
+			Score:     r.Score,
+		})
+	}
+	return out
+}
+
+// Active 获取会话的话题统计和活跃话题
+func (TopicSummary) Active(ctx context.Context, sessionID string) (*client.TopicInfo, error) {
+	info, err := topic_summary.GetTopicInfo(ctx, sessionID)
+	if err != nil {
+		return nil, rejected(err)
+	}
+	return toTopicInfo(info), nil
+}
+
+func toTopicInfo(info *topic_summary.TopicInfo) *client.TopicInfo {
+	out := &client.TopicInfo{
+		SessionID:    info.SessionID,
+		TopicCount:   info.TopicCount,
+		ActiveTopics: make([]client.ActiveTopic, 0, len(info.ActiveTopics)),
+		UpdatedAt:    info.UpdatedAt,
+	}
+	for _, t := range info.ActiveTopics {
+		out.ActiveTopics = append(out.ActiveTopics, client.ActiveTopic{Topic: t.Topic, LastActive: t.LastActive})
+	}
+	return out
+}
+
+// Delete 删除会话的全部话题、话题统计及队列中的待处理任务
+func (TopicSummary) Delete(ctx context.Context, sessionID string) error {
+	return rejected(topic_summary.DeleteSession(ctx, sessionID))
+}
+
+// Task 查询任务状态
+func (TopicSummary) Task(ctx context.Context, taskID string) (*client.TaskStatus, error) {
+	status, err := topic_summary.GetTaskStatus(ctx, taskID)
+	if err != nil {
+		return nil, rejected(err)
+	}
+	out := client.TaskStatus(*status)
+	return &out, nil
+}
+
+// Export 导出会话的全部话题记录及话题统计
+func (TopicSummary) Export(ctx context.Context, sessionID string) (*client.TopicExport, error) {
+	data, err := topic_summary.ExportTopics(ctx, sessionID)
+	if err != nil {
+		return nil, rejected(err)
+	}
+	out := &client.TopicExport{Topics: toTopicRecords(data.Topics)}
+	if data.Info != nil {
+		out.Info = toTopicInfo(data.Info)
+	}
+	return out, nil
+}
+
+// Import 将话题记录及话题统计导入会话
+func (TopicSummary) Import(ctx context.Context, sessionID, mode string, data client.TopicExport) (*client.ImportResult, error) {
+	in := topic_summary.TopicExport{Topics: make([]topic_summary.TopicRecord, 0, len(data.Topics))}
+	for _, r := range data.Topics {
+		in.Topics = append(in.Topics, topic_summary.TopicRecord(r))
+	}
+	if data.Info != nil {
+		in.Info = &topic_summary.TopicInfo{
+			SessionID:    data.Info.SessionID,
+			TopicCount:   data.Info.TopicCount,
+			ActiveTopics: make([]topic_summary.ActiveTopic, 0, len(data.Info.ActiveTopics)),
+			UpdatedAt:    data.Info.UpdatedAt,
+		}
+		for _, t := range data.Info.ActiveTopics {
+			in.Info.ActiveTopics = append(in.Info.ActiveTopics, topic_summary.ActiveTopic(t))
+		}
+	}
+	result, err := topic_summary.ImportTopics(ctx, sessionID, mode, in)
+	if err != nil {
+		return nil, rejected(err)
+	}
+	out := client.ImportResult(*result)
+	return &out, nil
+}
+
+// PurgeDeadLetters 清除会话的全部死信
+func (TopicSummary) PurgeDeadLetters(ctx context.Context, sessionID string) (int64, error) {
+	purged, err := topic_summary.DeadLetters.Purge(ctx, topic_summary.DeadLetterFilter{SessionID: sessionID})
+	return purged, rejected(err)
+}
+
+// PurgeClaim 删除批次抽取出的话题记录
+func (TopicSummary) PurgeClaim(ctx context.Context, sessionID, claimID string) (int64, error) {
+	purged, err := topic_summary.PurgeClaim(ctx, sessionID, claimID)
+	return purged, rejected(err)
+}
+
+// ---------------------------------- chat_event ----------------------------------
+
+// ChatEvent 关键事件服务
+type ChatEvent struct{}
+
+// Upload 提交关键事件抽取任务，返回任务ID
+func (ChatEvent) Upload(ctx context.Context, req client.ChatEventUploadRequest) (string, error) {
+	conversations := make([]chat_event.Conversation, 0, len(req.Conversations))
+	for _, conv := range req.Conversations {
+		msgs := make([]chat_event.Message, 0, len(conv.Messages))
+		for _, m := range conv.Messages {
+			msgs = append(msgs, chat_event.Message{Role: m.Role, Content: m.Content})
+		}
+		conversations = append(conversations, chat_event.Conversation{Timestamp: conv.Timestamp, Messages: msgs})
+	}
+
+	taskID, err := chat_event.SubmitTask(ctx, req.SessionID, req.ClaimID, conversations)
+	if err != nil {
+		return "", rejected(err)
+	}
+	return taskID, nil
+}
+
+// Get 获取最近的已完成事件和待办事件
+func (ChatEvent) Get(ctx context.Context, sessionID string) (*client.SessionEvents, error) {
+	events, err := chat_event.GetEvents(sessionID)
+	if err != nil {
+		return nil, rejected(err)
+	}
+	return &client.SessionEvents{
+		Completed: toChatEvents(events["completed"]),
+		Todo:      toChatEvents(events["todo"]),
+	}, nil
+}
+
+// GetBatch 批量获取多个会话的事件
+func (ChatEvent) GetBatch(ctx context.Context, sessionIDs []string) (map[string]*client.SessionEvents, error) {
+	sessions, err := chat_event.GetEventsBatch(sessionIDs)
+	if err != nil {
+		return nil, rejected(err)
+	}
+	out := make(map[string]*client.SessionEvents, len(sessions))
+	for sessionID, events := range sessions {
+		out[sessionID] = &client.SessionEvents{
+			Completed: toChatEvents(events["completed"]),
+			Todo:      toChatEvents(events["todo"]),
+		}
+	}
+	return out, nil
+}
+
+// Delete 删除会话的全部事件及队列中的待处理任务
+func (ChatEvent) Delete(ctx context.Context, sessionID string) error {
+	return rejected(chat_event.DeleteSession(ctx, sessionID))
+}
+
+// Task 查询任务状态
+func (ChatEvent) Task(ctx context.Context, taskID string) (*client.TaskStatus, error) {
+	status, err := chat_event.GetTaskStatus(ctx, taskID)
+	if err != nil {
+		return nil, rejected(err)
+	}
+	out := client.TaskStatus(*status)
+	return &out, nil
+}
+
+// Export 导出会话的全部事件
+func (ChatEvent) Export(ctx context.Context, sessionID string) ([]client.ChatEvent, error) {
+	events, err := chat_event.ExportEvents(sessionID)
+	if err != nil {
+		return nil, rejected(err)
+	}
+	out := make([]client.ChatEvent, 0, len(events))
+	for _, e := range events {
+		out = append(out, client.ChatEvent(e))
+	}
+	return out, nil
+}
+
+// Import 将事件导入会话
+func (ChatEvent) Import(ctx context.Context, sessionID, mode string, events []client.ChatEvent) (*client.ImportResult, error) {
+	in := make([]chat_event.ChatEvent, 0, len(events))
+	for _, e := range events {
+		in = append(in, chat_event.ChatEvent(e))
+	}
+	result, err := chat_event.ImportEvents(sessionID, mode, in)
+	if err != nil {
+		return nil, rejected(err)
+	}
+	out := client.ImportResult(*result)
+	return &out, nil
+}
+
+// PurgeDeadLetters 清除会话的全部死信
+func (ChatEvent) PurgeDeadLetters(ctx context.Context, sessionID string) (int64, error) {
+	purged, err := chat_event.DeadLetters.Purge(ctx, chat_event.DeadLetterFilter{SessionID: sessionID})
+	return purged, rejected(err)
+}
+
+// PurgeClaim 删除批次抽取出的事件
+func (ChatEvent) PurgeClaim(ctx context.Context, sessionID, claimID string) (int64, error) {
+	purged, err := chat_event.PurgeClaim(ctx, sessionID, claimID)
+	return purged, rejected(err)
+}
+
+func toChatEvents(events []*chat_event.ChatEvent) []client.ChatEvent {
+	out := make([]client.ChatEvent, 0, len(events))
+	for _, e := range events {
+		out = append(out, client.ChatEvent{
+			ID:            e.ID,
+			SessionID:     e.SessionID,
+			CreatedAt:     e.CreatedAt,
+			Event:         e.Event,
+			ExecutionTime: e.ExecutionTime,
+			EventType:     e.EventType,
+			ClaimID:       e.ClaimID,
+		})
+	}
+	return out
+}
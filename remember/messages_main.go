@@ -15,6 +15,12 @@ import (
 
 func main() {
 
+	// 启动任务完成通知的消费者及 re-drive 任务
+	completions := session_messages.NewCompletionWorker()
+	completions.Start()
+	redriver := session_messages.NewRedriver(session_messages.RedriveInterval * time.Second)
+	redriver.Start()
+
 	// 注册 HTTP 路由
 	r := session_messages.RegisterRoutes()
 	server := &http.Server{
@@ -43,4 +49,7 @@ func main() {
 		log.Fatalf("HTTP server Shutdown: %v", err)
 	}
 	log.Println("✅ HTTP server stopped gracefully")
+
+	completions.Stop()
+	redriver.Stop()
 }
@@ -4,11 +4,12 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"io"
 	"net/http"
 	"strings"
 	"time"
 
+	"remember/client"
+
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/openai/openai-go/v2"
@@ -21,6 +22,7 @@ var (
 	LLMModel     string
 	OpenAIClient openai.Client
 	ServerURL    string
+	MemoryClient *client.MemoryClient // 主服务 /memory/* 客户端
 )
 
 // InitLLM 初始化 OpenAI Client
@@ -43,7 +45,40 @@ func InitLLM() {
 		option.WithBaseURL(Config.LLM.BaseURL),
 	)
 	LLMModel = Config.LLM.ModelID
-	ServerURL = fmt.Sprintf("http://localhost:%d", Config.Server.Main)
+	memory := mainEndpoint()
+	ServerURL = memory.BaseURL
+	MemoryClient = client.New(client.Config{
+		Memory:  memory,
+		Token:   Config.Auth.Token,
+		Timeout: 30 * time.Second,
+	}).Memory
+}
+
+// mainEndpoint 主服务地址，server.endpoints.main 未配置时使用 localhost:{端口}
+func mainEndpoint() client.Endpoint {
+	cfg := Config.Server.Endpoints.Main
+	endpoint := client.LocalEndpoint(Config.Server.Main)
+	if cfg.URL != "" {
+		endpoint.BaseURL = cfg.URL
+	}
+	endpoint.Token = cfg.Token
+
+	opts := client.TLSOptions{
+		CAFile:             cfg.TLS.CAFile,
+		CertFile:           cfg.TLS.CertFile,
+		KeyFile:            cfg.TLS.KeyFile,
+		ServerName:         cfg.TLS.ServerName,
+		InsecureSkipVerify: cfg.TLS.InsecureSkipVerify,
+	}
+	if !opts.IsZero() {
+		tlsConfig, err := client.LoadTLSConfig(opts)
+		if err != nil {
+			Error("load tls config for main endpoint failed: %v", err)
+		} else {
+			endpoint.TLS = tlsConfig
+		}
+	}
+	return endpoint
 }
 
 // 请求结构
@@ -73,32 +108,6 @@ type Message struct {
 	Content string `json:"content"`
 }
 
-// apply_memory 响应结构
-type ApplyMemoryResponse struct {
-	Code int    `json:"code"`
-	Msg  string `json:"msg"`
-	Data struct {
-		SystemPrompt string    `json:"system_prompt"`
-		Messages     []Message `json:"messages"`
-	} `json:"data"`
-}
-
-// 上传请求结构
-type UploadRequest struct {
-	SessionID string    `json:"session_id"`
-	UserID    string    `json:"user_id"`
-	RoleID    string    `json:"role_id"`
-	GroupID   string    `json:"group_id"`
-	Messages  []Message `json:"messages"`
-}
-
-// 上传响应结构
-type UploadResponse struct {
-	Code int         `json:"code"`
-	Msg  string      `json:"msg"`
-	Data interface{} `json:"data"`
-}
-
 // 注册路由
 func RegisterRoutes() http.Handler {
 	r := chi.NewRouter()
@@ -155,7 +164,7 @@ func streamCompletionHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// 1. 调用server的apply_memory接口获取系统提示词和消息
-	systemPrompt, messages, err := getSystemPromptAndMessages(req)
+	systemPrompt, messages, err := getSystemPromptAndMessages(r.Context(), req)
 	if err != nil {
 		writeJSON(w, StreamCompletionResponse{
 			Code: -1,
@@ -214,32 +223,18 @@ func streamCompletionHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 // 获取系统提示词和消息
-func getSystemPromptAndMessages(req StreamCompletionRequest) (string, []Message, error) {
-	applyReq := map[string]interface{}{
-		"query":       req.Query,
-		"session_id":  req.SessionID,
-		"user_id":     req.UserID,
-		"role_id":     req.RoleID,
-		"group_id":    req.GroupID,
-		"role_prompt": req.RolePrompt,
-	}
-
-	applyResp, err := callServerAPI("/memory/apply", applyReq)
+func getSystemPromptAndMessages(ctx context.Context, req StreamCompletionRequest) (string, []Message, error) {
+	applyData, err := MemoryClient.Apply(ctx, client.MemoryApplyRequest{
+		SessionIdentity: sessionIdentity(req),
+		RolePrompt:      req.RolePrompt,
+		Query:           req.Query,
+	})
 	if err != nil {
 		return "", nil, fmt.Errorf("调用apply_memory接口失败: %w", err)
 	}
 
-	var applyData ApplyMemoryResponse
-	if err := json.Unmarshal(applyResp, &applyData); err != nil {
-		return "", nil, fmt.Errorf("解析apply_memory响应失败: %w", err)
-	}
-
-	if applyData.Code != 0 {
-		return "", nil, fmt.Errorf("apply_memory接口返回错误: %s", applyData.Msg)
-	}
-
 	// 如果apply_memory返回的messages为空，且提供了first_message，则上传初始对话到server
-	if len(applyData.Data.Messages) == 0 && req.FirstMessage != "" {
+	if len(applyData.Messages) == 0 && req.FirstMessage != "" {
 		// 创建初始对话：空用户消息 + first_message作为助手回复
 		Warn("apply接口没有消息返回，默认为首次对话，创建首轮对话：空用户消息+first message!!!")
 		initialMessages := []Message{
@@ -258,11 +253,25 @@ func getSystemPromptAndMessages(req StreamCompletionRequest) (string, []Message,
 		go uploadInitialConversation(req, initialMessages)
 
 		// 返回空的messages，让OpenAI生成新的回复
-		return applyData.Data.SystemPrompt, []Message{}, nil
+		return applyData.SystemPrompt, []Message{}, nil
 	}
-	Info(fmt.Sprintf("%s generate system prompt: %s", SERVER_NAME, applyData.Data.SystemPrompt))
+	Info(fmt.Sprintf("%s generate system prompt: %s", SERVER_NAME, applyData.SystemPrompt))
 
-	return applyData.Data.SystemPrompt, applyData.Data.Messages, nil
+	messages := make([]Message, 0, len(applyData.Messages))
+	for _, m := range applyData.Messages {
+		messages = append(messages, Message{Role: m.Role, Content: m.Content})
+	}
+	return applyData.SystemPrompt, messages, nil
+}
+
+// sessionIdentity 从请求中取出会话标识
+func sessionIdentity(req StreamCompletionRequest) client.SessionIdentity {
+	return client.SessionIdentity{
+		SessionID: req.SessionID,
+		UserID:    req.UserID,
+		RoleID:    req.RoleID,
+		GroupID:   req.GroupID,
+	}
 }
 
 // 生成非流式响应
@@ -429,15 +438,7 @@ func uploadConversation(req StreamCompletionRequest, historyMessages []Message,
 		Content: responseContent,
 	})
 
-	uploadReq := UploadRequest{
-		SessionID: req.SessionID,
-		UserID:    req.UserID,
-		RoleID:    req.RoleID,
-		GroupID:   req.GroupID,
-		Messages:  newMessages,
-	}
-
-	_, err := callServerAPI("/memory/upload", uploadReq)
+	err := uploadMessages(req, newMessages)
 	if err != nil {
 		fmt.Printf("上传对话失败: %v\n", err)
 	}
@@ -445,15 +446,7 @@ func uploadConversation(req StreamCompletionRequest, historyMessages []Message,
 
 // 上传初始对话到server（使用first_message创建初始对话）
 func uploadInitialConversation(req StreamCompletionRequest, initialMessages []Message) {
-	uploadReq := UploadRequest{
-		SessionID: req.SessionID,
-		UserID:    req.UserID,
-		RoleID:    req.RoleID,
-		GroupID:   req.GroupID,
-		Messages:  initialMessages,
-	}
-
-	_, err := callServerAPI("/memory/upload", uploadReq)
+	err := uploadMessages(req, initialMessages)
 	if err != nil {
 		fmt.Printf("上传初始对话失败: %v\n", err)
 	} else {
@@ -475,15 +468,7 @@ func uploadCurrentConversation(req StreamCompletionRequest, query string, respon
 		},
 	}
 
-	uploadReq := UploadRequest{
-		SessionID: req.SessionID,
-		UserID:    req.UserID,
-		RoleID:    req.RoleID,
-		GroupID:   req.GroupID,
-		Messages:  newMessages,
-	}
-
-	_, err := callServerAPI("/memory/upload", uploadReq)
+	err := uploadMessages(req, newMessages)
 	if err != nil {
 		fmt.Printf("上传当轮对话失败: %v\n", err)
 	} else {
@@ -491,29 +476,18 @@ func uploadCurrentConversation(req StreamCompletionRequest, query string, respon
 	}
 }
 
-// 调用server API
-func callServerAPI(endpoint string, data interface{}) ([]byte, error) {
-	jsonData, err := json.Marshal(data)
-	if err != nil {
-		return nil, err
-	}
-	url := ServerURL + endpoint
-	req, err := http.NewRequest("POST", url, strings.NewReader(string(jsonData)))
-	if err != nil {
-		return nil, err
-	}
-
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", "Bearer "+Config.Auth.Token)
-
-	client := &http.Client{Timeout: 30 * time.Second}
-	resp, err := client.Do(req)
-	if err != nil {
-		return nil, err
+// 上传消息到server的 /memory/upload 接口
+func uploadMessages(req StreamCompletionRequest, messages []Message) error {
+	payload := make([]client.Message, 0, len(messages))
+	for _, m := range messages {
+		payload = append(payload, client.Message{Role: m.Role, Content: m.Content})
 	}
-	defer resp.Body.Close()
 
-	return io.ReadAll(resp.Body)
+	_, err := MemoryClient.Upload(context.Background(), client.MemoryUploadRequest{
+		SessionIdentity: sessionIdentity(req),
+		Messages:        payload,
+	})
+	return err
 }
 
 // 写入JSON响应
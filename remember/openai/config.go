@@ -38,13 +38,39 @@ type FeishuConfig struct {
 	Webhook string
 }
 
+// TLSConfig 访问下游服务时使用的 TLS 配置
+type TLSConfig struct {
+	CAFile             string `mapstructure:"ca_file"`
+	CertFile           string `mapstructure:"cert_file"`
+	KeyFile            string `mapstructure:"key_file"`
+	ServerName         string `mapstructure:"server_name"`
+	InsecureSkipVerify bool   `mapstructure:"insecure_skip_verify"`
+}
+
+// EndpointConfig 单个服务的访问地址，url 为空时使用 http://localhost:{端口}
+type EndpointConfig struct {
+	URL   string    `mapstructure:"url"`   // 完整地址，例如 https://portrait.internal:9121
+	Token string    `mapstructure:"token"` // 为空时使用 auth.token
+	TLS   TLSConfig `mapstructure:"tls"`
+}
+
+// EndpointsConfig 各服务的访问地址（可选）
+type EndpointsConfig struct {
+	SessionMessages EndpointConfig `mapstructure:"session_messages"`
+	UserPortrait    EndpointConfig `mapstructure:"user_poritrait"`
+	TopicSummary    EndpointConfig `mapstructure:"topic_summary"`
+	ChatEvent       EndpointConfig `mapstructure:"chat_event"`
+	Main            EndpointConfig `mapstructure:"main"`
+}
+
 type ServerConfig struct {
-	SessionMessages int `mapstructure:"session_messages"`
-	UserPortrait    int `mapstructure:"user_poritrait"`
-	TopicSummary    int `mapstructure:"topic_summary"`
-	ChatEvent       int `mapstructure:"chat_event"`
-	Openai          int `mapstructure:"openai"`
-	Main            int `mapstructure:"main"`
+	SessionMessages int             `mapstructure:"session_messages"`
+	UserPortrait    int             `mapstructure:"user_poritrait"`
+	TopicSummary    int             `mapstructure:"topic_summary"`
+	ChatEvent       int             `mapstructure:"chat_event"`
+	Openai          int             `mapstructure:"openai"`
+	Main            int             `mapstructure:"main"`
+	Endpoints       EndpointsConfig `mapstructure:"endpoints"` // 可选，覆盖上面的端口配置
 }
 
 type AppConfig struct {
@@ -0,0 +1,64 @@
+package prompt
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"text/template"
+)
+
+// Funcs 模板中可用的辅助函数
+var Funcs = template.FuncMap{
+	"join":    join,
+	"indent":  indent,
+	"trim":    strings.TrimSpace,
+	"upper":   strings.ToUpper,
+	"lower":   strings.ToLower,
+	"default": defaultValue,
+	"inc":     func(i int) int { return i + 1 },
+	"json":    toJSON,
+}
+
+// join 用 sep 连接列表元素：{{.active_topics | join ", "}}
+func join(sep string, items any) string {
+	v := reflect.ValueOf(items)
+	if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+		return fmt.Sprint(items)
+	}
+	parts := make([]string, 0, v.Len())
+	for i := 0; i < v.Len(); i++ {
+		parts = append(parts, fmt.Sprint(v.Index(i).Interface()))
+	}
+	return strings.Join(parts, sep)
+}
+
+// indent 每行前加 n 个空格：{{.user_portrait | indent 2}}
+func indent(n int, text string) string {
+	pad := strings.Repeat(" ", n)
+	return pad + strings.ReplaceAll(text, "\n", "\n"+pad)
+}
+
+// defaultValue 值为空时使用默认值：{{.language | default "English"}}
+func defaultValue(def, value any) any {
+	if value == nil {
+		return def
+	}
+	v := reflect.ValueOf(value)
+	switch v.Kind() {
+	case reflect.String, reflect.Slice, reflect.Map, reflect.Array:
+		if v.Len() == 0 {
+			return def
+		}
+	}
+	return value
+}
+
+// toJSON 输出 JSON，需要把结构化数据交给模型时使用：{{json .portrait}}
+func toJSON(value any) (string, error) {
+	b, err := json.Marshal(value)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
@@ -0,0 +1,239 @@
+package prompt
+
+// 提示词渲染：基于 text/template，变量原样输出（不做 JSON 转义），支持条件、循环和辅助函数。
+// 各服务的提示词模板、apply 的模板库都通过这里渲染。
+//
+// 模板写法：
+//   {{.messages_str}}                               变量
+//   {{if .chat_events}}...{{end}}                   条件，变量为空时省略整段
+//   {{range $i, $t := .topics}}{{inc $i}}. {{$t.Content}}{{end}}  循环
+//   {{.active_topics | join ", "}}                  辅助函数，见 Funcs
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"maps"
+	"sort"
+	"strings"
+	"text/template"
+	"text/template/parse"
+)
+
+// Vars 模板变量
+type Vars map[string]any
+
+// Mode 缺少变量时的处理方式
+type Mode int
+
+const (
+	Strict  Mode = iota // 模板引用的变量必须全部提供，缺少时报错
+	Lenient             // 缺少的变量（包括 {{.a.b}} 这样的嵌套字段）按空字符串处理
+)
+
+// Template 解析后的模板，可并发渲染
+type Template struct {
+	name  string
+	mode  Mode
+	tpl   *template.Template
+	vars  []string   // 模板引用的顶层变量
+	paths [][]string // 模板引用的嵌套字段路径，例如 {{.a.b}} 为 [a b]，宽松模式渲染时补齐
+}
+
+// New 解析模板
+func New(name, text string, mode Mode) (*Template, error) {
+	missing := "missingkey=error"
+	if mode == Lenient {
+		missing = "missingkey=zero"
+	}
+
+	tpl, err := template.New(name).Option(missing).Funcs(Funcs).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("模板解析失败: %v", err)
+	}
+
+	seen := make(map[string]bool)
+	for _, t := range tpl.Templates() {
+		if t.Tree != nil {
+			collectNode(t.Tree.Root, true, seen)
+		}
+	}
+	// seen 的 key 为以 . 连接的字段路径，第一段即顶层变量
+	top := make(map[string]bool)
+	var paths [][]string
+	for key := range seen {
+		path := strings.Split(key, ".")
+		top[path[0]] = true
+		if len(path) > 1 {
+			paths = append(paths, path)
+		}
+	}
+	vars := make([]string, 0, len(top))
+	for name := range top {
+		vars = append(vars, name)
+	}
+	sort.Strings(vars)
+
+	return &Template{name: name, mode: mode, tpl: tpl, vars: vars, paths: paths}, nil
+}
+
+// Must 模板解析失败时 panic，用于代码中内置的模板
+func Must(t *Template, err error) *Template {
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+// Vars 模板引用的顶层变量（按名称排序），不包括 range/with 内部相对于元素的字段
+func (t *Template) Vars() []string {
+	return t.vars
+}
+
+// Uses 模板是否引用了某个变量
+func (t *Template) Uses(name string) bool {
+	i := sort.SearchStrings(t.vars, name)
+	return i < len(t.vars) && t.vars[i] == name
+}
+
+// Render 渲染模板，多个 Vars 依次合并，后面的覆盖前面的（通常先静态变量、后动态变量）
+func (t *Template) Render(vars ...Vars) (string, error) {
+	data := make(map[string]any)
+	for _, v := range vars {
+		for name, value := range v {
+			data[name] = value
+		}
+	}
+
+	for _, name := range t.vars {
+		if _, ok := data[name]; ok {
+			continue
+		}
+		if t.mode == Strict {
+			return "", errors.New("缺少变量: " + name)
+		}
+		data[name] = ""
+	}
+	if t.mode == Lenient {
+		for _, path := range t.paths {
+			fillPath(data, path)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := t.tpl.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("模板渲染失败: %v", err)
+	}
+	return buf.String(), nil
+}
+
+// fillPath 宽松模式下补齐嵌套字段路径上缺少的 map，使 {{.a.b}} 在 a 缺少或为空时输出空字符串而不是报错；
+// 路径上已有的 map 复制后再补齐，不修改调用方的数据，遇到其他类型（结构体等）时停止
+func fillPath(data map[string]any, path []string) {
+	for i, name := range path {
+		value, ok := data[name]
+		if i == len(path)-1 {
+			if !ok {
+				data[name] = ""
+			}
+			return
+		}
+
+		var next map[string]any
+		switch v := value.(type) {
+		case map[string]any:
+			next = maps.Clone(v)
+		case Vars:
+			next = maps.Clone(map[string]any(v))
+		case nil:
+			next = make(map[string]any)
+		case string:
+			if v != "" {
+				return
+			}
+			next = make(map[string]any)
+		default:
+			return
+		}
+		data[name] = next
+		data = next
+	}
+}
+
+// Compose 严格模式解析并渲染，对应原来的 SystemPromptCompose
+func Compose(text string, vars ...Vars) (string, error) {
+	t, err := New("prompt", text, Strict)
+	if err != nil {
+		return "", err
+	}
+	return t.Render(vars...)
+}
+
+// ComposeLenient 宽松模式解析并渲染，对应原来的 SystemPromptComposeStatic
+func ComposeLenient(text string, vars ...Vars) (string, error) {
+	t, err := New("prompt", text, Lenient)
+	if err != nil {
+		return "", err
+	}
+	return t.Render(vars...)
+}
+
+// --------------------- 解析树遍历：收集模板引用的顶层变量及嵌套字段路径 -----------------------------
+
+// collectNode root 表示当前 . 是否为顶层数据，range/with 内部 . 指向元素，字段不算顶层变量
+func collectNode(node parse.Node, root bool, seen map[string]bool) {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+		for _, child := range n.Nodes {
+			collectNode(child, root, seen)
+		}
+	case *parse.ActionNode:
+		collectPipe(n.Pipe, root, seen)
+	case *parse.IfNode:
+		collectPipe(n.Pipe, root, seen)
+		collectNode(n.List, root, seen)
+		collectNode(n.ElseList, root, seen)
+	case *parse.RangeNode:
+		collectPipe(n.Pipe, root, seen)
+		collectNode(n.List, false, seen)
+		collectNode(n.ElseList, root, seen)
+	case *parse.WithNode:
+		collectPipe(n.Pipe, root, seen)
+		collectNode(n.List, false, seen)
+		collectNode(n.ElseList, root, seen)
+	case *parse.TemplateNode:
+		collectPipe(n.Pipe, root, seen)
+	}
+}
+
+func collectPipe(pipe *parse.PipeNode, root bool, seen map[string]bool) {
+	if pipe == nil {
+		return
+	}
+	for _, cmd := range pipe.Cmds {
+		for _, arg := range cmd.Args {
+			collectArg(arg, root, seen)
+		}
+	}
+}
+
+func collectArg(arg parse.Node, root bool, seen map[string]bool) {
+	switch n := arg.(type) {
+	case *parse.FieldNode:
+		if root {
+			seen[strings.Join(n.Ident, ".")] = true
+		}
+	case *parse.VariableNode:
+		// $.name 始终指向顶层数据
+		if len(n.Ident) > 1 && n.Ident[0] == "$" {
+			seen[strings.Join(n.Ident[1:], ".")] = true
+		}
+	case *parse.ChainNode:
+		collectArg(n.Node, root, seen)
+	case *parse.PipeNode:
+		collectPipe(n, root, seen)
+	}
+}
@@ -0,0 +1,148 @@
+package prompt
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRender(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		vars []Vars
+		want string
+	}{
+		{"variable", "hi {{.name}}", []Vars{{"name": "bob"}}, "hi bob"},
+		{"no escaping", "{{.text}}", []Vars{{"text": `"a" & <b> \n`}}, `"a" & <b> \n`},
+		{"later vars override", "{{.a}}{{.b}}", []Vars{{"a": "1", "b": "2"}, {"b": "3"}}, "13"},
+		{"if empty", "x{{if .events}}[{{.events}}]{{end}}y", []Vars{{"events": ""}}, "xy"},
+		{"if set", "x{{if .events}}[{{.events}}]{{end}}y", []Vars{{"events": "e"}}, "x[e]y"},
+		{"range", "{{range $i, $t := .topics}}{{inc $i}}.{{$t}} {{end}}", []Vars{{"topics": []string{"a", "b"}}}, "1.a 2.b "},
+		{"root inside range", "{{range .items}}{{.}}-{{$.sep}}{{end}}", []Vars{{"items": []int{1, 2}, "sep": "|"}}, "1-|2-|"},
+		{"struct field", "{{.t.Topic}}", []Vars{{"t": struct{ Topic string }{"go"}}}, "go"},
+		{"nested map", "{{.p.name}}", []Vars{{"p": map[string]any{"name": "amy"}}}, "amy"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Compose(tt.text, tt.vars...)
+			if err != nil {
+				t.Fatalf("Compose: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMissingVars(t *testing.T) {
+	text := "a={{.a}} b={{.b}}"
+	if _, err := Compose(text, Vars{"a": "1"}); err == nil || !strings.Contains(err.Error(), "b") {
+		t.Errorf("strict: err = %v, want missing b", err)
+	}
+	got, err := ComposeLenient(text, Vars{"a": "1"})
+	if err != nil || got != "a=1 b=" {
+		t.Errorf("lenient: got %q, %v", got, err)
+	}
+}
+
+func TestLenientNested(t *testing.T) {
+	partial := map[string]any{"b": "1"}
+	tests := []struct {
+		text string
+		vars Vars
+		want string
+	}{
+		{"[{{.y.z}}]", nil, "[]"},
+		{"[{{.a.b.c}}]", nil, "[]"},
+		{"[{{.a.b.c}}]", Vars{"a": ""}, "[]"},
+		{"{{.a.b}}-{{.a.c}}", Vars{"a": partial}, "1-"},
+		{"{{.a.b}}-{{.a.c.d}}", Vars{"a": Vars{"b": "2"}}, "2-"},
+		{"{{if .y.z}}yes{{else}}no{{end}}", nil, "no"},
+		{"{{range .items}}{{.}}{{$.sep.v}}{{end}}", Vars{"items": []string{"x"}}, "x"},
+	}
+	for _, tt := range tests {
+		got, err := ComposeLenient(tt.text, tt.vars)
+		if err != nil || got != tt.want {
+			t.Errorf("ComposeLenient(%q) = %q, %v, want %q", tt.text, got, err, tt.want)
+		}
+	}
+	if _, ok := partial["c"]; ok {
+		t.Error("lenient render should not modify caller data")
+	}
+
+	if _, err := Compose("{{.y.z}}"); err == nil {
+		t.Error("strict: missing nested variable should fail")
+	}
+}
+
+func TestParseError(t *testing.T) {
+	for _, text := range []string{"{{.a", "{{if .a}}x", "{{unknown .a}}"} {
+		if _, err := New("t", text, Strict); err == nil {
+			t.Errorf("New(%q) should fail", text)
+		}
+	}
+}
+
+func TestVars(t *testing.T) {
+	tests := []struct {
+		text string
+		want []string
+	}{
+		{"plain text", []string{}},
+		{"{{.b}} {{.a}} {{.a}}", []string{"a", "b"}},
+		{"{{if .x}}{{.y}}{{else}}{{.z}}{{end}}", []string{"x", "y", "z"}},
+		// range / with 内部的字段相对于元素，$. 始终指向顶层
+		{"{{range .items}}{{.Name}}{{$.sep}}{{end}}", []string{"items", "sep"}},
+		{"{{with .p}}{{.name}}{{else}}{{.fallback}}{{end}}", []string{"fallback", "p"}},
+		{"{{.list | join .sep}}", []string{"list", "sep"}},
+		{"{{.p.name}}", []string{"p"}},
+	}
+	for _, tt := range tests {
+		tpl, err := New("t", tt.text, Strict)
+		if err != nil {
+			t.Fatalf("New(%q): %v", tt.text, err)
+		}
+		if got := tpl.Vars(); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Vars(%q) = %v, want %v", tt.text, got, tt.want)
+		}
+		for _, name := range tt.want {
+			if !tpl.Uses(name) {
+				t.Errorf("Uses(%q) = false for %q", name, tt.text)
+			}
+		}
+		if tpl.Uses("missing") {
+			t.Errorf("Uses(missing) = true for %q", tt.text)
+		}
+	}
+}
+
+func TestFuncs(t *testing.T) {
+	tests := []struct {
+		text string
+		vars Vars
+		want string
+	}{
+		{`{{.l | join ", "}}`, Vars{"l": []string{"a", "b"}}, "a, b"},
+		{`{{.l | join ", "}}`, Vars{"l": "single"}, "single"},
+		{`{{.t | indent 2}}`, Vars{"t": "a\nb"}, "  a\n  b"},
+		{`{{.t | trim | upper}}`, Vars{"t": "  hi "}, "HI"},
+		{`{{.t | lower}}`, Vars{"t": "HI"}, "hi"},
+		{`{{.lang | default "English"}}`, Vars{"lang": ""}, "English"},
+		{`{{.lang | default "English"}}`, Vars{"lang": "中文"}, "中文"},
+		{`{{.l | default "none"}}`, Vars{"l": []string{}}, "none"},
+		{`{{inc .i}}`, Vars{"i": 1}, "2"},
+		{`{{json .p}}`, Vars{"p": map[string]any{"a": []int{1}}}, `{"a":[1]}`},
+	}
+	for _, tt := range tests {
+		got, err := Compose(tt.text, tt.vars)
+		if err != nil {
+			t.Errorf("Compose(%q): %v", tt.text, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("Compose(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"remember/chat_event"
+	"remember/config"
+	"remember/inprocess"
+	"remember/openai"
+	"remember/server"
+	"remember/session_messages"
+	"remember/topic_summary"
+	"remember/user_poritrait"
+	"syscall"
+	"time"
+)
+
+// remember all：单进程运行全部服务，所有路由挂在主服务端口上，
+// 主服务直接调用各微服务的 Go 函数，不再经过 HTTP。
+// 拆分部署仍使用 server_main.go / messages_main.go 等独立入口。
+
+const usage = `Usage: remember <command>
+
+Commands:
+  all    在一个进程中运行全部服务（主服务、会话消息、用户画像、话题归纳、关键事件、OpenAI）
+`
+
+// worker 各服务 Worker 的公共方法
+type worker interface {
+	Start()
+	Stop()
+}
+
+func main() {
+	if len(os.Args) < 2 || os.Args[1] != "all" {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	// 主服务改为进程内调用各微服务
+	inprocess.Attach(server.Services)
+
+	// 启动各服务的 Worker，数量与独立部署一致
+	var workers []worker
+	for i := 0; i < 20; i++ {
+		workers = append(workers, server.NewWorker(1*time.Second))
+	}
+	for i := 0; i < 100; i++ {
+		workers = append(workers, user_poritrait.NewWorker(1*time.Second))
+	}
+	for i := 0; i < 100; i++ {
+		workers = append(workers, topic_summary.NewWorker(1*time.Second))
+	}
+	for i := 0; i < 20; i++ {
+		workers = append(workers, chat_event.NewWorker(1*time.Second))
+	}
+	workers = append(workers, session_messages.NewCompletionWorker())
+	for _, w := range workers {
+		w.Start()
+	}
+	log.Printf("✅ %d workers started", len(workers))
+
+	// 启动队列监控
+	(&server.QueueMonitor{
+		Queue:    server.MessageQueue,
+		MaxLen:   server.Queue_MAXLEN,
+		Interval: server.Monitor_Interval * time.Second,
+	}).Start()
+	(&user_poritrait.QueueMonitor{
+		Queue:    user_poritrait.MessageQueue,
+		MaxLen:   user_poritrait.Queue_MAXLEN,
+		Interval: user_poritrait.Monitor_Interval * time.Second,
+	}).Start()
+	(&topic_summary.QueueMonitor{
+		Queue:    topic_summary.MessageQueue,
+		MaxLen:   topic_summary.Queue_MAXLEN,
+		Interval: topic_summary.Monitor_Interval * time.Second,
+	}).Start()
+	(&chat_event.QueueMonitor{
+		Queue:    chat_event.MessageQueue,
+		MaxLen:   chat_event.Queue_MAXLEN,
+		Interval: chat_event.Monitor_Interval * time.Second,
+	}).Start()
+	log.Println("✅ Queue monitors started")
+
+	// 启动补齐调度
+	server.NewFlushScheduler().Start()
+
+	// 启动 apply 缓存后台刷新
+	server.NewApplyRefresher().Start()
+
+	// 启动会话记录更新
+	server.NewSessionTracker().Start()
+
+	// 启动认领超时消息的 re-drive
+	session_messages.NewRedriver(session_messages.RedriveInterval * time.Second).Start()
+
+	// OpenAI 服务通过主服务端口访问 /memory/*
+	openai.InitLLM()
+
+	// 注册 HTTP 路由，各服务路径前缀互不冲突
+	mux := http.NewServeMux()
+	mux.Handle("/memory/", server.RegisterRoutes())
+	mux.Handle("/session_messages/", session_messages.RegisterRoutes())
+	mux.Handle("/user_poritrait/", user_poritrait.RegisterRoutes())
+	mux.Handle("/topic_summary/", topic_summary.RegisterRoutes())
+	mux.Handle("/chat_event/", chat_event.RegisterRoutes())
+	mux.Handle("/v1/", openai.RegisterRoutes())
+
+	port := config.Config.Server.Main
+	httpServer := &http.Server{
+		Addr:    fmt.Sprintf(":%d", port),
+		Handler: mux,
+	}
+
+	// 启动 HTTP 服务
+	go func() {
+		log.Printf("✅ RememberMe (all-in-one) running at http://localhost:%d", port)
+		if err := httpServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Fatalf("HTTP server ListenAndServe: %v", err)
+		}
+	}()
+
+	// 捕获系统信号，用于优雅退出
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
+	<-sigCh
+	log.Println("🛑 Signal received, shutting down...")
+
+	// 先关闭 HTTP 服务，不再接收新任务
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := httpServer.Shutdown(ctx); err != nil {
+		log.Printf("HTTP server Shutdown: %v", err)
+	}
+	log.Println("✅ HTTP server stopped gracefully")
+
+	// 停止所有 Worker
+	for _, w := range workers {
+		w.Stop()
+	}
+	log.Println("✅ Workers stopped gracefully")
+}
@@ -1,6 +1,7 @@
 package server
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
@@ -10,6 +11,8 @@ import (
 	"log"
 	"sync"
 
+	"remember/client"
+
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 )
@@ -34,7 +37,34 @@ func RegisterRoutes() http.Handler {
 
 	// 删除接口 - 同时删除所有微服务中的相关数据
 	r.Delete("/memory/delete", deleteHandler)
+
+	// 任务状态接口 - 查询上传任务及其触发的下游任务的状态
+	r.Get("/memory/task/{taskID}", taskStatusHandler)
     
+	// 死信管理接口
+	DeadLetters.RegisterRoutes(r, "/memory")
+
+	// 任务触发频次管理接口
+	registerCadenceRoutes(r, "/memory")
+
+	// 提示词模板管理接口
+	registerTemplateRoutes(r, "/memory")
+
+	// 批量查询与批量 apply 接口
+	registerBatchRoutes(r, "/memory")
+
+	// 会话查询接口
+	registerSessionRoutes(r, "/memory")
+
+	// 导出与导入接口
+	registerExportRoutes(r, "/memory")
+
+	// 用户数据删除接口
+	registerErasureRoutes(r, "/memory")
+
+	// 单条消息编辑、删除、重新生成接口
+	registerMessageRoutes(r, "/memory")
+
 	return r
 }
 
@@ -83,10 +113,17 @@ func uploadHandler(w http.ResponseWriter, r *http.Request) {
 		}
 		req.SessionID = SessionID
 	}
+	// 登记会话，失败不影响上传
+	if err := recordSession(r.Context(), req.SessionID, req.GroupID, req.UserID, req.RoleID); err != nil {
+		Warn("记录会话失败 session_id=%s: %v", req.SessionID, err)
+	}
 
 	// 推入队列
 	qMsg := QueueMessage{
 		SessionID: req.SessionID,
+		RoleID:    req.RoleID,
+		GroupID:   req.GroupID,
+		UserID:    req.UserID,
 		Messages:  req.Messages,
 		Timestamp: time.Now().UTC().Unix(),
 		Retry:     0,
@@ -116,26 +153,40 @@ func queryHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// 并发执行
+	// 并发执行，每个记忆块返回数据和查询状态
 	type result[T any] struct {
-		data T
-		err  error
+		data   T
+		status SectionStatus
 	}
 
-	userPortraitCh := make(chan result[UserPortraitDTO])
-	topicSummaryCh := make(chan result[[]TopicSummaryDTO])
-	chatEventsCh := make(chan result[ChatEventsDTO])
-	sessionMessagesCh := make(chan result[SessionMessagesDTO])
+	userPortraitCh := make(chan result[UserPortraitDTO], 1)
+	topicSummaryCh := make(chan result[[]TopicSummaryDTO], 1)
+	chatEventsCh := make(chan result[ChatEventsDTO], 1)
+	sessionMessagesCh := make(chan result[SessionMessagesDTO], 1)
 
-	go func() { d, e := getUserPortrait(req.SessionID); userPortraitCh <- result[UserPortraitDTO]{d, e} }()
 	go func() {
-		d, e := getTopicSummaryWithGroup(req.SessionID, req.Query)
-		topicSummaryCh <- result[[]TopicSummaryDTO]{d, e}
+		d, st := fetchSection(r.Context(), BlockUserPortrait, req.SessionID, req.Fallback, func(ctx context.Context) (UserPortraitDTO, error) {
+			return getUserPortrait(ctx, req.SessionID)
+		})
+		userPortraitCh <- result[UserPortraitDTO]{d, st}
+	}()
+	go func() {
+		d, st := fetchSection(r.Context(), BlockTopicSummary, req.SessionID, req.Fallback, func(ctx context.Context) ([]client.TopicRecord, error) {
+			return searchTopicRecords(ctx, req.SessionID, req.Query)
+		})
+		topicSummaryCh <- result[[]TopicSummaryDTO]{groupTopicSummary(d), st}
+	}()
+	go func() {
+		d, st := fetchSection(r.Context(), BlockChatEvents, req.SessionID, req.Fallback, func(ctx context.Context) (ChatEventsDTO, error) {
+			return getChatEvents(ctx, req.SessionID)
+		})
+		chatEventsCh <- result[ChatEventsDTO]{d, st}
 	}()
-	go func() { d, e := getChatEvents(req.SessionID); chatEventsCh <- result[ChatEventsDTO]{d, e} }()
 	go func() {
-		d, e := getSessionMessages(req.SessionID)
-		sessionMessagesCh <- result[SessionMessagesDTO]{d, e}
+		d, st := fetchSection(r.Context(), SectionMessages, req.SessionID, req.Fallback, func(ctx context.Context) (SessionMessagesDTO, error) {
+			return getSessionMessages(ctx, req.SessionID)
+		})
+		sessionMessagesCh <- result[SessionMessagesDTO]{d, st}
 	}()
 
 	// 收集结果
@@ -144,18 +195,11 @@ func queryHandler(w http.ResponseWriter, r *http.Request) {
 	chatEventsRes := <-chatEventsCh
 	sessionMessagesRes := <-sessionMessagesCh
 
-	// 打日志
-	if userPortraitRes.err != nil {
-		Error("getUserPortrait error: %v", userPortraitRes.err)
-	}
-	if topicSummaryRes.err != nil {
-		Error("getTopicSummary error: %v", topicSummaryRes.err)
-	}
-	if chatEventsRes.err != nil {
-		Error("getChatEvents error: %v", chatEventsRes.err)
-	}
-	if sessionMessagesRes.err != nil {
-		Error("getSessionMessages error: %v", sessionMessagesRes.err)
+	sections := SectionStatuses{
+		BlockUserPortrait: userPortraitRes.status,
+		BlockTopicSummary: topicSummaryRes.status,
+		BlockChatEvents:   chatEventsRes.status,
+		SectionMessages:   sessionMessagesRes.status,
 	}
 
 	// 拼装 FormResponse
@@ -163,6 +207,18 @@ func queryHandler(w http.ResponseWriter, r *http.Request) {
 		Code: 0,
 		Msg:  "success",
 	}
+	formresp.Data.Sections = sections
+
+	// strict 模式下有记忆块不可用时直接失败，只返回各记忆块状态
+	if req.Strict {
+		if err := sections.Err(); err != nil {
+			formresp.Code = -1
+			formresp.Msg = err.Error()
+			writeJSON(w, formresp)
+			return
+		}
+	}
+
 	formresp.Data.UserPortrait = userPortraitRes.data
 	formresp.Data.TopicSummary = topicSummaryRes.data
 	formresp.Data.ChatEvents = chatEventsRes.data
@@ -177,13 +233,21 @@ func queryHandler(w http.ResponseWriter, r *http.Request) {
 
 
 // getMessagesHandler 获取指定 session_id 的全部消息
-// getMessagesHandler 获取指定 session_id 或 user_id+role_id+group_id 的消息
+// getMessagesHandler 获取指定 session_id 或 user_id+role_id+group_id 的消息，带分页参数时按游标分页
 func getMessagesHandler(w http.ResponseWriter, r *http.Request) {
     var req struct {
         SessionID string `json:"session_id"`
         UserID    string `json:"user_id"`
         RoleID    string `json:"role_id"`
         GroupID   string `json:"group_id"`
+
+        // 分页参数，均为空时返回全部消息
+        Limit  int    `json:"limit"`
+        Before string `json:"before"`
+        After  string `json:"after"`
+        Since  string `json:"since"` // RFC3339
+        Until  string `json:"until"` // RFC3339
+        Order  string `json:"order"` // desc | asc
     }
 
     if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -218,8 +282,37 @@ func getMessagesHandler(w http.ResponseWriter, r *http.Request) {
         }
     }
 
+    if req.Limit != 0 || req.Before != "" || req.After != "" || req.Since != "" || req.Until != "" || req.Order != "" {
+        q := client.MessageQuery{Limit: req.Limit, Before: req.Before, After: req.After, Order: req.Order}
+        var err error
+        if req.Since != "" {
+            q.Since, err = time.Parse(time.RFC3339, req.Since)
+        }
+        if err == nil && req.Until != "" {
+            q.Until, err = time.Parse(time.RFC3339, req.Until)
+        }
+        var page *client.MessagePage
+        if err == nil {
+            page, err = getSessionMessagesPage(r.Context(), req.SessionID, q)
+        }
+        if err != nil {
+            writeJSON(w, map[string]interface{}{
+                "code": -1,
+                "msg":  "获取消息失败: " + err.Error(),
+                "data": struct{}{},
+            })
+            return
+        }
+        writeJSON(w, map[string]interface{}{
+            "code": 0,
+            "msg":  "success",
+            "data": page,
+        })
+        return
+    }
+
     // 调用已有的 getSessionMessages
-    data, err := getSessionMessages(req.SessionID)
+    data, err := getSessionMessages(r.Context(), req.SessionID)
     if err != nil {
         writeJSON(w, map[string]interface{}{
             "code": -1,
@@ -299,7 +392,6 @@ func getMessagesHandler(w http.ResponseWriter, r *http.Request) {
 */
 
 // applyHandler 将历史消息、用户画像、主题归纳、关键事件整合成角色扮演系统提示
-// TopicSummaryResult 封装 getTopicSummary 的返回
 
 func applyHandler(w http.ResponseWriter, r *http.Request) {
 	var req ApplyRequest
@@ -322,43 +414,122 @@ func applyHandler(w http.ResponseWriter, r *http.Request) {
 		req.SessionID = sessionID
 	}
 
-	type result[T any] struct {
-		data T
-		err  error
-	}
-
 	fmt.Printf("applyHandler applyrequest: %+v\n", req)
 
-	// 并发通道
-	userPortraitCh := make(chan result[UserPortraitDTO])
-	topicSummaryCh := make(chan result[TopicSummaryResult])
-	chatEventsCh := make(chan result[ChatEventsDTO])
-	sessionMessagesCh := make(chan result[SessionMessagesDTO])
+	// 命中缓存时只读取一次 Redis，在本地渲染模板
+	ctx := r.Context()
+	cacheable := applyCacheConfig().Enabled && !req.NoCache
+	var sig, gen string
+	if cacheable {
+		sig = applySignature(req)
+		if entry, ok := getApplyCache(ctx, req.SessionID, sig); ok {
+			writeApply(w, entry, true)
+			return
+		}
+		gen = applyGeneration(ctx, req.SessionID)
+	}
 
-	go func() {
-		d, e := getUserPortrait(req.SessionID)
-		userPortraitCh <- result[UserPortraitDTO]{d, e}
-	}()
+	entry, err := buildApply(ctx, req)
+	if err != nil {
+		writeJSON(w, ApplyResponse{Code: -1, Msg: err.Error()})
+		return
+	}
 
-	go func() {
-		topics,d, e := getTopicSummary(req.SessionID, req.Query)
-		if e != nil {
-			Error("getTopicSummary error: %v", e)
+	// strict 模式下有记忆块不可用时直接失败，不生成 system_prompt
+	if req.Strict {
+		if err := entry.Sections.Err(); err != nil {
+			writeJSON(w, ApplyResponse{
+				Code: -1,
+				Msg:  err.Error(),
+				Data: ApplyData{TemplateID: entry.Template.TemplateID, TemplateVersion: entry.Template.Version, Sections: entry.Sections},
+			})
+			return
 		}
-		topicSummaryCh <- result[TopicSummaryResult]{TopicSummaryResult{
-    TopicList: topics,    // []string
-    Data:     d, // TopicSummaryData
-	}, e}
-	}()
+	}
 
-	go func() {
-		d, e := getChatEvents(req.SessionID)
-		chatEventsCh <- result[ChatEventsDTO]{d, e}
-	}()
+	if writeApply(w, entry, false) && cacheable && entry.complete() {
+		putApplyCache(ctx, req, sig, gen, entry)
+	}
+}
+
+// writeApply 渲染并返回 apply 结果，渲染失败时返回 false
+func writeApply(w http.ResponseWriter, entry *applyEntry, cached bool) bool {
+	data, err := entry.render(time.Now())
+	if err != nil {
+		writeJSON(w, ApplyResponse{
+			Code: -1,
+			Msg:  fmt.Sprintf("生成 system_prompt 失败: %v", err),
+		})
+		return false
+	}
+	data.Cached = cached
+
+	// 返回结果（带上 TopicList）
+	writeJSON(w, ApplyResponse{
+		Code: 0,
+		Msg:  "success",
+		Data: data,
+	})
+	return true
+}
+
+// buildApply 查询模板用到的记忆块并按预算裁剪，结果不含 current_time，可以缓存
+func buildApply(ctx context.Context, req ApplyRequest) (*applyEntry, error) {
+	// 选择模板
+	tpl, err := Templates.Resolve(ctx, req.TemplateID, req.Version, req.RoleID)
+	if err != nil {
+		return nil, fmt.Errorf("获取模板失败: %w", err)
+	}
+
+	type result[T any] struct {
+		data   T
+		status SectionStatus
+	}
+
+	// 并发通道，只查询模板用到的记忆块
+	userPortraitCh := make(chan result[UserPortraitDTO], 1)
+	topicSummaryCh := make(chan result[TopicSummaryResult], 1)
+	chatEventsCh := make(chan result[ChatEventsDTO], 1)
+	sessionMessagesCh := make(chan result[SessionMessagesDTO], 1)
+
+	if tpl.Uses(BlockUserPortrait) {
+		go func() {
+			d, st := fetchSection(ctx, BlockUserPortrait, req.SessionID, req.Fallback, func(ctx context.Context) (UserPortraitDTO, error) {
+				return getUserPortrait(ctx, req.SessionID)
+			})
+			userPortraitCh <- result[UserPortraitDTO]{d, st}
+		}()
+	} else {
+		userPortraitCh <- result[UserPortraitDTO]{}
+	}
+
+	if tpl.Uses(BlockTopicSummary) {
+		go func() {
+			d, st := fetchSection(ctx, BlockTopicSummary, req.SessionID, req.Fallback, func(ctx context.Context) ([]client.TopicRecord, error) {
+				return searchTopicRecords(ctx, req.SessionID, req.Query)
+			})
+			topicSummaryCh <- result[TopicSummaryResult]{topicSummaryOf(d), st}
+		}()
+	} else {
+		topicSummaryCh <- result[TopicSummaryResult]{}
+	}
+
+	if tpl.Uses(BlockChatEvents) {
+		go func() {
+			d, st := fetchSection(ctx, BlockChatEvents, req.SessionID, req.Fallback, func(ctx context.Context) (ChatEventsDTO, error) {
+				return getChatEvents(ctx, req.SessionID)
+			})
+			chatEventsCh <- result[ChatEventsDTO]{d, st}
+		}()
+	} else {
+		chatEventsCh <- result[ChatEventsDTO]{}
+	}
 
 	go func() {
-		d, e := getSessionMessages(req.SessionID)
-		sessionMessagesCh <- result[SessionMessagesDTO]{d, e}
+		d, st := fetchSection(ctx, SectionMessages, req.SessionID, req.Fallback, func(ctx context.Context) (SessionMessagesDTO, error) {
+			return getSessionMessages(ctx, req.SessionID)
+		})
+		sessionMessagesCh <- result[SessionMessagesDTO]{d, st}
 	}()
 
 	// 收集结果
@@ -367,53 +538,37 @@ func applyHandler(w http.ResponseWriter, r *http.Request) {
 	chatEventsRes := <-chatEventsCh
 	sessionMessagesRes := <-sessionMessagesCh
 
-	// 日志错误
-	if userPortraitRes.err != nil {
-		Error("getUserPortrait error: %v", userPortraitRes.err)
-	}
-	if topicSummaryRes.err != nil {
-		Error("getTopicSummary error: %v", topicSummaryRes.err)
+	// 只返回查询过的记忆块的状态
+	sections := SectionStatuses{SectionMessages: sessionMessagesRes.status}
+	if tpl.Uses(BlockUserPortrait) {
+		sections[BlockUserPortrait] = userPortraitRes.status
 	}
-	if chatEventsRes.err != nil {
-		Error("getChatEvents error: %v", chatEventsRes.err)
+	if tpl.Uses(BlockTopicSummary) {
+		sections[BlockTopicSummary] = topicSummaryRes.status
 	}
-	if sessionMessagesRes.err != nil {
-		Error("getSessionMessages error: %v", sessionMessagesRes.err)
+	if tpl.Uses(BlockChatEvents) {
+		sections[BlockChatEvents] = chatEventsRes.status
 	}
 
-	log.Printf("Generate Template for %s", req.SessionID)
-	//log.Printf("TopicList: %+v", topicSummaryRes.data.TopicList)
-	//log.Printf("SummaryData: %+v", topicSummaryRes.data.Data)
+	return assembleApply(tpl, req, contextSources{
+		rolePrompt: req.RolePrompt,
+		topics:     topicSummaryRes.data,
+		portrait:   userPortraitRes.data,
+		events:     chatEventsRes.data,
+		messages:   sessionMessagesRes.data.Messages,
+	}, sections), nil
+}
 
-	// 构建动态变量填充模板
-	dynamicVars := map[string]string{
-		"role_prompt":   req.RolePrompt,
-		"topic_summary": buildTopicSummaryText(topicSummaryRes.data),
-		"user_portrait": buildUserPortraitText(userPortraitRes.data, "  "), // 缩进两个空格
-		"chat_events":   buildChatEventsText(chatEventsRes.data),
-		"current_time":  time.Now().UTC().Format("2006-01-02 15:04:05"),
-	}
+// assembleApply 按 token 预算裁剪已查询的记忆块，apply 与批量 apply 共用
+func assembleApply(tpl *PromptTemplate, req ApplyRequest, src contextSources, sections SectionStatuses) *applyEntry {
+	log.Printf("Generate Template %s@%d for %s", tpl.TemplateID, tpl.Version, req.SessionID)
 
-	// 生成 system_prompt
-	tmpl := NewMemoryTemplate()
-	systemPrompt, err := tmpl.BuildPrompt(dynamicVars)
-	if err != nil {
-		writeJSON(w, ApplyResponse{
-			Code: -1,
-			Msg:  fmt.Sprintf("生成 system_prompt 失败: %v", err),
-		})
-		return
-	}
+	// current_time 在渲染时填入
+	src.currentTime = time.Now().UTC().Format("2006-01-02 15:04:05")
+	vars, messages, usage := packContext(ContextTokenizer, tpl, src, req.ContextBudget)
+	delete(vars, BlockCurrentTime)
 
-	// 返回结果（带上 TopicList）
-	writeJSON(w, ApplyResponse{
-		Code: 0,
-		Msg:  "success",
-		Data: ApplyData{
-		SystemPrompt: systemPrompt,
-		Messages:     sessionMessagesRes.data.Messages,
-	},
-    })
+	return &applyEntry{Template: tpl, Vars: vars, Messages: messages, Usage: usage, Sections: sections}
 }
 
 // 辅助函数：将 []TopicSummaryResult 转成模板中展示文本
@@ -483,7 +638,7 @@ func buildChatEventsText(c ChatEventsDTO) string {
 
 
 // 辅助函数 runDeleteTask 启动一个删除任务，自动将结果放入 channel
-func runDeleteTask(wg *sync.WaitGroup, ch chan<- deleteResult, serviceName string, fn func(string) error, sessionID string) {
+func runDeleteTask(ctx context.Context, wg *sync.WaitGroup, ch chan<- deleteResult, serviceName string, fn func(context.Context, string) error, sessionID string) {
     wg.Add(1)
     go func() {
         defer wg.Done()
@@ -497,7 +652,7 @@ func runDeleteTask(wg *sync.WaitGroup, ch chan<- deleteResult, serviceName strin
             }
         }()
 
-        err := fn(sessionID)
+        err := fn(ctx, sessionID)
 
         var message string
         if err == nil {
@@ -533,14 +688,25 @@ func deleteHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// 不再需要补齐
+	if err := clearPending(r.Context(), req.SessionID); err != nil {
+		log.Printf("⚠️ Clear pending session failed, session_id=%s, err=%v", req.SessionID, err)
+	}
+	if err := deleteSnapshots(r.Context(), req.SessionID); err != nil {
+		log.Printf("⚠️ Delete snapshots failed, session_id=%s, err=%v", req.SessionID, err)
+	}
+	if err := deleteApplyCache(r.Context(), req.SessionID); err != nil {
+		log.Printf("⚠️ Delete apply cache failed, session_id=%s, err=%v", req.SessionID, err)
+	}
+
 	deleteResults := make(chan deleteResult, 4) // 容量 >= 可能的任务数
 	var wg sync.WaitGroup
 
 	// 使用 helper 启动删除任务
-	runDeleteTask(&wg, deleteResults, "user_portrait", deleteUserPortrait, req.SessionID)
-	runDeleteTask(&wg, deleteResults, "topic_summary", deleteTopicSummary, req.SessionID)
-	runDeleteTask(&wg, deleteResults, "chat_event", deleteChatEvents, req.SessionID)
-	runDeleteTask(&wg, deleteResults, "session_messages", deleteSessionMessages, req.SessionID)
+	runDeleteTask(r.Context(), &wg, deleteResults, "user_portrait", deleteUserPortrait, req.SessionID)
+	runDeleteTask(r.Context(), &wg, deleteResults, "topic_summary", deleteTopicSummary, req.SessionID)
+	runDeleteTask(r.Context(), &wg, deleteResults, "chat_event", deleteChatEvents, req.SessionID)
+	runDeleteTask(r.Context(), &wg, deleteResults, "session_messages", deleteSessionMessages, req.SessionID)
 
 	// 等待所有任务完成后关闭 channel
 	go func() {
@@ -562,6 +728,13 @@ func deleteHandler(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	// 所有服务的数据都已删除，删除会话记录
+	if allSuccess {
+		if err := deleteSessionRecord(r.Context(), req.SessionID); err != nil {
+			log.Printf("⚠️ Delete session record failed, session_id=%s, err=%v", req.SessionID, err)
+		}
+	}
+
 	// 构建响应
 	response := DeleteResponse{
 		Code: ifThenElseInt(allSuccess, 0, -1),
@@ -575,6 +748,69 @@ func deleteHandler(w http.ResponseWriter, r *http.Request) {
 	writeJSON(w, response)
 }
 
+// taskStatusHandler 查询主任务状态，并汇总本轮触发的下游任务状态
+func taskStatusHandler(w http.ResponseWriter, r *http.Request) {
+	taskID := chi.URLParam(r, "taskID")
+	if taskID == "" {
+		writeJSON(w, TaskStatusResponse{Code: -1, Msg: "task_id is required", Data: struct{}{}})
+		return
+	}
+
+	status, err := GetTaskStatus(r.Context(), taskID)
+	if err != nil {
+		writeJSON(w, TaskStatusResponse{Code: -1, Msg: err.Error(), Data: struct{}{}})
+		return
+	}
+
+	downstream, err := GetDownstreamTasks(r.Context(), taskID)
+	if err != nil {
+		writeJSON(w, TaskStatusResponse{Code: -1, Msg: err.Error(), Data: struct{}{}})
+		return
+	}
+
+	tasks := make(map[string]client.TaskStatus, len(downstream))
+	for service, downstreamID := range downstream {
+		tasks[service] = queryDownstreamTask(r.Context(), service, downstreamID)
+	}
+
+	writeJSON(w, TaskStatusResponse{
+		Code: 0,
+		Msg:  "success",
+		Data: MemoryTaskStatus{TaskStatus: status, Tasks: tasks},
+	})
+}
+
+// queryDownstreamTask 查询下游任务状态，查询失败时状态为 unknown
+func queryDownstreamTask(ctx context.Context, service, taskID string) client.TaskStatus {
+	var (
+		status *client.TaskStatus
+		err    error
+	)
+	switch service {
+	case "user_poritrait":
+		status, err = Services.UserPortrait.Task(ctx, taskID)
+	case "topic_summary":
+		status, err = Services.TopicSummary.Task(ctx, taskID)
+	case "chat_event":
+		status, err = Services.ChatEvent.Task(ctx, taskID)
+	default:
+		// 主服务内执行的抽取器，任务在主队列中
+		if lookupExtractor(service) == nil {
+			err = fmt.Errorf("unknown service: %s", service)
+			break
+		}
+		var local *TaskStatus
+		if local, err = GetTaskStatus(ctx, taskID); err == nil {
+			status = &client.TaskStatus{TaskID: local.TaskID, SessionID: local.SessionID, Status: local.Status, Retry: local.Retry,
+				LastError: local.LastError, CreatedAt: local.CreatedAt, UpdatedAt: local.UpdatedAt}
+		}
+	}
+	if err != nil {
+		return client.TaskStatus{TaskID: taskID, Status: client.TaskUnknown, LastError: err.Error()}
+	}
+	return *status
+}
+
 // 辅助函数：条件返回字符串
 func ifThenElse(condition bool, trueVal, falseVal string) string {
 	if condition {
@@ -0,0 +1,301 @@
+package server
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"remember/prompt"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// --------------------- apply 缓存：缓存裁剪后的记忆块，命中时只需一次 Redis 读取，模板在本地渲染（current_time 保持实时） -----------------------------
+//
+//   - APPLY_CACHE_PREFIX{session_id}：Hash，field 为请求签名（query、模板、角色设定、预算等），value 为 applyEntry
+//   - APPLY_GEN_PREFIX{session_id}：会话记忆的版本号，各服务写入会话数据后 INCR 并删除缓存，见 taskqueue/memory_changed.go
+//   - APPLY_REQUEST_PREFIX{session_id}：Sorted Set，最近使用的请求，后台刷新时按这些请求重建缓存
+// 未命中时先读取版本号再查询各服务，写入缓存时版本号已变化说明期间数据有更新，放弃写入，避免缓存旧数据。
+// 只缓存所有记忆块都查询成功的结果；模板变更时清空全部缓存。
+
+// ApplyCacheConfig apply 缓存配置，为 0 时使用 static.go 中的默认值
+type ApplyCacheConfig struct {
+	Enabled    bool          `mapstructure:"enabled"`     // 是否启用缓存
+	TTL        time.Duration `mapstructure:"ttl"`         // 缓存有效期，例如 1h
+	Refresh    bool          `mapstructure:"refresh"`     // 会话数据变更后是否在后台重建缓存
+	RefreshMax int           `mapstructure:"refresh_max"` // 每个会话后台重建的最近请求数
+}
+
+// withDefaults 补全未配置的字段
+func (c ApplyCacheConfig) withDefaults() ApplyCacheConfig {
+	if c.TTL <= 0 {
+		c.TTL = ApplyCacheTTL * time.Second
+	}
+	if c.RefreshMax <= 0 {
+		c.RefreshMax = ApplyRefreshMax
+	}
+	return c
+}
+
+// applyEntry 缓存的 apply 结果，不含 current_time
+type applyEntry struct {
+	Template *PromptTemplate `json:"template"`
+	Vars     prompt.Vars     `json:"vars"`
+	Messages []Message       `json:"messages"`
+	Usage    ContextUsage    `json:"usage"`
+	Sections SectionStatuses `json:"sections"`
+}
+
+// complete 所有记忆块都查询成功，可以缓存
+func (e *applyEntry) complete() bool {
+	for _, st := range e.Sections {
+		if st.Status != SectionOK {
+			return false
+		}
+	}
+	return true
+}
+
+// render 填入当前时间并生成 system_prompt
+func (e *applyEntry) render(now time.Time) (ApplyData, error) {
+	vars := make(prompt.Vars, len(e.Vars)+1)
+	for name, value := range e.Vars {
+		vars[name] = value
+	}
+	if e.Template.Uses(BlockCurrentTime) {
+		vars[BlockCurrentTime] = now.UTC().Format("2006-01-02 15:04:05")
+	}
+
+	tmpl := &MemoryTemplate{Template: e.Template.Content, StaticVars: MemoryStaticVars}
+	systemPrompt, err := tmpl.BuildPrompt(vars)
+	if err != nil {
+		return ApplyData{}, err
+	}
+
+	usage := e.Usage
+	usage.SystemPrompt = ContextTokenizer.Count(systemPrompt)
+	usage.Total = usage.SystemPrompt + usage.Sections[SectionMessages].Tokens
+
+	return ApplyData{
+		SystemPrompt:    systemPrompt,
+		Messages:        e.Messages,
+		TemplateID:      e.Template.TemplateID,
+		TemplateVersion: e.Template.Version,
+		Usage:           usage,
+		Sections:        e.Sections,
+	}, nil
+}
+
+// applySignature 影响 apply 结果的请求参数，session 已在 key 中
+func applySignature(req ApplyRequest) string {
+	b, _ := json.Marshal(struct {
+		RoleID     string        `json:"role_id"`
+		RolePrompt string        `json:"role_prompt"`
+		Query      string        `json:"query"`
+		TemplateID string        `json:"template_id"`
+		Version    int           `json:"version"`
+		Budget     ContextBudget `json:"budget"`
+	}{req.RoleID, req.RolePrompt, req.Query, req.TemplateID, req.Version, req.ContextBudget})
+	sum := sha1.Sum(b)
+	return hex.EncodeToString(sum[:])
+}
+
+// applyCacheConfig config.yaml 中的 apply_cache 配置
+func applyCacheConfig() ApplyCacheConfig {
+	return Config.ApplyCache.withDefaults()
+}
+
+// getApplyCache 读取缓存，未命中或解析失败时 ok 为 false
+func getApplyCache(ctx context.Context, sessionID, sig string) (*applyEntry, bool) {
+	b, err := RedisClient.HGet(ctx, APPLY_CACHE_PREFIX+sessionID, sig).Bytes()
+	if err != nil {
+		if !errors.Is(err, redis.Nil) {
+			Error("get apply cache failed, session_id=%s, err=%v", sessionID, err)
+		}
+		return nil, false
+	}
+	var entry applyEntry
+	if err := json.Unmarshal(b, &entry); err != nil || entry.Template == nil {
+		return nil, false
+	}
+	return &entry, true
+}
+
+// applyGeneration 会话记忆的当前版本号，写入缓存前与之比较
+func applyGeneration(ctx context.Context, sessionID string) string {
+	gen, err := RedisClient.Get(ctx, APPLY_GEN_PREFIX+sessionID).Result()
+	if err != nil {
+		return "0"
+	}
+	return gen
+}
+
+// putScript 版本号未变化时写入缓存；缓存条目过多时先清空，避免不同 query 无限增长
+var putScript = redis.NewScript(`
+local gen = redis.call('GET', KEYS[1]) or '0'
+if gen ~= ARGV[1] then
+	return 0
+end
+if redis.call('HLEN', KEYS[2]) >= tonumber(ARGV[5]) then
+	redis.call('DEL', KEYS[2])
+end
+redis.call('HSET', KEYS[2], ARGV[2], ARGV[3])
+redis.call('EXPIRE', KEYS[2], ARGV[4])
+return 1
+`)
+
+// putApplyCache 写入缓存并记录请求，供后台刷新使用；失败只记录日志
+func putApplyCache(ctx context.Context, req ApplyRequest, sig, gen string, entry *applyEntry) {
+	cfg := applyCacheConfig()
+	b, err := json.Marshal(entry)
+	if err != nil {
+		return
+	}
+	keys := []string{APPLY_GEN_PREFIX + req.SessionID, APPLY_CACHE_PREFIX + req.SessionID}
+	ttl := int(cfg.TTL / time.Second)
+	if _, err := putScript.Run(ctx, RedisClient, keys, gen, sig, b, ttl, ApplyCacheMaxEntries).Result(); err != nil {
+		Error("put apply cache failed, session_id=%s, err=%v", req.SessionID, err)
+		return
+	}
+
+	if !cfg.Refresh {
+		return
+	}
+	// 只保留刷新需要的参数
+	r := ApplyRequest{SessionID: req.SessionID, RoleID: req.RoleID, RolePrompt: req.RolePrompt, Query: req.Query,
+		TemplateID: req.TemplateID, Version: req.Version, ContextBudget: req.ContextBudget}
+	rb, _ := json.Marshal(r)
+	key := APPLY_REQUEST_PREFIX + req.SessionID
+	_, err = RedisClient.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.ZAdd(ctx, key, redis.Z{Score: float64(time.Now().UnixMilli()), Member: rb})
+		pipe.ZRemRangeByRank(ctx, key, 0, int64(-cfg.RefreshMax-1))
+		pipe.Expire(ctx, key, cfg.TTL)
+		return nil
+	})
+	if err != nil {
+		Error("record apply request failed, session_id=%s, err=%v", req.SessionID, err)
+	}
+}
+
+// deleteApplyCache 删除会话的缓存及最近的请求，会话删除后不再后台重建
+func deleteApplyCache(ctx context.Context, sessionID string) error {
+	return RedisClient.Del(ctx, APPLY_CACHE_PREFIX+sessionID, APPLY_REQUEST_PREFIX+sessionID).Err()
+}
+
+// invalidateApplyCache 清空全部会话的缓存，模板变更时调用；失败只记录日志，缓存最迟在 TTL 后过期
+func invalidateApplyCache(ctx context.Context) {
+	iter := RedisClient.Scan(ctx, 0, APPLY_CACHE_PREFIX+"*", 1000).Iterator()
+	for iter.Next(ctx) {
+		if err := RedisClient.Unlink(ctx, iter.Val()).Err(); err != nil {
+			log.Printf("⚠️ Invalidate apply cache failed, key=%s, err=%v", iter.Val(), err)
+		}
+	}
+	if err := iter.Err(); err != nil {
+		log.Printf("⚠️ Invalidate apply cache failed, err=%v", err)
+	}
+}
+
+// --------------------- 后台刷新：订阅会话数据变更，防抖后按最近的请求重建缓存 -----------------------------
+
+// ApplyRefresher 会话数据变更后重建 apply 缓存
+type ApplyRefresher struct {
+	Config ApplyCacheConfig
+	Delay  time.Duration // 防抖时间，一次上传会依次触发多个服务的变更
+	StopCh chan struct{}
+
+	mu     sync.Mutex
+	timers map[string]*time.Timer
+}
+
+// NewApplyRefresher 创建后台刷新器
+func NewApplyRefresher() *ApplyRefresher {
+	return &ApplyRefresher{
+		Config: applyCacheConfig(),
+		Delay:  ApplyRefreshDelay * time.Second,
+		StopCh: make(chan struct{}),
+		timers: make(map[string]*time.Timer),
+	}
+}
+
+// Start 启动刷新器，未启用缓存或后台刷新时不做任何事
+func (f *ApplyRefresher) Start() {
+	if !f.Config.Enabled || !f.Config.Refresh {
+		return
+	}
+	go func() {
+		pubsub := RedisClient.Subscribe(context.Background(), MEMORY_CHANGED_CHANNEL)
+		defer pubsub.Close()
+		log.Printf("✅ ApplyRefresher started, delay=%s, refresh_max=%d", f.Delay, f.Config.RefreshMax)
+
+		ch := pubsub.Channel()
+		for {
+			select {
+			case <-f.StopCh:
+				log.Println("🛑 ApplyRefresher stopped")
+				return
+			case m, ok := <-ch:
+				if !ok {
+					return
+				}
+				var event MemoryChangedEvent
+				if err := json.Unmarshal([]byte(m.Payload), &event); err != nil || event.SessionID == "" {
+					continue
+				}
+				f.schedule(event.SessionID)
+			}
+		}
+	}()
+}
+
+// Stop 停止刷新器
+func (f *ApplyRefresher) Stop() {
+	close(f.StopCh)
+}
+
+// schedule 防抖：Delay 内同一会话的多次变更只刷新一次
+func (f *ApplyRefresher) schedule(sessionID string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if t, ok := f.timers[sessionID]; ok {
+		t.Reset(f.Delay)
+		return
+	}
+	f.timers[sessionID] = time.AfterFunc(f.Delay, func() {
+		f.mu.Lock()
+		delete(f.timers, sessionID)
+		f.mu.Unlock()
+		f.refresh(context.Background(), sessionID)
+	})
+}
+
+// refresh 按最近的请求重建缓存，多个实例同时收到通知时只有一个执行
+func (f *ApplyRefresher) refresh(ctx context.Context, sessionID string) {
+	ok, err := RedisClient.SetNX(ctx, APPLY_REFRESH_LOCK_PREFIX+sessionID, 1, f.Delay).Result()
+	if err != nil || !ok {
+		return
+	}
+
+	requests, err := RedisClient.ZRevRange(ctx, APPLY_REQUEST_PREFIX+sessionID, 0, int64(f.Config.RefreshMax-1)).Result()
+	if err != nil {
+		log.Printf("⚠️ Load apply requests failed, session_id=%s, err=%v", sessionID, err)
+		return
+	}
+	for _, raw := range requests {
+		var req ApplyRequest
+		if err := json.Unmarshal([]byte(raw), &req); err != nil {
+			continue
+		}
+		gen := applyGeneration(ctx, sessionID)
+		entry, err := buildApply(ctx, req)
+		if err != nil || !entry.complete() {
+			continue
+		}
+		putApplyCache(ctx, req, applySignature(req), gen, entry)
+	}
+	log.Printf("♻️ Apply cache refreshed, session_id=%s, requests=%d", sessionID, len(requests))
+}
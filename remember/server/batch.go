@@ -0,0 +1,331 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"remember/client"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// --------------------- 批量查询与批量 apply：每个记忆块只调用一次下游批量接口，下游调用次数与会话数无关 -----------------------------
+
+// registerBatchRoutes 注册批量接口
+func registerBatchRoutes(r chi.Router, prefix string) {
+	r.Post(prefix+"/query:batch", queryBatchHandler) // 批量查询
+	r.Post(prefix+"/apply:batch", applyBatchHandler) // 批量 apply
+}
+
+// resolveBatchSession 补全批量请求中第 i 个会话的 session_id，并检查重复
+func resolveBatchSession(i int, sessionID *string, groupID, userID, roleID string, seen map[string]bool) error {
+	if *sessionID == "" {
+		id, err := GenerateSessionID(groupID, userID, roleID)
+		if err != nil {
+			return fmt.Errorf("sessions[%d]: 生成 session_id 失败: %w", i, err)
+		}
+		*sessionID = id
+	}
+	if seen[*sessionID] {
+		return fmt.Errorf("sessions[%d]: session_id 重复: %s", i, *sessionID)
+	}
+	seen[*sessionID] = true
+	return nil
+}
+
+// checkBatchSize 批量请求的会话数
+func checkBatchSize(n int) error {
+	if n == 0 || n > MaxBatchSessions {
+		return fmt.Errorf("sessions is required, at most %d", MaxBatchSessions)
+	}
+	return nil
+}
+
+// queryBatchHandler 批量查询接口，结果与请求中 sessions 的顺序一致
+func queryBatchHandler(w http.ResponseWriter, r *http.Request) {
+	var req QueryBatchRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, BatchResponse{Code: -1, Msg: "参数解析错误: " + err.Error(), Data: struct{}{}})
+		return
+	}
+	if err := checkBatchSize(len(req.Sessions)); err != nil {
+		writeJSON(w, BatchResponse{Code: -1, Msg: err.Error(), Data: struct{}{}})
+		return
+	}
+	seen := make(map[string]bool, len(req.Sessions))
+	for i := range req.Sessions {
+		s := &req.Sessions[i]
+		if err := resolveBatchSession(i, &s.SessionID, s.GroupID, s.UserID, s.RoleID, seen); err != nil {
+			writeJSON(w, BatchResponse{Code: -1, Msg: err.Error(), Data: struct{}{}})
+			return
+		}
+	}
+
+	writeJSON(w, BatchResponse{
+		Code: 0,
+		Msg:  "success",
+		Data: map[string]interface{}{"results": queryBatch(r.Context(), req.Sessions)},
+	})
+}
+
+// queryBatch 并发查询四个记忆块，每个记忆块一次批量调用
+func queryBatch(ctx context.Context, items []QueryBatchItem) []QueryBatchResult {
+	ids := make([]string, 0, len(items))
+	searches := make([]client.TopicSearch, 0, len(items))
+	fallback := make(map[string]bool, len(items))
+	for _, item := range items {
+		ids = append(ids, item.SessionID)
+		searches = append(searches, client.TopicSearch{SessionID: item.SessionID, Query: item.Query})
+		fallback[item.SessionID] = item.Fallback
+	}
+
+	var (
+		wg                                                       sync.WaitGroup
+		portraits                                                map[string]UserPortraitDTO
+		topics                                                   map[string][]client.TopicRecord
+		events                                                   map[string]ChatEventsDTO
+		messages                                                 map[string]SessionMessagesDTO
+		portraitStatus, topicStatus, eventStatus, messagesStatus map[string]SectionStatus
+	)
+	wg.Add(4)
+	go func() {
+		defer wg.Done()
+		portraits, portraitStatus = fetchSectionBatch(ctx, BlockUserPortrait, ids, fallback, func(ctx context.Context) (map[string]UserPortraitDTO, error) {
+			return getUserPortraits(ctx, ids)
+		})
+	}()
+	go func() {
+		defer wg.Done()
+		topics, topicStatus = fetchSectionBatch(ctx, BlockTopicSummary, ids, fallback, func(ctx context.Context) (map[string][]client.TopicRecord, error) {
+			return searchTopicRecordsBatch(ctx, searches)
+		})
+	}()
+	go func() {
+		defer wg.Done()
+		events, eventStatus = fetchSectionBatch(ctx, BlockChatEvents, ids, fallback, func(ctx context.Context) (map[string]ChatEventsDTO, error) {
+			return getChatEventsBatch(ctx, ids)
+		})
+	}()
+	go func() {
+		defer wg.Done()
+		messages, messagesStatus = fetchSectionBatch(ctx, SectionMessages, ids, fallback, func(ctx context.Context) (map[string]SessionMessagesDTO, error) {
+			return getSessionMessagesBatch(ctx, ids)
+		})
+	}()
+	wg.Wait()
+
+	now := time.Now().UTC().Format("2006-01-02 15:04:05")
+	results := make([]QueryBatchResult, 0, len(items))
+	for _, item := range items {
+		sid := item.SessionID
+		data := &QueryData{
+			Sections: SectionStatuses{
+				BlockUserPortrait: portraitStatus[sid],
+				BlockTopicSummary: topicStatus[sid],
+				BlockChatEvents:   eventStatus[sid],
+				SectionMessages:   messagesStatus[sid],
+			},
+		}
+
+		// strict 模式下有记忆块不可用时该会话失败，只返回各记忆块状态
+		if item.Strict {
+			if err := data.Sections.Err(); err != nil {
+				results = append(results, QueryBatchResult{SessionID: sid, Code: -1, Msg: err.Error(), Data: data})
+				continue
+			}
+		}
+
+		data.UserPortrait = portraits[sid]
+		data.TopicSummary = groupTopicSummary(topics[sid])
+		data.ChatEvents = events[sid]
+		data.SessionMessages = messages[sid].Messages
+		data.CurrentTime = now
+		results = append(results, QueryBatchResult{SessionID: sid, Code: 0, Msg: "success", Data: data})
+	}
+	return results
+}
+
+// applyBatchHandler 批量 apply 接口，结果与请求中 sessions 的顺序一致
+func applyBatchHandler(w http.ResponseWriter, r *http.Request) {
+	var req ApplyBatchRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, BatchResponse{Code: -1, Msg: "参数解析错误: " + err.Error(), Data: struct{}{}})
+		return
+	}
+	if err := checkBatchSize(len(req.Sessions)); err != nil {
+		writeJSON(w, BatchResponse{Code: -1, Msg: err.Error(), Data: struct{}{}})
+		return
+	}
+	seen := make(map[string]bool, len(req.Sessions))
+	for i := range req.Sessions {
+		s := &req.Sessions[i]
+		if err := resolveBatchSession(i, &s.SessionID, s.GroupID, s.UserID, s.RoleID, seen); err != nil {
+			writeJSON(w, BatchResponse{Code: -1, Msg: err.Error(), Data: struct{}{}})
+			return
+		}
+	}
+
+	writeJSON(w, BatchResponse{
+		Code: 0,
+		Msg:  "success",
+		Data: map[string]interface{}{"results": applyBatch(r.Context(), req.Sessions)},
+	})
+}
+
+// applyBatch 先读缓存，未命中的会话按各自模板用到的记忆块汇总后批量查询，再逐个裁剪渲染
+func applyBatch(ctx context.Context, reqs []ApplyRequest) []ApplyBatchResult {
+	type pending struct {
+		req       ApplyRequest
+		index     int
+		tpl       *PromptTemplate
+		cacheable bool
+		sig, gen  string
+	}
+
+	cfg := applyCacheConfig()
+	results := make([]ApplyBatchResult, len(reqs))
+	todo := make([]pending, 0, len(reqs))
+	for i, req := range reqs {
+		p := pending{req: req, index: i, cacheable: cfg.Enabled && !req.NoCache}
+		if p.cacheable {
+			p.sig = applySignature(req)
+			if entry, ok := getApplyCache(ctx, req.SessionID, p.sig); ok {
+				results[i] = renderBatchApply(req.SessionID, entry, true)
+				continue
+			}
+			p.gen = applyGeneration(ctx, req.SessionID)
+		}
+
+		tpl, err := Templates.Resolve(ctx, req.TemplateID, req.Version, req.RoleID)
+		if err != nil {
+			results[i] = ApplyBatchResult{SessionID: req.SessionID, Code: -1, Msg: "获取模板失败: " + err.Error()}
+			continue
+		}
+		p.tpl = tpl
+		todo = append(todo, p)
+	}
+	if len(todo) == 0 {
+		return results
+	}
+
+	// 只查询模板用到的记忆块
+	var portraitIDs, eventIDs, messageIDs []string
+	var searches []client.TopicSearch
+	fallback := make(map[string]bool, len(todo))
+	for _, p := range todo {
+		sid := p.req.SessionID
+		fallback[sid] = p.req.Fallback
+		messageIDs = append(messageIDs, sid)
+		if p.tpl.Uses(BlockUserPortrait) {
+			portraitIDs = append(portraitIDs, sid)
+		}
+		if p.tpl.Uses(BlockTopicSummary) {
+			searches = append(searches, client.TopicSearch{SessionID: sid, Query: p.req.Query})
+		}
+		if p.tpl.Uses(BlockChatEvents) {
+			eventIDs = append(eventIDs, sid)
+		}
+	}
+	topicIDs := make([]string, 0, len(searches))
+	for _, s := range searches {
+		topicIDs = append(topicIDs, s.SessionID)
+	}
+
+	var (
+		wg                                                       sync.WaitGroup
+		portraits                                                map[string]UserPortraitDTO
+		topics                                                   map[string][]client.TopicRecord
+		events                                                   map[string]ChatEventsDTO
+		messages                                                 map[string]SessionMessagesDTO
+		portraitStatus, topicStatus, eventStatus, messagesStatus map[string]SectionStatus
+	)
+	if len(portraitIDs) > 0 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			portraits, portraitStatus = fetchSectionBatch(ctx, BlockUserPortrait, portraitIDs, fallback, func(ctx context.Context) (map[string]UserPortraitDTO, error) {
+				return getUserPortraits(ctx, portraitIDs)
+			})
+		}()
+	}
+	if len(searches) > 0 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			topics, topicStatus = fetchSectionBatch(ctx, BlockTopicSummary, topicIDs, fallback, func(ctx context.Context) (map[string][]client.TopicRecord, error) {
+				return searchTopicRecordsBatch(ctx, searches)
+			})
+		}()
+	}
+	if len(eventIDs) > 0 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			events, eventStatus = fetchSectionBatch(ctx, BlockChatEvents, eventIDs, fallback, func(ctx context.Context) (map[string]ChatEventsDTO, error) {
+				return getChatEventsBatch(ctx, eventIDs)
+			})
+		}()
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		messages, messagesStatus = fetchSectionBatch(ctx, SectionMessages, messageIDs, fallback, func(ctx context.Context) (map[string]SessionMessagesDTO, error) {
+			return getSessionMessagesBatch(ctx, messageIDs)
+		})
+	}()
+	wg.Wait()
+
+	for _, p := range todo {
+		sid := p.req.SessionID
+		src := contextSources{rolePrompt: p.req.RolePrompt, messages: messages[sid].Messages}
+
+		// 只返回查询过的记忆块的状态
+		sections := SectionStatuses{SectionMessages: messagesStatus[sid]}
+		if p.tpl.Uses(BlockUserPortrait) {
+			sections[BlockUserPortrait] = portraitStatus[sid]
+			src.portrait = portraits[sid]
+		}
+		if p.tpl.Uses(BlockTopicSummary) {
+			sections[BlockTopicSummary] = topicStatus[sid]
+			src.topics = topicSummaryOf(topics[sid])
+		}
+		if p.tpl.Uses(BlockChatEvents) {
+			sections[BlockChatEvents] = eventStatus[sid]
+			src.events = events[sid]
+		}
+
+		// strict 模式下有记忆块不可用时该会话失败，不生成 system_prompt
+		if p.req.Strict {
+			if err := sections.Err(); err != nil {
+				results[p.index] = ApplyBatchResult{
+					SessionID: sid,
+					Code:      -1,
+					Msg:       err.Error(),
+					Data:      &ApplyData{TemplateID: p.tpl.TemplateID, TemplateVersion: p.tpl.Version, Sections: sections},
+				}
+				continue
+			}
+		}
+
+		entry := assembleApply(p.tpl, p.req, src, sections)
+		results[p.index] = renderBatchApply(sid, entry, false)
+		if results[p.index].Code == 0 && p.cacheable && entry.complete() {
+			putApplyCache(ctx, p.req, p.sig, p.gen, entry)
+		}
+	}
+	return results
+}
+
+// renderBatchApply 渲染批量 apply 中单个会话的结果
+func renderBatchApply(sessionID string, entry *applyEntry, cached bool) ApplyBatchResult {
+	data, err := entry.render(time.Now())
+	if err != nil {
+		return ApplyBatchResult{SessionID: sessionID, Code: -1, Msg: fmt.Sprintf("生成 system_prompt 失败: %v", err)}
+	}
+	data.Cached = cached
+	return ApplyBatchResult{SessionID: sessionID, Code: 0, Msg: "success", Data: &data}
+}
@@ -0,0 +1,385 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// --------------------- 任务触发频次：默认值来自 static.go，可被 config.yaml 的 cadence 及 /memory/cadence 接口覆盖 -----------------------------
+//
+// 生效顺序（后者覆盖前者，字段为 0 表示沿用上一级）：
+//   static.go 默认值 → cadence.default → cadence.groups[group_id] → cadence.roles[role_id]
+// 每一级中，通过接口写入 Redis 的值优先于 config.yaml
+
+// Cadence 各任务的触发频次，单位为会话消息轮数
+type Cadence struct {
+	UserRound    int `json:"user_round,omitempty" mapstructure:"user_round"`       // 用户画像生成
+	EventRound   int `json:"event_round,omitempty" mapstructure:"event_round"`     // 关键事件抽取
+	TopicRound   int `json:"topic_round,omitempty" mapstructure:"topic_round"`     // 主题归纳
+	ClearRound   int `json:"clear_round,omitempty" mapstructure:"clear_round"`     // 清理已完成处理的轮次
+	KeepMessages int `json:"keep_messages,omitempty" mapstructure:"keep_messages"` // 清理时保留的最近消息数
+
+	Rounds map[string]int `json:"rounds,omitempty" mapstructure:"rounds"` // 自定义抽取器的频次，key 为抽取器名称
+}
+
+// 覆盖范围
+const (
+	CadenceDefault = "default"
+	CadenceRole    = "role"
+	CadenceGroup   = "group"
+)
+
+// defaultCadence static.go 中的默认值
+var defaultCadence = Cadence{
+	UserRound:    UserRound,
+	EventRound:   EventRound,
+	TopicRound:   TopicRound,
+	ClearRound:   ClearRound,
+	KeepMessages: KeepMessages,
+}
+
+// merge 用 o 中非 0 的字段覆盖 c
+func (c Cadence) merge(o Cadence) Cadence {
+	if o.UserRound != 0 {
+		c.UserRound = o.UserRound
+	}
+	if o.EventRound != 0 {
+		c.EventRound = o.EventRound
+	}
+	if o.TopicRound != 0 {
+		c.TopicRound = o.TopicRound
+	}
+	if o.ClearRound != 0 {
+		c.ClearRound = o.ClearRound
+	}
+	if o.KeepMessages != 0 {
+		c.KeepMessages = o.KeepMessages
+	}
+	if len(o.Rounds) > 0 {
+		rounds := make(map[string]int, len(c.Rounds)+len(o.Rounds))
+		for name, round := range c.Rounds {
+			rounds[name] = round
+		}
+		for name, round := range o.Rounds {
+			if round != 0 {
+				rounds[name] = round
+			}
+		}
+		c.Rounds = rounds
+	}
+	return c
+}
+
+// Validate 校验频次：均需为正数，且清理轮次必须大于其他所有任务的轮次，包括每个已注册抽取器生效的轮次
+func (c Cadence) Validate() error {
+	if c.UserRound < 1 || c.EventRound < 1 || c.TopicRound < 1 || c.ClearRound < 1 || c.KeepMessages < 1 {
+		return fmt.Errorf("all rounds and keep_messages must be >= 1: %+v", c)
+	}
+	for name, round := range map[string]int{"user_round": c.UserRound, "event_round": c.EventRound, "topic_round": c.TopicRound} {
+		if c.ClearRound <= round {
+			return fmt.Errorf("clear_round (%d) must be greater than %s (%d)", c.ClearRound, name, round)
+		}
+	}
+	for name, round := range c.Rounds {
+		if round < 1 {
+			return fmt.Errorf("rounds.%s must be >= 1: %d", name, round)
+		}
+		if c.ClearRound <= round {
+			return fmt.Errorf("clear_round (%d) must be greater than rounds.%s (%d)", c.ClearRound, name, round)
+		}
+	}
+	// 未在 rounds 中覆盖的自定义抽取器使用 DefaultRound
+	for _, e := range Extractors() {
+		if round := e.Round(c); c.ClearRound <= round {
+			return fmt.Errorf("clear_round (%d) must be greater than the round of extractor %s (%d)", c.ClearRound, e.Name(), round)
+		}
+	}
+	return nil
+}
+
+// cadenceField 覆盖值在 Redis Hash 中的字段名
+func cadenceField(scope, id string) (string, error) {
+	switch scope {
+	case CadenceDefault:
+		return CadenceDefault, nil
+	case CadenceRole, CadenceGroup:
+		if id == "" {
+			return "", fmt.Errorf("id is required for scope %s", scope)
+		}
+		return scope + ":" + id, nil
+	default:
+		return "", fmt.Errorf("invalid scope: %s", scope)
+	}
+}
+
+// cadenceOverrides 读取通过接口写入的全部覆盖值，key 为字段名
+func cadenceOverrides(ctx context.Context) (map[string]Cadence, error) {
+	values, err := RedisClient.HGetAll(ctx, CADENCE_KEY).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	overrides := make(map[string]Cadence, len(values))
+	for field, raw := range values {
+		var c Cadence
+		if err := json.Unmarshal([]byte(raw), &c); err != nil {
+			Error("%s invalid cadence override %s: %v", SERVER_NAME, field, err)
+			continue
+		}
+		overrides[field] = c
+	}
+	return overrides, nil
+}
+
+// cadenceLayer 某一级的覆盖值：config.yaml 叠加 Redis
+func cadenceLayer(overrides map[string]Cadence, scope, id string) Cadence {
+	var c Cadence
+	switch scope {
+	case CadenceDefault:
+		c = Config.Cadence.Default
+	case CadenceRole:
+		c = Config.Cadence.Roles[id]
+	case CadenceGroup:
+		c = Config.Cadence.Groups[id]
+	}
+	field, _ := cadenceField(scope, id)
+	return c.merge(overrides[field])
+}
+
+// resolveCadence 计算生效的频次，结果不合法时退回到默认级别
+func resolveCadence(overrides map[string]Cadence, roleID, groupID string) Cadence {
+	base := defaultCadence.merge(cadenceLayer(overrides, CadenceDefault, ""))
+	if err := base.Validate(); err != nil {
+		Error("%s invalid default cadence, using built-in values: %v", SERVER_NAME, err)
+		base = defaultCadence
+	}
+
+	c := base
+	if groupID != "" {
+		c = c.merge(cadenceLayer(overrides, CadenceGroup, groupID))
+	}
+	if roleID != "" {
+		c = c.merge(cadenceLayer(overrides, CadenceRole, roleID))
+	}
+	if err := c.Validate(); err != nil {
+		Error("%s invalid cadence for role_id=%s group_id=%s, using default: %v", SERVER_NAME, roleID, groupID, err)
+		return base
+	}
+	return c
+}
+
+// ResolveCadence 获取角色/分组生效的频次；读取 Redis 失败时只使用 config.yaml
+func ResolveCadence(ctx context.Context, roleID, groupID string) Cadence {
+	overrides, err := cadenceOverrides(ctx)
+	if err != nil {
+		Error("%s load cadence overrides failed: %v", SERVER_NAME, err)
+	}
+	return resolveCadence(overrides, roleID, groupID)
+}
+
+// CadenceSnapshot 当前全部生效的频次
+type CadenceSnapshot struct {
+	Default Cadence            `json:"default"`
+	Roles   map[string]Cadence `json:"roles"`
+	Groups  map[string]Cadence `json:"groups"`
+}
+
+// cadenceIDs 列出配置了覆盖值的角色或分组
+func cadenceIDs(overrides map[string]Cadence, scope string) []string {
+	seen := make(map[string]bool)
+	configured := Config.Cadence.Roles
+	if scope == CadenceGroup {
+		configured = Config.Cadence.Groups
+	}
+	for id := range configured {
+		seen[id] = true
+	}
+	for field := range overrides {
+		if id, ok := strings.CutPrefix(field, scope+":"); ok {
+			seen[id] = true
+		}
+	}
+
+	ids := make([]string, 0, len(seen))
+	for id := range seen {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+func snapshotCadence(overrides map[string]Cadence) CadenceSnapshot {
+	snapshot := CadenceSnapshot{
+		Default: resolveCadence(overrides, "", ""),
+		Roles:   make(map[string]Cadence),
+		Groups:  make(map[string]Cadence),
+	}
+	for _, id := range cadenceIDs(overrides, CadenceRole) {
+		snapshot.Roles[id] = resolveCadence(overrides, id, "")
+	}
+	for _, id := range cadenceIDs(overrides, CadenceGroup) {
+		snapshot.Groups[id] = resolveCadence(overrides, "", id)
+	}
+	return snapshot
+}
+
+// validateOverrides 校验默认级别、每个角色、每个分组，以及每个角色与分组组合叠加后的频次
+// （会话同时带 role_id 和 group_id 时两级都会生效，单独合法的覆盖值组合后仍可能不合法）
+func validateOverrides(overrides map[string]Cadence) error {
+	base := defaultCadence.merge(cadenceLayer(overrides, CadenceDefault, ""))
+	if err := base.Validate(); err != nil {
+		return fmt.Errorf("default: %w", err)
+	}
+
+	roles := append([]string{""}, cadenceIDs(overrides, CadenceRole)...)
+	groups := append([]string{""}, cadenceIDs(overrides, CadenceGroup)...)
+	for _, groupID := range groups {
+		for _, roleID := range roles {
+			c := base
+			if groupID != "" {
+				c = c.merge(cadenceLayer(overrides, CadenceGroup, groupID))
+			}
+			if roleID != "" {
+				c = c.merge(cadenceLayer(overrides, CadenceRole, roleID))
+			}
+			err := c.Validate()
+			switch {
+			case err == nil:
+			case groupID == "":
+				return fmt.Errorf("%s %s: %w", CadenceRole, roleID, err)
+			case roleID == "":
+				return fmt.Errorf("%s %s: %w", CadenceGroup, groupID, err)
+			default:
+				return fmt.Errorf("%s %s with %s %s: %w", CadenceRole, roleID, CadenceGroup, groupID, err)
+			}
+		}
+	}
+	return nil
+}
+
+// SetCadence 设置某一级的覆盖值（整体替换），校验通过后写入 Redis，所有 Worker 立即生效
+func SetCadence(ctx context.Context, scope, id string, c Cadence) error {
+	field, err := cadenceField(scope, id)
+	if err != nil {
+		return err
+	}
+
+	overrides, err := cadenceOverrides(ctx)
+	if err != nil {
+		return err
+	}
+	overrides[field] = c
+	if err := validateOverrides(overrides); err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+	return RedisClient.HSet(ctx, CADENCE_KEY, field, data).Err()
+}
+
+// ResetCadence 删除某一级通过接口写入的覆盖值，恢复为 config.yaml 中的配置
+func ResetCadence(ctx context.Context, scope, id string) error {
+	field, err := cadenceField(scope, id)
+	if err != nil {
+		return err
+	}
+
+	overrides, err := cadenceOverrides(ctx)
+	if err != nil {
+		return err
+	}
+	delete(overrides, field)
+	if err := validateOverrides(overrides); err != nil {
+		return err
+	}
+	return RedisClient.HDel(ctx, CADENCE_KEY, field).Err()
+}
+
+// validateConfigCadence 启动时校验 config.yaml 中的频次，不合法的配置在使用时会退回默认值
+func validateConfigCadence() {
+	if err := validateOverrides(nil); err != nil {
+		Error("%s invalid cadence in config.yaml: %v", SERVER_NAME, err)
+	}
+}
+
+// ---------------------------------- 管理接口 ----------------------------------
+
+// CadenceRequest 设置/重置频次请求体
+type CadenceRequest struct {
+	Scope   string  `json:"scope"` // default | role | group
+	ID      string  `json:"id"`    // role_id 或 group_id，scope 为 default 时忽略
+	Cadence Cadence `json:"cadence"`
+}
+
+// CadenceResponse 频次接口响应
+type CadenceResponse struct {
+	Code int         `json:"code"` // 0 成功, -1 失败
+	Msg  string      `json:"msg"`
+	Data interface{} `json:"data"`
+}
+
+// registerCadenceRoutes 注册频次管理接口
+func registerCadenceRoutes(r chi.Router, prefix string) {
+	r.Get(prefix+"/cadence", cadenceGetHandler)          // 查看生效的频次
+	r.Post(prefix+"/cadence/set", cadenceSetHandler)     // 设置覆盖值
+	r.Post(prefix+"/cadence/reset", cadenceResetHandler) // 删除覆盖值
+}
+
+// cadenceGetHandler 查看生效的频次；带 role_id/group_id 参数时返回该组合生效的频次
+func cadenceGetHandler(w http.ResponseWriter, r *http.Request) {
+	overrides, err := cadenceOverrides(r.Context())
+	if err != nil {
+		writeJSON(w, CadenceResponse{Code: -1, Msg: err.Error(), Data: struct{}{}})
+		return
+	}
+
+	roleID, groupID := r.URL.Query().Get("role_id"), r.URL.Query().Get("group_id")
+	if roleID != "" || groupID != "" {
+		writeJSON(w, CadenceResponse{Code: 0, Msg: "success", Data: resolveCadence(overrides, roleID, groupID)})
+		return
+	}
+	writeJSON(w, CadenceResponse{Code: 0, Msg: "success", Data: snapshotCadence(overrides)})
+}
+
+// cadenceSetHandler 设置某一级的频次
+func cadenceSetHandler(w http.ResponseWriter, r *http.Request) {
+	var req CadenceRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, CadenceResponse{Code: -1, Msg: "参数解析错误: " + err.Error(), Data: struct{}{}})
+		return
+	}
+
+	if err := SetCadence(r.Context(), req.Scope, req.ID, req.Cadence); err != nil {
+		writeJSON(w, CadenceResponse{Code: -1, Msg: err.Error(), Data: struct{}{}})
+		return
+	}
+
+	Info("%s cadence updated, scope=%s, id=%s, cadence=%+v", SERVER_NAME, req.Scope, req.ID, req.Cadence)
+	writeJSON(w, CadenceResponse{Code: 0, Msg: "success", Data: struct{}{}})
+}
+
+// cadenceResetHandler 删除某一级通过接口设置的频次
+func cadenceResetHandler(w http.ResponseWriter, r *http.Request) {
+	var req CadenceRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, CadenceResponse{Code: -1, Msg: "参数解析错误: " + err.Error(), Data: struct{}{}})
+		return
+	}
+
+	if err := ResetCadence(r.Context(), req.Scope, req.ID); err != nil {
+		writeJSON(w, CadenceResponse{Code: -1, Msg: err.Error(), Data: struct{}{}})
+		return
+	}
+
+	Info("%s cadence reset, scope=%s, id=%s", SERVER_NAME, req.Scope, req.ID)
+	writeJSON(w, CadenceResponse{Code: 0, Msg: "success", Data: struct{}{}})
+}
@@ -0,0 +1,107 @@
+package server
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidateOverrides(t *testing.T) {
+	saved := Config.Cadence
+	t.Cleanup(func() { Config.Cadence = saved })
+	Config.Cadence = CadenceConfig{}
+
+	tests := []struct {
+		name      string
+		overrides map[string]Cadence
+		wantErr   string // 为空表示合法
+	}{
+		{"built-in", nil, ""},
+		{"default", map[string]Cadence{"default": {ClearRound: 20, TopicRound: 10}}, ""},
+		{"invalid default", map[string]Cadence{"default": {ClearRound: 3}}, "default"},
+		{"invalid role", map[string]Cadence{"role:r1": {UserRound: 15}}, "role r1"},
+		{"invalid group", map[string]Cadence{"group:g1": {ClearRound: 4}}, "group g1"},
+		{
+			"valid pair",
+			map[string]Cadence{"role:r1": {UserRound: 10}, "group:g1": {ClearRound: 30}},
+			"",
+		},
+		{
+			// 单独合法：分组 clear_round=8 > 默认各轮次，角色 user_round=10 < 默认 clear_round=15；组合后 clear_round 8 <= user_round 10
+			"invalid pair",
+			map[string]Cadence{"role:r1": {UserRound: 10}, "group:g1": {ClearRound: 8}},
+			"role r1 with group g1",
+		},
+		{
+			"invalid pair rounds",
+			map[string]Cadence{"role:r1": {Rounds: map[string]int{"mood": 12}}, "group:g1": {ClearRound: 10}},
+			"role r1 with group g1",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateOverrides(tt.overrides)
+			switch {
+			case tt.wantErr == "" && err != nil:
+				t.Errorf("unexpected error: %v", err)
+			case tt.wantErr != "" && err == nil:
+				t.Errorf("want error %q, got nil", tt.wantErr)
+			case tt.wantErr != "" && !strings.HasPrefix(err.Error(), tt.wantErr+":"):
+				t.Errorf("error = %v, want prefix %q", err, tt.wantErr)
+			}
+		})
+	}
+
+	// config.yaml 中的组合同样校验
+	Config.Cadence = CadenceConfig{
+		Roles:  map[string]Cadence{"r1": {EventRound: 9}},
+		Groups: map[string]Cadence{"g1": {ClearRound: 9}},
+	}
+	if err := validateOverrides(nil); err == nil || !strings.HasPrefix(err.Error(), "role r1 with group g1:") {
+		t.Errorf("config pair: err = %v", err)
+	}
+}
+
+func TestValidateExtractorRounds(t *testing.T) {
+	saved := Config.Cadence
+	extractorMu.RLock()
+	registered := extractors
+	extractorMu.RUnlock()
+	t.Cleanup(func() {
+		Config.Cadence = saved
+		extractorMu.Lock()
+		extractors = registered
+		extractorMu.Unlock()
+	})
+	Config.Cadence = CadenceConfig{}
+
+	if err := RegisterExtractor(&ExtractorSpec{ExtractorName: "mood", DefaultRound: 15}); err == nil {
+		t.Fatal("default round equal to the built-in clear_round should be rejected")
+	}
+	if err := RegisterExtractor(&ExtractorSpec{ExtractorName: "mood", DefaultRound: 12}); err != nil {
+		t.Fatalf("register: %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		overrides map[string]Cadence
+		wantErr   string // 为空表示合法
+	}{
+		{"default round", nil, ""},
+		// rounds 中没有 mood，按 DefaultRound 12 校验
+		{"clear below default round", map[string]Cadence{"group:g1": {ClearRound: 12}}, "group g1"},
+		{"rounds override", map[string]Cadence{"group:g1": {ClearRound: 12, Rounds: map[string]int{"mood": 6}}}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateOverrides(tt.overrides)
+			switch {
+			case tt.wantErr == "" && err != nil:
+				t.Errorf("unexpected error: %v", err)
+			case tt.wantErr != "" && err == nil:
+				t.Errorf("want error %q, got nil", tt.wantErr)
+			case tt.wantErr != "" && !strings.HasPrefix(err.Error(), tt.wantErr+":"):
+				t.Errorf("error = %v, want prefix %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -1,104 +1,41 @@
 package server
 
 import (
-	"encoding/json"
-	"fmt"
-	"io"
-	"net/http"
-	"net/url"
+	"context"
 	"time"
+
+	"remember/client"
 )
 
 // --------------------- core.go 脚本的核心在于实现与各个微服务服务的交互与相应的数据格式化 -----------------------------
 
-// getUserPortrait 获取用户画像数据
-func getUserPortrait(sessionID string) (UserPortraitDTO, error) {
-	client := &http.Client{Timeout: 5 * time.Second}
-	url := fmt.Sprintf("http://localhost:%d/user_poritrait/get/%s", Config.Server.UserPortrait, sessionID)
+const queryTimeout = 5 * time.Second // 查询类接口的超时时间
 
-	req, err := http.NewRequest("GET", url, nil)
-	if err != nil {
-		return UserPortraitDTO{}, err
-	}
-	req.Header.Set("Authorization", "Bearer "+Config.Auth.Token)
+// getUserPortrait 获取用户画像数据
+func getUserPortrait(ctx context.Context, sessionID string) (UserPortraitDTO, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
 
-	resp, err := client.Do(req)
+	portrait, err := Services.UserPortrait.Get(ctx, sessionID)
 	if err != nil {
 		return UserPortraitDTO{}, err
 	}
-	defer resp.Body.Close()
-
-	var result QueryResponse
-	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-		return UserPortraitDTO{}, fmt.Errorf("failed to decode response: %v", err)
-	}
-	if result.Code != 0 {
-		return UserPortraitDTO{}, fmt.Errorf("user_portrait error: %s", result.Msg)
-	}
-
-	// 先 marshal result.Data 再 unmarshal 到 DTO
-	rawData, err := json.Marshal(result.Data)
-	if err != nil {
-		return UserPortraitDTO{}, fmt.Errorf("marshal data error: %v", err)
-	}
-
-	var userResp struct {
-		UserPortrait UserPortraitDTO `json:"UserPortrait"`
-	}
-	if err := json.Unmarshal(rawData, &userResp); err != nil {
-		return UserPortraitDTO{}, fmt.Errorf("unmarshal user portrait error: %v", err)
-	}
-
-	return userResp.UserPortrait, nil
+	return UserPortraitDTO(portrait.UserPortrait), nil
 }
 
-// getTopicSummary 获取主题归纳，但不分组，应用提示词专属
-func getTopicSummary(sessionID, query string) ([]string, TopicSummaryData, error) {
-	client := &http.Client{Timeout: 5 * time.Second}
-	url := fmt.Sprintf("http://localhost:%d/topic_summary/search/%s?q=%s",
-		Config.Server.TopicSummary,
-		sessionID,
-		url.QueryEscape(query),
-	)
+// searchTopicRecords 检索话题归纳原始记录，apply 与 query 共用，快照也保存这一层
+func searchTopicRecords(ctx context.Context, sessionID, query string) ([]client.TopicRecord, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
 
-	req, err := http.NewRequest("GET", url, nil)
-	if err != nil {
-		return nil, TopicSummaryData{}, err
-	}
-	req.Header.Set("Authorization", "Bearer "+Config.Auth.Token)
-
-	resp, err := client.Do(req)
-	if err != nil {
-		return nil, TopicSummaryData{}, err
-	}
-	defer resp.Body.Close()
-
-	bodyBytes, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, TopicSummaryData{}, fmt.Errorf("read response body failed: %v", err)
-	}
-
-	// 通用响应结构
-	var result struct {
-		Code int             `json:"code"`
-		Msg  string          `json:"msg"`
-		Data json.RawMessage `json:"data"`
-	}
-
-	if err := json.Unmarshal(bodyBytes, &result); err != nil {
-		return nil, TopicSummaryData{}, fmt.Errorf("decode response failed: %v, body: %s", err, string(bodyBytes))
-	}
+	return Services.TopicSummary.Search(ctx, sessionID, query)
+}
 
-	if result.Code != 0 {
-		return nil, TopicSummaryData{}, fmt.Errorf("topic_summary error: %s, body: %s", result.Msg, string(bodyBytes))
-	}
-
-	// 解析 Data
-	var topicData TopicSummaryData
-	if len(result.Data) > 0 && string(result.Data) != "{}" {
-		if err := json.Unmarshal(result.Data, &topicData); err != nil {
-			return nil, TopicSummaryData{}, fmt.Errorf("decode topic data failed: %v, data: %s", err, string(result.Data))
-		}
+// topicSummaryOf 话题归纳原始记录转为 apply 使用的数据，不分组
+func topicSummaryOf(records []client.TopicRecord) TopicSummaryResult {
+	topicData := make(TopicSummaryData, 0, len(records))
+	for _, item := range records {
+		topicData = append(topicData, TopicSummaryRaw{Topic: item.Topic, Content: item.Content, Score: item.Score})
 	}
 
 	// 提取去重后的 topic 列表
@@ -112,67 +49,14 @@ func getTopicSummary(sessionID, query string) ([]string, TopicSummaryData, error
 	}
 
 	Info("success getTopicSummary: %d topics", len(topicList))
-	return topicList, topicData, nil
+	return TopicSummaryResult{TopicList: topicList, Data: topicData}
 }
 
-
-
-// getTopicSummaryWithGroup  获取主题归纳数据，并分组
-func getTopicSummaryWithGroup(sessionID, query string) ([]TopicSummaryDTO, error) {
-	client := &http.Client{Timeout: 5 * time.Second}
-	url := fmt.Sprintf("http://localhost:%d/topic_summary/search/%s?q=%s",
-		Config.Server.TopicSummary,
-		sessionID,
-		url.QueryEscape(query),
-	)
-
-	req, err := http.NewRequest("GET", url, nil)
-	if err != nil {
-		return nil, err
-	}
-	req.Header.Set("Authorization", "Bearer "+Config.Auth.Token)
-
-	resp, err := client.Do(req)
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
-
-	bodyBytes, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, fmt.Errorf("read response body failed: %v", err)
-	}
-
-	// 通用响应结构
-	var result struct {
-		Code int             `json:"code"`
-		Msg  string          `json:"msg"`
-		Data json.RawMessage `json:"data"`
-	}
-
-	if err := json.Unmarshal(bodyBytes, &result); err != nil {
-		return nil, fmt.Errorf("decode response failed: %v, body: %s", err, string(bodyBytes))
-	}
-
-	if result.Code != 0 {
-		return nil, fmt.Errorf("topic_summary error: %s, body: %s", result.Msg, string(bodyBytes))
-	}
-
-	// 解析 Data
-	var topicData []struct {
-		Topic   string `json:"Topic"`
-		Content string `json:"Content"`
-	}
-
-	if len(result.Data) > 0 && string(result.Data) != "{}" {
-		if err := json.Unmarshal(result.Data, &topicData); err != nil {
-			return nil, fmt.Errorf("decode topic data failed: %v, data: %s", err, string(result.Data))
-		}
-	}
-
+// groupTopicSummary 话题归纳原始记录按话题分组，query 接口使用
+func groupTopicSummary(records []client.TopicRecord) []TopicSummaryDTO {
 	// 聚合同一话题的内容
 	topicMap := make(map[string][]string)
-	for _, item := range topicData {
+	for _, item := range records {
 		topicMap[item.Topic] = append(topicMap[item.Topic], item.Content)
 	}
 
@@ -185,210 +69,151 @@ func getTopicSummaryWithGroup(sessionID, query string) ([]TopicSummaryDTO, error
 	}
 
 	Info("success getTopicSummary: %d", len(dtoList))
-	return dtoList, nil
+	return dtoList
 }
 
 // getChatEvents 获取关键事件数据
-func getChatEvents(sessionID string) (ChatEventsDTO, error) {
-	client := &http.Client{Timeout: 5 * time.Second}
-	req, err := http.NewRequest("GET", fmt.Sprintf("http://localhost:%d/chat_event/get/%s", Config.Server.ChatEvent, sessionID), nil)
-	if err != nil {
-		return ChatEventsDTO{}, err
-	}
-	req.Header.Set("Authorization", "Bearer "+Config.Auth.Token)
+func getChatEvents(ctx context.Context, sessionID string) (ChatEventsDTO, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
 
-	resp, err := client.Do(req)
+	events, err := Services.ChatEvent.Get(ctx, sessionID)
 	if err != nil {
 		return ChatEventsDTO{}, err
 	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return ChatEventsDTO{}, fmt.Errorf("chat_event request failed with status: %d", resp.StatusCode)
-	}
+	return chatEventsDTO(events), nil
+}
 
-	var result struct {
-		Code int        `json:"code"`
-		Msg  string     `json:"msg"`
-		Data *EventData `json:"data"`
-	}
-	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-		return ChatEventsDTO{}, fmt.Errorf("failed to decode response: %v", err)
+// chatEventsDTO 关键事件转换成 DTO，只保留事件描述
+func chatEventsDTO(events *client.SessionEvents) ChatEventsDTO {
+	dto := ChatEventsDTO{
+		Completed: make([]string, len(events.Completed)),
+		Todo:      make([]string, len(events.Todo)),
 	}
-	if result.Code != 0 {
-		return ChatEventsDTO{}, fmt.Errorf("chat_event error: %s", result.Msg)
+	for i, item := range events.Completed {
+		dto.Completed[i] = item.Event
 	}
-
-	// 转换成 DTO
-	dto := ChatEventsDTO{}
-	if result.Data != nil {
-		dto.Completed = make([]string, len(result.Data.Completed))
-		for i, item := range result.Data.Completed {
-			dto.Completed[i] = item.Event
-		}
-		dto.Todo = make([]string, len(result.Data.Todo))
-		for i, item := range result.Data.Todo {
-			dto.Todo[i] = item.Event
-		}
+	for i, item := range events.Todo {
+		dto.Todo[i] = item.Event
 	}
-
-	return dto, nil
+	return dto
 }
 
 // getSessionMessages 获取会话消息数据
-func getSessionMessages(sessionID string) (SessionMessagesDTO, error) {
-	client := &http.Client{Timeout: 5 * time.Second}
-	urlStr := fmt.Sprintf("http://localhost:%d/session_messages/get/%s", Config.Server.SessionMessages, sessionID)
-	req, err := http.NewRequest("GET", urlStr, nil)
-	if err != nil {
-		return SessionMessagesDTO{}, err
-	}
-	req.Header.Set("Authorization", "Bearer "+Config.Auth.Token)
+func getSessionMessages(ctx context.Context, sessionID string) (SessionMessagesDTO, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
 
-	resp, err := client.Do(req)
+	stored, err := Services.SessionMessages.Get(ctx, sessionID)
 	if err != nil {
 		return SessionMessagesDTO{}, err
 	}
-	defer resp.Body.Close()
+	return sessionMessagesDTO(stored), nil
+}
 
-	var result QueryResponse
-	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-		return SessionMessagesDTO{}, fmt.Errorf("failed to decode response: %v", err)
-	}
-	if result.Code != 0 {
-		return SessionMessagesDTO{}, fmt.Errorf("session_messages error: %s", result.Msg)
-	}
+// getSessionMessagesPage 按游标分页获取会话消息，保留时间字段供前端按时间展示
+func getSessionMessagesPage(ctx context.Context, sessionID string, q client.MessageQuery) (*client.MessagePage, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
 
-	var data SessionMessagesDTO
-	if err := json.Unmarshal(result.Data, &data); err != nil {
-		return SessionMessagesDTO{}, fmt.Errorf("failed to unmarshal session_messages data: %v", err)
-	}
+	return Services.SessionMessages.Page(ctx, sessionID, q)
+}
 
-	return data, nil
+// sessionMessagesDTO 存储的消息转换成 DTO，只保留 role/content
+func sessionMessagesDTO(stored []client.StoredMessage) SessionMessagesDTO {
+	messages := make([]Message, 0, len(stored))
+	for _, m := range stored {
+		messages = append(messages, Message{Role: m.Role, Content: m.Content})
+	}
+	return SessionMessagesDTO{Messages: messages}
 }
 
-// deleteUserPortrait 删除用户画像数据
-func deleteUserPortrait(sessionID string) error {
-	client := &http.Client{Timeout: 5 * time.Second}
-	url := fmt.Sprintf("http://localhost:%d/user_poritrait/delete/%s", Config.Server.UserPortrait, sessionID)
+// --------------------- 批量查询：每个记忆块调用一次下游批量接口，结果以 session_id 为 key -----------------------------
 
-	req, err := http.NewRequest("DELETE", url, nil)
-	if err != nil {
-		return err
-	}
-	req.Header.Set("Authorization", "Bearer "+Config.Auth.Token)
+// getUserPortraits 批量获取用户画像
+func getUserPortraits(ctx context.Context, sessionIDs []string) (map[string]UserPortraitDTO, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
 
-	resp, err := client.Do(req)
+	portraits, err := Services.UserPortrait.GetBatch(ctx, sessionIDs)
 	if err != nil {
-		return err
-	}
-	defer resp.Body.Close()
-
-	var result struct {
-		Code int    `json:"code"`
-		Msg  string `json:"msg"`
-	}
-	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-		return fmt.Errorf("failed to decode response: %v", err)
+		return nil, err
 	}
-	//Info("deleteUserPortrait result: %v", result)
-	if result.Code != 0 {
-		return fmt.Errorf("user_poritrait delete error: %s", result.Msg)
+	result := make(map[string]UserPortraitDTO, len(portraits))
+	for sessionID, p := range portraits {
+		if p != nil {
+			result[sessionID] = UserPortraitDTO(p.UserPortrait)
+		}
 	}
-
-	return nil
+	return result, nil
 }
 
-// deleteTopicSummary 删除主题归纳数据
-func deleteTopicSummary(sessionID string) error {
-	client := &http.Client{Timeout: 5 * time.Second}
-	url := fmt.Sprintf("http://localhost:%d/topic_summary/delete/%s", Config.Server.TopicSummary, sessionID)
+// searchTopicRecordsBatch 批量检索话题归纳原始记录
+func searchTopicRecordsBatch(ctx context.Context, searches []client.TopicSearch) (map[string][]client.TopicRecord, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
 
-	req, err := http.NewRequest("DELETE", url, nil)
-	if err != nil {
-		return err
-	}
-	req.Header.Set("Authorization", "Bearer "+Config.Auth.Token)
+	return Services.TopicSummary.SearchBatch(ctx, searches)
+}
 
-	resp, err := client.Do(req)
-	if err != nil {
-		return err
-	}
-	defer resp.Body.Close()
+// getChatEventsBatch 批量获取关键事件
+func getChatEventsBatch(ctx context.Context, sessionIDs []string) (map[string]ChatEventsDTO, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
 
-	var result struct {
-		Code int    `json:"code"`
-		Msg  string `json:"msg"`
-	}
-	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-		return fmt.Errorf("failed to decode response: %v", err)
+	sessions, err := Services.ChatEvent.GetBatch(ctx, sessionIDs)
+	if err != nil {
+		return nil, err
 	}
-	if result.Code != 0 {
-		return fmt.Errorf("topic_summary delete error: %s", result.Msg)
+	result := make(map[string]ChatEventsDTO, len(sessions))
+	for sessionID, events := range sessions {
+		if events != nil {
+			result[sessionID] = chatEventsDTO(events)
+		}
 	}
-
-	return nil
+	return result, nil
 }
 
-// deleteChatEvents 删除关键事件数据
-func deleteChatEvents(sessionID string) error {
-	client := &http.Client{Timeout: 5 * time.Second}
-	url := fmt.Sprintf("http://localhost:%d/chat_event/delete/%s", Config.Server.ChatEvent, sessionID)
-	Info("request delete chat_event in url: %s", url)
-	req, err := http.NewRequest("DELETE", url, nil)
-	if err != nil {
-		return err
-	}
-	req.Header.Set("Authorization", "Bearer "+Config.Auth.Token)
+// getSessionMessagesBatch 批量获取会话消息
+func getSessionMessagesBatch(ctx context.Context, sessionIDs []string) (map[string]SessionMessagesDTO, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
 
-	resp, err := client.Do(req)
+	sessions, err := Services.SessionMessages.GetBatch(ctx, sessionIDs)
 	if err != nil {
-		return err
-	}
-	defer resp.Body.Close()
-
-	var result struct {
-		Code int    `json:"code"`
-		Msg  string `json:"msg"`
-	}
-	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-		return fmt.Errorf("failed to decode response: %v", err)
+		return nil, err
 	}
-	if result.Code != 0 {
-		return fmt.Errorf("chat_event delete error: %s", result.Msg)
+	result := make(map[string]SessionMessagesDTO, len(sessions))
+	for sessionID, stored := range sessions {
+		result[sessionID] = sessionMessagesDTO(stored)
 	}
-
-	return nil
+	return result, nil
 }
 
-// deleteSessionMessages 删除会话消息数据
-func deleteSessionMessages(sessionID string) error {
-	client := &http.Client{Timeout: 5 * time.Second}
-	url := fmt.Sprintf("http://localhost:%d/session_messages/delete/%s", Config.Server.SessionMessages, sessionID)
-	//Info("request delete session_messages in url: %s", url)
-
-	req, err := http.NewRequest("DELETE", url, nil)
-	if err != nil {
-		return err
-	}
-	req.Header.Set("Authorization", "Bearer "+Config.Auth.Token)
+// deleteUserPortrait 删除用户画像数据
+func deleteUserPortrait(ctx context.Context, sessionID string) error {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+	return Services.UserPortrait.Delete(ctx, sessionID)
+}
 
-	resp, err := client.Do(req)
-	if err != nil {
-		return err
-	}
-	defer resp.Body.Close()
+// deleteTopicSummary 删除主题归纳数据
+func deleteTopicSummary(ctx context.Context, sessionID string) error {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+	return Services.TopicSummary.Delete(ctx, sessionID)
+}
 
-	var result struct {
-		Code int    `json:"code"`
-		Msg  string `json:"msg"`
-	}
-	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-		return fmt.Errorf("failed to decode response: %v", err)
-	}
-	if result.Code != 0 {
-		return fmt.Errorf("session_messages delete error: %s", result.Msg)
-	}
+// deleteChatEvents 删除关键事件数据
+func deleteChatEvents(ctx context.Context, sessionID string) error {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+	return Services.ChatEvent.Delete(ctx, sessionID)
+}
 
-	return nil
+// deleteSessionMessages 删除会话消息数据
+func deleteSessionMessages(ctx context.Context, sessionID string) error {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+	return Services.SessionMessages.Delete(ctx, sessionID)
 }
@@ -0,0 +1,532 @@
+package server
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"remember/sessionid"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/redis/go-redis/v9"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// --------------------- 用户数据删除：找出用户出现过的全部会话，删除各服务、死信及 Redis 中的数据，写入凭证并核验 -----------------------------
+//
+//   - 会话来自 SESSION_NAME 登记的 user_id，以及各集合中 user_id 字段匹配的结构化 session_id（登记之前产生的数据）
+//   - 旧格式与自行指定的 session_id 只能通过会话记录找到
+//   - 凭证只保存 user_id 与 session_id 的 sha256，按序号组成 hash 链，修改或删除任意一条都能被 /memory/erasure/verify 发现
+//   - 删除期间仍在上传的会话可能重新产生数据，核验报告会显示剩余数量，停止上传后重新调用即可
+
+// 会话数据所在的集合，与各服务 static.go 中的集合名一致，核验报告逐个统计剩余文档数
+var erasureCollections = []string{
+	"session_messages",
+	"user_poritrait",
+	"topic_summary",
+	"topic_info",
+	"chat_event",
+	DEAD_LETTER_NAME,
+	"user_poritrait_dead_letter",
+	"topic_summary_dead_letter",
+	"chat_event_dead_letter",
+}
+
+// 下游服务的任务队列，与各服务 static.go 中的 QUEUE_NAME 一致
+var erasureQueues = []string{
+	"remember:user_poritrait:queue",
+	"remember:topic_summary:queue",
+	"remember:chat_event:queue",
+}
+
+// ErasureReport 核验报告，Collections、Redis 为删除后剩余的数量
+type ErasureReport struct {
+	Collections map[string]int64 `json:"collections" bson:"collections"`
+	Redis       map[string]int64 `json:"redis" bson:"redis"` // 队列、完成通知、快照、缓存、补齐调度、任务状态
+	Clean       bool             `json:"clean" bson:"clean"` // 全部为 0
+	CheckedAt   time.Time        `json:"checked_at" bson:"checked_at"`
+}
+
+// ErasureReceipt 删除凭证，Hash 为去掉 hash 字段后凭证 JSON 的 sha256
+type ErasureReceipt struct {
+	Seq           int64          `json:"seq" bson:"_id"`
+	SubjectHash   string         `json:"subject_hash" bson:"subject_hash"`     // sha256(user_id)
+	SessionHashes []string       `json:"session_hashes" bson:"session_hashes"` // sha256(session_id)
+	Failures      map[string]int `json:"failures" bson:"failures"`             // 删除失败的步骤及会话数
+	Report        ErasureReport  `json:"report" bson:"report"`
+	CreatedAt     time.Time      `json:"created_at" bson:"created_at"`
+	PrevHash      string         `json:"prev_hash" bson:"prev_hash"` // 上一条凭证的 hash，第一条为空
+	Hash          string         `json:"hash" bson:"hash"`
+}
+
+func sha256Hex(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+// receiptHash 计算凭证的 hash，不包含 hash 字段本身
+func receiptHash(r ErasureReceipt) (string, error) {
+	r.Hash = ""
+	data, err := json.Marshal(r)
+	if err != nil {
+		return "", err
+	}
+	return sha256Hex(string(data)), nil
+}
+
+// findUserSessions 找出用户出现过的全部会话
+func findUserSessions(ctx context.Context, userID string) ([]string, error) {
+	found := map[string]bool{}
+
+	cursor, err := MongoDB.Collection(SESSION_NAME).Find(ctx, bson.M{"user_id": userID}, options.Find().SetProjection(bson.M{"_id": 1}))
+	if err != nil {
+		return nil, err
+	}
+	var records []SessionRecord
+	if err := cursor.All(ctx, &records); err != nil {
+		return nil, err
+	}
+	for _, r := range records {
+		found[r.SessionID] = true
+	}
+
+	// s2.{group_id}.{user_id}.{role_id}
+	pattern := "^" + regexp.QuoteMeta(sessionid.Prefix) + `\.[^.]*\.` + regexp.QuoteMeta(sessionid.Field(userID)) + `\.`
+	filter := bson.M{"session_id": bson.M{"$regex": pattern}}
+	for _, name := range erasureCollections {
+		ids, err := MongoDB.Collection(name).Distinct(ctx, "session_id", filter)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		for _, id := range ids {
+			if s, ok := id.(string); ok {
+				found[s] = true
+			}
+		}
+	}
+
+	sessions := make([]string, 0, len(found))
+	for id := range found {
+		sessions = append(sessions, id)
+	}
+	sort.Strings(sessions)
+	return sessions, nil
+}
+
+// eraseSession 删除单个会话在各服务、死信和 Redis 中的数据，返回失败的步骤
+func eraseSession(ctx context.Context, sessionID string) map[string]error {
+	steps := map[string]func(context.Context) error{
+		"main_queue":  func(ctx context.Context) error { return MessageQueue.DeleteBySession(ctx, sessionID) },
+		"pending":     func(ctx context.Context) error { return clearPending(ctx, sessionID) },
+		"completions": func(ctx context.Context) error { return purgeCompletions(ctx, sessionID) },
+		"snapshots":   func(ctx context.Context) error { return deleteSnapshots(ctx, sessionID) },
+		"apply_cache": func(ctx context.Context) error {
+			return RedisClient.Del(ctx, APPLY_CACHE_PREFIX+sessionID, APPLY_REQUEST_PREFIX+sessionID,
+				APPLY_GEN_PREFIX+sessionID, APPLY_REFRESH_LOCK_PREFIX+sessionID).Err()
+		},
+		DEAD_LETTER_NAME: func(ctx context.Context) error {
+			_, err := DeadLetters.Purge(ctx, DeadLetterFilter{SessionID: sessionID})
+			return err
+		},
+		"user_portrait":    func(ctx context.Context) error { return deleteUserPortrait(ctx, sessionID) },
+		"topic_summary":    func(ctx context.Context) error { return deleteTopicSummary(ctx, sessionID) },
+		"chat_event":       func(ctx context.Context) error { return deleteChatEvents(ctx, sessionID) },
+		"session_messages": func(ctx context.Context) error { return deleteSessionMessages(ctx, sessionID) },
+		"user_portrait_dead_letter": func(ctx context.Context) error {
+			_, err := Services.UserPortrait.PurgeDeadLetters(ctx, sessionID)
+			return err
+		},
+		"topic_summary_dead_letter": func(ctx context.Context) error {
+			_, err := Services.TopicSummary.PurgeDeadLetters(ctx, sessionID)
+			return err
+		},
+		"chat_event_dead_letter": func(ctx context.Context) error {
+			_, err := Services.ChatEvent.PurgeDeadLetters(ctx, sessionID)
+			return err
+		},
+	}
+
+	var (
+		failed = map[string]error{}
+		mu     sync.Mutex
+		wg     sync.WaitGroup
+	)
+	for name, fn := range steps {
+		wg.Add(1)
+		go func(name string, fn func(context.Context) error) {
+			defer wg.Done()
+			if err := fn(ctx); err != nil {
+				mu.Lock()
+				failed[name] = err
+				mu.Unlock()
+			}
+		}(name, fn)
+	}
+	wg.Wait()
+
+	// 全部成功后删除会话记录，失败时保留，重新调用仍能找到该会话
+	if len(failed) == 0 {
+		if err := deleteSessionRecord(ctx, sessionID); err != nil {
+			failed[SESSION_NAME] = err
+		}
+	}
+	return failed
+}
+
+// purgeCompletions 删除完成通知 Stream 中属于该会话、尚未被 session_messages 处理的通知（包括已领取未 ACK 的）
+func purgeCompletions(ctx context.Context, sessionID string) error {
+	entries, err := RedisClient.XRange(ctx, COMPLETION_STREAM, "-", "+").Result()
+	if err != nil {
+		return err
+	}
+	sessions := map[string]bool{sessionID: true}
+	for _, entry := range entries {
+		if raw, _ := entry.Values["data"].(string); !queuedBy(raw, sessions) {
+			continue
+		}
+		_, err := RedisClient.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.XAck(ctx, COMPLETION_STREAM, COMPLETION_GROUP, entry.ID)
+			pipe.XDel(ctx, COMPLETION_STREAM, entry.ID)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// eraseTaskStatus 删除属于这些会话的任务状态（主服务及各下游服务），返回删除的数量
+func eraseTaskStatus(ctx context.Context, sessions map[string]bool, dryRun bool) (int64, error) {
+	var count int64
+	iter := RedisClient.Scan(ctx, 0, "remember:*:task:*", 1000).Iterator()
+	for iter.Next(ctx) {
+		key := iter.Val()
+		sessionID, err := RedisClient.HGet(ctx, key, "session_id").Result()
+		if errors.Is(err, redis.Nil) {
+			continue
+		}
+		if err != nil {
+			return count, err
+		}
+		if !sessions[sessionID] {
+			continue
+		}
+		if !dryRun {
+			if err := RedisClient.Del(ctx, key).Err(); err != nil {
+				return count, err
+			}
+		}
+		count++
+	}
+	return count, iter.Err()
+}
+
+// queuedBy 队列中的任务是否属于这些会话
+func queuedBy(raw string, sessions map[string]bool) bool {
+	var msg struct {
+		SessionID string `json:"session_id"`
+	}
+	return json.Unmarshal([]byte(raw), &msg) == nil && sessions[msg.SessionID]
+}
+
+// countQueued 统计队列（Stream 及其 :retry，retry 为空时不统计）中属于这些会话的任务数
+func countQueued(ctx context.Context, streams []string, retry string, sessions map[string]bool) (int64, error) {
+	belongs := func(raw string) bool { return queuedBy(raw, sessions) }
+
+	var count int64
+	for _, stream := range streams {
+		entries, err := RedisClient.XRange(ctx, stream, "-", "+").Result()
+		if err != nil {
+			return 0, err
+		}
+		for _, entry := range entries {
+			if raw, _ := entry.Values["data"].(string); belongs(raw) {
+				count++
+			}
+		}
+	}
+	if retry == "" {
+		return count, nil
+	}
+	members, err := RedisClient.ZRange(ctx, retry, 0, -1).Result()
+	if err != nil {
+		return 0, err
+	}
+	for _, raw := range members {
+		if belongs(raw) {
+			count++
+		}
+	}
+	return count, nil
+}
+
+// verifyErasure 统计删除后各集合及 Redis 中剩余的数据
+func verifyErasure(ctx context.Context, sessionIDs []string) (ErasureReport, error) {
+	report := ErasureReport{
+		Collections: map[string]int64{},
+		Redis:       map[string]int64{},
+		CheckedAt:   time.Now().UTC().Truncate(time.Millisecond),
+	}
+	sessions := make(map[string]bool, len(sessionIDs))
+	for _, id := range sessionIDs {
+		sessions[id] = true
+	}
+
+	filter := bson.M{"session_id": bson.M{"$in": sessionIDs}}
+	for _, name := range erasureCollections {
+		n, err := MongoDB.Collection(name).CountDocuments(ctx, filter)
+		if err != nil {
+			return report, fmt.Errorf("%s: %w", name, err)
+		}
+		report.Collections[name] = n
+	}
+	n, err := MongoDB.Collection(SESSION_NAME).CountDocuments(ctx, bson.M{"_id": bson.M{"$in": sessionIDs}})
+	if err != nil {
+		return report, fmt.Errorf("%s: %w", SESSION_NAME, err)
+	}
+	report.Collections[SESSION_NAME] = n
+
+	// 队列
+	mainStreams := make([]string, 0, QueuePartitions)
+	for p := 0; p < QueuePartitions; p++ {
+		mainStreams = append(mainStreams, MessageQueue.streamKey(p))
+	}
+	if report.Redis[QUEUE_NAME], err = countQueued(ctx, mainStreams, MessageQueue.RetryName, sessions); err != nil {
+		return report, fmt.Errorf("%s: %w", QUEUE_NAME, err)
+	}
+	gates, err := MessageQueue.retryGates(ctx)
+	if err != nil {
+		return report, fmt.Errorf("%s: %w", QUEUE_NAME, err)
+	}
+	for _, raw := range gates {
+		if queuedBy(raw, sessions) {
+			report.Redis[QUEUE_NAME]++
+		}
+	}
+	for _, queue := range erasureQueues {
+		if report.Redis[queue], err = countQueued(ctx, []string{queue}, queue+":retry", sessions); err != nil {
+			return report, fmt.Errorf("%s: %w", queue, err)
+		}
+	}
+	if report.Redis[COMPLETION_STREAM], err = countQueued(ctx, []string{COMPLETION_STREAM}, "", sessions); err != nil {
+		return report, fmt.Errorf("%s: %w", COMPLETION_STREAM, err)
+	}
+
+	// 快照、apply 缓存、补齐调度
+	var snapshotKeys, cacheKeys []string
+	for _, id := range sessionIDs {
+		for _, section := range []string{BlockTopicSummary, BlockUserPortrait, BlockChatEvents, SectionMessages} {
+			snapshotKeys = append(snapshotKeys, snapshotKey(section, id))
+		}
+		cacheKeys = append(cacheKeys, APPLY_CACHE_PREFIX+id, APPLY_REQUEST_PREFIX+id, APPLY_GEN_PREFIX+id, APPLY_REFRESH_LOCK_PREFIX+id)
+	}
+	for name, keys := range map[string][]string{SNAPSHOT_PREFIX: snapshotKeys, APPLY_CACHE_PREFIX: cacheKeys} {
+		report.Redis[name] = 0
+		if len(keys) == 0 {
+			continue
+		}
+		if report.Redis[name], err = RedisClient.Exists(ctx, keys...).Result(); err != nil {
+			return report, fmt.Errorf("%s: %w", name, err)
+		}
+	}
+	for _, key := range []string{FLUSH_IDLE_KEY, FLUSH_STALE_KEY} {
+		report.Redis[key] = 0
+		if len(sessionIDs) == 0 {
+			continue
+		}
+		scores, err := RedisClient.ZMScore(ctx, key, sessionIDs...).Result()
+		if err != nil {
+			return report, fmt.Errorf("%s: %w", key, err)
+		}
+		for _, s := range scores {
+			if s != 0 {
+				report.Redis[key]++
+			}
+		}
+	}
+
+	// 任务状态
+	if report.Redis["task_status"], err = eraseTaskStatus(ctx, sessions, true); err != nil {
+		return report, fmt.Errorf("task_status: %w", err)
+	}
+
+	report.Clean = true
+	for _, n := range report.Collections {
+		report.Clean = report.Clean && n == 0
+	}
+	for _, n := range report.Redis {
+		report.Clean = report.Clean && n == 0
+	}
+	return report, nil
+}
+
+// appendReceipt 写入凭证，序号冲突（并发删除）时读取新的链尾重试
+func appendReceipt(ctx context.Context, receipt ErasureReceipt) (*ErasureReceipt, error) {
+	coll := MongoDB.Collection(ERASURE_NAME)
+	for i := 0; i < ErasureAppendTry; i++ {
+		var last ErasureReceipt
+		err := coll.FindOne(ctx, bson.M{}, options.FindOne().SetSort(bson.D{{Key: "_id", Value: -1}})).Decode(&last)
+		if err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, err
+		}
+		receipt.Seq, receipt.PrevHash = last.Seq+1, last.Hash
+		if receipt.Hash, err = receiptHash(receipt); err != nil {
+			return nil, err
+		}
+		if _, err = coll.InsertOne(ctx, receipt); err == nil {
+			return &receipt, nil
+		} else if !mongo.IsDuplicateKeyError(err) {
+			return nil, err
+		}
+	}
+	return nil, errors.New("too many concurrent erasures, receipt not recorded")
+}
+
+// EraseUser 删除用户出现过的全部会话，写入凭证并返回核验报告
+func EraseUser(ctx context.Context, userID string) ([]string, *ErasureReceipt, error) {
+	sessionIDs, err := findUserSessions(ctx, userID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to find sessions: %w", err)
+	}
+
+	receipt := ErasureReceipt{
+		SubjectHash:   sha256Hex(userID),
+		SessionHashes: make([]string, 0, len(sessionIDs)),
+		Failures:      map[string]int{},
+	}
+	sessions := make(map[string]bool, len(sessionIDs))
+	for _, id := range sessionIDs {
+		sessions[id] = true
+		receipt.SessionHashes = append(receipt.SessionHashes, sha256Hex(id))
+		for step, err := range eraseSession(ctx, id) {
+			receipt.Failures[step]++
+			log.Printf("⚠️ Erase session failed, session_id=%s, step=%s, err=%v", id, step, err)
+		}
+	}
+	if len(sessionIDs) > 0 {
+		if _, err := eraseTaskStatus(ctx, sessions, false); err != nil {
+			receipt.Failures["task_status"]++
+			log.Printf("⚠️ Erase task status failed, err=%v", err)
+		}
+	}
+
+	if receipt.Report, err = verifyErasure(ctx, sessionIDs); err != nil {
+		return sessionIDs, nil, fmt.Errorf("failed to verify erasure: %w", err)
+	}
+	receipt.CreatedAt = time.Now().UTC().Truncate(time.Millisecond)
+
+	saved, err := appendReceipt(ctx, receipt)
+	if err != nil {
+		return sessionIDs, nil, fmt.Errorf("failed to record receipt: %w", err)
+	}
+	return sessionIDs, saved, nil
+}
+
+// VerifyReceipts 按序号校验凭证链，返回凭证数量及第一条异常的序号（0 表示完整）
+func VerifyReceipts(ctx context.Context) (count, brokenAt int64, reason string, err error) {
+	cursor, err := MongoDB.Collection(ERASURE_NAME).Find(ctx, bson.M{}, options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}))
+	if err != nil {
+		return 0, 0, "", err
+	}
+	defer cursor.Close(ctx)
+
+	prev := ""
+	for cursor.Next(ctx) {
+		var r ErasureReceipt
+		if err := cursor.Decode(&r); err != nil {
+			return count, 0, "", err
+		}
+		count++
+		switch sum, err := receiptHash(r); {
+		case err != nil:
+			return count, 0, "", err
+		case r.Seq != count:
+			return count, r.Seq, fmt.Sprintf("expected seq %d", count), nil
+		case r.PrevHash != prev:
+			return count, r.Seq, "prev_hash mismatch", nil
+		case sum != r.Hash:
+			return count, r.Seq, "hash mismatch", nil
+		}
+		prev = r.Hash
+	}
+	return count, 0, "", cursor.Err()
+}
+
+// --------------------- 接口 -----------------------------
+
+// registerErasureRoutes 注册用户数据删除接口
+func registerErasureRoutes(r chi.Router, prefix string) {
+	r.Delete(prefix+"/user/{userID}", eraseUserHandler)            // 删除用户的全部数据
+	r.Get(prefix+"/erasure/receipts/{seq}", erasureReceiptHandler) // 凭证详情
+	r.Get(prefix+"/erasure/verify", erasureVerifyHandler)          // 校验凭证链
+}
+
+func eraseUserHandler(w http.ResponseWriter, r *http.Request) {
+	userID := chi.URLParam(r, "userID")
+	if userID == "" {
+		writeJSON(w, SessionResponse{Code: -1, Msg: "user_id is required", Data: struct{}{}})
+		return
+	}
+
+	sessionIDs, receipt, err := EraseUser(r.Context(), userID)
+	if err != nil {
+		writeJSON(w, SessionResponse{Code: -1, Msg: "failed to erase user: " + err.Error(), Data: struct{}{}})
+		return
+	}
+
+	ok := len(receipt.Failures) == 0 && receipt.Report.Clean
+	writeJSON(w, SessionResponse{
+		Code: ifThenElseInt(ok, 0, -1),
+		Msg:  ifThenElse(ok, "success", "用户数据未完全删除"),
+		Data: map[string]interface{}{
+			"user_id":  userID,
+			"sessions": sessionIDs,
+			"receipt":  receipt,
+		},
+	})
+}
+
+func erasureReceiptHandler(w http.ResponseWriter, r *http.Request) {
+	seq, err := strconv.ParseInt(chi.URLParam(r, "seq"), 10, 64)
+	if err != nil {
+		writeJSON(w, SessionResponse{Code: -1, Msg: "invalid seq", Data: struct{}{}})
+		return
+	}
+	var receipt ErasureReceipt
+	if err := MongoDB.Collection(ERASURE_NAME).FindOne(r.Context(), bson.M{"_id": seq}).Decode(&receipt); err != nil {
+		writeJSON(w, SessionResponse{Code: -1, Msg: "failed to get receipt: " + err.Error(), Data: struct{}{}})
+		return
+	}
+	writeJSON(w, SessionResponse{Code: 0, Msg: "success", Data: receipt})
+}
+
+func erasureVerifyHandler(w http.ResponseWriter, r *http.Request) {
+	count, brokenAt, reason, err := VerifyReceipts(r.Context())
+	if err != nil {
+		writeJSON(w, SessionResponse{Code: -1, Msg: "failed to verify receipts: " + err.Error(), Data: struct{}{}})
+		return
+	}
+	writeJSON(w, SessionResponse{
+		Code: ifThenElseInt(brokenAt == 0, 0, -1),
+		Msg:  ifThenElse(brokenAt == 0, "success", "凭证链校验失败"),
+		Data: map[string]interface{}{
+			"count":     count,
+			"valid":     brokenAt == 0,
+			"broken_at": brokenAt,
+			"reason":    reason,
+		},
+	})
+}
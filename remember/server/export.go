@@ -0,0 +1,308 @@
+package server
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"remember/client"
+	"remember/sessionid"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// --------------------- 导出与导入：把一个会话的全部记忆打包为带校验和的 JSON，恢复到新会话或已有会话 -----------------------------
+//
+//   - 导出包包含 session_messages 原始记录（含任务标记）、用户画像、话题记录、话题统计和关键事件
+//   - checksum 为去掉 checksum 字段后整个导出包 JSON 的 sha256，导入时校验，修改过的导出包会被拒绝
+//   - 导入时各服务按 mode 处理已有数据：replace 先删除，merge 只写入不存在的记录，skip 已有数据时跳过
+//   - 导入的记录重新生成 _id，session_id 改为目标会话；关键事件保留原有 created_at，仍按 TTL 索引过期
+
+// BundleSession 导出包中的会话信息
+type BundleSession struct {
+	SessionID string `json:"session_id"`
+	GroupID   string `json:"group_id"`
+	UserID    string `json:"user_id"`
+	RoleID    string `json:"role_id"`
+}
+
+// BundleData 导出包中的记忆数据，UserPortrait、TopicInfo 不存在时为 null
+type BundleData struct {
+	Messages     []client.SessionMessageRecord `json:"messages"`
+	UserPortrait *client.UserPortrait          `json:"user_portrait"`
+	Topics       []client.TopicRecord          `json:"topics"`
+	TopicInfo    *client.TopicInfo             `json:"topic_info"`
+	ChatEvents   []client.ChatEvent            `json:"chat_events"`
+}
+
+// ExportBundle 导出包
+type ExportBundle struct {
+	Format     string        `json:"format"`  // BUNDLE_FORMAT
+	Version    int           `json:"version"` // BundleVersion
+	ExportedAt time.Time     `json:"exported_at"`
+	Session    BundleSession `json:"session"`
+	Data       BundleData    `json:"data"`
+	Checksum   string        `json:"checksum"` // sha256:{hex}
+}
+
+// ImportRequest 导入接口请求体，目标会话为空时导入到导出包中的会话
+type ImportRequest struct {
+	SessionID string       `json:"session_id"`
+	GroupID   string       `json:"group_id"`
+	UserID    string       `json:"user_id"`
+	RoleID    string       `json:"role_id"`
+	Mode      string       `json:"mode"` // replace / merge / skip，为空时为 skip
+	Bundle    ExportBundle `json:"bundle"`
+}
+
+// ImportSectionResult 单个服务的导入结果
+type ImportSectionResult struct {
+	Status   string `json:"status"` // ok / failed
+	Imported int    `json:"imported"`
+	Skipped  bool   `json:"skipped"`
+	Error    string `json:"error,omitempty"`
+}
+
+// bundleChecksum 计算导出包的校验和，不包含 checksum 字段本身
+func bundleChecksum(b ExportBundle) (string, error) {
+	b.Checksum = ""
+	data, err := json.Marshal(b)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return "sha256:" + hex.EncodeToString(sum[:]), nil
+}
+
+// validateBundle 导入前校验格式、版本和校验和
+func validateBundle(b ExportBundle) error {
+	if b.Format != BUNDLE_FORMAT {
+		return fmt.Errorf("unsupported bundle format: %q", b.Format)
+	}
+	if b.Version < 1 || b.Version > BundleVersion {
+		return fmt.Errorf("unsupported bundle version: %d", b.Version)
+	}
+	if !strings.HasPrefix(b.Checksum, "sha256:") {
+		return errors.New("bundle checksum is missing")
+	}
+	sum, err := bundleChecksum(b)
+	if err != nil {
+		return err
+	}
+	if sum != b.Checksum {
+		return errors.New("bundle checksum mismatch")
+	}
+	return nil
+}
+
+// bundleSession 导出包中的会话信息：优先使用会话记录，没有记录时从结构化 session_id 还原
+func bundleSession(ctx context.Context, sessionID string) BundleSession {
+	s := BundleSession{SessionID: sessionID}
+	if record, err := GetSession(ctx, sessionID); err == nil {
+		s.GroupID, s.UserID, s.RoleID = record.GroupID, record.UserID, record.RoleID
+	} else if id, ok := sessionid.Parse(sessionID); ok {
+		s.GroupID, s.UserID, s.RoleID = id.GroupID, id.UserID, id.RoleID
+	}
+	return s
+}
+
+// ExportMemory 并发导出各服务的数据，任一服务失败时返回错误
+func ExportMemory(ctx context.Context, sessionID string) (*ExportBundle, error) {
+	ctx, cancel := context.WithTimeout(ctx, BundleTimeout*time.Second)
+	defer cancel()
+
+	var (
+		data BundleData
+		wg   sync.WaitGroup
+		mu   sync.Mutex
+		errs []error
+	)
+	run := func(name string, fn func() error) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := fn(); err != nil {
+				mu.Lock()
+				errs = append(errs, fmt.Errorf("%s: %w", name, err))
+				mu.Unlock()
+			}
+		}()
+	}
+
+	run("session_messages", func() (err error) {
+		data.Messages, err = Services.SessionMessages.Export(ctx, sessionID)
+		return err
+	})
+	run("user_portrait", func() (err error) {
+		data.UserPortrait, err = Services.UserPortrait.Export(ctx, sessionID)
+		return err
+	})
+	run("topic_summary", func() error {
+		topics, err := Services.TopicSummary.Export(ctx, sessionID)
+		if err != nil {
+			return err
+		}
+		data.Topics, data.TopicInfo = topics.Topics, topics.Info
+		return nil
+	})
+	run("chat_event", func() (err error) {
+		data.ChatEvents, err = Services.ChatEvent.Export(ctx, sessionID)
+		return err
+	})
+	wg.Wait()
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+
+	bundle := &ExportBundle{
+		Format:     BUNDLE_FORMAT,
+		Version:    BundleVersion,
+		ExportedAt: time.Now().UTC().Truncate(time.Millisecond),
+		Session:    bundleSession(ctx, sessionID),
+		Data:       data,
+	}
+	sum, err := bundleChecksum(*bundle)
+	if err != nil {
+		return nil, err
+	}
+	bundle.Checksum = sum
+	return bundle, nil
+}
+
+// ImportMemory 校验导出包后并发导入各服务，返回各服务的导入结果，以服务名为 key
+func ImportMemory(ctx context.Context, sessionID, mode string, b ExportBundle) (map[string]ImportSectionResult, error) {
+	if mode != client.ImportReplace && mode != client.ImportMerge && mode != client.ImportSkip {
+		return nil, fmt.Errorf("invalid import mode: %s", mode)
+	}
+	if err := validateBundle(b); err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, BundleTimeout*time.Second)
+	defer cancel()
+
+	var (
+		results = make(map[string]ImportSectionResult, 4)
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+	)
+	run := func(name string, fn func() (*client.ImportResult, error)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			res := ImportSectionResult{Status: "ok"}
+			if r, err := fn(); err != nil {
+				res = ImportSectionResult{Status: "failed", Error: err.Error()}
+			} else {
+				res.Imported, res.Skipped = r.Imported, r.Skipped
+			}
+			mu.Lock()
+			results[name] = res
+			mu.Unlock()
+		}()
+	}
+
+	run("session_messages", func() (*client.ImportResult, error) {
+		return Services.SessionMessages.Import(ctx, sessionID, mode, b.Data.Messages)
+	})
+	run("user_portrait", func() (*client.ImportResult, error) {
+		return Services.UserPortrait.Import(ctx, sessionID, mode, b.Data.UserPortrait)
+	})
+	run("topic_summary", func() (*client.ImportResult, error) {
+		return Services.TopicSummary.Import(ctx, sessionID, mode, client.TopicExport{Topics: b.Data.Topics, Info: b.Data.TopicInfo})
+	})
+	run("chat_event", func() (*client.ImportResult, error) {
+		return Services.ChatEvent.Import(ctx, sessionID, mode, b.Data.ChatEvents)
+	})
+	wg.Wait()
+	return results, nil
+}
+
+// --------------------- 接口 -----------------------------
+
+// registerExportRoutes 注册导出与导入接口
+func registerExportRoutes(r chi.Router, prefix string) {
+	r.Get(prefix+"/export", exportHandler)  // 导出，?session_id= 或 ?group_id=&user_id=&role_id=
+	r.Post(prefix+"/import", importHandler) // 导入
+}
+
+func exportHandler(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	sessionID := q.Get("session_id")
+	if sessionID == "" {
+		var err error
+		if sessionID, err = GenerateSessionID(q.Get("group_id"), q.Get("user_id"), q.Get("role_id")); err != nil {
+			writeJSON(w, SessionResponse{Code: -1, Msg: "session_id is required", Data: struct{}{}})
+			return
+		}
+	}
+
+	bundle, err := ExportMemory(r.Context(), sessionID)
+	if err != nil {
+		writeJSON(w, SessionResponse{Code: -1, Msg: "failed to export memory: " + err.Error(), Data: struct{}{}})
+		return
+	}
+	writeJSON(w, SessionResponse{Code: 0, Msg: "success", Data: bundle})
+}
+
+func importHandler(w http.ResponseWriter, r *http.Request) {
+	var req ImportRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, SessionResponse{Code: -1, Msg: "参数解析错误: " + err.Error(), Data: struct{}{}})
+		return
+	}
+	if req.Mode == "" {
+		req.Mode = client.ImportSkip
+	}
+
+	// 目标会话：session_id > group_id/user_id/role_id > 导出包中的会话
+	target := BundleSession{SessionID: req.SessionID, GroupID: req.GroupID, UserID: req.UserID, RoleID: req.RoleID}
+	if target.SessionID == "" {
+		if id, err := GenerateSessionID(req.GroupID, req.UserID, req.RoleID); err == nil {
+			target.SessionID = id
+		} else {
+			target = req.Bundle.Session
+		}
+	}
+	if target.SessionID == "" {
+		writeJSON(w, SessionResponse{Code: -1, Msg: "session_id is required", Data: struct{}{}})
+		return
+	}
+
+	results, err := ImportMemory(r.Context(), target.SessionID, req.Mode, req.Bundle)
+	if err != nil {
+		writeJSON(w, SessionResponse{Code: -1, Msg: "failed to import memory: " + err.Error(), Data: struct{}{}})
+		return
+	}
+
+	if err := recordSession(r.Context(), target.SessionID, target.GroupID, target.UserID, target.RoleID); err != nil {
+		log.Printf("⚠️ Record session failed, session_id=%s, err=%v", target.SessionID, err)
+	}
+	if err := deleteSnapshots(r.Context(), target.SessionID); err != nil {
+		log.Printf("⚠️ Delete snapshots failed, session_id=%s, err=%v", target.SessionID, err)
+	}
+
+	allSuccess := true
+	for _, res := range results {
+		if res.Status != "ok" {
+			allSuccess = false
+		}
+	}
+	writeJSON(w, SessionResponse{
+		Code: ifThenElseInt(allSuccess, 0, -1),
+		Msg:  ifThenElse(allSuccess, "success", "部分微服务数据导入失败"),
+		Data: map[string]interface{}{
+			"session_id": target.SessionID,
+			"mode":       req.Mode,
+			"results":    results,
+		},
+	})
+}
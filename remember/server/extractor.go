@@ -0,0 +1,286 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"regexp"
+	"sync"
+	"time"
+
+	"remember/client"
+	"remember/taskqueue"
+)
+
+// --------------------- 抽取器：Worker 按频次遍历注册表，为每个抽取器认领会话中未处理的消息并执行抽取 -----------------------------
+//
+//   - 认领状态按抽取器名称保存在 session_messages 的 task_states 中，清理时只删除所有抽取器都已完成的消息
+//   - 内置的用户画像、关键事件、主题归纳由独立服务执行（实现 Dispatcher），完成后由服务上报
+//   - 其他抽取器在主服务内执行：写入主队列，由 Worker 依次调用 Prompt、模型、Parse、Store，完成后上报 session_messages
+//
+// 新增抽取器只需在 init 中调用 RegisterExtractor，例如：
+//
+//	RegisterExtractor(&ExtractorSpec{
+//		ExtractorName: "mood",
+//		DefaultRound:  3,
+//		PromptFunc:    buildMoodPrompt,
+//		ParseFunc:     parseMood,
+//		StoreFunc:     saveMood,
+//	})
+
+// Extractor 记忆抽取器
+type Extractor interface {
+	Name() string                                                                                  // 唯一名称，同时是 session_messages 中 task_states 的 key
+	Round(c Cadence) int                                                                           // 每多少轮消息触发一次
+	Prompt(ctx context.Context, sessionID string, messages []client.StoredMessage) (string, error) // 构造系统提示词
+	Parse(raw string) (interface{}, error)                                                         // 解析模型输出
+	Store(ctx context.Context, sessionID string, result interface{}) error                         // 保存解析结果
+}
+
+// Dispatcher 由独立服务执行的抽取器：认领的消息交给服务处理，返回服务的任务ID，主服务不调用 Prompt、Parse、Store
+type Dispatcher interface {
+	Dispatch(ctx context.Context, sessionID, claimID string, messages []client.StoredMessage) (string, error)
+}
+
+// ClaimPurger 能按批次删除抽取结果的抽取器：消息被修改或删除后，该批次重新排队，主服务先删除批次已抽取的结果，
+// 再由补齐调度以新的 claim_id 重新抽取；未实现的抽取器保留旧结果
+type ClaimPurger interface {
+	PurgeClaim(ctx context.Context, sessionID, claimID string) error
+}
+
+// ExtractorSpec 用函数定义的抽取器，在主服务内执行
+type ExtractorSpec struct {
+	ExtractorName string
+	DefaultRound  int // 默认频次，可在 cadence 的 rounds 中按名称覆盖
+	PromptFunc    func(ctx context.Context, sessionID string, messages []client.StoredMessage) (string, error)
+	ParseFunc     func(raw string) (interface{}, error)
+	StoreFunc     func(ctx context.Context, sessionID string, result interface{}) error
+}
+
+func (s *ExtractorSpec) Name() string { return s.ExtractorName }
+
+func (s *ExtractorSpec) Round(c Cadence) int {
+	if round := c.Rounds[s.ExtractorName]; round > 0 {
+		return round
+	}
+	return s.DefaultRound
+}
+
+func (s *ExtractorSpec) Prompt(ctx context.Context, sessionID string, messages []client.StoredMessage) (string, error) {
+	return s.PromptFunc(ctx, sessionID, messages)
+}
+
+func (s *ExtractorSpec) Parse(raw string) (interface{}, error) {
+	return s.ParseFunc(raw)
+}
+
+func (s *ExtractorSpec) Store(ctx context.Context, sessionID string, result interface{}) error {
+	return s.StoreFunc(ctx, sessionID, result)
+}
+
+// serviceExtractor 内置抽取器，由独立服务执行
+type serviceExtractor struct {
+	name     string
+	round    func(c Cadence) int
+	dispatch func(ctx context.Context, sessionID, claimID string, messages []client.StoredMessage) (string, error)
+	purge    func(ctx context.Context, sessionID, claimID string) error // 为 nil 时不删除旧结果（用户画像是合并后的整体，无法按批次删除）
+}
+
+func (s *serviceExtractor) Name() string        { return s.name }
+func (s *serviceExtractor) Round(c Cadence) int { return s.round(c) }
+
+func (s *serviceExtractor) Dispatch(ctx context.Context, sessionID, claimID string, messages []client.StoredMessage) (string, error) {
+	return s.dispatch(ctx, sessionID, claimID, messages)
+}
+
+func (s *serviceExtractor) PurgeClaim(ctx context.Context, sessionID, claimID string) error {
+	if s.purge == nil {
+		return nil
+	}
+	return s.purge(ctx, sessionID, claimID)
+}
+
+func (s *serviceExtractor) Prompt(ctx context.Context, sessionID string, messages []client.StoredMessage) (string, error) {
+	return "", fmt.Errorf("extractor %s runs in its own service", s.name)
+}
+
+func (s *serviceExtractor) Parse(raw string) (interface{}, error) {
+	return nil, fmt.Errorf("extractor %s runs in its own service", s.name)
+}
+
+func (s *serviceExtractor) Store(ctx context.Context, sessionID string, result interface{}) error {
+	return fmt.Errorf("extractor %s runs in its own service", s.name)
+}
+
+// ---------------------------------- 注册表 ----------------------------------
+
+// extractorNamePattern 与 session_messages 的限制一致：名称同时是 MongoDB 字段名
+var extractorNamePattern = regexp.MustCompile(`^[a-z][a-z0-9_]{0,63}$`)
+
+var (
+	extractorMu sync.RWMutex
+	extractors  []Extractor
+)
+
+func init() {
+	// 内置抽取器，名称与服务名及 session_messages 的 EXTRACTOR_* 一致，顺序即触发顺序
+	for _, e := range []Extractor{
+		&serviceExtractor{"chat_event", func(c Cadence) int { return c.EventRound }, dispatchChatEvent, purgeChatEvent},
+		&serviceExtractor{"user_poritrait", func(c Cadence) int { return c.UserRound }, dispatchUserPortrait, nil},
+		&serviceExtractor{"topic_summary", func(c Cadence) int { return c.TopicRound }, dispatchTopicSummary, purgeTopicSummary},
+	} {
+		if err := RegisterExtractor(e); err != nil {
+			log.Fatalf("register extractor %s: %v", e.Name(), err)
+		}
+	}
+}
+
+// RegisterExtractor 注册抽取器，名称不合法或重复时返回错误；应在 Worker 启动前调用
+func RegisterExtractor(e Extractor) error {
+	name := e.Name()
+	if !extractorNamePattern.MatchString(name) {
+		return fmt.Errorf("invalid extractor name: %q", name)
+	}
+	if round := e.Round(defaultCadence); round < 1 || round >= defaultCadence.ClearRound {
+		return fmt.Errorf("extractor %s: default round must be >= 1 and less than clear_round (%d)", name, defaultCadence.ClearRound)
+	}
+
+	extractorMu.Lock()
+	for _, existing := range extractors {
+		if existing.Name() == name {
+			extractorMu.Unlock()
+			return fmt.Errorf("extractor %s already registered", name)
+		}
+	}
+	extractors = append(extractors, e)
+	extractorMu.Unlock()
+
+	// config.yaml 中的频次在启动时已校验，clear_round 还需大于新抽取器的频次
+	validateConfigCadence()
+	return nil
+}
+
+// Extractors 已注册的抽取器，按注册顺序
+func Extractors() []Extractor {
+	extractorMu.RLock()
+	defer extractorMu.RUnlock()
+	return append([]Extractor(nil), extractors...)
+}
+
+// lookupExtractor 按名称查找抽取器，不存在时返回 nil
+func lookupExtractor(name string) Extractor {
+	for _, e := range Extractors() {
+		if e.Name() == name {
+			return e
+		}
+	}
+	return nil
+}
+
+// extractorNames 已注册的抽取器名称，清理时要求这些抽取器都已完成
+func extractorNames() []string {
+	list := Extractors()
+	names := make([]string, 0, len(list))
+	for _, e := range list {
+		names = append(names, e.Name())
+	}
+	return names
+}
+
+// ---------------------------------- 触发与执行 ----------------------------------
+
+// triggerExtractor 认领抽取器 e 未处理的消息并交给抽取器执行，返回执行任务的ID，没有需要处理的消息时返回空
+func triggerExtractor(ctx context.Context, e Extractor, sessionID, taskID string) (string, error) {
+	// 第一步：以主任务ID认领消息
+	messages, err := markTaskMessages(ctx, sessionID, e.Name(), taskID)
+	if err != nil {
+		return "", err
+	}
+
+	// 如果没有认领到消息，直接返回成功
+	if len(messages) == 0 {
+		log.Printf("✅ No messages to process for %s in session %s", e.Name(), sessionID)
+		return "", nil
+	}
+
+	// 第二步：独立服务执行的抽取器直接交给服务
+	if d, ok := e.(Dispatcher); ok {
+		downstreamID, err := d.Dispatch(ctx, sessionID, taskID, messages)
+		if err != nil {
+			return "", fmt.Errorf("%s service failed: %w", e.Name(), err)
+		}
+		log.Printf("✅ %s task triggered successfully for session %s, downstream task_id=%s", e.Name(), sessionID, downstreamID)
+		return downstreamID, nil
+	}
+
+	// 主服务内执行的抽取器写入主队列，与上传任务在同一分区内按顺序执行
+	extractID, err := MessageQueue.Enqueue(ctx, QueueMessage{
+		SessionID: sessionID,
+		Extractor: e.Name(),
+		ClaimID:   taskID,
+		Claimed:   messages,
+	})
+	if err != nil {
+		return "", fmt.Errorf("enqueue %s extraction failed: %w", e.Name(), err)
+	}
+	log.Printf("✅ %s extraction enqueued for session %s, task_id=%s", e.Name(), sessionID, extractID)
+	return extractID, nil
+}
+
+// processExtraction 执行主服务内的抽取任务：构造提示词、调用模型、解析并保存结果，成功后上报 session_messages
+func (w *Worker) processExtraction(ctx context.Context, msg *QueueMessage) error {
+	e := lookupExtractor(msg.Extractor)
+	if e == nil {
+		return taskqueue.Permanent(fmt.Errorf("unknown extractor: %s", msg.Extractor))
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, ExtractorTimeout*time.Second)
+	defer cancel()
+
+	prompt, err := e.Prompt(ctx, msg.SessionID, msg.Claimed)
+	if err != nil {
+		return fmt.Errorf("%s build prompt failed: %w", e.Name(), err)
+	}
+	raw, err := executeLLM(ctx, prompt)
+	if err != nil {
+		return fmt.Errorf("%s execute failed: %w", e.Name(), err)
+	}
+	result, err := e.Parse(raw)
+	if err != nil {
+		// 解析失败重试大概率得到同样结果，不再重试
+		return taskqueue.Permanent(fmt.Errorf("%s parse failed: %w", e.Name(), err))
+	}
+	if err := e.Store(ctx, msg.SessionID, result); err != nil {
+		return fmt.Errorf("%s store failed: %w", e.Name(), err)
+	}
+
+	notifyMemoryChanged(ctx, msg.SessionID, e.Name())
+	reportExtraction(ctx, msg, client.MessageTaskDone, nil)
+	log.Printf("✅ %s extraction done for session %s, %d messages", e.Name(), msg.SessionID, len(msg.Claimed))
+	return nil
+}
+
+// reportExtraction 上报主服务内抽取任务的结果，失败只记录日志，消息由 session_messages 在认领超时后重新触发
+func reportExtraction(ctx context.Context, msg *QueueMessage, status string, taskErr error) {
+	if msg.Extractor == "" || msg.ClaimID == "" {
+		return
+	}
+	req := client.TaskCompletion{
+		SessionID: msg.SessionID,
+		Extractor: msg.Extractor,
+		ClaimID:   msg.ClaimID,
+		Status:    status,
+		TaskID:    msg.TaskID,
+	}
+	if taskErr != nil {
+		req.Error = taskErr.Error()
+	}
+	if _, err := Services.SessionMessages.Complete(ctx, req); err != nil {
+		log.Printf("⚠️ Report extraction failed, session_id=%s, extractor=%s, claim_id=%s, err=%v", msg.SessionID, msg.Extractor, msg.ClaimID, err)
+	}
+}
+
+// notifyMemoryChanged 主服务内的抽取器写入数据后，与各服务的 NotifyMemoryChanged 相同，以抽取器名称作为记忆名称
+func notifyMemoryChanged(ctx context.Context, sessionID, source string) {
+	memoryNotifier.Notify(ctx, sessionID, source)
+}
@@ -0,0 +1,56 @@
+package server
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/openai/openai-go/v2"
+	"github.com/openai/openai-go/v2/option"
+)
+
+// --------------------- 模型调用：供主服务内执行的抽取器使用，配置与其他服务共用 config.yaml 的 llm -----------------------------
+
+// 全局变量，直接暴露
+var (
+	LLMModel     string
+	OpenAIClient openai.Client
+)
+
+func init() {
+	InitLLM()
+}
+
+// InitLLM 初始化 OpenAI Client 并设置模型名称
+func InitLLM() {
+	OpenAIClient = openai.NewClient(
+		option.WithAPIKey(Config.LLM.APIKey),
+		option.WithBaseURL(Config.LLM.BaseURL),
+	)
+	LLMModel = Config.LLM.ModelID
+}
+
+// executeLLM 以 systemPrompt 调用模型，返回原始文本
+func executeLLM(ctx context.Context, systemPrompt string) (string, error) {
+	resp, err := OpenAIClient.Chat.Completions.New(
+		ctx,
+		openai.ChatCompletionNewParams{
+			Messages: []openai.ChatCompletionMessageParamUnion{
+				openai.SystemMessage(systemPrompt),
+				openai.UserMessage(EXTRACTOR_QUERY),
+			},
+			Model:           LLMModel,
+			ReasoningEffort: "minimal",
+		},
+		option.WithJSONSet("thinking", map[string]string{
+			"type": "disabled", // 禁用深度思考
+		}),
+	)
+	if err != nil {
+		return "", fmt.Errorf("openai request failed: %w", err) // 保留 *openai.Error，由 IsRetryable 判断是否重试
+	}
+
+	if len(resp.Choices) == 0 {
+		return "", fmt.Errorf("empty response from model")
+	}
+	return resp.Choices[0].Message.Content, nil
+}
@@ -0,0 +1,132 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+
+	"remember/client"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// --------------------- 单条消息：编辑内容、删除一轮、重新生成最后一轮的回复 -----------------------------
+//
+// 由 session_messages 修改消息，并把认领过该消息的抽取任务所在批次重新排队，会话空闲后由补齐调度重新抽取；
+// 主服务删除这些批次已抽取出的记忆（见 ClaimPurger），并删除消息快照，避免降级时返回修改前的内容
+
+// MessageEditRequest 单条消息接口请求体，session_id 为空时根据 group_id/user_id/role_id 生成
+type MessageEditRequest struct {
+	SessionID        string  `json:"session_id"`
+	GroupID          string  `json:"group_id"`
+	UserID           string  `json:"user_id"`
+	RoleID           string  `json:"role_id"`
+	MessageID        string  `json:"message_id"`        // 获取消息接口返回的 message_id；regenerate 时可选
+	UserContent      *string `json:"user_content"`      // 仅 edit 使用
+	AssistantContent *string `json:"assistant_content"` // edit 时可选；regenerate 时必填
+}
+
+// registerMessageRoutes 注册单条消息接口
+func registerMessageRoutes(r chi.Router, prefix string) {
+	r.Post(prefix+"/message/edit", messageEditHandler)             // 编辑一轮消息
+	r.Post(prefix+"/message/delete", messageDeleteHandler)         // 删除一轮消息
+	r.Post(prefix+"/message/regenerate", messageRegenerateHandler) // 替换最后一轮的 assistant 回复
+}
+
+// decodeMessageEdit 解析请求体并确定 session_id，失败时已写入响应
+func decodeMessageEdit(w http.ResponseWriter, r *http.Request) (*MessageEditRequest, bool) {
+	var req MessageEditRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, SessionResponse{Code: -1, Msg: "参数解析错误: " + err.Error(), Data: struct{}{}})
+		return nil, false
+	}
+	if req.SessionID == "" {
+		id, err := GenerateSessionID(req.GroupID, req.UserID, req.RoleID)
+		if err != nil {
+			writeJSON(w, SessionResponse{Code: -1, Msg: "必须提供 session_id 或 user_id+role_id+group_id", Data: struct{}{}})
+			return nil, false
+		}
+		req.SessionID = id
+	}
+	return &req, true
+}
+
+// writeMessageChange 输出修改结果，成功时删除重新排队的批次已抽取的记忆及消息快照
+func writeMessageChange(ctx context.Context, w http.ResponseWriter, sessionID string, change *client.MessageChange, err error) {
+	if err != nil {
+		writeJSON(w, SessionResponse{Code: -1, Msg: "修改消息失败: " + err.Error(), Data: struct{}{}})
+		return
+	}
+	if err := RedisClient.Del(ctx, snapshotKey(SectionMessages, sessionID)).Err(); err != nil {
+		log.Printf("⚠️ Delete messages snapshot failed, session_id=%s, err=%v", sessionID, err)
+	}
+	if err := purgeClaims(ctx, sessionID, change.Claims); err != nil {
+		log.Printf("❌ Purge extracted memory failed, session_id=%s, err=%v", sessionID, err)
+		writeJSON(w, SessionResponse{Code: -1, Msg: "消息已修改，删除旧批次的抽取结果失败: " + err.Error(), Data: change})
+		return
+	}
+	writeJSON(w, SessionResponse{Code: 0, Msg: "success", Data: change})
+}
+
+func messageEditHandler(w http.ResponseWriter, r *http.Request) {
+	req, ok := decodeMessageEdit(w, r)
+	if !ok {
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), queryTimeout)
+	defer cancel()
+
+	change, err := Services.SessionMessages.EditMessage(ctx, client.MessageEdit{
+		SessionID:        req.SessionID,
+		MessageID:        req.MessageID,
+		UserContent:      req.UserContent,
+		AssistantContent: req.AssistantContent,
+	})
+	writeMessageChange(ctx, w, req.SessionID, change, err)
+}
+
+func messageDeleteHandler(w http.ResponseWriter, r *http.Request) {
+	req, ok := decodeMessageEdit(w, r)
+	if !ok {
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), queryTimeout)
+	defer cancel()
+
+	change, err := Services.SessionMessages.DeleteRound(ctx, req.SessionID, req.MessageID)
+	writeMessageChange(ctx, w, req.SessionID, change, err)
+}
+
+func messageRegenerateHandler(w http.ResponseWriter, r *http.Request) {
+	req, ok := decodeMessageEdit(w, r)
+	if !ok {
+		return
+	}
+	if req.AssistantContent == nil {
+		writeJSON(w, SessionResponse{Code: -1, Msg: "assistant_content is required", Data: struct{}{}})
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), queryTimeout)
+	defer cancel()
+
+	change, err := Services.SessionMessages.Regenerate(ctx, req.SessionID, req.MessageID, *req.AssistantContent)
+	writeMessageChange(ctx, w, req.SessionID, change, err)
+}
+
+// purgeClaims 删除各抽取器重新排队的批次已抽取的结果，返回所有失败
+func purgeClaims(ctx context.Context, sessionID string, claims map[string]string) error {
+	var errs []error
+	for name, claimID := range claims {
+		purger, ok := lookupExtractor(name).(ClaimPurger)
+		if !ok {
+			continue
+		}
+		if err := purger.PurgeClaim(ctx, sessionID, claimID); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -1,6 +1,10 @@
 package server
 
-import "encoding/json"
+import (
+	"encoding/json"
+
+	"remember/client"
+)
 
 // ----------------------  upload 接口 -------------------------
 
@@ -28,10 +32,17 @@ type UploadResponse struct {
 
 //-------------------------- query 查询  接口 ----------
 
+// SectionOptions 记忆块查询失败时的处理方式，query 与 apply 共用
+type SectionOptions struct {
+	Strict   bool `json:"strict,omitempty"`   // 有记忆块查询失败且没有快照可用时返回 code -1
+	Fallback bool `json:"fallback,omitempty"` // 查询失败时回退到最近一次成功查询的快照
+}
+
 // QueryRequest 查询接口请求体
 type QueryRequest struct {
 	SessionID string `json:"session_id"`
 	Query     string `json:"query"` // 可选
+	SectionOptions
 }
 
 // QueryResponse 微服务查询接口响应-通用
@@ -43,15 +54,40 @@ type QueryResponse struct {
 
 // server 多个微服务结果汇总，format之后的查询响应
 type FormResponse struct {
-	Code int    `json:"code"`
-	Msg  string `json:"msg"`
-	Data struct {
-		UserPortrait    UserPortraitDTO   `json:"user_portrait"`
-		TopicSummary    []TopicSummaryDTO `json:"topic_summary"`
-		ChatEvents      ChatEventsDTO     `json:"chat_events"`
-		SessionMessages []Message         `json:"session_messages"`
-		CurrentTime     string            `json:"current_time"`
-	} `json:"data"`
+	Code int       `json:"code"`
+	Msg  string    `json:"msg"`
+	Data QueryData `json:"data"`
+}
+
+// QueryData 查询接口响应 data，批量查询中每个会话的结果相同
+type QueryData struct {
+	UserPortrait    UserPortraitDTO   `json:"user_portrait"`
+	TopicSummary    []TopicSummaryDTO `json:"topic_summary"`
+	ChatEvents      ChatEventsDTO     `json:"chat_events"`
+	SessionMessages []Message         `json:"session_messages"`
+	CurrentTime     string            `json:"current_time"`
+	Sections        SectionStatuses   `json:"sections"` // 各记忆块的查询状态
+}
+
+// QueryBatchItem 批量查询中的单个会话，session_id 为空时根据 group/user/role 生成
+type QueryBatchItem struct {
+	QueryRequest
+	UserID  string `json:"user_id,omitempty"`
+	RoleID  string `json:"role_id,omitempty"`
+	GroupID string `json:"group_id,omitempty"`
+}
+
+// QueryBatchRequest /memory/query:batch 请求体
+type QueryBatchRequest struct {
+	Sessions []QueryBatchItem `json:"sessions"`
+}
+
+// QueryBatchResult 批量查询中单个会话的结果，code/msg 含义与 /memory/query 相同
+type QueryBatchResult struct {
+	SessionID string     `json:"session_id"`
+	Code      int        `json:"code"`
+	Msg       string     `json:"msg"`
+	Data      *QueryData `json:"data,omitempty"`
 }
 
 // 关键事件查询接口返回数据结构体
@@ -82,8 +118,9 @@ type SessionMessagesDTO struct {
 
 // 话题归纳查询响应结构体
 type TopicSummaryRaw struct {
-	Topic   string `json:"topic"`
-	Content string `json:"content"`
+	Topic   string  `json:"topic"`
+	Content string  `json:"content"`
+	Score   float64 `json:"score,omitempty"` // 检索得分，apply 裁剪时优先保留得分高的话题
 	// Keywords, ID 等字段可省略
 }
 
@@ -123,6 +160,11 @@ type ApplyRequest struct {
 	GroupID    string `json:"group_id,omitempty"`
 	RolePrompt string `json:"role_prompt"` // 角色设定提示词
 	Query      string `json:"query"`  // 可选，可为空
+	TemplateID string `json:"template_id,omitempty"` // 可选，为空时使用角色默认模板
+	Version    int    `json:"version,omitempty"`     // 可选，模板版本，为空时使用最新版本
+	ContextBudget                                     // 可选，max_tokens 及各记忆块的 token 预算
+	SectionOptions                                    // 可选，strict / fallback
+	NoCache    bool   `json:"no_cache,omitempty"`    // 可选，跳过 apply 缓存
 }
 
 // 响应体结构
@@ -133,8 +175,33 @@ type ApplyResponse struct {
 }
 
 type ApplyData struct {
-	SystemPrompt string    `json:"system_prompt"` // 不加json，直接使用字段名作为json的key
-	Messages     []Message `json:"messages"`      // json key : messages
+	SystemPrompt    string          `json:"system_prompt"`    // 不加json，直接使用字段名作为json的key
+	Messages        []Message       `json:"messages"`         // json key : messages
+	TemplateID      string          `json:"template_id"`      // 实际使用的模板
+	TemplateVersion int             `json:"template_version"` // 实际使用的模板版本，内置模板为 0
+	Usage           ContextUsage    `json:"usage"`            // 各记忆块的 token 用量
+	Sections        SectionStatuses `json:"sections"`         // 各记忆块的查询状态
+	Cached          bool            `json:"cached"`           // 是否来自 apply 缓存
+}
+
+// ApplyBatchRequest /memory/apply:batch 请求体，每个会话的参数与 /memory/apply 相同
+type ApplyBatchRequest struct {
+	Sessions []ApplyRequest `json:"sessions"`
+}
+
+// ApplyBatchResult 批量 apply 中单个会话的结果，code/msg 含义与 /memory/apply 相同
+type ApplyBatchResult struct {
+	SessionID string     `json:"session_id"`
+	Code      int        `json:"code"`
+	Msg       string     `json:"msg"`
+	Data      *ApplyData `json:"data,omitempty"`
+}
+
+// BatchResponse 批量接口响应，results 与请求中 sessions 的顺序一致
+type BatchResponse struct {
+	Code int         `json:"code"`
+	Msg  string      `json:"msg"`
+	Data interface{} `json:"data"`
 }
 
 // -------------------------   delete 接口 -------------------------------------
@@ -156,3 +223,18 @@ type DeleteResult struct {
 	Success     bool   `json:"success"`
 	Message     string `json:"message"`
 }
+
+// -------------------------   task 接口 -------------------------------------
+
+// TaskStatusResponse 任务状态接口响应
+type TaskStatusResponse struct {
+	Code int         `json:"code"`
+	Msg  string      `json:"msg"`
+	Data interface{} `json:"data"`
+}
+
+// MemoryTaskStatus 主任务状态及其触发的下游任务状态，Tasks 以服务名为 key
+type MemoryTaskStatus struct {
+	*TaskStatus
+	Tasks map[string]client.TaskStatus `json:"tasks"`
+}
@@ -0,0 +1,288 @@
+package server
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"remember/prompt"
+)
+
+// --------------------- apply 上下文预算：按优先级裁剪各记忆块，使 system_prompt + messages 不超过 max_tokens -----------------------------
+//
+// 模板文本、role_prompt、current_time 不裁剪，先从 max_tokens 中扣除；剩余预算按以下顺序分配：
+//   1. 设置了单独预算的记忆块，各自不超过自己的预算
+//   2. 其余记忆块按 messages → topic_summary → user_portrait → chat_events 的优先级依次使用剩余预算
+// 各记忆块的裁剪策略：
+//   - messages：保留最新的消息
+//   - topic_summary：保留得分最高的话题（得分相同时保留较新的），按原顺序展示
+//   - user_portrait：先压缩为每个字段一行，仍超出时按字段名顺序保留能放下的字段
+//   - chat_events：优先保留待办事件，其次保留最近完成的事件
+
+// 记忆块名称，messages 不属于模板占位符，只用于预算和用量统计
+const (
+	SectionMessages = "messages"
+	SectionTemplate = "template" // 模板本身及不裁剪的 role_prompt、current_time
+)
+
+// messageOverhead 每条消息的角色、分隔符等额外开销
+const messageOverhead = 4
+
+// ContextBudget apply 的 token 预算，0 表示不限制
+type ContextBudget struct {
+	MaxTokens int            `json:"max_tokens,omitempty"` // system_prompt + messages 的总预算
+	Sections  map[string]int `json:"budgets,omitempty"`    // 单个记忆块的预算，key 为 messages / topic_summary / user_portrait / chat_events
+}
+
+// SectionUsage 单个记忆块的用量
+type SectionUsage struct {
+	Tokens    int  `json:"tokens"`    // 使用的 token 数
+	Kept      int  `json:"kept"`      // 保留的条目数（消息、话题、画像字段、事件）
+	Total     int  `json:"total"`     // 原有的条目数
+	Truncated bool `json:"truncated"` // 是否被裁剪
+}
+
+// ContextUsage apply 的 token 用量
+type ContextUsage struct {
+	MaxTokens    int                     `json:"max_tokens"`    // 请求的总预算，0 表示不限制
+	SystemPrompt int                     `json:"system_prompt"` // 最终 system_prompt 的 token 数
+	Total        int                     `json:"total"`         // system_prompt + messages
+	Sections     map[string]SectionUsage `json:"sections"`
+}
+
+// contextSources apply 查询到的原始记忆
+type contextSources struct {
+	rolePrompt  string
+	currentTime string
+	topics      TopicSummaryResult
+	portrait    UserPortraitDTO
+	events      ChatEventsDTO
+	messages    []Message
+}
+
+// packContext 按预算裁剪各记忆块，返回模板变量、保留的消息及各记忆块用量
+func packContext(tk Tokenizer, tpl *PromptTemplate, src contextSources, budget ContextBudget) (prompt.Vars, []Message, ContextUsage) {
+	usage := ContextUsage{MaxTokens: budget.MaxTokens, Sections: make(map[string]SectionUsage)}
+
+	// 不裁剪的部分
+	vars := prompt.Vars{}
+	if tpl.Uses(BlockRolePrompt) {
+		vars[BlockRolePrompt] = src.rolePrompt
+	}
+	if tpl.Uses(BlockCurrentTime) {
+		vars[BlockCurrentTime] = src.currentTime
+	}
+	fixed := tk.Count(fixedTemplateText(tpl, vars))
+	usage.Sections[SectionTemplate] = SectionUsage{Tokens: fixed, Kept: 1, Total: 1}
+
+	// 参与裁剪的记忆块，按优先级排列，设置了单独预算的排在前面
+	sections := []string{SectionMessages}
+	for _, block := range []string{BlockTopicSummary, BlockUserPortrait, BlockChatEvents} {
+		if tpl.Uses(block) {
+			sections = append(sections, block)
+		}
+	}
+	sort.SliceStable(sections, func(i, j int) bool {
+		return budget.Sections[sections[i]] > 0 && budget.Sections[sections[j]] <= 0
+	})
+
+	remaining := budget.MaxTokens - fixed
+	var messages []Message
+	for _, section := range sections {
+		limit := -1 // 不限制
+		if own := budget.Sections[section]; own > 0 {
+			limit = own
+		}
+		if budget.MaxTokens > 0 && (limit < 0 || limit > remaining) {
+			limit = max(remaining, 0)
+		}
+
+		var u SectionUsage
+		switch section {
+		case SectionMessages:
+			messages, u = packMessages(tk, src.messages, limit)
+		case BlockTopicSummary:
+			var kept TopicSummaryResult
+			vars[section], kept, u = packTopics(tk, src.topics, limit)
+			vars[VarTopics], vars[VarActiveTopics] = kept.Data, kept.TopicList
+		case BlockUserPortrait:
+			vars[section], vars[VarPortrait], u = packPortrait(tk, src.portrait, limit)
+		case BlockChatEvents:
+			vars[section], vars[VarEvents], u = packEvents(tk, src.events, limit)
+		}
+		usage.Sections[section] = u
+		remaining -= u.Tokens
+	}
+	return vars, messages, usage
+}
+
+// fixedTemplateText 模板中不参与裁剪的部分。记忆块文本用一个空格占位，使 {{if .chat_events}} 等条件段落的标题计入固定部分
+func fixedTemplateText(tpl *PromptTemplate, vars prompt.Vars) string {
+	fixed := prompt.Vars{
+		VarTopics:       TopicSummaryData{},
+		VarActiveTopics: []string{},
+		VarPortrait:     UserPortraitDTO{},
+		VarEvents:       ChatEventsDTO{},
+	}
+	for name, value := range vars {
+		fixed[name] = value
+	}
+	for _, block := range []string{BlockTopicSummary, BlockUserPortrait, BlockChatEvents} {
+		fixed[block] = " "
+	}
+	text, err := (&MemoryTemplate{Template: tpl.Content, StaticVars: MemoryStaticVars}).BuildPrompt(fixed)
+	if err != nil {
+		return tpl.Content
+	}
+	return text
+}
+
+// fits limit < 0 表示不限制
+func fits(tokens, limit int) bool {
+	return limit < 0 || tokens <= limit
+}
+
+// packMessages 从最新的消息开始保留，保证保留的是连续的最近若干条
+func packMessages(tk Tokenizer, messages []Message, limit int) ([]Message, SectionUsage) {
+	used, start := 0, len(messages)
+	for i := len(messages) - 1; i >= 0; i-- {
+		n := tk.Count(messages[i].Content) + messageOverhead
+		if !fits(used+n, limit) {
+			break
+		}
+		used += n
+		start = i
+	}
+
+	kept := messages[start:]
+	return kept, SectionUsage{Tokens: used, Kept: len(kept), Total: len(messages), Truncated: start > 0}
+}
+
+// packTopics 保留得分最高的话题，得分相同时保留较新的（列表中靠后的）
+func packTopics(tk Tokenizer, topics TopicSummaryResult, limit int) (string, TopicSummaryResult, SectionUsage) {
+	full := buildTopicSummaryText(topics)
+	total := len(topics.Data)
+	if n := tk.Count(full); fits(n, limit) {
+		return full, topics, SectionUsage{Tokens: n, Kept: total, Total: total}
+	}
+
+	order := make([]int, total)
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		if topics.Data[order[a]].Score != topics.Data[order[b]].Score {
+			return topics.Data[order[a]].Score > topics.Data[order[b]].Score
+		}
+		return order[a] > order[b]
+	})
+
+	keep := make(map[int]bool)
+	subset := func() TopicSummaryResult {
+		data := make(TopicSummaryData, 0, len(keep))
+		for i, t := range topics.Data {
+			if keep[i] {
+				data = append(data, t)
+			}
+		}
+		return TopicSummaryResult{TopicList: topics.TopicList, Data: data}
+	}
+	kept := subset()
+	text := buildTopicSummaryText(kept)
+	if !fits(tk.Count(text), limit) {
+		return "", TopicSummaryResult{}, SectionUsage{Total: total, Truncated: true}
+	}
+	for _, i := range order {
+		keep[i] = true
+		candidate := subset()
+		candidateText := buildTopicSummaryText(candidate)
+		if !fits(tk.Count(candidateText), limit) {
+			delete(keep, i) // 放不下就跳过，尝试更短的话题
+			continue
+		}
+		kept, text = candidate, candidateText
+	}
+	return text, kept, SectionUsage{Tokens: tk.Count(text), Kept: len(keep), Total: total, Truncated: true}
+}
+
+// packPortrait 先尝试完整画像，超出时压缩为每个字段一行，仍超出时按字段名顺序保留能放下的字段
+func packPortrait(tk Tokenizer, portrait UserPortraitDTO, limit int) (string, UserPortraitDTO, SectionUsage) {
+	full := buildUserPortraitText(portrait, "  ")
+	total := len(portrait)
+	if n := tk.Count(full); fits(n, limit) {
+		return full, portrait, SectionUsage{Tokens: n, Kept: total, Total: total}
+	}
+
+	keys := make([]string, 0, total)
+	for k := range portrait {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	lines, used, kept := []string{}, 0, UserPortraitDTO{}
+	for _, k := range keys {
+		line := fmt.Sprintf("- %s: %s", k, compactValue(portrait[k]))
+		n := tk.Count(line) + 1 // 换行
+		if !fits(used+n, limit) {
+			continue
+		}
+		lines = append(lines, line)
+		used += n
+		kept[k] = portrait[k]
+	}
+	text := strings.Join(lines, "\n")
+	return text, kept, SectionUsage{Tokens: tk.Count(text), Kept: len(lines), Total: total, Truncated: true}
+}
+
+// compactValue 将画像字段压缩为一行：嵌套字段展开为 key=value，列表用逗号连接
+func compactValue(v interface{}) string {
+	switch val := v.(type) {
+	case map[string]interface{}:
+		keys := make([]string, 0, len(val))
+		for k := range val {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		parts := make([]string, 0, len(keys))
+		for _, k := range keys {
+			parts = append(parts, k+"="+compactValue(val[k]))
+		}
+		return strings.Join(parts, "; ")
+	case []interface{}:
+		parts := make([]string, 0, len(val))
+		for _, item := range val {
+			parts = append(parts, compactValue(item))
+		}
+		return strings.Join(parts, ", ")
+	default:
+		return fmt.Sprint(val)
+	}
+}
+
+// packEvents 优先保留待办事件，其次保留最近完成的事件
+func packEvents(tk Tokenizer, events ChatEventsDTO, limit int) (string, ChatEventsDTO, SectionUsage) {
+	full := buildChatEventsText(events)
+	total := len(events.Todo) + len(events.Completed)
+	if n := tk.Count(full); fits(n, limit) {
+		return full, events, SectionUsage{Tokens: n, Kept: total, Total: total}
+	}
+
+	kept := ChatEventsDTO{}
+	text := ""
+	try := func(next ChatEventsDTO) bool {
+		candidate := buildChatEventsText(next)
+		if !fits(tk.Count(candidate), limit) {
+			return false
+		}
+		kept, text = next, candidate
+		return true
+	}
+	for _, e := range events.Todo {
+		try(ChatEventsDTO{Todo: append(append([]string{}, kept.Todo...), e), Completed: kept.Completed})
+	}
+	for i := len(events.Completed) - 1; i >= 0; i-- {
+		// 保持完成事件的时间顺序
+		try(ChatEventsDTO{Todo: kept.Todo, Completed: append([]string{events.Completed[i]}, kept.Completed...)})
+	}
+	return text, kept, SectionUsage{Tokens: tk.Count(text), Kept: len(kept.Todo) + len(kept.Completed), Total: total, Truncated: true}
+}
@@ -0,0 +1,265 @@
+package server
+
+import (
+	"reflect"
+	"testing"
+	"unicode/utf8"
+)
+
+// runeTokenizer 每个字符一个 token，便于计算预期结果
+type runeTokenizer struct{}
+
+func (runeTokenizer) Count(text string) int { return utf8.RuneCountInString(text) }
+
+func TestPackMessages(t *testing.T) {
+	messages := []Message{
+		{Role: "user", Content: "aaaa"},    // 4 + 4
+		{Role: "assistant", Content: "bb"}, // 2 + 4
+		{Role: "user", Content: "cccccc"},  // 6 + 4
+	}
+	tests := []struct {
+		name      string
+		messages  []Message
+		limit     int
+		kept      []Message
+		tokens    int
+		truncated bool
+	}{
+		{"unlimited", messages, -1, messages, 24, false},
+		{"exact", messages, 24, messages, 24, false},
+		{"latest two", messages, 16, messages[1:], 16, true},
+		{"stop at first overflow", messages, 15, messages[2:], 10, true},
+		{"nothing fits", messages, 9, []Message{}, 0, true},
+		{"zero", messages, 0, []Message{}, 0, true},
+		{"empty", nil, 10, []Message{}, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			kept, u := packMessages(runeTokenizer{}, tt.messages, tt.limit)
+			if len(kept) != len(tt.kept) || (len(kept) > 0 && !reflect.DeepEqual(kept, tt.kept)) {
+				t.Errorf("kept = %v, want %v", kept, tt.kept)
+			}
+			want := SectionUsage{Tokens: tt.tokens, Kept: len(tt.kept), Total: len(tt.messages), Truncated: tt.truncated}
+			if u != want {
+				t.Errorf("usage = %+v, want %+v", u, want)
+			}
+		})
+	}
+}
+
+func TestPackTopics(t *testing.T) {
+	tk := runeTokenizer{}
+	topics := TopicSummaryResult{
+		TopicList: []string{"t"},
+		Data: TopicSummaryData{
+			{Topic: "A", Content: "aaaa", Score: 1},
+			{Topic: "B", Content: "bbbb", Score: 3},
+			{Topic: "C", Content: "cccc", Score: 2},
+			{Topic: "D", Content: "dddd", Score: 3},
+		},
+	}
+	subset := func(idx ...int) TopicSummaryResult {
+		r := TopicSummaryResult{TopicList: topics.TopicList, Data: TopicSummaryData{}}
+		for _, i := range idx {
+			r.Data = append(r.Data, topics.Data[i])
+		}
+		return r
+	}
+	count := func(r TopicSummaryResult) int { return tk.Count(buildTopicSummaryText(r)) }
+
+	tests := []struct {
+		name      string
+		limit     int
+		kept      TopicSummaryResult
+		truncated bool
+	}{
+		{"unlimited", -1, topics, false},
+		{"fits", count(topics), topics, false},
+		// 得分 3 的 B、D 优先，按原顺序展示
+		{"highest scores", count(subset(1, 3)), subset(1, 3), true},
+		// 得分相同时保留较新的 D
+		{"tie keeps newer", count(subset(3)), subset(3), true},
+		{"header only", count(subset()), subset(), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			text, kept, u := packTopics(tk, topics, tt.limit)
+			if !reflect.DeepEqual(kept, tt.kept) {
+				t.Errorf("kept = %+v, want %+v", kept, tt.kept)
+			}
+			if text != buildTopicSummaryText(tt.kept) {
+				t.Errorf("text = %q", text)
+			}
+			want := SectionUsage{Tokens: tk.Count(text), Kept: len(tt.kept.Data), Total: len(topics.Data), Truncated: tt.truncated}
+			if u != want {
+				t.Errorf("usage = %+v, want %+v", u, want)
+			}
+		})
+	}
+
+	// 连标题都放不下时不输出
+	text, kept, u := packTopics(tk, topics, count(subset())-1)
+	if text != "" || len(kept.Data) != 0 || u != (SectionUsage{Total: 4, Truncated: true}) {
+		t.Errorf("too small: text=%q kept=%+v usage=%+v", text, kept, u)
+	}
+}
+
+func TestPackPortrait(t *testing.T) {
+	tk := runeTokenizer{}
+	portrait := UserPortraitDTO{
+		"a": "1",
+		"b": map[string]interface{}{"x": "yyyyyyyyyy"},
+		"c": []interface{}{"p", "q"},
+	}
+
+	text, kept, u := packPortrait(tk, portrait, -1)
+	if !reflect.DeepEqual(kept, portrait) || u.Truncated || u.Kept != 3 || u.Tokens != tk.Count(text) {
+		t.Errorf("unlimited: kept=%v usage=%+v", kept, u)
+	}
+
+	// 压缩后 "- a: 1"(6+1)、"- b: x=yyyyyyyyyy"(17+1)、"- c: p, q"(9+1)，b 放不下时跳过
+	text, kept, u = packPortrait(tk, portrait, 17)
+	if want := "- a: 1\n- c: p, q"; text != want {
+		t.Errorf("text = %q, want %q", text, want)
+	}
+	if want := (UserPortraitDTO{"a": "1", "c": portrait["c"]}); !reflect.DeepEqual(kept, want) {
+		t.Errorf("kept = %v, want %v", kept, want)
+	}
+	if want := (SectionUsage{Tokens: 16, Kept: 2, Total: 3, Truncated: true}); u != want {
+		t.Errorf("usage = %+v, want %+v", u, want)
+	}
+
+	text, kept, u = packPortrait(tk, portrait, 0)
+	if text != "" || len(kept) != 0 || u != (SectionUsage{Total: 3, Truncated: true}) {
+		t.Errorf("zero: text=%q kept=%v usage=%+v", text, kept, u)
+	}
+}
+
+func TestCompactValue(t *testing.T) {
+	tests := []struct {
+		value interface{}
+		want  string
+	}{
+		{"x", "x"},
+		{3.5, "3.5"},
+		{[]interface{}{"a", "b"}, "a, b"},
+		{map[string]interface{}{"b": "2", "a": "1"}, "a=1; b=2"},
+		{map[string]interface{}{"k": []interface{}{"x", "y"}}, "k=x, y"},
+	}
+	for _, tt := range tests {
+		if got := compactValue(tt.value); got != tt.want {
+			t.Errorf("compactValue(%v) = %q, want %q", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestPackEvents(t *testing.T) {
+	tk := runeTokenizer{}
+	events := ChatEventsDTO{Todo: []string{"t1", "t2"}, Completed: []string{"c1", "c2", "c3"}}
+	count := func(e ChatEventsDTO) int { return tk.Count(buildChatEventsText(e)) }
+
+	tests := []struct {
+		name string
+		kept ChatEventsDTO
+	}{
+		{"todo and latest completed", ChatEventsDTO{Todo: []string{"t1", "t2"}, Completed: []string{"c3"}}},
+		{"completed in order", ChatEventsDTO{Todo: []string{"t1", "t2"}, Completed: []string{"c2", "c3"}}},
+		{"todo first", ChatEventsDTO{Todo: []string{"t1"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			text, kept, u := packEvents(tk, events, count(tt.kept))
+			if !reflect.DeepEqual(kept, tt.kept) {
+				t.Errorf("kept = %+v, want %+v", kept, tt.kept)
+			}
+			want := SectionUsage{Tokens: tk.Count(text), Kept: len(tt.kept.Todo) + len(tt.kept.Completed), Total: 5, Truncated: true}
+			if u != want {
+				t.Errorf("usage = %+v, want %+v", u, want)
+			}
+		})
+	}
+
+	if _, kept, u := packEvents(tk, events, -1); !reflect.DeepEqual(kept, events) || u.Truncated {
+		t.Errorf("unlimited: kept=%+v usage=%+v", kept, u)
+	}
+}
+
+func TestPackContext(t *testing.T) {
+	tk := runeTokenizer{}
+	tpl := &PromptTemplate{
+		Content: "Role: {{.role_prompt}}\n{{.topic_summary}}\n{{.chat_events}}",
+		Blocks:  []string{BlockRolePrompt, BlockTopicSummary, BlockChatEvents},
+	}
+	src := contextSources{
+		rolePrompt: "helper",
+		topics: TopicSummaryResult{
+			TopicList: []string{"t"},
+			Data:      TopicSummaryData{{Topic: "A", Content: "aaaa", Score: 1}},
+		},
+		events:   ChatEventsDTO{Todo: []string{"t1"}, Completed: []string{"c1"}},
+		messages: []Message{{Role: "user", Content: "hello"}, {Role: "assistant", Content: "hi"}},
+	}
+	fixed := tk.Count(fixedTemplateText(tpl, map[string]interface{}{BlockRolePrompt: src.rolePrompt}))
+	messageTokens := 5 + 4 + 2 + 4
+	eventTokens := tk.Count(buildChatEventsText(src.events))
+
+	total := func(u ContextUsage) int {
+		n := 0
+		for _, s := range u.Sections {
+			n += s.Tokens
+		}
+		return n
+	}
+
+	t.Run("unlimited", func(t *testing.T) {
+		vars, messages, u := packContext(tk, tpl, src, ContextBudget{})
+		if len(messages) != 2 || vars[BlockTopicSummary] != buildTopicSummaryText(src.topics) || vars[BlockChatEvents] != buildChatEventsText(src.events) {
+			t.Errorf("vars=%v messages=%v", vars, messages)
+		}
+		for name, s := range u.Sections {
+			if s.Truncated {
+				t.Errorf("section %s truncated", name)
+			}
+		}
+		if _, ok := u.Sections[BlockUserPortrait]; ok {
+			t.Errorf("unused block %s packed", BlockUserPortrait)
+		}
+	})
+
+	t.Run("messages first", func(t *testing.T) {
+		budget := ContextBudget{MaxTokens: fixed + messageTokens}
+		_, messages, u := packContext(tk, tpl, src, budget)
+		if len(messages) != 2 {
+			t.Errorf("messages = %v", messages)
+		}
+		if u.Sections[BlockTopicSummary].Tokens != 0 || u.Sections[BlockChatEvents].Tokens != 0 {
+			t.Errorf("usage = %+v", u.Sections)
+		}
+		if total(u) > budget.MaxTokens {
+			t.Errorf("total %d > max_tokens %d", total(u), budget.MaxTokens)
+		}
+	})
+
+	t.Run("own budget first", func(t *testing.T) {
+		budget := ContextBudget{MaxTokens: fixed + eventTokens + 6, Sections: map[string]int{BlockChatEvents: eventTokens}}
+		vars, messages, u := packContext(tk, tpl, src, budget)
+		if vars[BlockChatEvents] != buildChatEventsText(src.events) {
+			t.Errorf("chat_events = %q", vars[BlockChatEvents])
+		}
+		// 剩余预算只够最新的一条消息
+		if len(messages) != 1 || messages[0].Content != "hi" {
+			t.Errorf("messages = %v", messages)
+		}
+		if total(u) > budget.MaxTokens {
+			t.Errorf("total %d > max_tokens %d", total(u), budget.MaxTokens)
+		}
+	})
+
+	t.Run("section budget caps", func(t *testing.T) {
+		budget := ContextBudget{Sections: map[string]int{SectionMessages: 6}}
+		_, messages, u := packContext(tk, tpl, src, budget)
+		if len(messages) != 1 || u.Sections[SectionMessages].Tokens > 6 {
+			t.Errorf("messages=%v usage=%+v", messages, u.Sections[SectionMessages])
+		}
+	})
+}
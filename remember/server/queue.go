@@ -3,24 +3,73 @@ package server
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
 	"time"
 
+	"remember/client"
+
 	"github.com/redis/go-redis/v9"
 )
 
+// ---------------------------------------------------------------------------------------------
+// 队列基于 Redis Stream + 消费者组，并按 session_id 分区：
+//   - 同一 session 的任务固定写入同一个分区 Stream（QUEUE_NAME:{0..QueuePartitions-1}）
+//   - Worker 领取消息前先抢占分区租约（SET NX，有效期 ClaimIdle 秒），同一时刻每个分区只有一个 Worker 在处理，
+//     因此同一 session 的任务按入队顺序串行执行，不同分区之间仍然并行
+//   - 持有租约期间每 ClaimIdle/3 秒续期一次，任务执行时间超过 ClaimIdle 也不会被其他 Worker 接手
+//   - Dequeue 通过 XREADGROUP 领取消息，消息进入 pending 列表，处理成功后必须调用 Ack，Ack 同时释放租约；
+//     Ack 前校验租约仍属于自己，租约已丢失时不 ACK（消息已由新的持有者接手）
+//   - Worker 崩溃或未 ACK 时租约在 ClaimIdle 秒后过期，pending 消息空闲超过 ClaimIdle 秒后由下一个拿到租约的 Worker 通过 XAUTOCLAIM 接手；
+//     分区中有未到期的 pending 消息时不读取新消息
+//   - 失败需要重试的任务从 Stream 中 ACK 删除，写入分区重试闸门（Hash，field 为 session_id）中该 session 的队首后释放租约；
+//     闸门存在期间读到的同一 session 的任务依次移入闸门，同分区其他 session 的任务照常领取；
+//     队首到期后先交付闸门中的任务，ACK 后交付下一个，全部完成后删除闸门，因此重试不会被同一 session 后入队的任务超过
+//     （重试间隔见 RetryDelay）
+//   - 启动时会把旧版 List 队列及未分区的单个 Stream 中的任务迁移到分区，并把旧版整个分区等待的闸门转换为按 session 的闸门
+// ---------------------------------------------------------------------------------------------
+
 // QueueMessage 队列消息结构
 type QueueMessage struct {
-	TaskID    string    `json:"task_id"`
-	SessionID string    `json:"session_id"`
-	Messages  []Message `json:"messages"`
-	Timestamp int64     `json:"timestamp"`
-	Retry     int       `json:"retry"`
+	TaskID    string        `json:"task_id" bson:"task_id"`
+	SessionID string        `json:"session_id" bson:"session_id"`
+	RoleID    string        `json:"role_id,omitempty" bson:"role_id,omitempty"`   // 用于选择任务触发频次
+	GroupID   string        `json:"group_id,omitempty" bson:"group_id,omitempty"` // 用于选择任务触发频次
+	UserID    string        `json:"user_id,omitempty" bson:"user_id,omitempty"`   // 计数时补登会话记录
+	Messages  []Message     `json:"messages" bson:"messages"`
+	Timestamp int64         `json:"timestamp" bson:"timestamp"`
+	Retry     int           `json:"retry" bson:"retry"`
+	History   []RetryRecord `json:"history,omitempty" bson:"history,omitempty"` // 每次失败的记录
+	Flush     bool          `json:"flush,omitempty" bson:"flush,omitempty"`     // 补齐任务：不上传消息，触发所有抽取任务
+
+	// 抽取任务：执行主服务内的抽取器，Claimed 为以 ClaimID 认领的消息
+	Extractor string                 `json:"extractor,omitempty" bson:"extractor,omitempty"`
+	ClaimID   string                 `json:"claim_id,omitempty" bson:"claim_id,omitempty"`
+	Claimed   []client.StoredMessage `json:"claimed,omitempty" bson:"claimed,omitempty"`
+
+	StreamID  string `json:"-" bson:"-"` // Redis Stream 消息ID，Ack 时使用；从重试闸门交付的任务为空
+	Partition int    `json:"-" bson:"-"` // 所在分区
+	Lease     string `json:"-" bson:"-"` // 分区租约令牌，Ack 时释放
+
+	gated     bool               // 从重试闸门交付，Ack 时从闸门中移除
+	stopRenew context.CancelFunc // 停止租约续期
 }
 
 // QueueClient 封装队列操作
 type QueueClient struct {
 	RedisClient *redis.Client
-	QueueName   string
+	QueueName   string // 分区 Stream key 前缀
+	RetryName   string // 旧版延迟重试 Sorted Set key，只迁移升级前写入的任务
+	Group       string // 消费者组
+	Consumer    string // 当前进程的消费者名
+	Partitions  int    // 分区数
+
+	next atomic.Uint32 // Dequeue 轮询分区的起点，避免所有 Worker 从同一个分区开始抢
 }
 
 var MessageQueue *QueueClient
@@ -28,6 +77,14 @@ var MessageQueue *QueueClient
 func init() {
 	MessageQueue = NewQueueClient()
 
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := MessageQueue.ensureGroup(ctx); err != nil {
+		Error("%s create consumer group failed: %v", SERVER_NAME, err)
+	}
+	if err := MessageQueue.migrateLegacy(ctx); err != nil {
+		Error("%s migrate legacy queue failed: %v", SERVER_NAME, err)
+	}
 }
 
 // NewQueueClient 创建 QueueClient
@@ -35,7 +92,220 @@ func NewQueueClient() *QueueClient {
 	return &QueueClient{
 		RedisClient: RedisClient,
 		QueueName:   QUEUE_NAME,
+		RetryName:   QUEUE_NAME + ":retry",
+		Group:       QUEUE_GROUP,
+		Consumer:    consumerName(),
+		Partitions:  QueuePartitions,
+	}
+}
+
+// consumerName 生成当前进程的消费者名：hostname-pid-随机串
+func consumerName() string {
+	host, err := os.Hostname()
+	if err != nil || host == "" {
+		host = "unknown"
+	}
+	return fmt.Sprintf("%s-%d-%s", host, os.Getpid(), GenerateUUID()[:8])
+}
+
+// partitionOf 计算 session 所属分区
+func (q *QueueClient) partitionOf(sessionID string) int {
+	h := fnv.New32a()
+	h.Write([]byte(sessionID))
+	return int(h.Sum32() % uint32(q.Partitions))
+}
+
+// gateKey 分区重试闸门 key
+func (q *QueueClient) gateKey(partition int) string {
+	return fmt.Sprintf("%s:gates:%d", q.QueueName, partition)
+}
+
+// sessionGate 重试闸门中一个 session 的任务（原始 JSON）：队首是等待重试的任务，其后是等待期间读到的同 session 任务；
+// Due 为队首的交付时间（毫秒）
+type sessionGate struct {
+	Due   int64    `json:"due"`
+	Tasks []string `json:"tasks"`
+}
+
+// streamKey 分区 Stream key
+func (q *QueueClient) streamKey(partition int) string {
+	return fmt.Sprintf("%s:%d", q.QueueName, partition)
+}
+
+// leaseKey 分区租约 key
+func (q *QueueClient) leaseKey(partition int) string {
+	return fmt.Sprintf("%s:lease:%d", q.QueueName, partition)
+}
+
+// ensureGroup 为每个分区创建消费者组（已存在时忽略）
+func (q *QueueClient) ensureGroup(ctx context.Context) error {
+	for p := 0; p < q.Partitions; p++ {
+		err := q.RedisClient.XGroupCreateMkStream(ctx, q.streamKey(p), q.Group, "0").Err()
+		if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+			return err
+		}
+	}
+	return nil
+}
+
+// migrateLegacy 将旧版 List 队列和未分区的 Stream 中的任务迁移到分区
+// 旧 key 先 RENAMENX 到 :legacy，再逐条写入分区成功后删除，进程中途退出时下次启动会继续迁移（最多重复一条，不会丢失）；
+// 迁移期间持有 :migrating 锁，多个进程同时启动时只有一个进程执行迁移
+func (q *QueueClient) migrateLegacy(ctx context.Context) error {
+	lock := q.QueueName + ":migrating"
+	ok, err := q.RedisClient.SetNX(ctx, lock, q.Consumer, ClaimIdle*time.Second).Result()
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return nil // 其他进程正在迁移
+	}
+	defer q.RedisClient.Del(context.Background(), lock)
+
+	if err := q.migrateGates(ctx); err != nil {
+		return err
+	}
+
+	legacy := q.QueueName + ":legacy"
+	// 上次未迁移完的数据
+	if err := q.drainLegacy(ctx, legacy); err != nil {
+		return err
+	}
+
+	keyType, err := q.RedisClient.Type(ctx, q.QueueName).Result()
+	if err != nil {
+		return err
+	}
+	if keyType != "list" && keyType != "stream" {
+		return nil
+	}
+	if err := q.RedisClient.RenameNX(ctx, q.QueueName, legacy).Err(); err != nil {
+		return fmt.Errorf("rename %s failed: %w", q.QueueName, err)
+	}
+	return q.drainLegacy(ctx, legacy)
+}
+
+// drainLegacy 将 :legacy 中的任务按 session 写入分区
+func (q *QueueClient) drainLegacy(ctx context.Context, legacy string) error {
+	keyType, err := q.RedisClient.Type(ctx, legacy).Result()
+	if err != nil {
+		return err
+	}
+
+	migrated := 0
+	switch keyType {
+	case "list":
+		for {
+			raw, err := q.RedisClient.LIndex(ctx, legacy, 0).Result()
+			if err == redis.Nil {
+				break
+			}
+			if err != nil {
+				return err
+			}
+			if err := q.addRaw(ctx, raw); err != nil {
+				return err
+			}
+			if err := q.RedisClient.LPop(ctx, legacy).Err(); err != nil {
+				return err
+			}
+			migrated++
+		}
+	case "stream":
+		for {
+			entries, err := q.RedisClient.XRangeN(ctx, legacy, "-", "+", 100).Result()
+			if err != nil {
+				return err
+			}
+			if len(entries) == 0 {
+				break
+			}
+			for _, entry := range entries {
+				raw, _ := entry.Values["data"].(string)
+				if err := q.addRaw(ctx, raw); err != nil {
+					return err
+				}
+				if err := q.RedisClient.XDel(ctx, legacy, entry.ID).Err(); err != nil {
+					return err
+				}
+				migrated++
+			}
+		}
+		// 删除空 Stream 及其消费者组
+		if err := q.RedisClient.Del(ctx, legacy).Err(); err != nil {
+			return err
+		}
+	default:
+		return nil
+	}
+
+	if migrated > 0 {
+		Info("%s migrated %d tasks from %s %s to partitions", SERVER_NAME, migrated, keyType, legacy)
+	}
+	return nil
+}
+
+// addRaw 将旧队列中的原始消息写入所属分区，无法解析的消息写入 0 号分区，由 Worker 丢弃
+func (q *QueueClient) addRaw(ctx context.Context, raw string) error {
+	var msg QueueMessage
+	partition := 0
+	if err := json.Unmarshal([]byte(raw), &msg); err == nil {
+		partition = q.partitionOf(msg.SessionID)
 	}
+	return q.add(ctx, partition, []byte(raw))
+}
+
+// migrateGateScript 把旧版分区闸门中的任务放到该 session 闸门的队首，并从 Stream 中删除仍在 pending 中的原消息
+var migrateGateScript = redis.NewScript(`
+local raw = redis.call('HGET', KEYS[2], ARGV[1])
+local gate = {tasks = {}}
+if raw then
+	gate = cjson.decode(raw)
+end
+table.insert(gate.tasks, 1, ARGV[3])
+gate.due = tonumber(ARGV[2])
+redis.call('HSET', KEYS[2], ARGV[1], cjson.encode(gate))
+redis.call('XACK', KEYS[3], ARGV[5], ARGV[4])
+redis.call('XDEL', KEYS[3], ARGV[4])
+redis.call('DEL', KEYS[1])
+return 1
+`)
+
+// migrateGates 将旧版分区闸门（Hash：id、due、data，闸门到期前整个分区暂停领取）转换为按 session 的闸门
+func (q *QueueClient) migrateGates(ctx context.Context) error {
+	for p := 0; p < q.Partitions; p++ {
+		legacy := fmt.Sprintf("%s:gate:%d", q.QueueName, p)
+		gate, err := q.RedisClient.HGetAll(ctx, legacy).Result()
+		if err != nil {
+			return err
+		}
+		if len(gate) == 0 {
+			continue
+		}
+
+		var msg QueueMessage
+		if err := json.Unmarshal([]byte(gate["data"]), &msg); err != nil {
+			// 闸门损坏时删除闸门，原消息按 pending 消息重新领取
+			q.RedisClient.Del(ctx, legacy)
+			continue
+		}
+		due, _ := strconv.ParseInt(gate["due"], 10, 64)
+		err = migrateGateScript.Run(ctx, q.RedisClient, []string{legacy, q.gateKey(p), q.streamKey(p)},
+			msg.SessionID, due, gate["data"], gate["id"], q.Group).Err()
+		if err != nil {
+			return err
+		}
+		Info("%s migrated retry gate of partition %d, task_id=%s", SERVER_NAME, p, msg.TaskID)
+	}
+	return nil
+}
+
+// add 写入分区 Stream
+func (q *QueueClient) add(ctx context.Context, partition int, data []byte) error {
+	return q.RedisClient.XAdd(ctx, &redis.XAddArgs{
+		Stream: q.streamKey(partition),
+		Values: map[string]interface{}{"data": data},
+	}).Err()
 }
 
 // Enqueue 入队列
@@ -44,10 +314,6 @@ func (q *QueueClient) Enqueue(ctx context.Context, msg QueueMessage) (string, er
 	if msg.TaskID == "" {
 		msg.TaskID = GenerateUUID()
 	}
-	// 初始化重试次数
-	if msg.Retry == 0 {
-		msg.Retry = 0
-	}
 	// 设置时间戳
 	if msg.Timestamp == 0 {
 		msg.Timestamp = time.Now().UTC().Unix()
@@ -58,58 +324,520 @@ func (q *QueueClient) Enqueue(ctx context.Context, msg QueueMessage) (string, er
 		return msg.TaskID, err
 	}
 
-	if err := q.RedisClient.RPush(ctx, q.QueueName, data).Err(); err != nil {
+	if err := q.add(ctx, q.partitionOf(msg.SessionID), data); err != nil {
 		return msg.TaskID, err
 	}
 
 	Info("%s Enqueued message for session_id=%s, task_id=%s, retry=%d", SERVER_NAME, msg.SessionID, msg.TaskID, msg.Retry)
+	trackTask(ctx, &msg, TaskQueued, nil)
 	return msg.TaskID, nil
 }
 
-// Dequeue 出队列
+// scheduleScript 持有租约时把任务写入该 session 闸门的队首并释放租约：从闸门交付的任务（ARGV[5] 为空）替换队首，
+// 从 Stream 读取的任务插入队首并从 Stream 中 ACK 删除
+var scheduleScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) ~= ARGV[1] then
+	return 0
+end
+local raw = redis.call('HGET', KEYS[2], ARGV[2])
+local gate = {tasks = {}}
+if raw then
+	gate = cjson.decode(raw)
+end
+if ARGV[5] == '' and raw then
+	gate.tasks[1] = ARGV[4]
+else
+	table.insert(gate.tasks, 1, ARGV[4])
+end
+if ARGV[5] ~= '' then
+	redis.call('XACK', KEYS[3], ARGV[6], ARGV[5])
+	redis.call('XDEL', KEYS[3], ARGV[5])
+end
+gate.due = tonumber(ARGV[3])
+redis.call('HSET', KEYS[2], ARGV[2], cjson.encode(gate))
+redis.call('DEL', KEYS[1])
+return 1
+`)
+
+// ScheduleRetry 任务 delay 后重试：移入该 session 的重试闸门并释放租约，到期前只暂停该 session，到期后先重新交付该任务；
+// 调用后不再 Ack
+func (q *QueueClient) ScheduleRetry(ctx context.Context, msg QueueMessage, delay time.Duration) error {
+	if msg.stopRenew != nil {
+		msg.stopRenew()
+	}
+	if (msg.StreamID == "" && !msg.gated) || msg.Lease == "" {
+		return errors.New("queue message has no stream id or lease")
+	}
+	streamID, partition, lease := msg.StreamID, msg.Partition, msg.Lease
+	msg.StreamID, msg.Lease = "", ""
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	due := time.Now().Add(delay).UnixMilli()
+	keys := []string{q.leaseKey(partition), q.gateKey(partition), q.streamKey(partition)}
+	held, err := scheduleScript.Run(ctx, q.RedisClient, keys, lease, msg.SessionID, due, data, streamID, q.Group).Int()
+	if err != nil {
+		return err
+	}
+	if held == 0 {
+		return errLeaseLost
+	}
+	return nil
+}
+
+// promoteScript 原子地把一条到期的旧版重试任务移回所属分区；多个 Worker 同时提升同一条任务时只有一个会写入
+var promoteScript = redis.NewScript(`
+if redis.call('ZREM', KEYS[1], ARGV[1]) == 1 then
+	redis.call('XADD', KEYS[2], '*', 'data', ARGV[1])
+	return 1
+end
+return 0
+`)
+
+// promoteDueRetries 将旧版延迟队列（升级前写入，不再新增）中到期的任务移回所属分区
+func (q *QueueClient) promoteDueRetries(ctx context.Context) error {
+	items, err := q.RedisClient.ZRangeByScore(ctx, q.RetryName, &redis.ZRangeBy{
+		Min:   "-inf",
+		Max:   fmt.Sprint(time.Now().UnixMilli()),
+		Count: 100,
+	}).Result()
+	if err != nil {
+		return err
+	}
+
+	for _, raw := range items {
+		var msg QueueMessage
+		partition := 0
+		if err := json.Unmarshal([]byte(raw), &msg); err == nil {
+			partition = q.partitionOf(msg.SessionID)
+		}
+		if err := promoteScript.Run(ctx, q.RedisClient, []string{q.RetryName, q.streamKey(partition)}, raw).Err(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// errLeaseLost 租约已过期并被其他 Worker 抢占，消息由新的持有者处理
+var errLeaseLost = errors.New("partition lease lost")
+
+// releaseScript 只在租约仍属于自己时删除，避免误删过期后被其他 Worker 抢到的租约
+var releaseScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('DEL', KEYS[1])
+end
+return 0
+`)
+
+// renewScript 只在租约仍属于自己时续期
+var renewScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('PEXPIRE', KEYS[1], ARGV[2])
+end
+return 0
+`)
+
+// acquire 抢占分区租约，返回租约令牌；分区已被占用时返回空
+func (q *QueueClient) acquire(ctx context.Context, partition int) (string, error) {
+	token := GenerateUUID()
+	ok, err := q.RedisClient.SetNX(ctx, q.leaseKey(partition), token, ClaimIdle*time.Second).Result()
+	if err != nil || !ok {
+		return "", err
+	}
+	return token, nil
+}
+
+// release 释放分区租约
+func (q *QueueClient) release(ctx context.Context, partition int, token string) error {
+	return releaseScript.Run(ctx, q.RedisClient, []string{q.leaseKey(partition)}, token).Err()
+}
+
+// keepalive 每 ClaimIdle/3 秒续期一次租约，直到返回的 cancel 被调用或租约已丢失
+func (q *QueueClient) keepalive(partition int, token string) context.CancelFunc {
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		ticker := time.NewTicker(ClaimIdle * time.Second / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			held, err := renewScript.Run(ctx, q.RedisClient, []string{q.leaseKey(partition)}, token, ClaimIdle*1000).Int()
+			if ctx.Err() != nil {
+				return
+			}
+			if err != nil {
+				Error("%s renew lease of partition %d failed: %v", SERVER_NAME, partition, err)
+				continue
+			}
+			if held == 0 {
+				Error("%s lease of partition %d lost", SERVER_NAME, partition)
+				return
+			}
+		}
+	}()
+	return cancel
+}
+
+// Dequeue 领取一条消息：依次尝试各分区，抢到租约后优先交付重试闸门中到期的任务，其次接手上一个持有者未 ACK 的消息，最后读取新消息；
+// 所有分区都为空、被占用或只有等待重试的任务时返回 redis.Nil。返回的消息必须 Ack、ScheduleRetry 或 Release，否则租约一直续期
 func (q *QueueClient) Dequeue(ctx context.Context) (*QueueMessage, error) {
-	result, err := q.RedisClient.LPop(ctx, q.QueueName).Result()
+	if err := q.promoteDueRetries(ctx); err != nil {
+		Error("%s promote due retries failed: %v", SERVER_NAME, err)
+	}
+
+	start := int(q.next.Add(1))
+	for i := 0; i < q.Partitions; i++ {
+		partition := (start + i) % q.Partitions
+		msg, err := q.dequeuePartition(ctx, partition)
+		if err == redis.Nil {
+			continue
+		}
+		return msg, err
+	}
+	return nil, redis.Nil
+}
+
+// dequeuePartition 从指定分区领取一条消息，分区为空、被占用或只有等待重试的任务时返回 redis.Nil
+func (q *QueueClient) dequeuePartition(ctx context.Context, partition int) (*QueueMessage, error) {
+	stream := q.streamKey(partition)
+
+	// 空分区不抢租约（XLEN 包含已领取未 ACK 的消息）
+	var length, gates *redis.IntCmd
+	_, err := q.RedisClient.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		length = pipe.XLen(ctx, stream)
+		gates = pipe.HLen(ctx, q.gateKey(partition))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if length.Val() == 0 && gates.Val() == 0 {
+		return nil, redis.Nil
+	}
+
+	token, err := q.acquire(ctx, partition)
 	if err != nil {
 		return nil, err
 	}
+	if token == "" {
+		return nil, redis.Nil
+	}
 
-	var msg QueueMessage
-	if err := json.Unmarshal([]byte(result), &msg); err != nil {
+	msg, err := q.readGate(ctx, partition)
+	if err == nil && msg == nil {
+		msg, err = q.readStream(ctx, partition, token, length.Val())
+	}
+	if err != nil {
+		q.release(ctx, partition, token)
+		return nil, err
+	}
+	msg.Partition = partition
+	msg.Lease = token
+	msg.stopRenew = q.keepalive(partition, token)
+	return msg, nil
+}
+
+// readGate 读取分区的重试闸门，返回最早到期的 session 的队首任务；没有到期的闸门时返回 nil
+func (q *QueueClient) readGate(ctx context.Context, partition int) (*QueueMessage, error) {
+	gates, err := q.RedisClient.HGetAll(ctx, q.gateKey(partition)).Result()
+	if err != nil {
 		return nil, err
 	}
 
+	now := time.Now().UnixMilli()
+	var next *sessionGate
+	for sessionID, raw := range gates {
+		var gate sessionGate
+		if err := json.Unmarshal([]byte(raw), &gate); err != nil || len(gate.Tasks) == 0 {
+			Error("%s invalid retry gate of session_id=%s in partition %d: %v", SERVER_NAME, sessionID, partition, err)
+			continue
+		}
+		if gate.Due <= now && (next == nil || gate.Due < next.Due) {
+			next = &gate
+		}
+	}
+	if next == nil {
+		return nil, nil
+	}
+
+	var msg QueueMessage
+	if err := json.Unmarshal([]byte(next.Tasks[0]), &msg); err != nil {
+		return nil, fmt.Errorf("invalid task in retry gate of partition %d: %w", partition, err)
+	}
+	msg.gated = true
+	Info("%s redeliver retry %d of task_id=%s from partition %d", SERVER_NAME, msg.Retry, msg.TaskID, partition)
 	return &msg, nil
 }
 
-// Length 获取队列长度
+// holdScript 持有租约时把读到的消息追加到该 session 的重试闸门并从 Stream 中 ACK 删除；session 没有闸门时返回 2
+var holdScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) ~= ARGV[1] then
+	return 0
+end
+local raw = redis.call('HGET', KEYS[2], ARGV[2])
+if not raw then
+	return 2
+end
+local gate = cjson.decode(raw)
+table.insert(gate.tasks, ARGV[3])
+redis.call('HSET', KEYS[2], ARGV[2], cjson.encode(gate))
+redis.call('XACK', KEYS[3], ARGV[4], ARGV[5])
+redis.call('XDEL', KEYS[3], ARGV[5])
+return 1
+`)
+
+// readStream 读取分区中的下一条消息；所属 session 有重试闸门时把消息移入闸门，排在重试之后执行，继续读取下一条，
+// 最多读取 limit 条
+func (q *QueueClient) readStream(ctx context.Context, partition int, token string, limit int64) (*QueueMessage, error) {
+	stream := q.streamKey(partition)
+	keys := []string{q.leaseKey(partition), q.gateKey(partition), stream}
+	for i := int64(0); i < limit; i++ {
+		entry, err := q.readPartition(ctx, stream)
+		if err != nil {
+			return nil, err
+		}
+		msg, err := q.decode(ctx, stream, entry)
+		if err != nil {
+			return nil, err
+		}
+
+		raw, _ := entry.Values["data"].(string)
+		held, err := holdScript.Run(ctx, q.RedisClient, keys, token, msg.SessionID, raw, q.Group, entry.ID).Int()
+		if err != nil {
+			return nil, err
+		}
+		switch held {
+		case 0:
+			return nil, errLeaseLost
+		case 2:
+			return msg, nil
+		}
+		Info("%s task_id=%s waits for retry of session_id=%s", SERVER_NAME, msg.TaskID, msg.SessionID)
+	}
+	return nil, redis.Nil
+}
+
+// readPartition 持有租约时读取分区中的下一条消息：pending 中空闲超过 ClaimIdle 秒的消息属于已失去租约的 Worker，直接接手；
+// 还有未到期的 pending 消息时返回 redis.Nil，不读取后入队的消息
+func (q *QueueClient) readPartition(ctx context.Context, stream string) (redis.XMessage, error) {
+	claimed, _, err := q.RedisClient.XAutoClaim(ctx, &redis.XAutoClaimArgs{
+		Stream:   stream,
+		Group:    q.Group,
+		Consumer: q.Consumer,
+		MinIdle:  ClaimIdle * time.Second,
+		Start:    "0-0",
+		Count:    1,
+	}).Result()
+	if err != nil && err != redis.Nil {
+		return redis.XMessage{}, err
+	}
+	if len(claimed) > 0 {
+		Info("%s reclaimed pending message %s from %s", SERVER_NAME, claimed[0].ID, stream)
+		return claimed[0], nil
+	}
+
+	pending, err := q.RedisClient.XPending(ctx, stream, q.Group).Result()
+	if err != nil {
+		return redis.XMessage{}, err
+	}
+	if pending.Count > 0 {
+		return redis.XMessage{}, redis.Nil
+	}
+
+	streams, err := q.RedisClient.XReadGroup(ctx, &redis.XReadGroupArgs{
+		Group:    q.Group,
+		Consumer: q.Consumer,
+		Streams:  []string{stream, ">"},
+		Count:    1,
+		Block:    -1, // 不阻塞，由 Worker 控制轮询间隔
+	}).Result()
+	if err != nil {
+		return redis.XMessage{}, err
+	}
+	if len(streams) == 0 || len(streams[0].Messages) == 0 {
+		return redis.XMessage{}, redis.Nil
+	}
+	return streams[0].Messages[0], nil
+}
+
+// decode 解析 Stream 消息；无法解析的消息直接 ACK 丢弃，避免反复被领取
+func (q *QueueClient) decode(ctx context.Context, stream string, entry redis.XMessage) (*QueueMessage, error) {
+	raw, _ := entry.Values["data"].(string)
+
+	var msg QueueMessage
+	if err := json.Unmarshal([]byte(raw), &msg); err != nil {
+		q.ackID(ctx, stream, entry.ID)
+		return nil, fmt.Errorf("invalid queue message %s: %w", entry.ID, err)
+	}
+	msg.StreamID = entry.ID
+	return &msg, nil
+}
+
+// ackScript 租约仍属于自己时 ACK 并删除消息（ARGV[3] 不为空）或移除 session 闸门的队首（ARGV[4] 不为空）、释放租约；
+// 闸门中还有任务时下一个任务立即到期，没有时删除闸门；租约已丢失时不做任何修改
+var ackScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) ~= ARGV[1] then
+	return 0
+end
+if ARGV[3] ~= '' then
+	redis.call('XACK', KEYS[2], ARGV[2], ARGV[3])
+	redis.call('XDEL', KEYS[2], ARGV[3])
+end
+if ARGV[4] ~= '' then
+	local raw = redis.call('HGET', KEYS[3], ARGV[4])
+	if raw then
+		local gate = cjson.decode(raw)
+		table.remove(gate.tasks, 1)
+		if #gate.tasks == 0 then
+			redis.call('HDEL', KEYS[3], ARGV[4])
+		else
+			gate.due = 0
+			redis.call('HSET', KEYS[3], ARGV[4], cjson.encode(gate))
+		end
+	end
+end
+redis.call('DEL', KEYS[1])
+return 1
+`)
+
+// Ack 确认消息已处理（成功或已放弃），从 Stream 中删除并释放分区租约；租约已丢失时返回 errLeaseLost
+func (q *QueueClient) Ack(ctx context.Context, msg *QueueMessage) error {
+	if msg.stopRenew != nil {
+		msg.stopRenew()
+	}
+	if (msg.StreamID == "" && !msg.gated) || msg.Lease == "" {
+		return errors.New("queue message has no stream id or lease")
+	}
+	gatedSession := ""
+	if msg.gated {
+		gatedSession = msg.SessionID
+	}
+	keys := []string{q.leaseKey(msg.Partition), q.streamKey(msg.Partition), q.gateKey(msg.Partition)}
+	held, err := ackScript.Run(ctx, q.RedisClient, keys, msg.Lease, q.Group, msg.StreamID, gatedSession).Int()
+	if err != nil {
+		return err
+	}
+	if held == 0 {
+		return errLeaseLost
+	}
+	return nil
+}
+
+// Release 不 ACK，只停止续期并释放租约，消息保留在 pending 中，空闲超过 ClaimIdle 秒后重新领取；
+// 从重试闸门交付的任务仍在闸门队首，下次领取时重新交付
+func (q *QueueClient) Release(ctx context.Context, msg *QueueMessage) error {
+	if msg.stopRenew != nil {
+		msg.stopRenew()
+	}
+	if msg.Lease == "" {
+		return nil
+	}
+	return q.release(ctx, msg.Partition, msg.Lease)
+}
+
+func (q *QueueClient) ackID(ctx context.Context, stream, id string) error {
+	_, err := q.RedisClient.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.XAck(ctx, stream, q.Group, id)
+		pipe.XDel(ctx, stream, id)
+		return nil
+	})
+	return err
+}
+
+// retryGates 所有分区重试闸门中的任务（原始 JSON），包括等待重试的任务和排在其后的同 session 任务
+func (q *QueueClient) retryGates(ctx context.Context) ([]string, error) {
+	cmds, err := q.RedisClient.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for p := 0; p < q.Partitions; p++ {
+			pipe.HVals(ctx, q.gateKey(p))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var tasks []string
+	for _, cmd := range cmds {
+		for _, raw := range cmd.(*redis.StringSliceCmd).Val() {
+			var gate sessionGate
+			if json.Unmarshal([]byte(raw), &gate) == nil {
+				tasks = append(tasks, gate.Tasks...)
+			}
+		}
+	}
+	return tasks, nil
+}
+
+// Length 获取队列长度（未处理 + 处理中，不含重试闸门中的任务）
 func (q *QueueClient) Length() (int64, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
 	defer cancel()
 
-	length, err := q.RedisClient.LLen(ctx, q.QueueName).Result()
+	cmds, err := q.RedisClient.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for p := 0; p < q.Partitions; p++ {
+			pipe.XLen(ctx, q.streamKey(p))
+		}
+		return nil
+	})
 	if err != nil {
 		return 0, err
 	}
+
+	var length int64
+	for _, cmd := range cmds {
+		length += cmd.(*redis.IntCmd).Val()
+	}
 	return length, nil
 }
 
 // DeleteBySession 删除队列中指定 sessionID 的消息
 func (q *QueueClient) DeleteBySession(ctx context.Context, sessionID string) error {
-	// 获取整个队列
-	messages, err := q.RedisClient.LRange(ctx, q.QueueName, 0, -1).Result()
+	// 获取 session 所在分区的整个队列
+	stream := q.streamKey(q.partitionOf(sessionID))
+	entries, err := q.RedisClient.XRange(ctx, stream, "-", "+").Result()
 	if err != nil {
 		return err
 	}
 
-	for _, raw := range messages {
+	for _, entry := range entries {
+		raw, _ := entry.Values["data"].(string)
+
 		var msg QueueMessage
 		if err := json.Unmarshal([]byte(raw), &msg); err != nil {
 			continue // 出错就跳过
 		}
 
 		if msg.SessionID == sessionID {
-			// 从队列中删除该条消息
-			if err := q.RedisClient.LRem(ctx, q.QueueName, 1, raw).Err(); err != nil {
+			// 从队列中删除该条消息（包括已被领取但未 ACK 的）
+			if err := q.ackID(ctx, stream, entry.ID); err != nil {
+				return err
+			}
+		}
+	}
+
+	// 删除该 session 的重试闸门及其中的任务
+	if err := q.RedisClient.HDel(ctx, q.gateKey(q.partitionOf(sessionID)), sessionID).Err(); err != nil {
+		return err
+	}
+
+	// 删除旧版延迟队列中的消息
+	retries, err := q.RedisClient.ZRange(ctx, q.RetryName, 0, -1).Result()
+	if err != nil {
+		return err
+	}
+	for _, raw := range retries {
+		var msg QueueMessage
+		if err := json.Unmarshal([]byte(raw), &msg); err != nil {
+			continue
+		}
+		if msg.SessionID == sessionID {
+			if err := q.RedisClient.ZRem(ctx, q.RetryName, raw).Err(); err != nil {
 				return err
 			}
 		}
@@ -0,0 +1,20 @@
+package server
+
+import (
+	"errors"
+
+	"remember/client"
+	"remember/taskqueue"
+)
+
+// IsRetryable 判断错误是否值得重试：网络错误、超时、5xx 及下游业务失败重试，鉴权失败、接口不存在、
+// 模型调用的 4xx（taskqueue.IsRetryable）和 PermanentError 不重试
+func IsRetryable(err error) bool {
+	if !taskqueue.IsRetryable(err) {
+		return false
+	}
+	if errors.Is(err, client.ErrUnauthorized) || errors.Is(err, client.ErrNotFound) {
+		return false
+	}
+	return true
+}
@@ -0,0 +1,166 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// --------------------- 补齐调度：按轮次触发的抽取任务在会话停止后可能永远不会执行，由调度器定期补齐 -----------------------------
+//
+// 有未处理消息（某个 taskN_id 为空）的会话记录在两个 Sorted Set 中：
+//   - FLUSH_IDLE_KEY：score 为最后一次上传的时间，会话空闲超过 Idle 后补齐
+//   - FLUSH_STALE_KEY：score 为第一条未处理消息的时间，未处理消息等待超过 MaxStaleness 后补齐（即使会话仍在活跃）
+// 补齐时向主队列写入一条 Flush 任务，与普通上传在同一个分区内按顺序执行，触发所有抽取任务
+
+// FlushConfig 补齐调度配置，为 0 时使用 static.go 中的默认值
+type FlushConfig struct {
+	Idle         time.Duration `mapstructure:"idle"`          // 会话空闲多久后补齐，例如 10m
+	MaxStaleness time.Duration `mapstructure:"max_staleness"` // 未处理消息最长等待时间，例如 30m
+	Interval     time.Duration `mapstructure:"interval"`      // 扫描间隔，例如 30s
+}
+
+// withDefaults 补全未配置的字段
+func (c FlushConfig) withDefaults() FlushConfig {
+	if c.Idle <= 0 {
+		c.Idle = FlushIdle * time.Second
+	}
+	if c.MaxStaleness <= 0 {
+		c.MaxStaleness = FlushMaxStaleness * time.Second
+	}
+	if c.Interval <= 0 {
+		c.Interval = FlushInterval * time.Second
+	}
+	return c
+}
+
+// markPending 记录会话还有未处理的消息：更新最后活跃时间，保留第一条未处理消息的时间
+func markPending(ctx context.Context, sessionID string) error {
+	now := float64(time.Now().UnixMilli())
+	_, err := RedisClient.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.ZAdd(ctx, FLUSH_IDLE_KEY, redis.Z{Score: now, Member: sessionID})
+		pipe.ZAddNX(ctx, FLUSH_STALE_KEY, redis.Z{Score: now, Member: sessionID})
+		return nil
+	})
+	return err
+}
+
+// clearPending 会话的消息已全部交给抽取任务处理，或会话已删除
+func clearPending(ctx context.Context, sessionID string) error {
+	_, err := RedisClient.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.ZRem(ctx, FLUSH_IDLE_KEY, sessionID)
+		pipe.ZRem(ctx, FLUSH_STALE_KEY, sessionID)
+		return nil
+	})
+	return err
+}
+
+// trackPending 根据本轮是否触发了全部抽取任务更新记录，失败只记录日志
+func trackPending(ctx context.Context, sessionID string, pending bool) {
+	var err error
+	if pending {
+		err = markPending(ctx, sessionID)
+	} else {
+		err = clearPending(ctx, sessionID)
+	}
+	if err != nil {
+		log.Printf("⚠️ Update pending session failed, session_id=%s, err=%v", sessionID, err)
+	}
+}
+
+// claimScript 原子地取出待补齐的会话，多个进程同时扫描时只有一个会写入补齐任务
+var claimScript = redis.NewScript(`
+local removed = redis.call('ZREM', KEYS[1], ARGV[1]) + redis.call('ZREM', KEYS[2], ARGV[1])
+return removed
+`)
+
+// FlushScheduler 定期补齐空闲或等待过久的会话
+type FlushScheduler struct {
+	Queue  *QueueClient
+	Config FlushConfig
+	StopCh chan struct{}
+}
+
+// NewFlushScheduler 创建补齐调度器，使用 config.yaml 中的 flush 配置
+func NewFlushScheduler() *FlushScheduler {
+	return &FlushScheduler{
+		Queue:  MessageQueue,
+		Config: Config.Flush.withDefaults(),
+		StopCh: make(chan struct{}),
+	}
+}
+
+// Start 启动调度器
+func (s *FlushScheduler) Start() {
+	go func() {
+		log.Printf("✅ FlushScheduler started, idle=%s, max_staleness=%s, interval=%s", s.Config.Idle, s.Config.MaxStaleness, s.Config.Interval)
+		ticker := time.NewTicker(s.Config.Interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-s.StopCh:
+				log.Println("🛑 FlushScheduler stopped")
+				return
+			case <-ticker.C:
+				if err := s.scan(context.Background()); err != nil {
+					log.Printf("⚠️ FlushScheduler scan error: %v", err)
+				}
+			}
+		}
+	}()
+}
+
+// Stop 停止调度器
+func (s *FlushScheduler) Stop() {
+	close(s.StopCh)
+}
+
+// scan 找出空闲超时或等待过久的会话并写入补齐任务
+func (s *FlushScheduler) scan(ctx context.Context) error {
+	now := time.Now()
+	idle, err := dueSessions(ctx, FLUSH_IDLE_KEY, now.Add(-s.Config.Idle))
+	if err != nil {
+		return err
+	}
+	stale, err := dueSessions(ctx, FLUSH_STALE_KEY, now.Add(-s.Config.MaxStaleness))
+	if err != nil {
+		return err
+	}
+
+	seen := make(map[string]bool, len(idle)+len(stale))
+	for _, sessionID := range append(idle, stale...) {
+		if seen[sessionID] {
+			continue
+		}
+		seen[sessionID] = true
+
+		removed, err := claimScript.Run(ctx, RedisClient, []string{FLUSH_IDLE_KEY, FLUSH_STALE_KEY}, sessionID).Int()
+		if err != nil {
+			return err
+		}
+		if removed == 0 {
+			continue // 已被其他进程处理
+		}
+
+		taskID, err := s.Queue.Enqueue(ctx, QueueMessage{SessionID: sessionID, Flush: true})
+		if err != nil {
+			// 放回集合，之后的扫描会再次补齐
+			markPending(ctx, sessionID)
+			return fmt.Errorf("enqueue flush task for session %s failed: %w", sessionID, err)
+		}
+		log.Printf("🧹 Flush task enqueued, session_id=%s, task_id=%s", sessionID, taskID)
+	}
+	return nil
+}
+
+// dueSessions 获取 score 早于 before 的会话
+func dueSessions(ctx context.Context, key string, before time.Time) ([]string, error) {
+	return RedisClient.ZRangeByScore(ctx, key, &redis.ZRangeBy{
+		Min:   "-inf",
+		Max:   fmt.Sprint(before.UnixMilli()),
+		Count: FlushBatch,
+	}).Result()
+}
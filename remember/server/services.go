@@ -0,0 +1,56 @@
+package server
+
+import (
+	"time"
+
+	"remember/client"
+)
+
+// Services 访问各微服务的客户端，所有调用共享一个连接池
+var Services *client.Client
+
+func init() {
+	Services = NewServicesClient()
+}
+
+// NewServicesClient 根据配置创建微服务客户端，server.endpoints 未配置的服务使用 localhost:{端口}
+func NewServicesClient() *client.Client {
+	endpoints := Config.Server.Endpoints
+	return client.New(client.Config{
+		SessionMessages: serviceEndpoint(client.ServiceSessionMessages, endpoints.SessionMessages, Config.Server.SessionMessages),
+		UserPortrait:    serviceEndpoint(client.ServiceUserPortrait, endpoints.UserPortrait, Config.Server.UserPortrait),
+		TopicSummary:    serviceEndpoint(client.ServiceTopicSummary, endpoints.TopicSummary, Config.Server.TopicSummary),
+		ChatEvent:       serviceEndpoint(client.ServiceChatEvent, endpoints.ChatEvent, Config.Server.ChatEvent),
+		Memory:          serviceEndpoint(client.ServiceMemory, endpoints.Main, Config.Server.Main),
+		Token:           Config.Auth.Token,
+		Timeout:         10 * time.Second,
+	})
+}
+
+// serviceEndpoint 将 EndpointConfig 转换为 client.Endpoint
+func serviceEndpoint(name string, cfg EndpointConfig, port int) client.Endpoint {
+	endpoint := client.LocalEndpoint(port)
+	if cfg.URL != "" {
+		endpoint.BaseURL = cfg.URL
+	}
+	endpoint.Token = cfg.Token
+
+	opts := client.TLSOptions{
+		CAFile:             cfg.TLS.CAFile,
+		CertFile:           cfg.TLS.CertFile,
+		KeyFile:            cfg.TLS.KeyFile,
+		ServerName:         cfg.TLS.ServerName,
+		InsecureSkipVerify: cfg.TLS.InsecureSkipVerify,
+	}
+	if !opts.IsZero() {
+		tlsConfig, err := client.LoadTLSConfig(opts)
+		if err != nil {
+			Error("load tls config for %s failed: %v", name, err)
+		} else {
+			endpoint.TLS = tlsConfig
+		}
+	}
+
+	Info("service endpoint %s -> %s", name, endpoint.BaseURL)
+	return endpoint
+}
@@ -0,0 +1,23 @@
+package server
+
+import (
+	"remember/sessionid"
+)
+
+// --------------------- session_id：按 group_id/user_id/role_id 的固定位置生成，见 sessionid 包 -----------------------------
+// 旧格式用 '_' 连接非空字段，不同组合可能得到相同的 ID；已有数据用 tools/migrate_session_ids.go 迁移，
+// 迁移完成前可在 config.yaml 中设置 session_id.legacy 继续生成旧格式。
+
+// SessionIDConfig session_id 生成配置
+type SessionIDConfig struct {
+	Legacy bool `mapstructure:"legacy"` // 继续生成旧格式，迁移完成后关闭
+}
+
+// GenerateSessionID 根据 group_id, user_id, role_id 生成 session_id
+func GenerateSessionID(groupID, userID, roleID string) (string, error) {
+	id := sessionid.Identity{GroupID: groupID, UserID: userID, RoleID: roleID}
+	if Config.SessionID.Legacy {
+		return sessionid.Legacy(id)
+	}
+	return sessionid.New(id)
+}
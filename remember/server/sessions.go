@@ -0,0 +1,270 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"remember/sessionid"
+
+	"github.com/go-chi/chi/v5"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// --------------------- 会话登记：SESSION_NAME 集合记录每个会话的原始字段、活跃时间、计数及各类记忆的更新时间 -----------------------------
+//
+//   - 上传时登记会话并更新 last_active_at
+//   - Worker 将消息写入 session_messages 后累加 message_count、round_count
+//   - 各服务通过 MEMORY_CHANGED_CHANNEL 发布数据变更，SessionTracker 更新 memory_updated_at
+//   - /memory/delete 全部成功后删除记录
+
+// 各类记忆的名称，与各服务 static.go 中的 MEMORY_SOURCE 一致；主服务内执行的抽取器以抽取器名称作为记忆名称
+var memorySources = map[string]bool{
+	"messages":      true,
+	"user_portrait": true,
+	"topic_summary": true,
+	"chat_events":   true,
+}
+
+// SessionRecord 会话记录
+type SessionRecord struct {
+	SessionID       string               `json:"session_id" bson:"_id"`
+	GroupID         string               `json:"group_id" bson:"group_id"`
+	UserID          string               `json:"user_id" bson:"user_id"`
+	RoleID          string               `json:"role_id" bson:"role_id"`
+	Scheme          string               `json:"scheme" bson:"scheme"` // s2 / legacy / custom
+	CreatedAt       time.Time            `json:"created_at" bson:"created_at"`
+	LastActiveAt    time.Time            `json:"last_active_at" bson:"last_active_at"`       // 最后一次上传时间
+	MessageCount    int64                `json:"message_count" bson:"message_count"`         // 累计写入的消息数
+	RoundCount      int64                `json:"round_count" bson:"round_count"`             // 累计处理的上传次数
+	MemoryUpdatedAt map[string]time.Time `json:"memory_updated_at" bson:"memory_updated_at"` // 各类记忆最后更新时间，key 见 memorySources
+}
+
+// SessionFilter 会话列表过滤条件，为空的字段不过滤
+type SessionFilter struct {
+	UserID  string
+	RoleID  string
+	GroupID string
+}
+
+// SessionResponse 会话接口的统一响应
+type SessionResponse struct {
+	Code int         `json:"code"` // 0 成功, -1 失败
+	Msg  string      `json:"msg"`
+	Data interface{} `json:"data"`
+}
+
+// sessionInsertFields 新建会话记录时写入的字段：上传时未提供原始字段的结构化 session_id 从 ID 中还原
+func sessionInsertFields(sessionID, groupID, userID, roleID string) bson.M {
+	id := sessionid.Identity{GroupID: groupID, UserID: userID, RoleID: roleID}
+	scheme := "custom" // 调用方自行指定的 session_id
+	if id.IsZero() {
+		if parsed, ok := sessionid.Parse(sessionID); ok {
+			id, scheme = parsed, sessionid.Prefix
+		}
+	} else if newID, _ := sessionid.New(id); newID == sessionID {
+		scheme = sessionid.Prefix
+	} else if legacyID, _ := sessionid.Legacy(id); legacyID == sessionID {
+		scheme = "legacy"
+	}
+	return bson.M{
+		"group_id":          id.GroupID,
+		"user_id":           id.UserID,
+		"role_id":           id.RoleID,
+		"scheme":            scheme,
+		"created_at":        time.Now().UTC(),
+		"memory_updated_at": bson.M{},
+	}
+}
+
+// recordSession 上传时登记会话，已存在时只更新 last_active_at
+func recordSession(ctx context.Context, sessionID, groupID, userID, roleID string) error {
+	_, err := MongoDB.Collection(SESSION_NAME).UpdateOne(ctx,
+		bson.M{"_id": sessionID},
+		bson.M{
+			"$setOnInsert": sessionInsertFields(sessionID, groupID, userID, roleID),
+			"$max":         bson.M{"last_active_at": time.Now().UTC()},
+		},
+		options.Update().SetUpsert(true),
+	)
+	return err
+}
+
+// countSessionRound 消息写入 session_messages 后累加计数，失败只记录日志
+func countSessionRound(ctx context.Context, msg *QueueMessage) {
+	_, err := MongoDB.Collection(SESSION_NAME).UpdateOne(ctx,
+		bson.M{"_id": msg.SessionID},
+		bson.M{
+			"$setOnInsert": sessionInsertFields(msg.SessionID, msg.GroupID, msg.UserID, msg.RoleID),
+			"$inc":         bson.M{"message_count": len(msg.Messages), "round_count": 1},
+			"$max":         bson.M{"last_active_at": time.Unix(msg.Timestamp, 0).UTC()},
+		},
+		options.Update().SetUpsert(true),
+	)
+	if err != nil {
+		log.Printf("⚠️ Count session round failed, session_id=%s, err=%v", msg.SessionID, err)
+	}
+}
+
+// markMemoryUpdated 更新某类记忆的更新时间，会话记录不存在（已删除）时不新建
+func markMemoryUpdated(ctx context.Context, sessionID, source string, at time.Time) error {
+	if !memorySources[source] && lookupExtractor(source) == nil {
+		return nil
+	}
+	_, err := MongoDB.Collection(SESSION_NAME).UpdateOne(ctx,
+		bson.M{"_id": sessionID},
+		bson.M{"$max": bson.M{"memory_updated_at." + source: at}},
+	)
+	return err
+}
+
+// deleteSessionRecord 删除会话记录
+func deleteSessionRecord(ctx context.Context, sessionID string) error {
+	_, err := MongoDB.Collection(SESSION_NAME).DeleteOne(ctx, bson.M{"_id": sessionID})
+	return err
+}
+
+// GetSession 获取会话记录
+func GetSession(ctx context.Context, sessionID string) (*SessionRecord, error) {
+	var record SessionRecord
+	if err := MongoDB.Collection(SESSION_NAME).FindOne(ctx, bson.M{"_id": sessionID}).Decode(&record); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, errors.New("session not found")
+		}
+		return nil, err
+	}
+	return &record, nil
+}
+
+// ListSessions 按最后活跃时间倒序列出会话
+func ListSessions(ctx context.Context, f SessionFilter, limit, skip int64) ([]SessionRecord, int64, error) {
+	filter := bson.M{}
+	if f.UserID != "" {
+		filter["user_id"] = f.UserID
+	}
+	if f.RoleID != "" {
+		filter["role_id"] = f.RoleID
+	}
+	if f.GroupID != "" {
+		filter["group_id"] = f.GroupID
+	}
+
+	coll := MongoDB.Collection(SESSION_NAME)
+	total, err := coll.CountDocuments(ctx, filter)
+	if err != nil {
+		return nil, 0, err
+	}
+	opts := options.Find().
+		SetSort(bson.D{{Key: "last_active_at", Value: -1}, {Key: "_id", Value: 1}}).
+		SetLimit(limit).
+		SetSkip(skip)
+	cursor, err := coll.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, 0, err
+	}
+	records := []SessionRecord{}
+	if err := cursor.All(ctx, &records); err != nil {
+		return nil, 0, err
+	}
+	return records, total, nil
+}
+
+// --------------------- 记忆更新时间：订阅各服务的数据变更通知 -----------------------------
+
+// SessionTracker 根据 MEMORY_CHANGED_CHANNEL 更新会话记录中各类记忆的更新时间
+type SessionTracker struct {
+	StopCh chan struct{}
+}
+
+// NewSessionTracker 创建 SessionTracker
+func NewSessionTracker() *SessionTracker {
+	return &SessionTracker{StopCh: make(chan struct{})}
+}
+
+// Start 启动订阅，服务未运行期间的变更不会记录
+func (t *SessionTracker) Start() {
+	go func() {
+		pubsub := RedisClient.Subscribe(context.Background(), MEMORY_CHANGED_CHANNEL)
+		defer pubsub.Close()
+		log.Println("✅ SessionTracker started")
+
+		ch := pubsub.Channel()
+		for {
+			select {
+			case <-t.StopCh:
+				log.Println("🛑 SessionTracker stopped")
+				return
+			case m, ok := <-ch:
+				if !ok {
+					return
+				}
+				var event MemoryChangedEvent
+				if err := json.Unmarshal([]byte(m.Payload), &event); err != nil || event.SessionID == "" {
+					continue
+				}
+				if err := markMemoryUpdated(context.Background(), event.SessionID, event.Source, time.Now().UTC()); err != nil {
+					log.Printf("⚠️ Mark memory updated failed, session_id=%s, source=%s, err=%v", event.SessionID, event.Source, err)
+				}
+			}
+		}
+	}()
+}
+
+// Stop 停止订阅
+func (t *SessionTracker) Stop() {
+	close(t.StopCh)
+}
+
+// --------------------- 接口 -----------------------------
+
+// registerSessionRoutes 注册会话查询接口
+func registerSessionRoutes(r chi.Router, prefix string) {
+	r.Get(prefix+"/sessions/list", sessionListHandler) // 列表，?user_id=&role_id=&group_id=&limit=&skip=
+	r.Get(prefix+"/sessions/get", sessionGetHandler)   // 详情，?session_id=
+}
+
+func sessionListHandler(w http.ResponseWriter, r *http.Request) {
+	limit, skip := int64(20), int64(0)
+	if v, err := strconv.ParseInt(r.URL.Query().Get("limit"), 10, 64); err == nil && v > 0 && v <= 200 {
+		limit = v
+	}
+	if v, err := strconv.ParseInt(r.URL.Query().Get("skip"), 10, 64); err == nil && v > 0 {
+		skip = v
+	}
+	filter := SessionFilter{
+		UserID:  r.URL.Query().Get("user_id"),
+		RoleID:  r.URL.Query().Get("role_id"),
+		GroupID: r.URL.Query().Get("group_id"),
+	}
+
+	records, total, err := ListSessions(r.Context(), filter, limit, skip)
+	if err != nil {
+		writeJSON(w, SessionResponse{Code: -1, Msg: "failed to list sessions: " + err.Error(), Data: struct{}{}})
+		return
+	}
+	writeJSON(w, SessionResponse{
+		Code: 0,
+		Msg:  "success",
+		Data: map[string]interface{}{"total": total, "items": records},
+	})
+}
+
+func sessionGetHandler(w http.ResponseWriter, r *http.Request) {
+	sessionID := r.URL.Query().Get("session_id")
+	if sessionID == "" {
+		writeJSON(w, SessionResponse{Code: -1, Msg: "session_id is required", Data: struct{}{}})
+		return
+	}
+	record, err := GetSession(r.Context(), sessionID)
+	if err != nil {
+		writeJSON(w, SessionResponse{Code: -1, Msg: "failed to get session: " + err.Error(), Data: struct{}{}})
+		return
+	}
+	writeJSON(w, SessionResponse{Code: 0, Msg: "success", Data: record})
+}
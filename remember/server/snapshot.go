@@ -0,0 +1,208 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// --------------------- 记忆块状态与快照：query/apply 返回每个记忆块的查询状态；查询成功时保存快照，下游服务不可用时可回退使用 -----------------------------
+
+// 记忆块查询状态
+const (
+	SectionOK       = "ok"       // 查询成功
+	SectionDegraded = "degraded" // 查询失败，使用了最近一次快照
+	SectionFailed   = "failed"   // 查询失败，没有可用数据
+)
+
+// SectionStatus 单个记忆块的查询状态
+type SectionStatus struct {
+	Status     string     `json:"status"`
+	Error      string     `json:"error,omitempty"`
+	SnapshotAt *time.Time `json:"snapshot_at,omitempty"` // degraded 时使用的快照保存时间
+}
+
+// SectionStatuses 以记忆块名为 key
+type SectionStatuses map[string]SectionStatus
+
+// Failed 查询失败且没有可用数据的记忆块，按名称排序
+func (s SectionStatuses) Failed() []string {
+	var failed []string
+	for name, st := range s {
+		if st.Status == SectionFailed {
+			failed = append(failed, name)
+		}
+	}
+	sort.Strings(failed)
+	return failed
+}
+
+// Err strict 模式下的错误：有记忆块查询失败时返回错误，degraded 视为可用
+func (s SectionStatuses) Err() error {
+	failed := s.Failed()
+	if len(failed) == 0 {
+		return nil
+	}
+	parts := make([]string, 0, len(failed))
+	for _, name := range failed {
+		parts = append(parts, fmt.Sprintf("%s: %s", name, s[name].Error))
+	}
+	return errors.New("记忆块查询失败: " + strings.Join(parts, "; "))
+}
+
+// snapshot 记忆块快照
+type snapshot[T any] struct {
+	Data    T         `json:"data"`
+	SavedAt time.Time `json:"saved_at"`
+}
+
+func snapshotKey(section, sessionID string) string {
+	return SNAPSHOT_PREFIX + section + ":" + sessionID
+}
+
+// saveSnapshot 保存快照，失败只记录日志
+func saveSnapshot[T any](ctx context.Context, section, sessionID string, data T) {
+	b, err := json.Marshal(snapshot[T]{Data: data, SavedAt: time.Now().UTC()})
+	if err == nil {
+		err = RedisClient.Set(ctx, snapshotKey(section, sessionID), b, SnapshotTTL*time.Second).Err()
+	}
+	if err != nil {
+		Error("save snapshot failed, section=%s, session_id=%s, err=%v", section, sessionID, err)
+	}
+}
+
+// loadSnapshot 读取快照，不存在时 ok 为 false
+func loadSnapshot[T any](ctx context.Context, section, sessionID string) (snap snapshot[T], ok bool, err error) {
+	b, err := RedisClient.Get(ctx, snapshotKey(section, sessionID)).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return snap, false, nil
+	}
+	if err != nil {
+		return snap, false, err
+	}
+	if err := json.Unmarshal(b, &snap); err != nil {
+		return snap, false, err
+	}
+	return snap, true, nil
+}
+
+// deleteSnapshots 删除会话的全部快照
+func deleteSnapshots(ctx context.Context, sessionID string) error {
+	keys := make([]string, 0, 4)
+	for _, section := range []string{BlockTopicSummary, BlockUserPortrait, BlockChatEvents, SectionMessages} {
+		keys = append(keys, snapshotKey(section, sessionID))
+	}
+	return RedisClient.Del(ctx, keys...).Err()
+}
+
+// fetchSection 查询记忆块：成功时更新快照；失败时记录错误，fallback 为 true 时回退到最近一次快照
+func fetchSection[T any](ctx context.Context, section, sessionID string, fallback bool, fetch func(context.Context) (T, error)) (T, SectionStatus) {
+	data, err := fetch(ctx)
+	if err == nil {
+		saveSnapshot(ctx, section, sessionID, data)
+		return data, SectionStatus{Status: SectionOK}
+	}
+
+	Error("fetch %s error: %v", section, err)
+	status := SectionStatus{Status: SectionFailed, Error: err.Error()}
+	if !fallback {
+		return data, status
+	}
+
+	snap, ok, serr := loadSnapshot[T](ctx, section, sessionID)
+	if serr != nil {
+		Error("load snapshot failed, section=%s, session_id=%s, err=%v", section, sessionID, serr)
+	}
+	if !ok {
+		return data, status
+	}
+	status.Status = SectionDegraded
+	status.SnapshotAt = &snap.SavedAt
+	return snap.Data, status
+}
+
+// saveSnapshots 批量保存快照，一次 pipeline，失败只记录日志
+func saveSnapshots[T any](ctx context.Context, section string, data map[string]T) {
+	_, err := RedisClient.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for sessionID, d := range data {
+			b, err := json.Marshal(snapshot[T]{Data: d, SavedAt: time.Now().UTC()})
+			if err != nil {
+				continue
+			}
+			pipe.Set(ctx, snapshotKey(section, sessionID), b, SnapshotTTL*time.Second)
+		}
+		return nil
+	})
+	if err != nil {
+		Error("save snapshots failed, section=%s, sessions=%d, err=%v", section, len(data), err)
+	}
+}
+
+// loadSnapshots 批量读取快照，一次 MGET，没有快照的会话不在结果中
+func loadSnapshots[T any](ctx context.Context, section string, sessionIDs []string) (map[string]snapshot[T], error) {
+	keys := make([]string, 0, len(sessionIDs))
+	for _, sessionID := range sessionIDs {
+		keys = append(keys, snapshotKey(section, sessionID))
+	}
+	values, err := RedisClient.MGet(ctx, keys...).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	snaps := make(map[string]snapshot[T], len(values))
+	for i, v := range values {
+		s, ok := v.(string)
+		if !ok {
+			continue
+		}
+		var snap snapshot[T]
+		if err := json.Unmarshal([]byte(s), &snap); err == nil {
+			snaps[sessionIDs[i]] = snap
+		}
+	}
+	return snaps, nil
+}
+
+// fetchSectionBatch 批量查询记忆块，规则与 fetchSection 相同：一次调用下游批量接口，
+// 失败时所有会话都为 failed，fallback 中为 true 的会话回退到各自最近一次快照
+func fetchSectionBatch[T any](ctx context.Context, section string, sessionIDs []string, fallback map[string]bool, fetch func(context.Context) (map[string]T, error)) (map[string]T, map[string]SectionStatus) {
+	statuses := make(map[string]SectionStatus, len(sessionIDs))
+	data, err := fetch(ctx)
+	if err == nil {
+		saveSnapshots(ctx, section, data)
+		for _, sessionID := range sessionIDs {
+			statuses[sessionID] = SectionStatus{Status: SectionOK}
+		}
+		return data, statuses
+	}
+
+	Error("fetch %s batch error: %v", section, err)
+	data = make(map[string]T, len(sessionIDs))
+	var degrade []string
+	for _, sessionID := range sessionIDs {
+		statuses[sessionID] = SectionStatus{Status: SectionFailed, Error: err.Error()}
+		if fallback[sessionID] {
+			degrade = append(degrade, sessionID)
+		}
+	}
+	if len(degrade) == 0 {
+		return data, statuses
+	}
+
+	snaps, serr := loadSnapshots[T](ctx, section, degrade)
+	if serr != nil {
+		Error("load snapshots failed, section=%s, err=%v", section, serr)
+	}
+	for sessionID, snap := range snaps {
+		data[sessionID] = snap.Data
+		savedAt := snap.SavedAt
+		statuses[sessionID] = SectionStatus{Status: SectionDegraded, Error: err.Error(), SnapshotAt: &savedAt}
+	}
+	return data, statuses
+}
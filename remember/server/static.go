@@ -1,20 +1,110 @@
 package server
 
 const (
-	DB_NAME     = "main"                // 数据库名
-	QUEUE_NAME  = "remember:main:queue" // 队列名
-	SERVER_NAME = "[主服务]"               // 服务名
+	DB_NAME          = "main"                  // 数据库名
+	QUEUE_NAME       = "remember:main:queue"   // 队列名
+	QUEUE_GROUP      = "remember:main:workers" // 队列消费者组
+	DEAD_LETTER_NAME = "main_dead_letter"      // 死信集合名
+	SERVER_NAME      = "[主服务]"                 // 服务名
 	//User_query       = "Returns the English JSON  result" // user_query填充位
-	MaxRetry         = 3  // 任务执行大重试次数
-	Monitor_Interval = 60 // 监控间隔
-	Queue_MAXLEN     = 80 // 队列最大长度
+	MaxRetry         = 3   // 任务执行大重试次数
+	RetryBaseDelay   = 10  // 首次重试前等待的秒数，之后每次翻倍
+	RetryMaxDelay    = 600 // 重试等待的上限（秒）
+	ClaimIdle        = 300 // 消息被领取后超过多少秒未 ACK，视为消费者已失联，可被其他 Worker 重新领取
+	Monitor_Interval = 60  // 监控间隔
+	Queue_MAXLEN     = 80  // 队列最大长度
 
 	//--------------------------  任务触发频次 例如5轮一总结 -----------------------------
 	// 主题归纳即时性比较强，尽量高频次，清理轮次要比所有任务的轮次都要唱
+	// 以下为默认值，可按 role_id/group_id 在 config.yaml 的 cadence 或 /memory/cadence 接口中覆盖，见 cadence.go
 	//MessagesRound =1    //消息入库
-	UserRound  = 1  // 用户画像生成
-	EventRound = 5  // 关键事件抽取
-	TopicRound = 1  // 主题归纳
-	ClearRound = 15 // 清理已完成处理的轮次
+	UserRound    = 1  // 用户画像生成
+	EventRound   = 5  // 关键事件抽取
+	TopicRound   = 1  // 主题归纳
+	ClearRound   = 15 // 清理已完成处理的轮次
+	KeepMessages = 5  // 清理时保留的最近消息数，与 session_messages 的 PROJECT_MESSAGES_COUNT 一致
 
 )
+
+// --------------------------  任务状态 -----------------------------
+const (
+	TASK_STATUS_PREFIX = "remember:main:task:" // 任务状态 key 前缀
+	TaskStatusTTL      = 7 * 24 * 3600         // 任务状态保留时间（秒）
+)
+
+// --------------------------  队列分区 -----------------------------
+// 同一 session 的任务落在同一分区并串行处理；分区数不宜小于 Worker 数，修改后已入队的任务需先处理完
+const QueuePartitions = 20 // 主队列分区数
+
+// --------------------------  任务触发频次覆盖值 -----------------------------
+const CADENCE_KEY = "remember:main:cadence" // 通过接口设置的频次，Hash，field 为 default / role:{id} / group:{id}
+
+// --------------------------  补齐调度 -----------------------------
+// 默认值，可在 config.yaml 的 flush 中覆盖，见 scheduler.go
+const (
+	FLUSH_IDLE_KEY    = "remember:main:flush:idle"  // 有未处理消息的会话，score 为最后上传时间
+	FLUSH_STALE_KEY   = "remember:main:flush:stale" // 有未处理消息的会话，score 为第一条未处理消息的时间
+	FlushIdle         = 600                         // 会话空闲多少秒后补齐抽取任务
+	FlushMaxStaleness = 1800                        // 未处理消息最长等待秒数
+	FlushInterval     = 30                          // 扫描间隔（秒）
+	FlushBatch        = 100                         // 每次扫描最多补齐的会话数
+)
+
+// --------------------------  提示词模板库 -----------------------------
+const (
+	TEMPLATE_NAME         = "prompt_templates"         // 模板集合名，每个版本一条记录
+	TEMPLATE_DEFAULT_NAME = "prompt_template_defaults" // 角色默认模板集合名
+)
+
+// --------------------------  记忆块快照 -----------------------------
+const (
+	SNAPSHOT_PREFIX = "remember:main:snapshot:" // 快照 key 前缀，{section}:{session_id}
+	SnapshotTTL     = 7 * 24 * 3600             // 快照保留时间（秒）
+)
+
+// --------------------------  apply 缓存 -----------------------------
+// 默认值，可在 config.yaml 的 apply_cache 中覆盖，见 apply_cache.go；key 前缀与频道名与各服务的 static.go 一致
+const (
+	APPLY_CACHE_PREFIX        = "remember:main:apply:cache:"   // 缓存，Hash，field 为请求签名
+	APPLY_GEN_PREFIX          = "remember:main:apply:gen:"     // 会话记忆版本号
+	APPLY_REQUEST_PREFIX      = "remember:main:apply:req:"     // 最近的请求，后台刷新使用
+	APPLY_REFRESH_LOCK_PREFIX = "remember:main:apply:refresh:" // 后台刷新锁
+	MEMORY_CHANGED_CHANNEL    = "remember:memory:changed"      // 会话数据变更通知频道
+	ApplyCacheTTL             = 3600                           // 缓存有效期（秒）
+	ApplyCacheMaxEntries      = 50                             // 每个会话最多缓存的请求数
+	ApplyRefreshMax           = 5                              // 每个会话后台重建的最近请求数
+	ApplyRefreshDelay         = 3                              // 后台刷新防抖时间（秒）
+)
+
+// --------------------------  批量接口 -----------------------------
+const (
+	MaxBatchSessions = 100 // 批量接口单次最多的会话数，与各服务的批量查询接口一致
+)
+
+// --------------------------  会话记录 -----------------------------
+const SESSION_NAME = "sessions" // 会话集合名，保存 session_id 对应的 group_id/user_id/role_id
+
+// --------------------------  导出与导入 -----------------------------
+const (
+	BUNDLE_FORMAT = "remember.memory" // 导出包格式名
+	BundleVersion = 1                 // 导出包版本，结构不兼容时递增
+	BundleTimeout = 30                // 导出、导入单个服务的超时（秒）
+)
+
+// --------------------------  用户数据删除 -----------------------------
+const (
+	ERASURE_NAME     = "erasure_receipts" // 删除凭证集合名，_id 为递增序号，每条记录包含上一条的 hash
+	ErasureAppendTry = 5                  // 并发写入凭证序号冲突时的重试次数
+)
+
+// session_messages 的任务完成通知 Stream 及消费者组，与 session_messages/static.go 一致，删除用户数据时一并清理
+const (
+	COMPLETION_STREAM = "remember:session_messages:completions"
+	COMPLETION_GROUP  = "remember:session_messages:workers"
+)
+
+// --------------------------  抽取器 -----------------------------
+const (
+	EXTRACTOR_QUERY  = "Returns the English JSON  result" // 主服务内执行的抽取器调用模型时的 user_query 填充位
+	ExtractorTimeout = 120                                // 主服务内执行一次抽取的超时（秒）
+)
@@ -0,0 +1,40 @@
+package server
+
+import (
+	"context"
+	"log"
+	"strings"
+)
+
+// --------------------- 下游任务：主任务状态（见 TaskStatuses）的 Hash 中同时记录本轮触发的各服务任务ID -----------------------------
+
+// downstreamField 下游任务ID在主任务 Hash 中的字段名
+func downstreamField(service string) string {
+	return "task:" + service
+}
+
+// recordDownstreamTask 记录本轮触发的下游任务ID，失败只记录日志
+func recordDownstreamTask(ctx context.Context, taskID, service, downstreamID string) {
+	if downstreamID == "" {
+		return
+	}
+	if err := RedisClient.HSet(ctx, TaskStatuses.Key(taskID), downstreamField(service), downstreamID).Err(); err != nil {
+		log.Printf("⚠️ Record downstream task failed, task_id=%s, service=%s, err=%v", taskID, service, err)
+	}
+}
+
+// GetDownstreamTasks 获取主任务触发的下游任务ID，key 为服务名
+func GetDownstreamTasks(ctx context.Context, taskID string) (map[string]string, error) {
+	values, err := RedisClient.HGetAll(ctx, TaskStatuses.Key(taskID)).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	tasks := make(map[string]string)
+	for field, value := range values {
+		if service, ok := strings.CutPrefix(field, downstreamField("")); ok {
+			tasks[service] = value
+		}
+	}
+	return tasks, nil
+}
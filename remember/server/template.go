@@ -2,14 +2,19 @@ package server
 
 import (
 	"fmt"
+
+	"remember/prompt"
 )
 
 /*
+模板使用 text/template 语法（见 remember/prompt），没有关键事件时省略整个事件段落。
+
 "role_prompt":   req.RolePrompt,
 "topic_summary": buildTopicSummaryText(topicSummaryRes.data),
 "user_portrait": buildUserPortraitText(userPortraitRes.data, "  "), // 缩进两个空格
 "chat_events":   buildChatEventsText(chatEventsRes.data),
 "current_time":  time.Now().UTC().Format("2006-01-02 15:04:05"),
+"topics" / "active_topics" / "portrait" / "events": 记忆块对应的结构化数据，可用 range 循环输出
 
 */
 
@@ -18,7 +23,7 @@ var MemorySystemPromptTemplate = `## Mission Background
 You are an intelligent and talented actor. You have a unique understanding of role-playing and immerse yourself in the role instantly. You will be given some character information. Please be sure to bring your character's settings and previous conversation memories into play. Apply the knowledge gained from your user personas to understand the user and engage in conversation.
 
 ## Conversation Memory
-{topic_summary}
+{{.topic_summary}}
 
 ## Roleplaying Rules
 - Your responses must strictly adhere to your role setting.
@@ -32,20 +37,20 @@ You are an intelligent and talented actor. You have a unique understanding of ro
 - Guide the user to showcase their strengths on this topic.
 
 ## User Profile
-{user_portrait}
+{{.user_portrait}}
 
 ## Usage Rules
 - You must remember the information in your user profile. By default, you analyze the user profile before responding to each conversation.
 - Do your best to satisfy the user's preferences.
 - Avoid the user's dislikes.
 - If new information in a conversation contradicts existing information in the user persona, the current information should prevail.
-
+{{if .chat_events}}
 ## Timeline Review
 You and the user experienced key events that marked significant changes in your relationship or in one of your relationships.
 Key events are presented as a timeline and are constantly evolving.
 
 ## Key Event Timeline
-{chat_events}
+{{.chat_events}}
 
 ## Usage Rules
 - Key events consist of two parts: past events and future events.
@@ -54,25 +59,25 @@ Key events are presented as a timeline and are constantly evolving.
 - Provide users with more diverse, real-world story experiences.
 - Actively or implicitly prompt users to advance events.
 - If necessary, end an event and plan for a new one.
-
-# Current Time: {current_time}
+{{end}}
+# Current Time: {{.current_time}}
 
 Use the above information to conduct the conversation, but do not share your pre-conversation analysis or your thought process for developing the best response based on the information.
 
 As soon as the conversation begins, start your role-playing.
 ## Role Setting
-{role_prompt}
+{{.role_prompt}}
 `
 
 // 可作为静态变量
-var MemoryStaticVars = map[string]string{
+var MemoryStaticVars = prompt.Vars{
 	// 暂无固定静态变量，可以后续扩展
 }
 
 // ---------------------------------- 结构体 ----------------------------------
 type MemoryTemplate struct {
 	Template   string
-	StaticVars map[string]string
+	StaticVars prompt.Vars
 }
 
 // ---------------------------------- 构造函数 ----------------------------------
@@ -84,17 +89,11 @@ func NewMemoryTemplate() *MemoryTemplate {
 }
 
 // ---------------------------------- 生成最终Prompt ----------------------------------
-func (t *MemoryTemplate) BuildPrompt(dynamicVars map[string]string) (string, error) {
-	// 先替换静态变量（如果有）
-	finalTpl, err := SystemPromptComposeStatic(t.Template, t.StaticVars)
-	if err != nil {
-		return "", fmt.Errorf("静态模板组装失败: %v", err)
-	}
-
-	// 再替换动态变量
-	finalTpl, err = SystemPromptCompose(finalTpl, dynamicVars)
+func (t *MemoryTemplate) BuildPrompt(dynamicVars prompt.Vars) (string, error) {
+	// 静态变量与动态变量一起渲染，缺少变量报错
+	finalTpl, err := prompt.Compose(t.Template, t.StaticVars, dynamicVars)
 	if err != nil {
-		return "", fmt.Errorf("动态模板组装失败: %v", err)
+		return "", fmt.Errorf("模板组装失败: %v", err)
 	}
 
 	return finalTpl, nil
@@ -0,0 +1,476 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+
+	"remember/prompt"
+
+	"github.com/go-chi/chi/v5"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ---------------------------------------------------------------------------------------------
+// 提示词模板库：/memory/apply 使用的系统提示词模板保存在 MongoDB 中，每次保存生成一个新版本，已有版本不可修改。
+// 模板使用 text/template 语法（见 remember/prompt），需要声明用到的记忆块，保存时校验声明与模板中引用的变量一致；
+// apply 只查询模板用到的记忆块。
+// 选择顺序：请求中的 template_id/version → 角色默认模板 → 全局默认模板（role_id 为空）→ 内置模板 MemorySystemPromptTemplate
+// ---------------------------------------------------------------------------------------------
+
+// 记忆块，对应模板中的占位符
+const (
+	BlockTopicSummary = "topic_summary" // 话题归纳
+	BlockUserPortrait = "user_portrait" // 用户画像
+	BlockChatEvents   = "chat_events"   // 关键事件
+	BlockCurrentTime  = "current_time"  // 当前时间
+	BlockRolePrompt   = "role_prompt"   // 角色设定
+)
+
+// MemoryBlocks 全部可用的记忆块
+var MemoryBlocks = []string{BlockTopicSummary, BlockUserPortrait, BlockChatEvents, BlockCurrentTime, BlockRolePrompt}
+
+// 记忆块的结构化变量，模板可以用 range 循环输出，内容与同名记忆块一样经过预算裁剪
+const (
+	VarTopics       = "topics"        // []TopicSummaryRaw，属于 topic_summary
+	VarActiveTopics = "active_topics" // []string，属于 topic_summary
+	VarPortrait     = "portrait"      // map[string]any，属于 user_portrait
+	VarEvents       = "events"        // {Completed, Todo []string}，属于 chat_events
+)
+
+// blockVars 变量所属的记忆块
+var blockVars = map[string]string{
+	BlockTopicSummary: BlockTopicSummary,
+	BlockUserPortrait: BlockUserPortrait,
+	BlockChatEvents:   BlockChatEvents,
+	BlockCurrentTime:  BlockCurrentTime,
+	BlockRolePrompt:   BlockRolePrompt,
+	VarTopics:         BlockTopicSummary,
+	VarActiveTopics:   BlockTopicSummary,
+	VarPortrait:       BlockUserPortrait,
+	VarEvents:         BlockChatEvents,
+}
+
+// BuiltinTemplateID 内置模板ID
+const BuiltinTemplateID = "builtin"
+
+var (
+	templateIDPattern = regexp.MustCompile(`^[a-zA-Z0-9_.-]+$`)
+
+	ErrTemplateNotFound = errors.New("template not found")
+)
+
+// PromptTemplate 一个模板版本
+type PromptTemplate struct {
+	ID          string    `bson:"_id" json:"-"` // {template_id}@{version}
+	TemplateID  string    `bson:"template_id" json:"template_id"`
+	Version     int       `bson:"version" json:"version"`
+	Description string    `bson:"description" json:"description,omitempty"`
+	Content     string    `bson:"content" json:"content"`
+	Blocks      []string  `bson:"blocks" json:"blocks"` // 模板用到的记忆块
+	CreatedAt   time.Time `bson:"created_at" json:"created_at"`
+}
+
+// builtinTemplate 内置模板，使用全部记忆块
+var builtinTemplate = &PromptTemplate{
+	TemplateID: BuiltinTemplateID,
+	Content:    MemorySystemPromptTemplate,
+	Blocks:     MemoryBlocks,
+}
+
+// Uses 模板是否用到某个记忆块
+func (t *PromptTemplate) Uses(block string) bool {
+	for _, b := range t.Blocks {
+		if b == block {
+			return true
+		}
+	}
+	return false
+}
+
+// Validate 校验模板：模板语法正确，声明的记忆块必须合法且都在模板中用到，模板引用的变量必须属于声明的记忆块或是静态变量
+func (t *PromptTemplate) Validate() error {
+	if !templateIDPattern.MatchString(t.TemplateID) {
+		return fmt.Errorf("invalid template_id %q, only letters, digits, '_', '.' and '-' are allowed", t.TemplateID)
+	}
+	if t.TemplateID == BuiltinTemplateID {
+		return fmt.Errorf("template_id %q is reserved", BuiltinTemplateID)
+	}
+	if t.Content == "" {
+		return errors.New("content is required")
+	}
+
+	declared := make(map[string]bool, len(t.Blocks))
+	for _, b := range t.Blocks {
+		known := false
+		for _, m := range MemoryBlocks {
+			known = known || b == m
+		}
+		if !known {
+			return fmt.Errorf("unknown block %q, available: %v", b, MemoryBlocks)
+		}
+		if declared[b] {
+			return fmt.Errorf("duplicate block %q", b)
+		}
+		declared[b] = true
+	}
+
+	tpl, err := prompt.New(t.TemplateID, t.Content, prompt.Strict)
+	if err != nil {
+		return err
+	}
+	used := make(map[string]bool)
+	for _, name := range tpl.Vars() {
+		if _, ok := MemoryStaticVars[name]; ok {
+			continue
+		}
+		block, ok := blockVars[name]
+		if !ok || !declared[block] {
+			return fmt.Errorf("variable {{.%s}} is not a declared block", name)
+		}
+		used[block] = true
+	}
+	for _, b := range t.Blocks {
+		if !used[b] {
+			return fmt.Errorf("declared block %q is not used in content", b)
+		}
+	}
+	return nil
+}
+
+// TemplateDefault 角色默认模板，RoleID 为空表示全局默认
+type TemplateDefault struct {
+	RoleID     string    `bson:"_id" json:"role_id"`
+	TemplateID string    `bson:"template_id" json:"template_id"`
+	Version    int       `bson:"version" json:"version"` // 0 表示始终使用最新版本
+	UpdatedAt  time.Time `bson:"updated_at" json:"updated_at"`
+}
+
+// TemplateRegistry 模板集合操作
+type TemplateRegistry struct {
+	Templates *mongo.Collection
+	Defaults  *mongo.Collection
+}
+
+var Templates *TemplateRegistry
+
+func init() {
+	Templates = NewTemplateRegistry()
+}
+
+// NewTemplateRegistry 创建 TemplateRegistry
+func NewTemplateRegistry() *TemplateRegistry {
+	return &TemplateRegistry{
+		Templates: MongoDB.Collection(TEMPLATE_NAME),
+		Defaults:  MongoDB.Collection(TEMPLATE_DEFAULT_NAME),
+	}
+}
+
+// Save 保存模板的新版本，返回保存后的模板
+func (tr *TemplateRegistry) Save(ctx context.Context, t PromptTemplate) (*PromptTemplate, error) {
+	if err := t.Validate(); err != nil {
+		return nil, err
+	}
+
+	// 并发保存同一模板时 _id 冲突，重新取版本号
+	for attempt := 0; attempt < 3; attempt++ {
+		latest, err := tr.Get(ctx, t.TemplateID, 0)
+		switch {
+		case errors.Is(err, ErrTemplateNotFound):
+			t.Version = 1
+		case err != nil:
+			return nil, err
+		default:
+			t.Version = latest.Version + 1
+		}
+
+		t.ID = fmt.Sprintf("%s@%d", t.TemplateID, t.Version)
+		t.CreatedAt = time.Now().UTC()
+		_, err = tr.Templates.InsertOne(ctx, t)
+		if mongo.IsDuplicateKeyError(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		return &t, nil
+	}
+	return nil, fmt.Errorf("save template %s failed: too many concurrent updates", t.TemplateID)
+}
+
+// Get 获取模板的指定版本，version 为 0 时获取最新版本
+func (tr *TemplateRegistry) Get(ctx context.Context, templateID string, version int) (*PromptTemplate, error) {
+	filter := bson.M{"template_id": templateID}
+	if version > 0 {
+		filter["version"] = version
+	}
+
+	var t PromptTemplate
+	err := tr.Templates.FindOne(ctx, filter, options.FindOne().SetSort(bson.M{"version": -1})).Decode(&t)
+	if err == mongo.ErrNoDocuments {
+		return nil, fmt.Errorf("%w: %s version %d", ErrTemplateNotFound, templateID, version)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// Versions 获取模板的全部版本，按版本号升序
+func (tr *TemplateRegistry) Versions(ctx context.Context, templateID string) ([]PromptTemplate, error) {
+	cur, err := tr.Templates.Find(ctx, bson.M{"template_id": templateID}, options.Find().SetSort(bson.M{"version": 1}))
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+
+	versions := []PromptTemplate{}
+	if err := cur.All(ctx, &versions); err != nil {
+		return nil, err
+	}
+	return versions, nil
+}
+
+// List 列出每个模板的最新版本
+func (tr *TemplateRegistry) List(ctx context.Context) ([]PromptTemplate, error) {
+	cur, err := tr.Templates.Find(ctx, bson.M{}, options.Find().SetSort(bson.D{{Key: "template_id", Value: 1}, {Key: "version", Value: -1}}))
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+
+	latest := []PromptTemplate{}
+	for cur.Next(ctx) {
+		var t PromptTemplate
+		if err := cur.Decode(&t); err != nil {
+			return nil, err
+		}
+		if len(latest) > 0 && latest[len(latest)-1].TemplateID == t.TemplateID {
+			continue
+		}
+		latest = append(latest, t)
+	}
+	return latest, cur.Err()
+}
+
+// Delete 删除模板的全部版本，仍被设为默认模板时拒绝删除
+func (tr *TemplateRegistry) Delete(ctx context.Context, templateID string) (int64, error) {
+	n, err := tr.Defaults.CountDocuments(ctx, bson.M{"template_id": templateID})
+	if err != nil {
+		return 0, err
+	}
+	if n > 0 {
+		return 0, fmt.Errorf("template %s is used as default by %d role(s)", templateID, n)
+	}
+
+	result, err := tr.Templates.DeleteMany(ctx, bson.M{"template_id": templateID})
+	if err != nil {
+		return 0, err
+	}
+	return result.DeletedCount, nil
+}
+
+// SetDefault 设置角色默认模板，roleID 为空时设置全局默认
+func (tr *TemplateRegistry) SetDefault(ctx context.Context, roleID, templateID string, version int) error {
+	if _, err := tr.Get(ctx, templateID, version); err != nil {
+		return err
+	}
+
+	d := TemplateDefault{RoleID: roleID, TemplateID: templateID, Version: version, UpdatedAt: time.Now().UTC()}
+	_, err := tr.Defaults.ReplaceOne(ctx, bson.M{"_id": roleID}, d, options.Replace().SetUpsert(true))
+	return err
+}
+
+// DeleteDefault 删除角色默认模板
+func (tr *TemplateRegistry) DeleteDefault(ctx context.Context, roleID string) error {
+	_, err := tr.Defaults.DeleteOne(ctx, bson.M{"_id": roleID})
+	return err
+}
+
+// ListDefaults 列出全部默认模板设置
+func (tr *TemplateRegistry) ListDefaults(ctx context.Context) ([]TemplateDefault, error) {
+	cur, err := tr.Defaults.Find(ctx, bson.M{})
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+
+	defaults := []TemplateDefault{}
+	if err := cur.All(ctx, &defaults); err != nil {
+		return nil, err
+	}
+	sort.Slice(defaults, func(i, j int) bool { return defaults[i].RoleID < defaults[j].RoleID })
+	return defaults, nil
+}
+
+// defaultFor 获取角色默认模板，未设置时返回 nil
+func (tr *TemplateRegistry) defaultFor(ctx context.Context, roleID string) (*PromptTemplate, error) {
+	var d TemplateDefault
+	err := tr.Defaults.FindOne(ctx, bson.M{"_id": roleID}).Decode(&d)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return tr.Get(ctx, d.TemplateID, d.Version)
+}
+
+// Resolve 选择 apply 使用的模板：指定了 template_id 时必须存在；默认模板读取失败时退回内置模板
+func (tr *TemplateRegistry) Resolve(ctx context.Context, templateID string, version int, roleID string) (*PromptTemplate, error) {
+	if templateID != "" {
+		if templateID == BuiltinTemplateID {
+			return builtinTemplate, nil
+		}
+		return tr.Get(ctx, templateID, version)
+	}
+
+	roles := []string{""}
+	if roleID != "" {
+		roles = []string{roleID, ""}
+	}
+	for _, role := range roles {
+		t, err := tr.defaultFor(ctx, role)
+		if err != nil {
+			Error("%s load default template for role %q failed, using builtin: %v", SERVER_NAME, role, err)
+			return builtinTemplate, nil
+		}
+		if t != nil {
+			return t, nil
+		}
+	}
+	return builtinTemplate, nil
+}
+
+// ------------------------------------ 管理接口 ------------------------------------
+
+// TemplateResponse 模板接口响应
+type TemplateResponse struct {
+	Code int         `json:"code"` // 0 成功, -1 失败
+	Msg  string      `json:"msg"`
+	Data interface{} `json:"data"`
+}
+
+// registerTemplateRoutes 注册模板管理接口
+func registerTemplateRoutes(r chi.Router, prefix string) {
+	r.Get(prefix+"/template/list", templateListHandler)                      // 各模板最新版本
+	r.Get(prefix+"/template/get/{templateID}", templateGetHandler)           // 指定版本，?version=，默认最新
+	r.Get(prefix+"/template/versions/{templateID}", templateVersionsHandler) // 全部版本
+	r.Post(prefix+"/template/save", templateSaveHandler)                     // 保存新版本
+	r.Post(prefix+"/template/delete", templateDeleteHandler)                 // 删除全部版本
+	r.Get(prefix+"/template/defaults", templateDefaultsHandler)              // 默认模板列表
+	r.Post(prefix+"/template/default/set", templateSetDefaultHandler)        // 设置角色默认模板
+	r.Post(prefix+"/template/default/delete", templateDeleteDefaultHandler)  // 删除角色默认模板
+}
+
+func templateListHandler(w http.ResponseWriter, r *http.Request) {
+	templates, err := Templates.List(r.Context())
+	if err != nil {
+		writeJSON(w, TemplateResponse{Code: -1, Msg: "failed to list templates: " + err.Error(), Data: struct{}{}})
+		return
+	}
+	writeJSON(w, TemplateResponse{Code: 0, Msg: "success", Data: templates})
+}
+
+func templateGetHandler(w http.ResponseWriter, r *http.Request) {
+	version, _ := strconv.Atoi(r.URL.Query().Get("version"))
+	t, err := Templates.Resolve(r.Context(), chi.URLParam(r, "templateID"), version, "")
+	if err != nil {
+		writeJSON(w, TemplateResponse{Code: -1, Msg: err.Error(), Data: struct{}{}})
+		return
+	}
+	writeJSON(w, TemplateResponse{Code: 0, Msg: "success", Data: t})
+}
+
+func templateVersionsHandler(w http.ResponseWriter, r *http.Request) {
+	versions, err := Templates.Versions(r.Context(), chi.URLParam(r, "templateID"))
+	if err != nil {
+		writeJSON(w, TemplateResponse{Code: -1, Msg: err.Error(), Data: struct{}{}})
+		return
+	}
+	writeJSON(w, TemplateResponse{Code: 0, Msg: "success", Data: versions})
+}
+
+func templateSaveHandler(w http.ResponseWriter, r *http.Request) {
+	var req PromptTemplate
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, TemplateResponse{Code: -1, Msg: "invalid request body: " + err.Error(), Data: struct{}{}})
+		return
+	}
+
+	t, err := Templates.Save(r.Context(), req)
+	if err != nil {
+		writeJSON(w, TemplateResponse{Code: -1, Msg: err.Error(), Data: struct{}{}})
+		return
+	}
+	Info("%s template saved, template_id=%s, version=%d", SERVER_NAME, t.TemplateID, t.Version)
+	invalidateApplyCache(r.Context()) // 使用最新版本的请求需要重新渲染
+	writeJSON(w, TemplateResponse{Code: 0, Msg: "success", Data: t})
+}
+
+func templateDeleteHandler(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		TemplateID string `json:"template_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, TemplateResponse{Code: -1, Msg: "invalid request body: " + err.Error(), Data: struct{}{}})
+		return
+	}
+
+	deleted, err := Templates.Delete(r.Context(), req.TemplateID)
+	if err != nil {
+		writeJSON(w, TemplateResponse{Code: -1, Msg: err.Error(), Data: struct{}{}})
+		return
+	}
+	invalidateApplyCache(r.Context())
+	writeJSON(w, TemplateResponse{Code: 0, Msg: "success", Data: map[string]int64{"deleted": deleted}})
+}
+
+func templateDefaultsHandler(w http.ResponseWriter, r *http.Request) {
+	defaults, err := Templates.ListDefaults(r.Context())
+	if err != nil {
+		writeJSON(w, TemplateResponse{Code: -1, Msg: err.Error(), Data: struct{}{}})
+		return
+	}
+	writeJSON(w, TemplateResponse{Code: 0, Msg: "success", Data: defaults})
+}
+
+func templateSetDefaultHandler(w http.ResponseWriter, r *http.Request) {
+	var req TemplateDefault
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, TemplateResponse{Code: -1, Msg: "invalid request body: " + err.Error(), Data: struct{}{}})
+		return
+	}
+
+	if err := Templates.SetDefault(r.Context(), req.RoleID, req.TemplateID, req.Version); err != nil {
+		writeJSON(w, TemplateResponse{Code: -1, Msg: err.Error(), Data: struct{}{}})
+		return
+	}
+	invalidateApplyCache(r.Context())
+	writeJSON(w, TemplateResponse{Code: 0, Msg: "success", Data: struct{}{}})
+}
+
+func templateDeleteDefaultHandler(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		RoleID string `json:"role_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, TemplateResponse{Code: -1, Msg: "invalid request body: " + err.Error(), Data: struct{}{}})
+		return
+	}
+
+	if err := Templates.DeleteDefault(r.Context(), req.RoleID); err != nil {
+		writeJSON(w, TemplateResponse{Code: -1, Msg: err.Error(), Data: struct{}{}})
+		return
+	}
+	invalidateApplyCache(r.Context())
+	writeJSON(w, TemplateResponse{Code: 0, Msg: "success", Data: struct{}{}})
+}
@@ -0,0 +1,29 @@
+package server
+
+import "unicode"
+
+// --------------------- Tokenizer：估算文本的 token 数，用于 apply 的上下文预算 -----------------------------
+
+// Tokenizer 计算文本的 token 数，可替换为与模型一致的实现
+type Tokenizer interface {
+	Count(text string) int
+}
+
+// ContextTokenizer apply 使用的 Tokenizer，接入精确分词器时在启动前替换
+var ContextTokenizer Tokenizer = EstimateTokenizer{}
+
+// EstimateTokenizer 默认估算：中日韩字符每个字按 1 个 token，其他字符每 4 个按 1 个 token
+type EstimateTokenizer struct{}
+
+// Count 估算 token 数
+func (EstimateTokenizer) Count(text string) int {
+	cjk, other := 0, 0
+	for _, r := range text {
+		if unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul) {
+			cjk++
+		} else {
+			other++
+		}
+	}
+	return cjk + (other+3)/4
+}
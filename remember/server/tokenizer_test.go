@@ -0,0 +1,27 @@
+package server
+
+import "testing"
+
+func TestEstimateTokenizer(t *testing.T) {
+	tests := []struct {
+		text string
+		want int
+	}{
+		{"", 0},
+		{"a", 1},
+		{"abcd", 1},
+		{"abcde", 2},
+		{"你好", 2},
+		{"你好abcd", 3},
+		{"こんにちは", 5},
+		{"カタカナ", 4},
+		{"안녕", 2},
+		{"hello, world", 3},
+		{"用户 likes tea", 2 + 3}, // 2 个汉字 + 11 个其他字符
+	}
+	for _, tt := range tests {
+		if got := (EstimateTokenizer{}).Count(tt.text); got != tt.want {
+			t.Errorf("Count(%q) = %d, want %d", tt.text, got, tt.want)
+		}
+	}
+}
@@ -1,14 +1,12 @@
 package server
 
 import (
-	"bytes"
 	"context"
-	"encoding/json"
 	"fmt"
-	"io"
 	"log"
-	"net/http"
 	"time"
+
+	"remember/client"
 )
 
 // Worker 消费队列消息
@@ -60,609 +58,237 @@ func (w *Worker) processNext() {
 	}
 
 	log.Printf("Processing session_id=%s, task_id=%s, retry=%d", msg.SessionID, msg.TaskID, msg.Retry)
+	trackTask(ctx, msg, TaskRunning, nil)
 	// 处理任务分发
-	if err := w.processTaskDistribution(msg); err != nil {
+	if err := w.processTaskDistribution(ctx, msg); err != nil {
 		log.Printf("❌ Task failed, session_id=%s, task_id=%s, retry=%d, err=%v", msg.SessionID, msg.TaskID, msg.Retry, err)
+		msg.History = append(msg.History, RetryRecord{Retry: msg.Retry, Error: err.Error(), FailedAt: time.Now().UTC().Unix()})
 
-		// 判断是否需要重试
-		if msg.Retry < MaxRetry {
+		// 判断是否需要重试：临时错误（超时、限流、5xx）延迟重试，永久错误直接进入死信
+		if msg.Retry < MaxRetry && IsRetryable(err) {
+			delay := RetryDelay(msg.Retry)
 			msg.Retry++
-			if _, enqueueErr := w.Queue.Enqueue(ctx, *msg); enqueueErr != nil {
-				log.Printf("❌ Re-enqueue failed, task_id=%s, err=%v", msg.TaskID, enqueueErr)
-			} else {
-				log.Printf("🔁 Task re-enqueued, session_id=%s, task_id=%s, retry=%d", msg.SessionID, msg.TaskID, msg.Retry)
+			if scheduleErr := w.Queue.ScheduleRetry(ctx, *msg, delay); scheduleErr != nil {
+				log.Printf("❌ Schedule retry failed, task_id=%s, err=%v", msg.TaskID, scheduleErr)
+				w.release(ctx, msg) // 不 ACK，超过 ClaimIdle 秒后由其他 Worker 重新领取
+				return
 			}
+			log.Printf("🔁 Task scheduled for retry in %s, session_id=%s, task_id=%s, retry=%d", delay, msg.SessionID, msg.TaskID, msg.Retry)
+			trackTask(ctx, msg, TaskRetrying, err)
+			return // 重试任务已移入该 session 的重试闸门，不再 ACK
 		} else {
-			// 超过重试次数，发送飞书报警
+			// 超过重试次数或不可重试，发送飞书报警
 			alertText := fmt.Sprintf(
 				"*main server  task failed after %d retries!*\nTaskID: %s\nSessionID: %s\nLastError: %v",
-				MaxRetry, msg.TaskID, msg.SessionID, err,
+				msg.Retry, msg.TaskID, msg.SessionID, err,
 			)
 			go SendFeishuMsgAsync(alertText)
 
-			log.Printf("⚠️ Task dropped after %d retries, task_id=%s, last error: %v", MaxRetry, msg.TaskID, err)
+			// 写入死信队列，写入失败时不 ACK，稍后重新领取
+			if dlErr := DeadLetters.Add(ctx, msg.TaskID, msg.SessionID, *msg, msg.History, err); dlErr != nil {
+				log.Printf("❌ Dead letter failed, task_id=%s, err=%v", msg.TaskID, dlErr)
+				w.release(ctx, msg)
+				return
+			}
+			log.Printf("⚠️ Task dead-lettered after %d retries, task_id=%s, last error: %v", msg.Retry, msg.TaskID, err)
+			trackTask(ctx, msg, TaskFailed, err)
+			reportExtraction(ctx, msg, client.MessageTaskFailed, err)
 		}
+	} else {
+		trackTask(ctx, msg, TaskSucceeded, nil)
+	}
+
+	// 成功或已进入死信的任务需要 ACK
+	if err := w.Queue.Ack(ctx, msg); err != nil {
+		log.Printf("❌ Ack failed, task_id=%s, err=%v", msg.TaskID, err)
+	}
+}
+
+// release 不 ACK，释放分区租约
+func (w *Worker) release(ctx context.Context, msg *QueueMessage) {
+	if err := w.Queue.Release(ctx, msg); err != nil {
+		log.Printf("❌ Release lease failed, task_id=%s, err=%v", msg.TaskID, err)
 	}
 }
 
 // processTaskDistribution 处理任务分发
-func (w *Worker) processTaskDistribution(msg *QueueMessage) error {
+func (w *Worker) processTaskDistribution(ctx context.Context, msg *QueueMessage) error {
+	if msg.Flush {
+		return w.processFlush(ctx, msg)
+	}
+	if msg.Extractor != "" {
+		return w.processExtraction(ctx, msg)
+	}
+
 	// 第一步：上传消息到 session_messages 服务
-	if err := uploadToSessionMessages(msg); err != nil {
+	if err := uploadToSessionMessages(ctx, msg); err != nil {
 		return fmt.Errorf("failed to upload to session_messages: %w", err)
 	}
+	countSessionRound(ctx, msg)
 
 	// 第二步：获取当前会话的消息数量
-	count, err := getSessionMessagesCount(msg.SessionID)
+	count, err := getSessionMessagesCount(ctx, msg.SessionID)
 	if err != nil {
 		return fmt.Errorf("failed to get messages count: %w", err)
 	}
 
 	log.Printf("Session %s has %d messages", msg.SessionID, count)
 
-	// 第三步：根据消息数量分发任务
-
-	// 关键事件提取任务
-	if count%EventRound == 0 {
-		if err := triggerChatEventTask(msg.SessionID, msg.TaskID); err != nil {
-			return fmt.Errorf("failed to trigger chat event task: %w", err)
-		}
-		log.Printf("Triggered chat event task for session %s", msg.SessionID)
-	}
+	// 第三步：根据消息数量及角色/分组的触发频次分发任务
+	cadence := ResolveCadence(ctx, msg.RoleID, msg.GroupID)
 
-	// 用户画像任务
-	if count%UserRound == 0 {
-		if err := triggerUserPortraitTask(msg.SessionID, msg.TaskID); err != nil {
-			return fmt.Errorf("failed to trigger user portrait task: %w", err)
+	// 按注册顺序触发到达频次的抽取器
+	allTriggered := true
+	for _, e := range Extractors() {
+		if count%e.Round(cadence) != 0 {
+			allTriggered = false
+			continue
 		}
-		log.Printf("Triggered user portrait task for session %s", msg.SessionID)
-	}
-
-	// 主题归纳任务
-	if count%TopicRound == 0 {
-		if err := triggerTopicSummaryTask(msg.SessionID, msg.TaskID); err != nil {
-			return fmt.Errorf("failed to trigger topic summary task: %w", err)
+		downstreamID, err := triggerExtractor(ctx, e, msg.SessionID, msg.TaskID)
+		if err != nil {
+			return fmt.Errorf("failed to trigger %s task: %w", e.Name(), err)
 		}
-		log.Printf("Triggered topic summary task for session %s", msg.SessionID)
+		recordDownstreamTask(ctx, msg.TaskID, e.Name(), downstreamID)
+		log.Printf("Triggered %s task for session %s", e.Name(), msg.SessionID)
 	}
 
 	// 会话清理任务 ，注意这里是大于等于
-	if count >= ClearRound {
-		if err := cleanSessionMessages(msg.SessionID); err != nil {
+	if count >= cadence.ClearRound {
+		if err := cleanSessionMessages(ctx, msg.SessionID, cadence.KeepMessages); err != nil {
 			return fmt.Errorf("failed to clean session messages: %w", err)
 		}
 		log.Printf("Cleaned session messages for session %s", msg.SessionID)
 	}
 
+	// 记录会话是否还有未处理的消息，供补齐调度使用
+	trackPending(ctx, msg.SessionID, !allTriggered)
+
 	return nil
 }
 
-// uploadToSessionMessages 上传消息到 session_messages 服务
-func uploadToSessionMessages(msg *QueueMessage) error {
-	client := &http.Client{Timeout: 10 * time.Second}
-
-	uploadReq := map[string]interface{}{
-		"session_id": msg.SessionID,
-		"messages":   msg.Messages,
-		"task_id":    msg.TaskID,
-	}
-
-	jsonData, err := json.Marshal(uploadReq)
-	if err != nil {
-		return err
-	}
-
-	req, err := http.NewRequest("POST", fmt.Sprintf("http://localhost:%d/session_messages/upload", Config.Server.SessionMessages), bytes.NewReader(jsonData))
-	if err != nil {
-		return err
-	}
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", "Bearer "+Config.Auth.Token)
-
-	resp, err := client.Do(req)
-	if err != nil {
-		return err
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("session_messages upload failed with status: %d", resp.StatusCode)
+// processFlush 处理补齐任务：会话空闲或消息等待过久时，不论轮次触发所有抽取任务
+func (w *Worker) processFlush(ctx context.Context, msg *QueueMessage) error {
+	for _, e := range Extractors() {
+		downstreamID, err := triggerExtractor(ctx, e, msg.SessionID, msg.TaskID)
+		if err != nil {
+			return fmt.Errorf("failed to flush %s task: %w", e.Name(), err)
+		}
+		recordDownstreamTask(ctx, msg.TaskID, e.Name(), downstreamID)
 	}
 
+	log.Printf("🧹 Flushed pending extraction tasks for session %s", msg.SessionID)
 	return nil
 }
 
-// getSessionMessagesCount 获取会话消息数量
-func getSessionMessagesCount(sessionID string) (int, error) {
-	client := &http.Client{Timeout: 10 * time.Second}
-
-	req, err := http.NewRequest("GET", fmt.Sprintf("http://localhost:%d/session_messages/count/%s", Config.Server.SessionMessages, sessionID), nil)
-	if err != nil {
-		return 0, err
-	}
-	req.Header.Set("Authorization", "Bearer "+Config.Auth.Token)
-
-	resp, err := client.Do(req)
-	if err != nil {
-		return 0, err
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return 0, fmt.Errorf("failed to get messages count, status: %d", resp.StatusCode)
-	}
-
-	var result struct {
-		Code int                    `json:"code"`
-		Msg  string                 `json:"msg"`
-		Data map[string]interface{} `json:"data"`
-	}
-
-	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-		return 0, err
-	}
-
-	if result.Code != 0 {
-		return 0, fmt.Errorf("failed to get messages count: %s", result.Msg)
-	}
-
-	count, ok := result.Data["count"].(float64)
-	if !ok {
-		return 0, fmt.Errorf("invalid count format in response")
-	}
-
-	return int(count), nil
+// uploadToSessionMessages 上传消息到 session_messages 服务
+func uploadToSessionMessages(ctx context.Context, msg *QueueMessage) error {
+	messages := make([]client.Message, 0, len(msg.Messages))
+	for _, m := range msg.Messages {
+		messages = append(messages, client.Message{Role: m.Role, Content: m.Content})
+	}
+
+	_, err := Services.SessionMessages.Upload(ctx, client.SessionMessagesUploadRequest{
+		SessionID: msg.SessionID,
+		Messages:  messages,
+		TaskID:    msg.TaskID,
+	})
+	return err
 }
 
-// triggerChatEventTask 触发聊天事件提取任务
-func triggerChatEventTask(sessionID, taskID string) error {
-	client := &http.Client{Timeout: 10 * time.Second}
-
-	// 第一步：标记任务状态
-	markReq := map[string]interface{}{
-		"session_id": sessionID,
-		"task_index": 2, // 聊天事件任务索引
-		"task_id":    taskID,
-	}
-
-	jsonData, err := json.Marshal(markReq)
-	if err != nil {
-		return err
-	}
-
-	req, err := http.NewRequest("POST", fmt.Sprintf("http://localhost:%d/session_messages/mark_task", Config.Server.SessionMessages), bytes.NewReader(jsonData))
-	if err != nil {
-		return err
-	}
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", "Bearer "+Config.Auth.Token)
-
-	resp, err := client.Do(req)
-	if err != nil {
-		return err
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("chat event task mark failed with status: %d", resp.StatusCode)
-	}
-
-	// 第二步：从mark_task响应中获取标记后的消息并调用chat_event服务处理
-	var markResult struct {
-		Code int                    `json:"code"`
-		Msg  string                 `json:"msg"`
-		Data map[string]interface{} `json:"data"`
-	}
-
-	if err := json.NewDecoder(resp.Body).Decode(&markResult); err != nil {
-		return fmt.Errorf("failed to decode mark task response: %w", err)
-	}
-
-	if markResult.Code != 0 {
-		return fmt.Errorf("mark task failed: %s", markResult.Msg)
-	}
-
-	messagesData, ok := markResult.Data["messages"]
-	if !ok {
-		return fmt.Errorf("no messages found in mark task response")
-	}
-
-	messages, ok := messagesData.([]interface{})
-	if !ok {
-		return fmt.Errorf("invalid messages format in mark task response")
-	}
-
-	// 如果没有标记到消息，直接返回成功
-	if len(messages) == 0 {
-		log.Printf("✅ No messages to process for chat event task in session %s", sessionID)
-		return nil
-	}
-
-	// 将扁平消息列表转换为对话对格式
-	conversations, err := convertMessagesToConversations(messages)
-	if err != nil {
-		return fmt.Errorf("failed to convert messages to conversations: %w", err)
-	}
-
-	// 调用chat_event服务的上传接口（使用新的对话对格式）
-	eventRequest := map[string]interface{}{
-		"session_id":    sessionID,
-		"conversations": conversations,
-	}
-
-	eventData, err := json.Marshal(eventRequest)
-	if err != nil {
-		return err
-	}
-
-	eventHttpReq, err := http.NewRequest("POST", fmt.Sprintf("http://localhost:%d/chat_event/upload", Config.Server.ChatEvent), bytes.NewReader(eventData))
-	if err != nil {
-		return err
-	}
-	eventHttpReq.Header.Set("Content-Type", "application/json")
-	eventHttpReq.Header.Set("Authorization", "Bearer "+Config.Auth.Token)
-
-	eventResp, err := client.Do(eventHttpReq)
-
-	if err != nil {
-		return err
-	}
-
-	// 解析响应
-	var Result struct {
-		Code int                    `json:"code"`
-		Msg  string                 `json:"msg"`
-		Data map[string]interface{} `json:"data"`
-	}
-	if err := json.NewDecoder(eventResp.Body).Decode(&Result); err != nil {
-		return fmt.Errorf("failed to decode chat event service response: %w", err)
-	}
-
-	if Result.Code != 0 {
-		return fmt.Errorf("chat event service failed: %s", Result.Msg)
-	}
-
-	defer eventResp.Body.Close()
-
-	if eventResp.StatusCode != http.StatusOK {
-		return fmt.Errorf("chat event service upload failed with status: %d", eventResp.StatusCode)
-	}
-
-	log.Printf("✅ Chat event task triggered successfully for session %s", sessionID)
-	return nil
+// getSessionMessagesCount 获取会话消息数量
+func getSessionMessagesCount(ctx context.Context, sessionID string) (int, error) {
+	return Services.SessionMessages.Count(ctx, sessionID)
 }
 
-// triggerUserPortraitTask 触发用户画像任务
-func triggerUserPortraitTask(sessionID, taskID string) error {
-	client := &http.Client{Timeout: 10 * time.Second}
-
-	// 第一步：标记任务状态
-	markReq := map[string]interface{}{
-		"session_id": sessionID,
-		"task_index": 1, // 用户画像任务索引
-		"task_id":    taskID,
-	}
-
-	jsonData, err := json.Marshal(markReq)
-	if err != nil {
-		return err
-	}
-
-	req, err := http.NewRequest("POST", fmt.Sprintf("http://localhost:%d/session_messages/mark_task", Config.Server.SessionMessages), bytes.NewReader(jsonData))
+// markTaskMessages 以 taskID 认领抽取器 extractor 未处理的消息，返回本次任务需要处理的消息
+func markTaskMessages(ctx context.Context, sessionID, extractor, taskID string) ([]client.StoredMessage, error) {
+	messages, err := Services.SessionMessages.MarkTask(ctx, client.MarkTaskRequest{
+		SessionID: sessionID,
+		Extractor: extractor,
+		TaskID:    taskID,
+	})
 	if err != nil {
-		return err
+		return nil, fmt.Errorf("mark task failed: %w", err)
 	}
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", "Bearer "+Config.Auth.Token)
-
-	resp, err := client.Do(req)
-	if err != nil {
-		return err
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("user portrait task mark failed with status: %d", resp.StatusCode)
-	}
-
-	// 第二步：从mark_task响应中获取标记后的消息并调用user_portrait服务处理
-	var markResult struct {
-		Code int                    `json:"code"`
-		Msg  string                 `json:"msg"`
-		Data map[string]interface{} `json:"data"`
-	}
-
-	if err := json.NewDecoder(resp.Body).Decode(&markResult); err != nil {
-		return fmt.Errorf("failed to decode mark task response: %w", err)
-	}
-
-	if markResult.Code != 0 {
-		return fmt.Errorf("mark task failed: %s", markResult.Msg)
-	}
-
-	messagesData, ok := markResult.Data["messages"]
-	if !ok {
-		return fmt.Errorf("no messages found in mark task response")
-	}
-
-	messages, ok := messagesData.([]interface{})
-	if !ok {
-		return fmt.Errorf("invalid messages format in mark task response")
-	}
-
-	// 如果没有标记到消息，直接返回成功
-	if len(messages) == 0 {
-		log.Printf("✅ No messages to process for user portrait task in session %s", sessionID)
-		return nil
-	}
-
-	// 调用user_portrait服务的上传接口
-	portraitRequest := map[string]interface{}{
-		"session_id": sessionID,
-		"messages":   messages,
-	}
-
-	portraitData, err := json.Marshal(portraitRequest)
-	if err != nil {
-		return err
-	}
-
-	portraitHttpReq, err := http.NewRequest("POST", fmt.Sprintf("http://localhost:%d/user_poritrait/upload", Config.Server.UserPortrait), bytes.NewReader(portraitData))
-	if err != nil {
-		return err
-	}
-	portraitHttpReq.Header.Set("Content-Type", "application/json")
-	portraitHttpReq.Header.Set("Authorization", "Bearer "+Config.Auth.Token)
-
-	portraitResp, err := client.Do(portraitHttpReq)
-	if err != nil {
-		return err
-	}
-	// 解析响应
-	var Result struct {
-		Code int                    `json:"code"`
-		Msg  string                 `json:"msg"`
-		Data map[string]interface{} `json:"data"`
-	}
-	if err := json.NewDecoder(portraitResp.Body).Decode(&Result); err != nil {
-		return fmt.Errorf("failed to decode chat event service response: %w", err)
-	}
-
-	if Result.Code != 0 {
-		return fmt.Errorf("chat event service failed: %s", Result.Msg)
-	}
-
-	defer portraitResp.Body.Close()
-
-	if portraitResp.StatusCode != http.StatusOK {
-		return fmt.Errorf("user portrait service upload failed with status: %d", portraitResp.StatusCode)
-	}
-
-	log.Printf("✅ User portrait task triggered successfully for session %s", sessionID)
-	return nil
+	return messages, nil
 }
 
-// triggerTopicSummaryTask 触发主题归纳任务
-func triggerTopicSummaryTask(sessionID, taskID string) error {
-	client := &http.Client{Timeout: 10 * time.Second}
-
-	// 第一步：标记任务状态
-	markReq := map[string]interface{}{
-		"session_id": sessionID,
-		"task_index": 3, // 主题归纳任务索引
-		"task_id":    taskID,
-	}
-
-	jsonData, err := json.Marshal(markReq)
-	if err != nil {
-		return err
-	}
-
-	req, err := http.NewRequest("POST", fmt.Sprintf("http://localhost:%d/session_messages/mark_task", Config.Server.SessionMessages), bytes.NewReader(jsonData))
-	if err != nil {
-		return err
-	}
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", "Bearer "+Config.Auth.Token)
-
-	resp, err := client.Do(req)
-	if err != nil {
-		return err
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("topic summary task mark failed with status: %d", resp.StatusCode)
-	}
-
-	// 第二步：从mark_task响应中获取标记后的消息并调用topic_summary服务处理
-	var markResult struct {
-		Code int                    `json:"code"`
-		Msg  string                 `json:"msg"`
-		Data map[string]interface{} `json:"data"`
-	}
-
-	if err := json.NewDecoder(resp.Body).Decode(&markResult); err != nil {
-		return fmt.Errorf("failed to decode mark task response: %w", err)
-	}
-
-	if markResult.Code != 0 {
-		return fmt.Errorf("mark task failed: %s", markResult.Msg)
-	}
-
-	messagesData, ok := markResult.Data["messages"]
-	if !ok {
-		return fmt.Errorf("no messages found in mark task response")
-	}
-	//fmt.Println(messagesData)
-
-	messages, ok := messagesData.([]interface{})
-	if !ok {
-		return fmt.Errorf("invalid messages format in mark task response")
-	}
-
-	// 如果没有标记到消息，直接返回成功
-	if len(messages) == 0 {
-		log.Printf("✅ No messages to process for topic summary task in session %s", sessionID)
-		return nil
-	}
-
-	// 调用topic_summary服务的上传接口
-	topicRequest := map[string]interface{}{
-		"session_id": sessionID,
-		"messages":   messages,
-	}
+// dispatchChatEvent 将扁平消息列表转换为对话对格式，调用chat_event服务处理
+func dispatchChatEvent(ctx context.Context, sessionID, claimID string, messages []client.StoredMessage) (string, error) {
+	return Services.ChatEvent.Upload(ctx, client.ChatEventUploadRequest{
+		SessionID:     sessionID,
+		Conversations: convertMessagesToConversations(messages),
+		ClaimID:       claimID,
+	})
+}
 
-	topicData, err := json.Marshal(topicRequest)
-	if err != nil {
-		return err
-	}
+// dispatchUserPortrait 调用user_portrait服务的上传接口
+func dispatchUserPortrait(ctx context.Context, sessionID, claimID string, messages []client.StoredMessage) (string, error) {
+	return Services.UserPortrait.Upload(ctx, sessionID, claimID, toClientMessages(messages))
+}
 
-	topicHttpReq, err := http.NewRequest("POST", fmt.Sprintf("http://localhost:%d/topic_summary/upload", Config.Server.TopicSummary), bytes.NewReader(topicData))
-	if err != nil {
-		return err
-	}
-	topicHttpReq.Header.Set("Content-Type", "application/json")
-	topicHttpReq.Header.Set("Authorization", "Bearer "+Config.Auth.Token)
+// dispatchTopicSummary 调用topic_summary服务的上传接口
+func dispatchTopicSummary(ctx context.Context, sessionID, claimID string, messages []client.StoredMessage) (string, error) {
+	return Services.TopicSummary.Upload(ctx, sessionID, claimID, toClientMessages(messages))
+}
 
-	topicResp, err := client.Do(topicHttpReq)
-	if err != nil {
-		return err
-	}
-	// 解析响应
-	var Result struct {
-		Code int                    `json:"code"`
-		Msg  string                 `json:"msg"`
-		Data map[string]interface{} `json:"data"`
-	}
-	if err := json.NewDecoder(topicResp.Body).Decode(&Result); err != nil {
-		return fmt.Errorf("failed to decode chat event service response: %w", err)
-	}
+// purgeChatEvent 删除批次抽取出的关键事件
+func purgeChatEvent(ctx context.Context, sessionID, claimID string) error {
+	_, err := Services.ChatEvent.PurgeClaim(ctx, sessionID, claimID)
+	return err
+}
 
-	if Result.Code != 0 {
-		return fmt.Errorf("chat event service failed: %s", Result.Msg)
-	}
-	defer topicResp.Body.Close()
+// purgeTopicSummary 删除批次抽取出的话题记录
+func purgeTopicSummary(ctx context.Context, sessionID, claimID string) error {
+	_, err := Services.TopicSummary.PurgeClaim(ctx, sessionID, claimID)
+	return err
+}
 
-	if topicResp.StatusCode != http.StatusOK {
-		return fmt.Errorf("topic summary service upload failed with status: %d", topicResp.StatusCode)
+// toClientMessages 去掉存储时间，只保留 role/content
+func toClientMessages(stored []client.StoredMessage) []client.Message {
+	messages := make([]client.Message, 0, len(stored))
+	for _, m := range stored {
+		messages = append(messages, client.Message{Role: m.Role, Content: m.Content})
 	}
-
-	log.Printf("✅ Topic summary task triggered successfully for session %s", sessionID)
-	return nil
+	return messages
 }
 
 // convertMessagesToConversations 将扁平消息列表转换为对话对格式
-func convertMessagesToConversations(messages []interface{}) ([]map[string]interface{}, error) {
-	Info(fmt.Sprintf("convert messages %s to conversations", messages))
-	var conversations []map[string]interface{}
-	
+func convertMessagesToConversations(messages []client.StoredMessage) []client.Conversation {
+	var conversations []client.Conversation
+
 	// 按顺序处理消息，将连续的 user-assistant 对组合成对话
-	var currentConversation []map[string]interface{}
+	var currentConversation []client.Message
 	var lastTimestamp int64 = time.Now().UTC().Unix() // 默认使用当前时间戳
-	Info(fmt.Sprintf("mark the current conversation in %s time", time.Now().UTC().Format(time.RFC3339)))
-	
-	for i, msg := range messages {
-		message, ok := msg.(map[string]interface{})
-		if !ok {
-			return nil, fmt.Errorf("invalid message format at index %d", i)
-		}
-		
-		role, _ := message["role"].(string)
-		content, _ := message["content"].(string)
-		
+
+	for i, message := range messages {
 		// 尝试获取时间戳，如果没有则使用默认值
 		timestamp := lastTimestamp
-		if ts, ok := message["timestamp"].(float64); ok {
-
-			timestamp = int64(ts)
-		} else if ts, ok := message["created_at"].(string); ok {
-			// 尝试解析时间字符串
-			if t, err := time.Parse(time.RFC3339, ts); err == nil {
-				timestamp = t.Unix()
-			}
-		}
-		
-		msgData := map[string]interface{}{
-			"role":    role,
-			"content": content,
-		}
-		
-		currentConversation = append(currentConversation, msgData)
-		
-		// 如果是 assistant 消息，或者到达消息列表末尾，则完成当前对话对
-		if role == "assistant" || i == len(messages)-1 {
-			if len(currentConversation) > 0 {
-				conversation := map[string]interface{}{
-					"timestamp": timestamp,
-					"messages":  currentConversation,
-				}
-				conversations = append(conversations, conversation)
-				currentConversation = nil
-			}
-		}
-		
-		lastTimestamp = timestamp
-	}
-	
-	// 处理剩余的消息（如果有）
-	if len(currentConversation) > 0 {
-		conversation := map[string]interface{}{
-			"timestamp": lastTimestamp,
-			"messages":  currentConversation,
+		if t := message.Time(); !t.IsZero() {
+			timestamp = t.Unix()
 		}
-		conversations = append(conversations, conversation)
-	}
-	
-	return conversations, nil
-}
 
-// cleanSessionMessages 清理会话消息
-func cleanSessionMessages(sessionID string) error {
-	client := &http.Client{Timeout: 10 * time.Second}
+		currentConversation = append(currentConversation, client.Message{
+			Role:    message.Role,
+			Content: message.Content,
+		})
 
-	// 请求体 JSON
-	bodyData := map[string]string{"session_id": sessionID}
-	bodyBytes, err := json.Marshal(bodyData)
-	if err != nil {
-		return err
-	}
-
-	req, err := http.NewRequest(
-		"POST",
-		fmt.Sprintf("http://localhost:%d/session_messages/clean", Config.Server.SessionMessages),
-		bytes.NewReader(bodyBytes),
-	)
-	if err != nil {
-		return err
-	}
-
-	req.Header.Set("Authorization", "Bearer "+Config.Auth.Token)
-	req.Header.Set("Content-Type", "application/json")
-
-	resp, err := client.Do(req)
-	if err != nil {
-		return err
-	}
-	// 解析响应
-	var Result struct {
-		Code int                    `json:"code"`
-		Msg  string                 `json:"msg"`
-		Data map[string]interface{} `json:"data"`
-	}
-	if err := json.NewDecoder(resp.Body).Decode(&Result); err != nil {
-		return fmt.Errorf("failed to decode chat event service response: %w", err)
-	}
+		// 如果是 assistant 消息，或者到达消息列表末尾，则完成当前对话对
+		if message.Role == "assistant" || i == len(messages)-1 {
+			conversations = append(conversations, client.Conversation{
+				Timestamp: timestamp,
+				Messages:  currentConversation,
+			})
+			currentConversation = nil
+		}
 
-	if Result.Code != 0 {
-		return fmt.Errorf("chat event service failed: %s", Result.Msg)
+		lastTimestamp = timestamp
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("session clean failed with status: %d, body: %s", resp.StatusCode, string(body))
-	}
+	return conversations
+}
 
-	return nil
+// cleanSessionMessages 清理会话消息，保留最近 keep 条，只删除所有已注册抽取器都已完成的消息
+func cleanSessionMessages(ctx context.Context, sessionID string, keep int) error {
+	return Services.SessionMessages.Clean(ctx, sessionID, keep, extractorNames())
 }
@@ -36,6 +36,15 @@ func main() {
 	monitor.Start()
 	log.Println("✅ Queue monitor started")
 
+	// 启动补齐调度：空闲或等待过久的会话补齐抽取任务
+	server.NewFlushScheduler().Start()
+
+	// 启动 apply 缓存后台刷新：会话数据变更后按最近的请求重建缓存（需启用 apply_cache.refresh）
+	server.NewApplyRefresher().Start()
+
+	// 启动会话记录更新：订阅各服务的数据变更，记录各类记忆的更新时间
+	server.NewSessionTracker().Start()
+
 	// 注册 HTTP 路由
 	r := server.RegisterRoutes()
 	server := &http.Server{
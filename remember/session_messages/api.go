@@ -19,6 +19,18 @@ type UploadRequest struct {
 	TaskID    string                   `json:"task_id"`
 }
 
+// BatchQueryRequest 批量查询接口请求体
+type BatchQueryRequest struct {
+	SessionIDs []string `json:"session_ids"`
+}
+
+// ImportRequest 导入接口请求体
+type ImportRequest struct {
+	SessionID string          `json:"session_id"`
+	Mode      string          `json:"mode"` // replace / merge / skip
+	Messages  []MemoryMessage `json:"messages"`
+}
+
 // UploadResponse 上传接口响应（统一格式）
 type UploadResponse struct {
 	Code int         `json:"code"` // 0 成功, -1 失败
@@ -67,15 +79,27 @@ func RegisterRoutes() http.Handler {
 
 	//------------------- 基本接口 ---------------------
 	r.Post("/session_messages/upload", uploadHandler)               // 上传接口
-	r.Get("/session_messages/get/{sessionID}", queryHandler)        // 查询接口
+	r.Get("/session_messages/get/{sessionID}", queryHandler)        // 查询接口，?limit=&before=&after=&since=&until=&order= 时分页
+	r.Post("/session_messages/get_batch", batchQueryHandler)        // 批量查询接口
 	r.Delete("/session_messages/delete/{sessionID}", deleteHandler) // 删除接口
 
 	r.Get("/session_messages/count/{sessionID}", countHandler) // 查询当前会话中消息数量
 
+	//---------------------  导出与导入 ---------------------------
+	r.Get("/session_messages/export/{sessionID}", exportHandler) // 导出会话的全部消息
+	r.Post("/session_messages/import", importHandler)            // 导入消息
+
 	//---------------------  任务接口 ---------------------------
 	r.Post("/session_messages/clean", cleanSsesionHandler) //  清理已处理的消息
 
-	r.Post("/session_messages/mark_task", markEmptyTaskHandler) // 查找 taskN_id 为空并标记
+	r.Post("/session_messages/mark_task", markEmptyTaskHandler) // 认领抽取器未认领的消息并标记
+	r.Post("/session_messages/complete", completeHandler)       // 下游任务完成通知（HTTP 方式）
+	r.Post("/session_messages/redrive", redriveHandler)         // 重置认领超时（或失败）的消息
+
+	//---------------------  单条消息 ---------------------------
+	r.Post("/session_messages/message/edit", editMessageHandler)      // 编辑一轮消息的内容
+	r.Post("/session_messages/message/delete", deleteRoundHandler)    // 删除一轮消息
+	r.Post("/session_messages/message/regenerate", regenerateHandler) // 替换最后一轮的 assistant 回复
 
 	return r
 }
@@ -108,12 +132,12 @@ func uploadHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// 处理 messages 数组，过滤非支持字段并确保成对
-	processedMessages, err := processMessages(req.Messages)
+	// 保存消息（过滤非支持字段并确保成对）
+	messageIDs, err := SaveMessages(req.SessionID, req.Messages, req.TaskID)
 	if err != nil {
 		resp := UploadResponse{
 			Code: -1,
-			Msg:  fmt.Sprintf("invalid messages format: %s", err.Error()),
+			Msg:  err.Error(),
 			Data: struct{}{},
 		}
 		w.Header().Set("Content-Type", "application/json")
@@ -121,33 +145,6 @@ func uploadHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// 将处理后的消息保存到数据库
-	var messageIDs []string
-	for _, msg := range processedMessages {
-		// task.... 默认为空
-		message := MemoryMessage{
-			ID:               GenerateUUID(),
-			SessionID:        req.SessionID,
-			UserContent:      msg.UserContent,
-			AssistantContent: msg.AssistantContent,
-			CreatedAt:        time.Now().UTC(),
-			MessagesID:       req.TaskID,
-			Status:           0, // 默认为待处理
-		}
-
-		if err := DBClient.InsertMessage(&message); err != nil {
-			resp := UploadResponse{
-				Code: -1,
-				Msg:  fmt.Sprintf("failed to %s insert message", SERVER_NAME),
-				Data: struct{}{},
-			}
-			w.Header().Set("Content-Type", "application/json")
-			json.NewEncoder(w).Encode(resp)
-			return
-		}
-		messageIDs = append(messageIDs, message.ID)
-	}
-
 	// 成功响应，返回 message_ids
 	resp := UploadResponse{
 		Code: 0,
@@ -170,19 +167,39 @@ func queryHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	messages, err := DBClient.GetMessagesBySessionID(sessionID)
+	// 带分页参数时按游标分页返回
+	if q, ok, err := ParseMessageQuery(r.URL.Query()); ok {
+		var page *MessagePage
+		if err == nil {
+			page, err = GetMessagePage(sessionID, q)
+		}
+		if err != nil {
+			json.NewEncoder(w).Encode(QueryResponse{
+				Code: -1,
+				Msg:  err.Error(),
+				Data: struct{}{},
+			})
+			return
+		}
+		json.NewEncoder(w).Encode(QueryResponse{
+			Code: 0,
+			Msg:  "success",
+			Data: page,
+		})
+		return
+	}
+
+	// messages 格式: [{"role":"user","content":""},{"role":"assistant","content":""}]
+	formattedMessages, err := GetMessages(sessionID)
 	if err != nil {
 		json.NewEncoder(w).Encode(QueryResponse{
 			Code: -1,
-			Msg:  "failed to get messages: " + err.Error(),
+			Msg:  err.Error(),
 			Data: struct{}{},
 		})
 		return
 	}
 
-	// 转换为 messages 格式: [{"role":"user","content":""},{"role":"assistant","content":""}]
-	formattedMessages := formatMessagesToRoleContent(messages)
-
 	json.NewEncoder(w).Encode(QueryResponse{
 		Code: 0,
 		Msg:  "success",
@@ -192,6 +209,35 @@ func queryHandler(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// batchQueryHandler 批量查询会话消息，data 以 session_id 为 key
+func batchQueryHandler(w http.ResponseWriter, r *http.Request) {
+	var req BatchQueryRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		json.NewEncoder(w).Encode(QueryResponse{
+			Code: -1,
+			Msg:  "invalid request body",
+			Data: struct{}{},
+		})
+		return
+	}
+
+	sessions, err := GetMessagesBatch(req.SessionIDs)
+	if err != nil {
+		json.NewEncoder(w).Encode(QueryResponse{
+			Code: -1,
+			Msg:  err.Error(),
+			Data: struct{}{},
+		})
+		return
+	}
+
+	json.NewEncoder(w).Encode(QueryResponse{
+		Code: 0,
+		Msg:  "success",
+		Data: sessions,
+	})
+}
+
 // deleteHandler 删除指定 session_id 的所有消息
 func deleteHandler(w http.ResponseWriter, r *http.Request) {
 	sessionID := chi.URLParam(r, "sessionID")
@@ -205,10 +251,10 @@ func deleteHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// 删除数据库记录
-	if err := DBClient.DeleteMessagesBySessionID(sessionID); err != nil {
+	if err := DeleteMessages(sessionID); err != nil {
 		json.NewEncoder(w).Encode(QueryResponse{
 			Code: -1,
-			Msg:  "failed to delete messages: " + err.Error(),
+			Msg:  err.Error(),
 			Data: struct{}{},
 		})
 		return
@@ -223,7 +269,9 @@ func deleteHandler(w http.ResponseWriter, r *http.Request) {
 
 func cleanSsesionHandler(w http.ResponseWriter, r *http.Request) {
 	var req struct {
-		SessionID string `json:"session_id"`
+		SessionID  string   `json:"session_id"`
+		Keep       int      `json:"keep"`       // 保留最近的消息数，为空时使用 PROJECT_MESSAGES_COUNT
+		Extractors []string `json:"extractors"` // 需要全部完成的抽取器，为空时使用 DefaultExtractors
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		Error("clean session messages:invalid request body: " + err.Error())
@@ -246,10 +294,10 @@ func cleanSsesionHandler(w http.ResponseWriter, r *http.Request) {
 	//清理
 	sessionID := req.SessionID
 	// 清理数据库记录
-	if err := DBClient.clearSessionMessages(sessionID); err != nil {
+	if err := CleanMessages(sessionID, req.Keep, req.Extractors); err != nil {
 		json.NewEncoder(w).Encode(QueryResponse{
 			Code: -1,
-			Msg:  "failed to clean messages: " + err.Error(),
+			Msg:  err.Error(),
 			Data: struct{}{},
 		})
 		return
@@ -272,11 +320,11 @@ func countHandler(w http.ResponseWriter, r *http.Request) {
 		})
 		return
 	}
-	count, err := DBClient.CountMessagesBySessionID(sessionID)
+	count, err := CountMessages(sessionID)
 	if err != nil {
 		json.NewEncoder(w).Encode(QueryResponse{
 			Code: -1,
-			Msg:  "failed to count messages: " + err.Error(),
+			Msg:  err.Error(),
 			Data: struct{}{},
 		})
 		return
@@ -293,11 +341,12 @@ func countHandler(w http.ResponseWriter, r *http.Request) {
 // MarkTaskRequest 请求体
 type MarkTaskRequest struct {
 	SessionID string `json:"session_id"`
-	TaskIndex int    `json:"task_index"` // 1~4
+	Extractor string `json:"extractor"`  // 抽取器名称
+	TaskIndex int    `json:"task_index"` // 旧版任务序号 1~4，extractor 为空时使用
 	TaskID    string `json:"task_id"`
 }
 
-// markEmptyTaskHandler 查找指定 session 下 taskN_id 为空的消息并标记为 taskID
+// markEmptyTaskHandler 认领指定 session 下抽取器未认领的消息并标记为 taskID
 func markEmptyTaskHandler(w http.ResponseWriter, r *http.Request) {
 	var req MarkTaskRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -309,23 +358,22 @@ func markEmptyTaskHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if req.SessionID == "" || req.TaskIndex < 1 || req.TaskIndex > 4 || req.TaskID == "" {
+	extractor, err := ResolveExtractor(req.Extractor, req.TaskIndex)
+	if req.SessionID == "" || req.TaskID == "" || err != nil {
 		json.NewEncoder(w).Encode(QueryResponse{
 			Code: -1,
-			Msg:  "invalid params: session_id, task_index (1~4), task_id required",
+			Msg:  "invalid params: session_id, extractor (or task_index 1~4), task_id required",
 			Data: struct{}{},
 		})
 		return
 	}
 
-	// 调用 DBClient 的新方法
-	messages, err := DBClient.FindAndMarkMessagesWithoutTaskID(req.SessionID, req.TaskIndex, req.TaskID)
-	// 转换为 messages 格式: [{"role":"user","content":"","timestamp":""},{"role":"assistant","content":"","timestamp}]
-	formattedMessages := formatMessagesToRoleContent(messages)
+	// messages 格式: [{"role":"user","content":"","timestamp":""},{"role":"assistant","content":"","timestamp}]
+	formattedMessages, err := MarkTaskMessages(req.SessionID, extractor, 0, req.TaskID)
 	if err != nil {
 		json.NewEncoder(w).Encode(QueryResponse{
 			Code: -1,
-			Msg:  "failed to mark messages: " + err.Error(),
+			Msg:  err.Error(),
 			Data: struct{}{},
 		})
 		return
@@ -333,9 +381,179 @@ func markEmptyTaskHandler(w http.ResponseWriter, r *http.Request) {
 
 	json.NewEncoder(w).Encode(QueryResponse{
 		Code: 0,
-		Msg:  fmt.Sprintf("successfully marked %d messages for task%d", len(messages), req.TaskIndex),
+		Msg:  fmt.Sprintf("successfully marked %d messages for %s", len(formattedMessages), extractor),
 		Data: map[string]interface{}{
 			"messages": formattedMessages,
 		},
 	})
 }
+
+// exportHandler 导出会话的全部消息，包含任务标记
+func exportHandler(w http.ResponseWriter, r *http.Request) {
+	messages, err := ExportMessages(chi.URLParam(r, "sessionID"))
+	if err != nil {
+		json.NewEncoder(w).Encode(QueryResponse{
+			Code: -1,
+			Msg:  err.Error(),
+			Data: struct{}{},
+		})
+		return
+	}
+
+	json.NewEncoder(w).Encode(QueryResponse{
+		Code: 0,
+		Msg:  "success",
+		Data: messages,
+	})
+}
+
+// importHandler 将消息导入会话
+func importHandler(w http.ResponseWriter, r *http.Request) {
+	var req ImportRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		json.NewEncoder(w).Encode(QueryResponse{
+			Code: -1,
+			Msg:  "invalid request body",
+			Data: struct{}{},
+		})
+		return
+	}
+
+	result, err := ImportMessages(req.SessionID, req.Mode, req.Messages)
+	if err != nil {
+		json.NewEncoder(w).Encode(QueryResponse{
+			Code: -1,
+			Msg:  err.Error(),
+			Data: struct{}{},
+		})
+		return
+	}
+
+	json.NewEncoder(w).Encode(QueryResponse{
+		Code: 0,
+		Msg:  "success",
+		Data: result,
+	})
+}
+
+// completeHandler 下游服务通过 HTTP 上报任务完成，与 COMPLETION_STREAM 中的通知等价
+func completeHandler(w http.ResponseWriter, r *http.Request) {
+	var req CompletionEvent
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		json.NewEncoder(w).Encode(QueryResponse{
+			Code: -1,
+			Msg:  "invalid request body",
+			Data: struct{}{},
+		})
+		return
+	}
+
+	updated, err := CompleteTask(r.Context(), req)
+	if err != nil {
+		json.NewEncoder(w).Encode(QueryResponse{
+			Code: -1,
+			Msg:  err.Error(),
+			Data: struct{}{},
+		})
+		return
+	}
+
+	json.NewEncoder(w).Encode(QueryResponse{
+		Code: 0,
+		Msg:  "success",
+		Data: map[string]interface{}{"updated": updated},
+	})
+}
+
+// RedriveRequest re-drive 接口请求体
+type RedriveRequest struct {
+	SessionID     string `json:"session_id"`     // 为空时扫描所有会话
+	IncludeFailed bool   `json:"include_failed"` // 同时重置失败的消息
+}
+
+// redriveHandler 立即重置认领超时的消息，include_failed 时也重置失败的消息
+func redriveHandler(w http.ResponseWriter, r *http.Request) {
+	var req RedriveRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		json.NewEncoder(w).Encode(QueryResponse{
+			Code: -1,
+			Msg:  "invalid request body",
+			Data: struct{}{},
+		})
+		return
+	}
+
+	result, err := Redrive(r.Context(), req.SessionID, req.IncludeFailed)
+	if err != nil {
+		json.NewEncoder(w).Encode(QueryResponse{
+			Code: -1,
+			Msg:  err.Error(),
+			Data: struct{}{},
+		})
+		return
+	}
+
+	json.NewEncoder(w).Encode(QueryResponse{
+		Code: 0,
+		Msg:  "success",
+		Data: result,
+	})
+}
+
+// MessageEditRequest 单条消息接口请求体，三个接口共用
+type MessageEditRequest struct {
+	SessionID        string  `json:"session_id"`
+	MessageID        string  `json:"message_id"`        // 查询接口返回的 message_id；regenerate 时可选，传入时必须是最后一轮
+	UserContent      *string `json:"user_content"`      // 仅 edit 使用，为空时不修改
+	AssistantContent *string `json:"assistant_content"` // edit 时为空不修改；regenerate 时必填
+}
+
+// writeMessageChange 输出单条消息接口的结果
+func writeMessageChange(w http.ResponseWriter, change *MessageChange, err error) {
+	if err != nil {
+		json.NewEncoder(w).Encode(QueryResponse{
+			Code: -1,
+			Msg:  err.Error(),
+			Data: struct{}{},
+		})
+		return
+	}
+	json.NewEncoder(w).Encode(QueryResponse{
+		Code: 0,
+		Msg:  "success",
+		Data: change,
+	})
+}
+
+// editMessageHandler 编辑一轮消息的 user / assistant 内容
+func editMessageHandler(w http.ResponseWriter, r *http.Request) {
+	var req MessageEditRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeMessageChange(w, nil, fmt.Errorf("invalid request body"))
+		return
+	}
+	change, err := EditMessage(r.Context(), req.SessionID, req.MessageID, req.UserContent, req.AssistantContent)
+	writeMessageChange(w, change, err)
+}
+
+// deleteRoundHandler 删除一轮消息
+func deleteRoundHandler(w http.ResponseWriter, r *http.Request) {
+	var req MessageEditRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeMessageChange(w, nil, fmt.Errorf("invalid request body"))
+		return
+	}
+	change, err := DeleteRound(r.Context(), req.SessionID, req.MessageID)
+	writeMessageChange(w, change, err)
+}
+
+// regenerateHandler 用新的回复替换最后一轮的 assistant 回复
+func regenerateHandler(w http.ResponseWriter, r *http.Request) {
+	var req MessageEditRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.AssistantContent == nil {
+		writeMessageChange(w, nil, fmt.Errorf("invalid request body, assistant_content is required"))
+		return
+	}
+	change, err := RegenerateReply(r.Context(), req.SessionID, req.MessageID, *req.AssistantContent)
+	writeMessageChange(w, change, err)
+}
@@ -0,0 +1,167 @@
+package session_messages
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// --------------------- 任务完成通知：抽取任务（user_poritrait、topic_summary、chat_event 及主服务中的抽取器）成功或进入死信后写入 COMPLETION_STREAM -----------------------------
+//
+// 消息被认领时 task_states.{抽取器} 为 claimed，收到通知后更新为 done / failed；
+// 清理只删除所有抽取器都为 done 的消息，认领超时仍未完成的消息由 Redriver 重置为未认领
+
+// CompletionEvent 完成通知，与 taskqueue/completion.go 中的结构一致
+type CompletionEvent struct {
+	SessionID string `json:"session_id"`
+	Extractor string `json:"extractor"`            // 抽取器名称
+	TaskIndex int    `json:"task_index,omitempty"` // 旧版任务序号，extractor 为空时使用：1 用户画像, 2 关键事件, 3 主题归纳, 4 预留
+	ClaimID   string `json:"claim_id"`             // 认领消息时的 task_id
+	Status    string `json:"status"`               // done / failed
+	Error     string `json:"error,omitempty"`
+	TaskID    string `json:"task_id,omitempty"` // 下游服务的任务ID，仅用于日志
+}
+
+// validate 检查通知字段，并将旧版 task_index 转换为抽取器名称
+func (ev *CompletionEvent) validate() error {
+	if ev.SessionID == "" || ev.ClaimID == "" {
+		return fmt.Errorf("%s session_id and claim_id are required", SERVER_NAME)
+	}
+	name, err := ResolveExtractor(ev.Extractor, ev.TaskIndex)
+	if err != nil {
+		return fmt.Errorf("%s %w", SERVER_NAME, err)
+	}
+	ev.Extractor = name
+	if ev.Status != TaskDone && ev.Status != TaskFailed {
+		return fmt.Errorf("%s invalid status: %s", SERVER_NAME, ev.Status)
+	}
+	return nil
+}
+
+// CompleteTask 根据完成通知更新消息的任务状态，返回更新的消息数
+func CompleteTask(ctx context.Context, ev CompletionEvent) (int64, error) {
+	if err := ev.validate(); err != nil {
+		return 0, err
+	}
+
+	updated, err := DBClient.CompleteTask(ev.SessionID, ev.Extractor, ev.ClaimID, ev.Status, ev.Error)
+	if err != nil {
+		return 0, fmt.Errorf("failed to complete task: %w", err)
+	}
+	Info("%s %s %s for %d messages, session_id=%s, claim_id=%s, task_id=%s",
+		SERVER_NAME, ev.Extractor, ev.Status, updated, ev.SessionID, ev.ClaimID, ev.TaskID)
+	return updated, nil
+}
+
+// CompletionWorker 消费 COMPLETION_STREAM 中的完成通知
+type CompletionWorker struct {
+	StopCh   chan struct{}
+	Consumer string
+}
+
+// NewCompletionWorker 创建 CompletionWorker
+func NewCompletionWorker() *CompletionWorker {
+	host, err := os.Hostname()
+	if err != nil || host == "" {
+		host = "unknown"
+	}
+	return &CompletionWorker{
+		StopCh:   make(chan struct{}),
+		Consumer: fmt.Sprintf("%s-%d-%s", host, os.Getpid(), GenerateUUID()[:8]),
+	}
+}
+
+// Start 启动 CompletionWorker
+func (w *CompletionWorker) Start() {
+	ctx := context.Background()
+	err := RedisClient.XGroupCreateMkStream(ctx, COMPLETION_STREAM, COMPLETION_GROUP, "0").Err()
+	if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		Error("%s create completion consumer group failed: %v", SERVER_NAME, err)
+	}
+
+	go func() {
+		log.Printf("✅ CompletionWorker started, consumer=%s", w.Consumer)
+		for {
+			select {
+			case <-w.StopCh:
+				log.Println("🛑 CompletionWorker stopped")
+				return
+			default:
+				if err := w.processNext(ctx); err != nil {
+					log.Printf("⚠️ CompletionWorker error: %v", err)
+					time.Sleep(time.Second)
+				}
+			}
+		}
+	}()
+}
+
+// Stop 停止 CompletionWorker
+func (w *CompletionWorker) Stop() {
+	close(w.StopCh)
+}
+
+// processNext 处理一批通知：优先重新领取超时未 ACK 的通知，其次阻塞读取新通知
+func (w *CompletionWorker) processNext(ctx context.Context) error {
+	entries, _, err := RedisClient.XAutoClaim(ctx, &redis.XAutoClaimArgs{
+		Stream:   COMPLETION_STREAM,
+		Group:    COMPLETION_GROUP,
+		Consumer: w.Consumer,
+		MinIdle:  CompletionClaimIdle * time.Second,
+		Start:    "0-0",
+		Count:    100,
+	}).Result()
+	if err != nil && err != redis.Nil {
+		return err
+	}
+
+	if len(entries) == 0 {
+		streams, err := RedisClient.XReadGroup(ctx, &redis.XReadGroupArgs{
+			Group:    COMPLETION_GROUP,
+			Consumer: w.Consumer,
+			Streams:  []string{COMPLETION_STREAM, ">"},
+			Count:    100,
+			Block:    5 * time.Second,
+		}).Result()
+		if err == redis.Nil {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		for _, s := range streams {
+			entries = append(entries, s.Messages...)
+		}
+	}
+
+	for _, entry := range entries {
+		raw, _ := entry.Values["data"].(string)
+		var ev CompletionEvent
+		err := json.Unmarshal([]byte(raw), &ev)
+		if err == nil {
+			err = ev.validate()
+		}
+		if err != nil {
+			// 无法处理的通知直接 ACK 丢弃，避免反复被领取
+			log.Printf("⚠️ Invalid completion event %s dropped: %v", entry.ID, err)
+		} else if _, err := CompleteTask(ctx, ev); err != nil {
+			// 不 ACK，超过 CompletionClaimIdle 秒后重新领取
+			log.Printf("❌ Complete task failed, session_id=%s, claim_id=%s, err=%v", ev.SessionID, ev.ClaimID, err)
+			continue
+		}
+
+		pipe := RedisClient.TxPipeline()
+		pipe.XAck(ctx, COMPLETION_STREAM, COMPLETION_GROUP, entry.ID)
+		pipe.XDel(ctx, COMPLETION_STREAM, entry.ID)
+		if _, err := pipe.Exec(ctx); err != nil {
+			log.Printf("❌ Ack completion event %s failed: %v", entry.ID, err)
+		}
+	}
+	return nil
+}
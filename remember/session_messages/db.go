@@ -26,6 +26,31 @@ func NewMessageClient() *MessageClient {
 	}
 }
 
+// messageSort 消息的顺序：created_at、轮次序号、_id，direction 为 1 升序、-1 降序；分页游标、最后一轮都按此顺序
+func messageSort(direction int) bson.D {
+	return bson.D{{Key: "created_at", Value: direction}, {Key: "index", Value: direction}, {Key: "_id", Value: direction}}
+}
+
+// cursorCond 按 messageSort 的顺序严格位于游标之后（op 为 $gt）或之前（op 为 $lt）的条件；没有 index 的旧消息按 0 处理
+func cursorCond(c *messageCursor, op string) bson.M {
+	indexEq := interface{}(c.Index)
+	if c.Index == 0 {
+		indexEq = bson.M{"$in": bson.A{0, nil}}
+	}
+	conds := []bson.M{
+		{"created_at": bson.M{op: c.CreatedAt}},
+		{"created_at": c.CreatedAt, "index": indexEq, "_id": bson.M{op: c.ID}},
+	}
+	switch {
+	case op == "$gt":
+		conds = append(conds, bson.M{"created_at": c.CreatedAt, "index": bson.M{"$gt": c.Index}})
+	case c.Index > 0:
+		// $not 同时匹配没有 index 的旧消息
+		conds = append(conds, bson.M{"created_at": c.CreatedAt, "index": bson.M{"$not": bson.M{"$gte": c.Index}}})
+	}
+	return bson.M{"$or": conds}
+}
+
 // InsertMessage 插入新的消息记录
 func (mc *MessageClient) InsertMessage(message *MemoryMessage) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
@@ -53,9 +78,7 @@ func (mc *MessageClient) GetMessagesBySessionID(sessionID string) ([]MemoryMessa
 	defer cancel()
 
 	filter := bson.M{"session_id": sessionID}
-	opts := options.Find().SetSort(bson.D{
-		{Key: "created_at", Value: 1}, // 按创建时间升序
-	})
+	opts := options.Find().SetSort(messageSort(1)) // 按创建时间升序
 
 	cursor, err := mc.Collection.Find(ctx, filter, opts)
 	if err != nil {
@@ -74,6 +97,183 @@ func (mc *MessageClient) GetMessagesBySessionID(sessionID string) ([]MemoryMessa
 	return messages, nil
 }
 
+// GetMessagesBySessionIDs 批量查询多个会话的消息，一次 $in 查询，以 session_id 为 key
+func (mc *MessageClient) GetMessagesBySessionIDs(sessionIDs []string) (map[string][]MemoryMessage, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	filter := bson.M{"session_id": bson.M{"$in": sessionIDs}}
+	opts := options.Find().SetSort(messageSort(1)) // 按创建时间升序
+
+	cursor, err := mc.Collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var messages []MemoryMessage
+	if err = cursor.All(ctx, &messages); err != nil {
+		return nil, err
+	}
+
+	result := make(map[string][]MemoryMessage, len(sessionIDs))
+	for _, msg := range messages {
+		result[msg.SessionID] = append(result[msg.SessionID], msg)
+	}
+	return result, nil
+}
+
+// GetMessagesPage 按游标分页查询消息，返回本页记录（按 q.Order 排序）、沿翻页方向是否还有更多记录，以及满足 since / until 的总数
+func (mc *MessageClient) GetMessagesPage(sessionID string, q MessageQuery, before, after *messageCursor) ([]MemoryMessage, bool, int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	filter := bson.M{"session_id": sessionID}
+	created := bson.M{}
+	if !q.Since.IsZero() {
+		created["$gte"] = q.Since
+	}
+	if !q.Until.IsZero() {
+		created["$lt"] = q.Until
+	}
+	if len(created) > 0 {
+		filter["created_at"] = created
+	}
+
+	total, err := mc.Collection.CountDocuments(ctx, filter)
+	if err != nil {
+		return nil, false, 0, err
+	}
+
+	// 游标条件：(created_at, index, _id) 严格小于 before、严格大于 after
+	var conds []bson.M
+	if before != nil {
+		conds = append(conds, cursorCond(before, "$lt"))
+	}
+	if after != nil {
+		conds = append(conds, cursorCond(after, "$gt"))
+	}
+	if len(conds) > 0 {
+		filter["$and"] = conds
+	}
+
+	// 从游标处沿翻页方向查询：只有 after 时取紧接其后（更新）的记录，只有 before 时取紧接其前（更早）的记录，否则按 q.Order；
+	// 查询方向与 q.Order 相反时，查询后再反转
+	forward := q.Order == OrderAsc
+	if after != nil && before == nil {
+		forward = true
+	} else if before != nil && after == nil {
+		forward = false
+	}
+	direction := -1
+	if forward {
+		direction = 1
+	}
+	// 多取一条判断是否还有更多
+	opts := options.Find().
+		SetSort(messageSort(direction)).
+		SetLimit(q.Limit + 1)
+
+	cursor, err := mc.Collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, false, 0, err
+	}
+	defer cursor.Close(ctx)
+
+	var messages []MemoryMessage
+	if err = cursor.All(ctx, &messages); err != nil {
+		return nil, false, 0, err
+	}
+
+	hasMore := int64(len(messages)) > q.Limit
+	if hasMore {
+		messages = messages[:q.Limit]
+	}
+	if forward != (q.Order == OrderAsc) {
+		for i, j := 0, len(messages)-1; i < j; i, j = i+1, j-1 {
+			messages[i], messages[j] = messages[j], messages[i]
+		}
+	}
+	return messages, hasMore, total, nil
+}
+
+// UpdateMessageContent 修改一轮消息的内容，为 nil 的字段保持不变，返回修改前的记录；不存在时返回 mongo.ErrNoDocuments
+func (mc *MessageClient) UpdateMessageContent(sessionID, messageID string, userContent, assistantContent *string) (*MemoryMessage, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	set := bson.M{}
+	if userContent != nil {
+		set["user_content"] = *userContent
+	}
+	if assistantContent != nil {
+		set["assistant_content"] = *assistantContent
+	}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.Before)
+	var msg MemoryMessage
+	err := mc.Collection.FindOneAndUpdate(ctx, bson.M{"_id": messageID, "session_id": sessionID}, bson.M{"$set": set}, opts).Decode(&msg)
+	if err != nil {
+		return nil, err
+	}
+	return &msg, nil
+}
+
+// ReplaceLastReply 替换会话最后一轮（与分页查询的排序一致）的 assistant 回复，返回修改前的记录；
+// messageID 不为空时只在最后一轮就是该消息时修改。定位最后一轮与比较 _id 在同一次 FindOneAndUpdate 中完成，
+// 不会替换到并发上传的新消息
+func (mc *MessageClient) ReplaceLastReply(sessionID, messageID, content string) (*MemoryMessage, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var value interface{} = bson.M{"$literal": content} // 内容以 $ 开头时不作为字段路径
+	if messageID != "" {
+		value = bson.M{"$cond": bson.A{bson.M{"$eq": bson.A{"$_id", messageID}}, value, "$assistant_content"}}
+	}
+	update := mongo.Pipeline{{{Key: "$set", Value: bson.M{"assistant_content": value}}}}
+	opts := options.FindOneAndUpdate().
+		SetSort(messageSort(-1)).
+		SetReturnDocument(options.Before)
+
+	var msg MemoryMessage
+	if err := mc.Collection.FindOneAndUpdate(ctx, bson.M{"session_id": sessionID}, update, opts).Decode(&msg); err != nil {
+		return nil, err
+	}
+	return &msg, nil
+}
+
+// DeleteMessage 删除会话中的一轮消息，返回删除前的记录；不存在时返回 mongo.ErrNoDocuments
+func (mc *MessageClient) DeleteMessage(sessionID, messageID string) (*MemoryMessage, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var msg MemoryMessage
+	if err := mc.Collection.FindOneAndDelete(ctx, bson.M{"_id": messageID, "session_id": sessionID}).Decode(&msg); err != nil {
+		return nil, err
+	}
+	return &msg, nil
+}
+
+// RequeueClaim 把由 claimID 认领的消息在抽取器 extractor 上重置为 pending，返回重置的消息数；
+// 内置抽取器同时重置只有旧版 taskN_id 的消息。正在执行的任务迟到的完成通知因 claim_id 不匹配不会生效
+func (mc *MessageClient) RequeueClaim(sessionID, extractor, claimID string) (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	field := stateField(extractor)
+	match := []bson.M{{field + ".claim_id": claimID}}
+	if taskField := legacyTaskField(extractor); taskField != "" {
+		match = append(match, bson.M{taskField: claimID, field: bson.M{"$exists": false}})
+	}
+	result, err := mc.Collection.UpdateMany(ctx,
+		bson.M{"session_id": sessionID, "$or": match},
+		bson.M{"$set": bson.M{field: TaskState{State: TaskPending, UpdatedAt: time.Now().UTC()}}},
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.ModifiedCount, nil
+}
+
 // UpdateMessageStatus 更新消息状态
 func (mc *MessageClient) UpdateMessageStatus(messageID string, status int) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
@@ -105,15 +305,22 @@ func (mc *MessageClient) DeleteMessagesBySessionID(sessionID string) error {
 	return err
 }
 
-//  清理逻辑是清理走完流程的消息，但是不保证所有任务处理都成功，这个逻辑考虑到微服务的分离，因此后续要回调函数
+//  清理逻辑只清理所有抽取器都已完成（task_states 为 done）的消息，任务状态由抽取任务的完成通知更新，见 completion.go
 
 // --------------------  清理逻辑 ------------------------
 
 // clearSessionMessages 清理指定 session 下 task1、task2、task3 全部完成的消息（目前只有用到这三个任务， 因此只判断这三个）
 //
 // -----------------------------  新增：最近消息保护：最近 project_messages_count 条消息必定保留 --------------------------------
-// clearSessionMessages 清理指定 session 下 task1、task2、task3 全部完成的消息
-func (mc *MessageClient) clearSessionMessages(sessionID string) error {
+// clearSessionMessages 清理指定 session 下 extractors 全部完成的消息，最近 keep 条消息必定保留（keep <= 0 时使用 PROJECT_MESSAGES_COUNT）
+func (mc *MessageClient) clearSessionMessages(sessionID string, keep int, extractors []string) error {
+	if keep <= 0 {
+		keep = PROJECT_MESSAGES_COUNT
+	}
+	if len(extractors) == 0 {
+		extractors = DefaultExtractors
+	}
+
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
@@ -123,16 +330,18 @@ func (mc *MessageClient) clearSessionMessages(sessionID string) error {
 		return err
 	}
 
-	// 过滤条件：task1_id、task2_id、task3_id 都不为空
+	// 过滤条件：所有抽取器都已完成
+	conds := make([]bson.M, 0, len(extractors))
+	for _, name := range extractors {
+		conds = append(conds, taskDoneFilter(name))
+	}
 	filter := bson.M{
 		"session_id": sessionID,
-		"task1_id":   bson.M{"$ne": ""},
-		"task2_id":   bson.M{"$ne": ""},
-		"task3_id":   bson.M{"$ne": ""},
+		"$and":       conds,
 	}
 
-	// 查询符合条件的消息，按时间排序（假设有 timestamp 字段，越大越新）
-	cursor, err := mc.Collection.Find(ctx, filter, options.Find().SetSort(bson.M{"timestamp": 1}))
+	// 查询符合条件的消息，按创建时间升序
+	cursor, err := mc.Collection.Find(ctx, filter, options.Find().SetSort(messageSort(1)))
 	if err != nil {
 		return err
 	}
@@ -147,7 +356,7 @@ func (mc *MessageClient) clearSessionMessages(sessionID string) error {
 	filteredCount := len(filteredMessages)
 
 
-	if filteredCount <= PROJECT_MESSAGES_COUNT {
+	if filteredCount <= keep {
 		// 如果过滤出的消息数量小于等于要保留的数量，则不删除任何消息
 		//Info(fmt.Sprintf(" ♻️ %s no delete, only %d messages found (<= %d)", SERVER_NAME, filteredCount, keepCount))
 		Info("♻️ filter messages count <= keep count, no need to delete.")
@@ -155,19 +364,19 @@ func (mc *MessageClient) clearSessionMessages(sessionID string) error {
 	}
 
 	
-	// 如果总消息数 - 过滤出的消息数 >= PROJECT_MESSAGES_COUNT，直接删除所有过滤出的消息
-	if int(totalCount)-filteredCount >= PROJECT_MESSAGES_COUNT {
+	// 如果总消息数 - 过滤出的消息数 >= keep，直接删除所有过滤出的消息
+	if int(totalCount)-filteredCount >= keep {
 		// 删除所有符合条件的消息
 		Info(fmt.Sprintf("all masked messages can be deleted."))
 		deleteResult, err := mc.Collection.DeleteMany(ctx, filter)
 		if err != nil {
 			return err
 		}
-		Info(fmt.Sprintf(" ♻️  %s delete %d messages (all 3 tasks done, keep last %d) from session %s", SERVER_NAME, deleteResult.DeletedCount, PROJECT_MESSAGES_COUNT, sessionID))
+		Info(fmt.Sprintf(" ♻️  %s delete %d messages (all extractors done, keep last %d) from session %s", SERVER_NAME, deleteResult.DeletedCount, keep, sessionID))
 		return nil
 	}
-	keepCount := int(PROJECT_MESSAGES_COUNT) - (int(totalCount) - filteredCount)
-	//keepCount取值 [0, PROJECT_MESSAGES_COUNT]
+	keepCount := keep - (int(totalCount) - filteredCount)
+	//keepCount取值 [0, keep]
 
 
 	// 从过滤出的消息中，keepCount 条消息保留，其余的删除
@@ -190,10 +399,20 @@ func (mc *MessageClient) clearSessionMessages(sessionID string) error {
 		return err
 	}
 
-	Info(fmt.Sprintf(" ♻️ %s delete %d messages (all 3 tasks done, keep last %d) from session %s", SERVER_NAME, deleteResult.DeletedCount, PROJECT_MESSAGES_COUNT, sessionID))
+	Info(fmt.Sprintf(" ♻️ %s delete %d messages (all extractors done, keep last %d) from session %s", SERVER_NAME, deleteResult.DeletedCount, keep, sessionID))
 	return nil
 }
 
+// taskDoneFilter 抽取器 name 已完成：task_states 中为 done；内置抽取器没有任务状态的旧消息沿用原来的判断（taskN_id 不为空）
+func taskDoneFilter(name string) bson.M {
+	field := stateField(name)
+	conds := []bson.M{{field + ".state": TaskDone}}
+	if taskField := legacyTaskField(name); taskField != "" {
+		conds = append(conds, bson.M{field: bson.M{"$exists": false}, taskField: bson.M{"$nin": []interface{}{"", nil}}})
+	}
+	return bson.M{"$or": conds}
+}
+
 /*
 // clearSessionMessages 指定sessionID, 清理status == 1 的消息
 
@@ -228,61 +447,161 @@ func (mc *MessageClient) CountMessagesBySessionID(sessionID string) (int64, erro
 	return count, nil
 }
 
-// 查找指定 session 下 taskN_id 为空的消息，并标记为指定 taskID，取消息和标记消息合并
-func (mc *MessageClient) FindAndMarkMessagesWithoutTaskID(sessionID string, taskIndex int, taskID string) ([]MemoryMessage, error) {
+// 认领指定 session 下抽取器 extractor 未认领的消息（task_states 中标记为 claimed，claim_id 为 taskID），返回由 taskID 认领的全部消息
+// 认领在每条文档上是原子的：并发的多个任务不会认领同一条消息，只返回真正被本任务认领的消息；
+// 认领之后才写入的消息保持未认领，留给下一次触发。同一 taskID 重试时会再次返回之前认领的消息。
+func (mc *MessageClient) FindAndMarkMessagesWithoutTaskID(sessionID, extractor, taskID string) ([]MemoryMessage, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	taskField := fmt.Sprintf("task%d_id", taskIndex)
-
-	// 查询条件：taskN_id 不存在或为空
-	filter := bson.M{
-		"session_id": sessionID,
-		"$or": []bson.M{
+	field := stateField(extractor)
+
+	// 认领条件：没有该抽取器的状态，或已被 re-drive 重置为 pending
+	conds := []bson.M{{"$or": []bson.M{
+		{field: bson.M{"$exists": false}},
+		{field + ".state": TaskPending},
+	}}}
+	// 内置抽取器：旧版消息的 taskN_id 不为空时视为已认领
+	if taskField := legacyTaskField(extractor); taskField != "" {
+		conds = append(conds, bson.M{"$or": []bson.M{
+			{field: bson.M{"$exists": true}},
 			{taskField: bson.M{"$exists": false}},
 			{taskField: ""},
-		},
+		}})
 	}
+	filter := bson.M{"session_id": sessionID, "$and": conds}
 
-	// 先查出需要更新的消息
-	var messages []MemoryMessage
-	cursor, err := mc.Collection.Find(ctx, filter)
+	now := time.Now().UTC()
+	update := bson.M{"$set": bson.M{
+		field: TaskState{State: TaskClaimed, ClaimID: taskID, ClaimedAt: now, UpdatedAt: now},
+	}}
+	result, err := mc.Collection.UpdateMany(ctx, filter, update)
 	if err != nil {
 		return nil, err
 	}
+
+	// 按认领结果查询，不受 UpdateMany 前后新写入消息的影响
+	messages := []MemoryMessage{}
+	opts := options.Find().SetSort(messageSort(1))
+	cursor, err := mc.Collection.Find(ctx, bson.M{"session_id": sessionID, field + ".claim_id": taskID}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
 	if err = cursor.All(ctx, &messages); err != nil {
 		return nil, err
 	}
-	cursor.Close(ctx)
 
-	// 如果没有符合条件的消息，直接返回
-	if len(messages) == 0 {
-		return []MemoryMessage{}, nil
+	Info(fmt.Sprintf("%s claimed %d messages (%d returned) with %s for %s in session %s",
+		SERVER_NAME, result.ModifiedCount, len(messages), taskID, extractor, sessionID))
+
+	return messages, nil
+}
+
+// CompleteTask 更新由 claimID 认领的消息在抽取器 extractor 上的状态（done / failed），返回更新的消息数
+// 按 claim_id 匹配：消息已被 re-drive 重置或已被其他任务重新认领时，迟到的完成通知不会覆盖新的状态
+func (mc *MessageClient) CompleteTask(sessionID, extractor, claimID, state, errMsg string) (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	field := stateField(extractor)
+	filter := bson.M{
+		"session_id":        sessionID,
+		field + ".claim_id": claimID,
+	}
+	update := bson.M{"$set": bson.M{
+		field + ".state":      state,
+		field + ".updated_at": time.Now().UTC(),
+		field + ".error":      errMsg,
+	}}
+
+	result, err := mc.Collection.UpdateMany(ctx, filter, update)
+	if err != nil {
+		return 0, err
+	}
+	return result.ModifiedCount, nil
+}
+
+// redriveCond 状态需要 re-drive：认领早于 before 仍未完成，includeFailed 时也包含失败
+func redriveCond(state TaskState, before time.Time, includeFailed bool) bool {
+	if state.State == TaskClaimed && state.ClaimedAt.Before(before) {
+		return true
+	}
+	return includeFailed && state.State == TaskFailed
+}
+
+// redriveFilter task_states 中有任一抽取器需要 re-drive 的消息；抽取器名称不固定，用 $objectToArray 遍历
+func redriveFilter(before time.Time, includeFailed bool) bson.M {
+	cond := bson.M{"$and": bson.A{
+		bson.M{"$eq": bson.A{"$$t.v.state", TaskClaimed}},
+		bson.M{"$lt": bson.A{"$$t.v.claimed_at", before}},
+	}}
+	if includeFailed {
+		cond = bson.M{"$or": bson.A{cond, bson.M{"$eq": bson.A{"$$t.v.state", TaskFailed}}}}
 	}
+	return bson.M{"$expr": bson.M{"$anyElementTrue": bson.A{bson.M{"$map": bson.M{
+		"input": bson.M{"$objectToArray": bson.M{"$ifNull": bson.A{"$task_states", bson.M{}}}},
+		"as":    "t",
+		"in":    cond,
+	}}}}}
+}
 
-	// 更新这些消息的 taskN_id
-	update := bson.M{"$set": bson.M{taskField: taskID}}
-	_, err = mc.Collection.UpdateMany(ctx, filter, update)
+// FindRedriveSessions 查找有需要 re-drive 的消息的会话，最多 limit 个
+func (mc *MessageClient) FindRedriveSessions(before time.Time, includeFailed bool, limit int) ([]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	values, err := mc.Collection.Distinct(ctx, "session_id", redriveFilter(before, includeFailed))
 	if err != nil {
 		return nil, err
 	}
 
-	// 更新返回结果里的 taskN_id
-	for i := range messages {
-		switch taskIndex {
-		case 1:
-			messages[i].Task1 = taskID
-		case 2:
-			messages[i].Task2 = taskID
-		case 3:
-			messages[i].Task3 = taskID
-		case 4:
-			messages[i].Task4 = taskID
+	sessions := make([]string, 0, len(values))
+	for _, v := range values {
+		if id, ok := v.(string); ok {
+			sessions = append(sessions, id)
+		}
+		if len(sessions) >= limit {
+			break
 		}
 	}
+	return sessions, nil
+}
 
-	Info(fmt.Sprintf("%s marked %d messages with %s for task%d in session %s",
-		SERVER_NAME, len(messages), taskID, taskIndex, sessionID))
+// RedriveSession 将会话中认领超时（或失败）的抽取器状态重置为 pending，返回重置的状态数
+// 按原 claim_id 和状态条件更新，期间已完成或被重新认领的状态不受影响
+func (mc *MessageClient) RedriveSession(sessionID string, before time.Time, includeFailed bool) (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
 
-	return messages, nil
+	filter := redriveFilter(before, includeFailed)
+	filter["session_id"] = sessionID
+	cursor, err := mc.Collection.Find(ctx, filter, options.Find().SetProjection(bson.M{"task_states": 1}))
+	if err != nil {
+		return 0, err
+	}
+	var messages []MemoryMessage
+	if err := cursor.All(ctx, &messages); err != nil {
+		return 0, err
+	}
+
+	var total int64
+	now := time.Now().UTC()
+	for _, msg := range messages {
+		for name, state := range msg.TaskStates {
+			if !redriveCond(state, before, includeFailed) {
+				continue
+			}
+			field := stateField(name)
+			result, err := mc.Collection.UpdateOne(ctx,
+				bson.M{"_id": msg.ID, field + ".claim_id": state.ClaimID, field + ".state": state.State},
+				bson.M{"$set": bson.M{field: TaskState{State: TaskPending, UpdatedAt: now}}},
+			)
+			if err != nil {
+				return total, err
+			}
+			total += result.ModifiedCount
+		}
+	}
+	return total, nil
 }
@@ -0,0 +1,208 @@
+package session_messages
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestMarkTaskConcurrent 一边写入消息一边由多个 goroutine 用不同的 task_id 并发认领，校验：
+//   - 每条消息只被一个任务返回，且返回时 task_states 中的 claim_id 就是该任务
+//   - 每条写入的消息最终都被某个任务认领并返回，没有被标记却未返回的消息
+//   - 同一 task_id 重复认领返回相同的消息
+//
+// 需要 MongoDB（config.yaml 中的 mongodb 配置），使用临时会话，结束后删除
+func TestMarkTaskConcurrent(t *testing.T) {
+	const (
+		extractor = EXTRACTOR_USER_PORTRAIT
+		workers   = 8
+		total     = 300
+	)
+	claimOf := func(m MemoryMessage) string { return m.TaskStates[extractor].ClaimID }
+
+	sessionID := "test-mark-task-" + GenerateUUID()
+	t.Cleanup(func() { DBClient.DeleteMessagesBySessionID(sessionID) })
+
+	var (
+		mu      sync.Mutex
+		claimed = map[string]string{} // 消息 ID -> 返回该消息的 task_id
+	)
+	claim := func(taskID string) []MemoryMessage {
+		messages, err := DBClient.FindAndMarkMessagesWithoutTaskID(sessionID, extractor, taskID)
+		if err != nil {
+			t.Errorf("claim with %s: %v", taskID, err)
+			return nil
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		for _, m := range messages {
+			if claimOf(m) != taskID {
+				t.Errorf("message %s returned to %s but claim_id is %s", m.ID, taskID, claimOf(m))
+			}
+			if prev, ok := claimed[m.ID]; ok && prev != taskID {
+				t.Errorf("message %s returned to both %s and %s", m.ID, prev, taskID)
+			}
+			claimed[m.ID] = taskID
+		}
+		return messages
+	}
+
+	// 写入
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < total; i++ {
+			err := DBClient.InsertMessage(&MemoryMessage{
+				ID:          GenerateUUID(),
+				SessionID:   sessionID,
+				UserContent: fmt.Sprintf("message %d", i),
+				CreatedAt:   time.Now().UTC(),
+			})
+			if err != nil {
+				t.Errorf("insert: %v", err)
+				return
+			}
+		}
+	}()
+
+	// 并发认领，直到写入结束
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+					claim(GenerateUUID())
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	// 认领剩余的消息，同一 task_id 重复认领应返回相同的消息
+	lastTask := GenerateUUID()
+	first := claim(lastTask)
+	if again := claim(lastTask); len(again) != len(first) {
+		t.Errorf("repeated claim with the same task_id returned %d messages, first returned %d", len(again), len(first))
+	}
+
+	// 与数据库中的结果比对
+	stored, err := ExportMessages(sessionID)
+	if err != nil {
+		t.Fatalf("export: %v", err)
+	}
+	if len(stored) != total {
+		t.Errorf("inserted %d messages, found %d", total, len(stored))
+	}
+	for _, m := range stored {
+		taskID, ok := claimed[m.ID]
+		switch {
+		case claimOf(m) == "":
+			t.Errorf("message %s was never claimed", m.ID)
+		case !ok:
+			t.Errorf("message %s marked by %s but never returned", m.ID, claimOf(m))
+		case taskID != claimOf(m):
+			t.Errorf("message %s returned to %s but claim_id is %s", m.ID, taskID, claimOf(m))
+		}
+	}
+}
+
+// TestSaveMessagesIdempotent 同一 task_id 重复上传只保存一次，返回相同的 message_ids
+//
+// 需要 MongoDB，使用临时会话，结束后删除
+func TestSaveMessagesIdempotent(t *testing.T) {
+	sessionID := "test-save-" + GenerateUUID()
+	t.Cleanup(func() { DBClient.DeleteMessagesBySessionID(sessionID) })
+
+	messages := []map[string]interface{}{
+		{"role": "user", "content": "u1"}, {"role": "assistant", "content": "a1"},
+		{"role": "user", "content": "u2"}, {"role": "assistant", "content": "a2"},
+	}
+	first, err := SaveMessages(sessionID, messages, "task-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := SaveMessages(sessionID, messages, "task-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(first) != fmt.Sprint(second) {
+		t.Errorf("message ids differ: %v vs %v", first, second)
+	}
+
+	stored, err := DBClient.GetMessagesBySessionID(sessionID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stored) != 2 {
+		t.Errorf("stored %d rounds, want 2", len(stored))
+	}
+}
+
+func TestRoundID(t *testing.T) {
+	if RoundID("t1", 0) != RoundID("t1", 0) {
+		t.Error("RoundID should be deterministic")
+	}
+	seen := map[string]bool{}
+	for _, taskID := range []string{"t1", "t2", "t1/1"} {
+		for i := 0; i < 12; i++ {
+			id := RoundID(taskID, i)
+			if seen[id] {
+				t.Errorf("RoundID(%q, %d) = %s collides", taskID, i, id)
+			}
+			seen[id] = true
+		}
+	}
+}
+
+// TestReplaceLastReplySameUpload 同一次上传的各轮 created_at 相同，最后一轮按轮次序号确定；需要 MongoDB
+func TestReplaceLastReplySameUpload(t *testing.T) {
+	sessionID := "test-regenerate-" + GenerateUUID()
+	t.Cleanup(func() { DBClient.DeleteMessagesBySessionID(sessionID) })
+
+	var messages []map[string]interface{}
+	for i := 0; i < 5; i++ {
+		messages = append(messages,
+			map[string]interface{}{"role": "user", "content": fmt.Sprintf("u%d", i)},
+			map[string]interface{}{"role": "assistant", "content": fmt.Sprintf("a%d", i)})
+	}
+	ids, err := SaveMessages(sessionID, messages, "task-"+GenerateUUID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	last := ids[len(ids)-1]
+
+	// 不是最后一轮时不修改
+	before, err := DBClient.ReplaceLastReply(sessionID, ids[0], "x")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if before.ID != last {
+		t.Errorf("last round = %s, want %s", before.ID, last)
+	}
+
+	if before, err = DBClient.ReplaceLastReply(sessionID, last, "new"); err != nil {
+		t.Fatal(err)
+	}
+	if before.ID != last || before.AssistantContent != "a4" {
+		t.Errorf("replaced %s (%q), want %s (a4)", before.ID, before.AssistantContent, last)
+	}
+	stored, err := DBClient.GetMessagesBySessionID(sessionID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, m := range stored {
+		want := fmt.Sprintf("a%d", i)
+		if i == len(stored)-1 {
+			want = "new"
+		}
+		if m.ID != ids[i] || m.AssistantContent != want {
+			t.Errorf("round %d = %s %q, want %s %q", i, m.ID, m.AssistantContent, ids[i], want)
+		}
+	}
+}
@@ -0,0 +1,129 @@
+package session_messages
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// --------------------- 单条消息的修改：编辑内容、删除一轮、替换最后一轮的回复（重新生成） -----------------------------
+//
+// 消息在 task_states 中记录了认领它的抽取任务（claim_id），旧版消息记录在 taskN_id 中。
+// 消息被修改或删除后，把同一批次（同一抽取器、同一 claim_id）中仍存在的消息重置为 pending，
+// 并把会话写入主服务的补齐集合，由主服务在会话空闲后重新认领并抽取
+
+// MessageChange 修改结果
+type MessageChange struct {
+	MessageID string            `json:"message_id"`
+	Requeued  map[string]int64  `json:"requeued"` // 以抽取器名称为 key，重新等待抽取的消息数
+	Claims    map[string]string `json:"claims"`   // 以抽取器名称为 key，重新排队的批次的 claim_id，由主服务删除该批次已抽取的结果
+}
+
+// EditMessage 修改一轮消息的 user / assistant 内容，为 nil 的字段保持不变
+func EditMessage(ctx context.Context, sessionID, messageID string, userContent, assistantContent *string) (*MessageChange, error) {
+	if sessionID == "" || messageID == "" {
+		return nil, fmt.Errorf("%s session_id and message_id are required", SERVER_NAME)
+	}
+	if userContent == nil && assistantContent == nil {
+		return nil, fmt.Errorf("user_content or assistant_content is required")
+	}
+	if (userContent != nil && strings.TrimSpace(*userContent) == "") || (assistantContent != nil && strings.TrimSpace(*assistantContent) == "") {
+		return nil, fmt.Errorf("content must not be empty, delete the round instead")
+	}
+
+	// 修改与读取修改前的认领状态在同一次操作中完成
+	msg, err := DBClient.UpdateMessageContent(sessionID, messageID, userContent, assistantContent)
+	if err != nil {
+		return nil, notFound(err, messageID)
+	}
+	return afterChange(ctx, msg)
+}
+
+// DeleteRound 删除一轮消息，同批次的其他消息重新抽取
+func DeleteRound(ctx context.Context, sessionID, messageID string) (*MessageChange, error) {
+	if sessionID == "" || messageID == "" {
+		return nil, fmt.Errorf("%s session_id and message_id are required", SERVER_NAME)
+	}
+
+	msg, err := DBClient.DeleteMessage(sessionID, messageID)
+	if err != nil {
+		return nil, notFound(err, messageID)
+	}
+	return afterChange(ctx, msg)
+}
+
+// RegenerateReply 替换会话最后一轮的 assistant 回复；messageID 不为空时必须是最后一轮，避免替换到新上传的消息
+func RegenerateReply(ctx context.Context, sessionID, messageID, content string) (*MessageChange, error) {
+	if sessionID == "" {
+		return nil, fmt.Errorf("%s session_id is required", SERVER_NAME)
+	}
+	if strings.TrimSpace(content) == "" {
+		return nil, fmt.Errorf("assistant_content is required")
+	}
+
+	last, err := DBClient.ReplaceLastReply(sessionID, messageID, content)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, fmt.Errorf("session %s has no messages", sessionID)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to replace last reply: %w", err)
+	}
+	if messageID != "" && messageID != last.ID {
+		// 最后一轮不是该消息时 ReplaceLastReply 没有修改
+		return nil, fmt.Errorf("message %s is not the last round, last is %s", messageID, last.ID)
+	}
+	return afterChange(ctx, last)
+}
+
+// notFound 消息不存在时返回明确的错误
+func notFound(err error, messageID string) error {
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return fmt.Errorf("message %s not found", messageID)
+	}
+	return fmt.Errorf("failed to change message %s: %w", messageID, err)
+}
+
+// afterChange 重新排队抽取修改前认领过该消息的批次，并通知记忆变更
+func afterChange(ctx context.Context, msg *MemoryMessage) (*MessageChange, error) {
+	change := &MessageChange{MessageID: msg.ID, Requeued: map[string]int64{}, Claims: map[string]string{}}
+	for name, claimID := range consumers(msg) {
+		count, err := DBClient.RequeueClaim(msg.SessionID, name, claimID)
+		if err != nil {
+			return change, fmt.Errorf("failed to requeue %s: %w", name, err)
+		}
+		change.Requeued[name] = count
+		change.Claims[name] = claimID
+	}
+
+	if len(change.Requeued) > 0 {
+		if err := markFlushPending(ctx, msg.SessionID); err != nil {
+			log.Printf("⚠️ Mark session %s for flush failed: %v", msg.SessionID, err)
+		}
+	}
+	NotifyMemoryChanged(ctx, msg.SessionID)
+	Info("%s message %s changed in session %s, requeued %v", SERVER_NAME, msg.ID, msg.SessionID, change.Requeued)
+	return change, nil
+}
+
+// consumers 认领过该消息的抽取任务，以抽取器名称为 key，值为 claim_id；
+// 未认领（pending）的抽取器之后会读到修改后的内容，不需要重新排队
+func consumers(msg *MemoryMessage) map[string]string {
+	result := map[string]string{}
+	for name, state := range msg.TaskStates {
+		if state.State != TaskPending && state.ClaimID != "" {
+			result[name] = state.ClaimID
+		}
+	}
+	// 旧版消息：内置抽取器没有 task_states 时使用 taskN_id
+	for i, taskID := range []string{msg.Task1, msg.Task2, msg.Task3, msg.Task4} {
+		name := legacyExtractors[i+1]
+		if _, ok := msg.TaskStates[name]; !ok && taskID != "" {
+			result[name] = taskID
+		}
+	}
+	return result
+}
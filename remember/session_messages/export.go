@@ -0,0 +1,115 @@
+package session_messages
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// --------------------- 导出与导入：主服务 /memory/export、/memory/import 按会话迁移全部消息 -----------------------------
+
+// ImportResult 导入结果
+type ImportResult struct {
+	Imported int  `json:"imported"` // 写入的消息数
+	Skipped  bool `json:"skipped"`  // skip 模式下会话已有消息，未写入
+}
+
+// ExportMessages 导出会话的全部消息（含任务标记），按创建时间升序
+func ExportMessages(sessionID string) ([]MemoryMessage, error) {
+	if sessionID == "" {
+		return nil, fmt.Errorf("%s session_id is required", SERVER_NAME)
+	}
+	messages, err := DBClient.GetMessagesBySessionID(sessionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to export messages: %w", err)
+	}
+	if messages == nil {
+		messages = []MemoryMessage{}
+	}
+	return messages, nil
+}
+
+// ImportMessages 将消息导入会话，session_id 改为目标会话并重新生成 _id
+func ImportMessages(sessionID, mode string, messages []MemoryMessage) (*ImportResult, error) {
+	if sessionID == "" {
+		return nil, fmt.Errorf("%s session_id is required", SERVER_NAME)
+	}
+	if mode != ImportReplace && mode != ImportMerge && mode != ImportSkip {
+		return nil, fmt.Errorf("%s invalid import mode: %s", SERVER_NAME, mode)
+	}
+
+	result, err := DBClient.importMessages(sessionID, mode, messages)
+	if err != nil {
+		return nil, fmt.Errorf("failed to import messages: %w", err)
+	}
+	if result.Imported > 0 || mode == ImportReplace {
+		NotifyMemoryChanged(context.Background(), sessionID)
+	}
+	return result, nil
+}
+
+// messageKey merge 模式下判断消息是否已存在：优先使用消息轮次ID
+func messageKey(m MemoryMessage) string {
+	if m.MessagesID != "" {
+		return "id:" + m.MessagesID
+	}
+	return fmt.Sprintf("%d\x00%s\x00%s", m.CreatedAt.UnixMilli(), m.UserContent, m.AssistantContent)
+}
+
+func (mc *MessageClient) importMessages(sessionID, mode string, messages []MemoryMessage) (*ImportResult, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), ImportTimeout*time.Second)
+	defer cancel()
+
+	filter := bson.M{"session_id": sessionID}
+	switch mode {
+	case ImportSkip:
+		count, err := mc.Collection.CountDocuments(ctx, filter)
+		if err != nil {
+			return nil, err
+		}
+		if count > 0 {
+			return &ImportResult{Skipped: true}, nil
+		}
+	case ImportReplace:
+		if _, err := mc.Collection.DeleteMany(ctx, filter); err != nil {
+			return nil, err
+		}
+	case ImportMerge:
+		existing, err := mc.GetMessagesBySessionID(sessionID)
+		if err != nil {
+			return nil, err
+		}
+		seen := make(map[string]bool, len(existing))
+		for _, m := range existing {
+			seen[messageKey(m)] = true
+		}
+		kept := messages[:0:0]
+		for _, m := range messages {
+			if key := messageKey(m); !seen[key] {
+				seen[key] = true
+				kept = append(kept, m)
+			}
+		}
+		messages = kept
+	}
+
+	if len(messages) == 0 {
+		return &ImportResult{}, nil
+	}
+	docs := make([]interface{}, 0, len(messages))
+	for _, m := range messages {
+		m.ID = GenerateUUID()
+		m.SessionID = sessionID
+		if m.CreatedAt.IsZero() {
+			m.CreatedAt = time.Now().UTC()
+		}
+		docs = append(docs, m)
+	}
+	if _, err := mc.Collection.InsertMany(ctx, docs); err != nil {
+		return nil, err
+	}
+	Info("%s imported %d messages into session %s, mode=%s", SERVER_NAME, len(docs), sessionID, mode)
+	return &ImportResult{Imported: len(docs)}, nil
+}
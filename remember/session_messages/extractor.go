@@ -0,0 +1,49 @@
+package session_messages
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// --------------------- 抽取器：task_states 以抽取器名称为 key 记录每条消息的处理状态 -----------------------------
+//
+// 主服务的抽取器注册表决定有哪些抽取器，session_messages 只按名称记录状态；
+// 旧版消息用 task1_id ~ task4_id 记录认领，内置抽取器在没有 task_states 时沿用对应的 taskN_id
+
+// extractorNamePattern 抽取器名称同时是 MongoDB 字段名，只允许小写字母、数字和下划线
+var extractorNamePattern = regexp.MustCompile(`^[a-z][a-z0-9_]{0,63}$`)
+
+// legacyExtractors 旧版 task_index 对应的抽取器，下标为 task_index
+var legacyExtractors = []string{"", EXTRACTOR_USER_PORTRAIT, EXTRACTOR_CHAT_EVENT, EXTRACTOR_TOPIC_SUMMARY, EXTRACTOR_RESERVED}
+
+// DefaultExtractors 清理时未指定抽取器，需要全部完成的抽取器
+var DefaultExtractors = []string{EXTRACTOR_USER_PORTRAIT, EXTRACTOR_CHAT_EVENT, EXTRACTOR_TOPIC_SUMMARY}
+
+// ResolveExtractor 优先使用 name，为空时按旧版 task_index 转换
+func ResolveExtractor(name string, taskIndex int) (string, error) {
+	if name == "" {
+		if taskIndex < 1 || taskIndex >= len(legacyExtractors) {
+			return "", fmt.Errorf("extractor or task_index (1~4) is required")
+		}
+		return legacyExtractors[taskIndex], nil
+	}
+	if !extractorNamePattern.MatchString(name) {
+		return "", fmt.Errorf("invalid extractor name: %s", name)
+	}
+	return name, nil
+}
+
+// legacyTaskField 内置抽取器对应的旧版 taskN_id 字段，自定义抽取器返回空
+func legacyTaskField(name string) string {
+	for i, n := range legacyExtractors {
+		if i > 0 && n == name {
+			return fmt.Sprintf("task%d_id", i)
+		}
+	}
+	return ""
+}
+
+// stateField 抽取器在 task_states 中的字段
+func stateField(name string) string {
+	return "task_states." + name
+}
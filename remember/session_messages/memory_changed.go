@@ -0,0 +1,27 @@
+package session_messages
+
+import (
+	"context"
+	"time"
+
+	"remember/taskqueue"
+)
+
+// --------------------- 记忆变更通知：会话消息变更后使主服务的 apply 缓存失效，实现见 remember/taskqueue -----------------------------
+
+var memoryNotifier *taskqueue.MemoryNotifier
+
+func init() {
+	memoryNotifier = &taskqueue.MemoryNotifier{
+		Redis:       RedisClient,
+		GenPrefix:   APPLY_GEN_PREFIX,
+		CachePrefix: APPLY_CACHE_PREFIX,
+		Channel:     MEMORY_CHANGED_CHANNEL,
+		GenTTL:      ApplyGenTTL * time.Second,
+	}
+}
+
+// NotifyMemoryChanged 递增会话记忆版本号、删除 apply 缓存并发布变更通知，失败只记录日志
+func NotifyMemoryChanged(ctx context.Context, sessionID string) {
+	memoryNotifier.Notify(ctx, sessionID, MEMORY_SOURCE)
+}
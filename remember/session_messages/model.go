@@ -10,12 +10,24 @@ type MemoryMessage struct {
 	AssistantContent string    `bson:"assistant_content"` // 助手回复
 	CreatedAt        time.Time `bson:"created_at"`        // 创建时间
 	MessagesID       string    `bson:"messages_id"`       // 消息轮次ID
-	//-------------- taskN 的设计是为了区分不同任务的完成情况，有task_id则说明该任务正在进行中或者已完成
+	Index            int       `bson:"index"`             // 在本次上传中的轮次序号；同一次上传的各轮 created_at 相同，按序号排列（旧消息没有该字段，按 0 处理）
+	//-------------- taskN 的设计是为了区分不同任务的完成情况，有task_id则说明该任务正在进行中或者已完成（旧版字段，新消息使用 task_states）
 	Task1  string `bson:"task1_id"` // 任务1 用户画像
 	Task2  string `bson:"task2_id"` // 任务2 关键事件
 	Task3  string `bson:"task3_id"` // 任务3 主题归纳
 	Task4  string `bson:"task4_id"` // 任务4 预留位
 	Status int    `bson:"status"`   // 状态  1: 已完成   0: 待处理  -1: 失败
+	//-------------- 各抽取器的认领与完成情况，抽取器由主服务注册，见 extractor.go
+	TaskStates map[string]TaskState `bson:"task_states,omitempty"` // 各抽取器的状态，key 为抽取器名称
+}
+
+// TaskState 消息在某个抽取器上的状态
+type TaskState struct {
+	State     string    `bson:"state"`           // pending / claimed / done / failed
+	ClaimID   string    `bson:"claim_id"`        // 认领消息的 task_id，完成通知据此匹配
+	ClaimedAt time.Time `bson:"claimed_at"`      // 认领时间，re-drive 以此判断是否超时
+	UpdatedAt time.Time `bson:"updated_at"`      // 最后一次状态变更时间
+	Error     string    `bson:"error,omitempty"` // 任务失败时的错误
 }
 
 // Message 消息结构
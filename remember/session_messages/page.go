@@ -0,0 +1,152 @@
+package session_messages
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// --------------------- 分页查询：按 created_at、轮次序号、_id 排序的游标分页，单位为一轮对话（一条存储记录） -----------------------------
+//
+// 同一次上传的各轮 created_at 相同，由轮次序号（index）决定先后，见 messageSort；
+// 游标是某一轮的 created_at（毫秒）、index 与 _id 编码后的字符串，before / after 分别取紧挨该轮之前 / 之后的一页，
+// 页内始终按 order 排序，例如 desc 时用 before=end_cursor 翻到更早的一页，用 after=start_cursor 翻回更新的一页；
+// total 只按 since / until 统计（CountDocuments），与游标无关
+
+// 排序方式
+const (
+	OrderDesc = "desc" // 最新的在前（默认）
+	OrderAsc  = "asc"  // 最早的在前
+)
+
+// MessageQuery 分页查询条件
+type MessageQuery struct {
+	Limit  int64     // 每页轮数，<= 0 时使用 MessagePageLimit
+	Before string    // 只返回该游标之前的记录
+	After  string    // 只返回该游标之后的记录
+	Since  time.Time // created_at >= since，零值不过滤
+	Until  time.Time // created_at < until，零值不过滤
+	Order  string    // desc | asc，为空时为 desc
+}
+
+// MessagePage 分页查询结果
+type MessagePage struct {
+	Messages    []map[string]string `json:"messages"`     // 格式与 GetMessages 相同，按 order 排序
+	Total       int64               `json:"total"`        // 满足 since / until 的总轮数
+	HasMore     bool                `json:"has_more"`     // 沿翻页方向是否还有记录：before 为更早、after 为更新，没有游标时为 order 方向
+	StartCursor string              `json:"start_cursor"` // 本页第一轮的游标，没有记录时为空
+	EndCursor   string              `json:"end_cursor"`   // 本页最后一轮的游标，没有记录时为空
+}
+
+// messageCursor 解码后的游标
+type messageCursor struct {
+	CreatedAt time.Time
+	Index     int
+	ID        string
+}
+
+// encodeCursor 编码游标
+func encodeCursor(msg MemoryMessage) string {
+	raw := strconv.FormatInt(msg.CreatedAt.UnixMilli(), 10) + ":" + strconv.Itoa(msg.Index) + ":" + msg.ID
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// decodeCursor 解码游标，空字符串返回 nil
+func decodeCursor(cursor string) (*messageCursor, error) {
+	if cursor == "" {
+		return nil, nil
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cursor: %s", cursor)
+	}
+	parts := strings.SplitN(string(raw), ":", 3)
+	if len(parts) != 3 || parts[2] == "" {
+		return nil, fmt.Errorf("invalid cursor: %s", cursor)
+	}
+	ms, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cursor: %s", cursor)
+	}
+	index, err := strconv.Atoi(parts[1])
+	if err != nil || index < 0 {
+		return nil, fmt.Errorf("invalid cursor: %s", cursor)
+	}
+	return &messageCursor{CreatedAt: time.UnixMilli(ms).UTC(), Index: index, ID: parts[2]}, nil
+}
+
+// ParseMessageQuery 从 URL 参数解析分页条件（limit、before、after、since、until、order），没有任何分页参数时 ok 为 false
+func ParseMessageQuery(values url.Values) (q MessageQuery, ok bool, err error) {
+	for _, key := range []string{"limit", "before", "after", "since", "until", "order"} {
+		if values.Has(key) {
+			ok = true
+		}
+	}
+	if !ok {
+		return q, false, nil
+	}
+
+	if v := values.Get("limit"); v != "" {
+		if q.Limit, err = strconv.ParseInt(v, 10, 64); err != nil {
+			return q, true, fmt.Errorf("invalid limit: %s", v)
+		}
+	}
+	for key, t := range map[string]*time.Time{"since": &q.Since, "until": &q.Until} {
+		if v := values.Get(key); v != "" {
+			if *t, err = time.Parse(time.RFC3339, v); err != nil {
+				return q, true, fmt.Errorf("invalid %s, RFC3339 required: %s", key, v)
+			}
+		}
+	}
+	q.Before, q.After, q.Order = values.Get("before"), values.Get("after"), values.Get("order")
+	return q, true, nil
+}
+
+// GetMessagePage 分页获取会话消息
+func GetMessagePage(sessionID string, q MessageQuery) (*MessagePage, error) {
+	if sessionID == "" {
+		return nil, fmt.Errorf("%s session_id is required", SERVER_NAME)
+	}
+	if q.Limit <= 0 {
+		q.Limit = MessagePageLimit
+	}
+	if q.Limit > MaxMessagePageLimit {
+		return nil, fmt.Errorf("limit must be <= %d", MaxMessagePageLimit)
+	}
+	if q.Order == "" {
+		q.Order = OrderDesc
+	}
+	if q.Order != OrderDesc && q.Order != OrderAsc {
+		return nil, fmt.Errorf("invalid order: %s", q.Order)
+	}
+	if !q.Since.IsZero() && !q.Until.IsZero() && !q.Since.Before(q.Until) {
+		return nil, fmt.Errorf("since must be before until")
+	}
+	before, err := decodeCursor(q.Before)
+	if err != nil {
+		return nil, err
+	}
+	after, err := decodeCursor(q.After)
+	if err != nil {
+		return nil, err
+	}
+
+	messages, hasMore, total, err := DBClient.GetMessagesPage(sessionID, q, before, after)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get messages: %w", err)
+	}
+
+	page := &MessagePage{
+		Messages: formatMessagesToRoleContent(messages),
+		Total:    total,
+		HasMore:  hasMore,
+	}
+	if len(messages) > 0 {
+		page.StartCursor = encodeCursor(messages[0])
+		page.EndCursor = encodeCursor(messages[len(messages)-1])
+	}
+	return page, nil
+}
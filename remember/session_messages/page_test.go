@@ -0,0 +1,147 @@
+package session_messages
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestCursorRoundTrip(t *testing.T) {
+	created := time.Date(2026, 1, 2, 3, 4, 5, 678e6, time.UTC)
+	tests := []struct {
+		name string
+		msg  MemoryMessage
+	}{
+		{"uuid", MemoryMessage{ID: "7b1f5c1e-2d0c-4a8e-9b8e-1f2a3b4c5d6e", CreatedAt: created}},
+		{"index", MemoryMessage{ID: "x", CreatedAt: created, Index: 12}},
+		{"id with colon", MemoryMessage{ID: "a:b", CreatedAt: created, Index: 1}},
+		{"epoch", MemoryMessage{ID: "x", CreatedAt: time.UnixMilli(0).UTC()}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cursor, err := decodeCursor(encodeCursor(tt.msg))
+			if err != nil {
+				t.Fatalf("decodeCursor: %v", err)
+			}
+			if cursor.ID != tt.msg.ID || cursor.Index != tt.msg.Index || !cursor.CreatedAt.Equal(tt.msg.CreatedAt) {
+				t.Errorf("got %+v, want id=%s index=%d created_at=%s", cursor, tt.msg.ID, tt.msg.Index, tt.msg.CreatedAt)
+			}
+		})
+	}
+}
+
+func TestDecodeCursorInvalid(t *testing.T) {
+	// 非 base64、没有冒号、缺少 index、时间不是数字、index 不是数字、id 为空
+	for _, cursor := range []string{"!!", "bm9jb2xvbg", "MTIzOmlk", "YWJjOjA6aWQ", "MTIzOng6aWQ", "MTIzOjA6"} {
+		if _, err := decodeCursor(cursor); err == nil {
+			t.Errorf("decodeCursor(%q) should fail", cursor)
+		}
+	}
+	if cursor, err := decodeCursor(""); cursor != nil || err != nil {
+		t.Errorf("decodeCursor(\"\") = %v, %v, want nil, nil", cursor, err)
+	}
+}
+
+// pageIDs 一页中各轮的 message_id，按页内顺序
+func pageIDs(page *MessagePage) []string {
+	var ids []string
+	for _, m := range page.Messages {
+		if m["role"] == "user" {
+			ids = append(ids, m["message_id"])
+		}
+	}
+	return ids
+}
+
+// TestGetMessagePageCursors 沿两个方向翻页后再翻回，每一页都应与之前取到的相同；需要 MongoDB
+func TestGetMessagePageCursors(t *testing.T) {
+	sessionID := "test-page-" + GenerateUUID()
+	t.Cleanup(func() { DBClient.DeleteMessagesBySessionID(sessionID) })
+
+	// 7 轮，第 2 ~ 4 轮是同一次上传（created_at 相同），按 index 区分先后；_id 的顺序与写入顺序相反，
+	// 最后两轮 created_at 相同且 index 都为 0（旧消息），按 _id 区分先后
+	base := time.Now().UTC().Truncate(time.Millisecond).Add(-time.Hour)
+	var all []string
+	for i := 0; i < 7; i++ {
+		created, index := base.Add(time.Duration(i)*time.Second), 0
+		if i >= 2 && i <= 4 {
+			created, index = base.Add(2*time.Second), i-2
+		}
+		id := fmt.Sprintf("r%d", 9-i)
+		if i == 6 {
+			created, id = base.Add(5*time.Second), "r4a"
+		}
+		msg := &MemoryMessage{ID: id, SessionID: sessionID, UserContent: "u" + id, AssistantContent: "a" + id, CreatedAt: created, Index: index}
+		if err := DBClient.InsertMessage(msg); err != nil {
+			t.Fatalf("insert: %v", err)
+		}
+		all = append(all, id)
+	}
+
+	for _, order := range []string{OrderDesc, OrderAsc} {
+		t.Run(order, func(t *testing.T) {
+			// 向后翻页：desc 用 before=end_cursor，asc 用 after=end_cursor
+			next := func(q *MessageQuery, cursor string) {
+				q.Before, q.After = "", ""
+				if order == OrderDesc {
+					q.Before = cursor
+				} else {
+					q.After = cursor
+				}
+			}
+			prev := func(q *MessageQuery, cursor string) {
+				q.Before, q.After = "", ""
+				if order == OrderDesc {
+					q.After = cursor
+				} else {
+					q.Before = cursor
+				}
+			}
+
+			q := MessageQuery{Limit: 3, Order: order}
+			var pages []*MessagePage
+			var seen []string
+			for {
+				page, err := GetMessagePage(sessionID, q)
+				if err != nil {
+					t.Fatalf("GetMessagePage: %v", err)
+				}
+				if page.Total != int64(len(all)) {
+					t.Fatalf("total = %d, want %d", page.Total, len(all))
+				}
+				pages = append(pages, page)
+				seen = append(seen, pageIDs(page)...)
+				if !page.HasMore {
+					break
+				}
+				next(&q, page.EndCursor)
+			}
+
+			want := append([]string(nil), all...)
+			if order == OrderDesc {
+				for i, j := 0, len(want)-1; i < j; i, j = i+1, j-1 {
+					want[i], want[j] = want[j], want[i]
+				}
+			}
+			if !reflect.DeepEqual(seen, want) {
+				t.Fatalf("forward pages = %v, want %v", seen, want)
+			}
+
+			// 从最后一页翻回第一页
+			for i := len(pages) - 1; i > 0; i-- {
+				prev(&q, pages[i].StartCursor)
+				page, err := GetMessagePage(sessionID, q)
+				if err != nil {
+					t.Fatalf("GetMessagePage: %v", err)
+				}
+				if got, want := pageIDs(page), pageIDs(pages[i-1]); !reflect.DeepEqual(got, want) {
+					t.Errorf("back to page %d = %v, want %v", i-1, got, want)
+				}
+				if page.HasMore != (i-1 > 0) {
+					t.Errorf("back to page %d has_more = %v", i-1, page.HasMore)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,104 @@
+package session_messages
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// --------------------- re-drive：下游任务丢失（进程崩溃、完成通知丢失、主服务任务进入死信等）时，消息会一直停留在 claimed -----------------------------
+//
+// 认领超过 ClaimTimeout 仍未完成的抽取器状态重置为 pending，同时把会话写入主服务的补齐集合，
+// 由主服务的 FlushScheduler 在会话空闲后重新认领并触发抽取任务
+
+// RedriveResult re-drive 结果，以 session_id 为 key 的重置消息数
+type RedriveResult struct {
+	Sessions map[string]int64 `json:"sessions"`
+	Total    int64            `json:"total"`
+}
+
+// Redrive 重置认领超时的消息；sessionID 为空时扫描所有会话（最多 RedriveBatch 个），includeFailed 时也重置失败的消息
+func Redrive(ctx context.Context, sessionID string, includeFailed bool) (*RedriveResult, error) {
+	before := time.Now().UTC().Add(-ClaimTimeout * time.Second)
+
+	sessions := []string{sessionID}
+	if sessionID == "" {
+		found, err := DBClient.FindRedriveSessions(before, includeFailed, RedriveBatch)
+		if err != nil {
+			return nil, fmt.Errorf("failed to find sessions to redrive: %w", err)
+		}
+		sessions = found
+	}
+
+	result := &RedriveResult{Sessions: map[string]int64{}}
+	for _, id := range sessions {
+		count, err := DBClient.RedriveSession(id, before, includeFailed)
+		if err != nil {
+			return result, fmt.Errorf("failed to redrive session %s: %w", id, err)
+		}
+		if count == 0 {
+			continue
+		}
+		result.Sessions[id] = count
+		result.Total += count
+
+		if err := markFlushPending(ctx, id); err != nil {
+			log.Printf("⚠️ Mark session %s for flush failed: %v", id, err)
+		}
+		Warn("%s redrive %d stale claimed messages in session %s", SERVER_NAME, count, id)
+	}
+	return result, nil
+}
+
+// markFlushPending 把会话写入主服务的补齐集合（已存在时保留原来的时间）
+func markFlushPending(ctx context.Context, sessionID string) error {
+	now := float64(time.Now().UnixMilli())
+	_, err := RedisClient.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.ZAddNX(ctx, FLUSH_IDLE_KEY, redis.Z{Score: now, Member: sessionID})
+		pipe.ZAddNX(ctx, FLUSH_STALE_KEY, redis.Z{Score: now, Member: sessionID})
+		return nil
+	})
+	return err
+}
+
+// Redriver 定期执行 re-drive
+type Redriver struct {
+	Interval time.Duration
+	StopCh   chan struct{}
+}
+
+// NewRedriver 创建 Redriver
+func NewRedriver(interval time.Duration) *Redriver {
+	return &Redriver{
+		Interval: interval,
+		StopCh:   make(chan struct{}),
+	}
+}
+
+// Start 启动 Redriver
+func (r *Redriver) Start() {
+	go func() {
+		log.Printf("✅ Redriver started, interval=%s, claim timeout=%ds", r.Interval, ClaimTimeout)
+		ticker := time.NewTicker(r.Interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-r.StopCh:
+				log.Println("🛑 Redriver stopped")
+				return
+			case <-ticker.C:
+				if _, err := Redrive(context.Background(), "", false); err != nil {
+					log.Printf("⚠️ Redriver error: %v", err)
+				}
+			}
+		}
+	}()
+}
+
+// Stop 停止 Redriver
+func (r *Redriver) Stop() {
+	close(r.StopCh)
+}
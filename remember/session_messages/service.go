@@ -0,0 +1,127 @@
+package session_messages
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// --------------------- service.go 会话消息的业务逻辑，HTTP 接口与单进程模式共用 -----------------------------
+
+// SaveMessages 保存一轮对话，user/assistant 成对存储，返回 message_ids
+// 队列至少交付一次，同一任务可能重复上传：有 task_id 时每轮的 _id 由 task_id 和轮次序号确定，已保存的轮次跳过
+func SaveMessages(sessionID string, messages []map[string]interface{}, taskID string) ([]string, error) {
+	if sessionID == "" {
+		return nil, fmt.Errorf("%s session_id is required", SERVER_NAME)
+	}
+
+	// 处理 messages 数组，过滤非支持字段并确保成对
+	processedMessages, err := processMessages(messages)
+	if err != nil {
+		return nil, fmt.Errorf("invalid messages format: %s", err.Error())
+	}
+
+	var messageIDs []string
+	now := time.Now().UTC() // 同一次上传的各轮使用相同的 created_at，先后由 Index 决定
+	for i, msg := range processedMessages {
+		id := GenerateUUID()
+		if taskID != "" {
+			id = RoundID(taskID, i)
+		}
+		// task.... 默认为空
+		message := MemoryMessage{
+			ID:               id,
+			SessionID:        sessionID,
+			UserContent:      msg.UserContent,
+			AssistantContent: msg.AssistantContent,
+			CreatedAt:        now,
+			MessagesID:       taskID,
+			Index:            i,
+			Status:           0, // 默认为待处理
+		}
+
+		if err := DBClient.InsertMessage(&message); err != nil && !mongo.IsDuplicateKeyError(err) {
+			return nil, fmt.Errorf("failed to %s insert message", SERVER_NAME)
+		}
+		messageIDs = append(messageIDs, message.ID)
+	}
+	NotifyMemoryChanged(context.Background(), sessionID)
+	return messageIDs, nil
+}
+
+// GetMessages 获取会话消息，格式为 [{"role","content","timestamp","created_at"}]
+func GetMessages(sessionID string) ([]map[string]string, error) {
+	messages, err := DBClient.GetMessagesBySessionID(sessionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get messages: %w", err)
+	}
+	return formatMessagesToRoleContent(messages), nil
+}
+
+// GetMessagesBatch 批量获取多个会话的消息，以 session_id 为 key，格式与 GetMessages 相同
+func GetMessagesBatch(sessionIDs []string) (map[string][]map[string]string, error) {
+	if len(sessionIDs) == 0 || len(sessionIDs) > MaxBatchSessions {
+		return nil, fmt.Errorf("session_ids is required, at most %d", MaxBatchSessions)
+	}
+	messages, err := DBClient.GetMessagesBySessionIDs(sessionIDs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get messages: %w", err)
+	}
+
+	result := make(map[string][]map[string]string, len(sessionIDs))
+	for _, sessionID := range sessionIDs {
+		result[sessionID] = formatMessagesToRoleContent(messages[sessionID])
+	}
+	return result, nil
+}
+
+// CountMessages 当前会话中的消息数量
+func CountMessages(sessionID string) (int64, error) {
+	count, err := DBClient.CountMessagesBySessionID(sessionID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count messages: %w", err)
+	}
+	return count, nil
+}
+
+// MarkTaskMessages 认领抽取器 extractor 未认领的消息，标记为 taskID，返回被标记的消息；extractor 为空时按旧版 taskIndex 转换
+func MarkTaskMessages(sessionID, extractor string, taskIndex int, taskID string) ([]map[string]string, error) {
+	if sessionID == "" || taskID == "" {
+		return nil, fmt.Errorf("invalid params: session_id, task_id required")
+	}
+	name, err := ResolveExtractor(extractor, taskIndex)
+	if err != nil {
+		return nil, fmt.Errorf("invalid params: %w", err)
+	}
+
+	messages, err := DBClient.FindAndMarkMessagesWithoutTaskID(sessionID, name, taskID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to mark messages: %w", err)
+	}
+	return formatMessagesToRoleContent(messages), nil
+}
+
+// CleanMessages 清理 extractors 都已完成的消息，保留最近 keep 条（keep <= 0 时使用 PROJECT_MESSAGES_COUNT，extractors 为空时使用 DefaultExtractors）
+func CleanMessages(sessionID string, keep int, extractors []string) error {
+	for _, name := range extractors {
+		if _, err := ResolveExtractor(name, 0); err != nil {
+			return err
+		}
+	}
+	if err := DBClient.clearSessionMessages(sessionID, keep, extractors); err != nil {
+		return fmt.Errorf("failed to clean messages: %w", err)
+	}
+	NotifyMemoryChanged(context.Background(), sessionID)
+	return nil
+}
+
+// DeleteMessages 删除会话的所有消息
+func DeleteMessages(sessionID string) error {
+	if err := DBClient.DeleteMessagesBySessionID(sessionID); err != nil {
+		return fmt.Errorf("failed to delete messages: %w", err)
+	}
+	NotifyMemoryChanged(context.Background(), sessionID)
+	return nil
+}
@@ -9,3 +9,59 @@ const (
 	//Queue_MAXLEN     = 80                                // 队列最大长度
 	PROJECT_MESSAGES_COUNT = 5 // 清理操作时，强制保留的消息数量
 )
+
+// --------------------------  记忆变更通知（与 server/static.go 一致） -----------------------------
+const (
+	APPLY_CACHE_PREFIX     = "remember:main:apply:cache:" // 主服务 apply 缓存 key 前缀
+	APPLY_GEN_PREFIX       = "remember:main:apply:gen:"   // 会话记忆版本号 key 前缀
+	MEMORY_CHANGED_CHANNEL = "remember:memory:changed"    // 会话数据变更通知频道
+	MEMORY_SOURCE          = "messages"
+	ApplyGenTTL            = 7 * 24 * 3600 // 版本号保留时间（秒）
+)
+
+// --------------------------  批量查询 -----------------------------
+const (
+	MaxBatchSessions = 100 // 批量查询接口单次最多的会话数
+)
+
+// --------------------------  导出与导入 -----------------------------
+const (
+	ImportReplace = "replace" // 删除会话现有消息后写入
+	ImportMerge   = "merge"   // 保留现有消息，只写入不存在的消息
+	ImportSkip    = "skip"    // 会话已有消息时跳过
+	ImportTimeout = 30        // 导出、导入的数据库超时（秒）
+)
+
+// --------------------------  消息任务状态 -----------------------------
+const (
+	TaskPending = "pending" // 未认领（或认领超时后被 re-drive 重置）
+	TaskClaimed = "claimed" // 已被任务认领，等待下游服务的完成通知
+	TaskDone    = "done"    // 下游服务处理成功
+	TaskFailed  = "failed"  // 下游任务重试耗尽进入死信
+
+	COMPLETION_STREAM   = "remember:session_messages:completions" // 下游服务的完成通知，Stream，与各服务的 static.go 一致
+	COMPLETION_GROUP    = "remember:session_messages:workers"     // 完成通知消费者组
+	CompletionClaimIdle = 60                                      // 完成通知被领取后超过多少秒未 ACK，可被其他 Worker 重新领取
+
+	ClaimTimeout    = 3600 // 消息被认领后超过多少秒仍未完成，由 re-drive 重置为未认领
+	RedriveInterval = 300  // re-drive 扫描间隔（秒）
+	RedriveBatch    = 100  // 每次 re-drive 最多重置的会话数
+
+	FLUSH_IDLE_KEY  = "remember:main:flush:idle"  // 与 server/static.go 一致，re-drive 后由主服务的补齐调度重新触发任务
+	FLUSH_STALE_KEY = "remember:main:flush:stale" // 同上
+)
+
+// --------------------------  抽取器 -----------------------------
+// 内置抽取器名称，与主服务中注册的抽取器一致；旧版 task_index 1 ~ 4 依次对应以下名称
+const (
+	EXTRACTOR_USER_PORTRAIT = "user_poritrait" // task1
+	EXTRACTOR_CHAT_EVENT    = "chat_event"     // task2
+	EXTRACTOR_TOPIC_SUMMARY = "topic_summary"  // task3
+	EXTRACTOR_RESERVED      = "task4"          // task4 预留位
+)
+
+// --------------------------  分页查询 -----------------------------
+const (
+	MessagePageLimit    = 50  // 分页查询未指定 limit 时每页的消息轮数
+	MaxMessagePageLimit = 200 // 每页最多的消息轮数
+)
@@ -0,0 +1,142 @@
+package sessionid
+
+// 会话 ID：由 group_id、user_id、role_id 按固定位置组成，格式为 s2.{group_id}.{user_id}.{role_id}。
+// 各字段中字母、数字、'-'、'_' 原样保留，其余字节（包括 '.' 和 '~'）转义为 ~XX（大写十六进制），
+// 为空的字段保留空位，因此不同的组合不会得到相同的 ID，且可以从 ID 还原出各字段：
+//   (g="a_b", u="c")  -> s2.a_b.c.
+//   (g="a", u="b_c")  -> s2.a.b_c.
+//   (u="u1", r="r1")  -> s2..u1.r1
+//   (g="g1", u="u1")  -> s2.g1.u1.
+// 旧格式用 '_' 连接非空字段，见 Legacy，仅用于迁移。
+
+import (
+	"errors"
+	"strings"
+)
+
+const (
+	Prefix    = "s2" // 格式版本
+	separator = '.'
+	escape    = '~'
+	hexDigits = "0123456789ABCDEF"
+)
+
+// Identity 会话的组成字段
+type Identity struct {
+	GroupID string `json:"group_id" bson:"group_id"`
+	UserID  string `json:"user_id" bson:"user_id"`
+	RoleID  string `json:"role_id" bson:"role_id"`
+}
+
+// IsZero 三个字段都为空
+func (id Identity) IsZero() bool {
+	return id.GroupID == "" && id.UserID == "" && id.RoleID == ""
+}
+
+var ErrEmpty = errors.New("无法生成 session_id，group_id, user_id, role_id 全为空")
+
+// New 生成结构化的 session_id
+func New(id Identity) (string, error) {
+	if id.IsZero() {
+		return "", ErrEmpty
+	}
+	var b strings.Builder
+	b.WriteString(Prefix)
+	for _, part := range []string{id.GroupID, id.UserID, id.RoleID} {
+		b.WriteByte(separator)
+		encode(&b, part)
+	}
+	return b.String(), nil
+}
+
+// Legacy 旧格式的 session_id：用 '_' 连接非空字段，不同组合可能相同
+func Legacy(id Identity) (string, error) {
+	parts := []string{}
+	for _, part := range []string{id.GroupID, id.UserID, id.RoleID} {
+		if part != "" {
+			parts = append(parts, part)
+		}
+	}
+	if len(parts) == 0 {
+		return "", ErrEmpty
+	}
+	return strings.Join(parts, "_"), nil
+}
+
+// Parse 从结构化的 session_id 还原各字段，不是 New 生成的格式时返回 false
+func Parse(sessionID string) (Identity, bool) {
+	fields := strings.Split(sessionID, string(separator))
+	if len(fields) != 4 || fields[0] != Prefix {
+		return Identity{}, false
+	}
+	parts := make([]string, 3)
+	for i, f := range fields[1:] {
+		part, ok := decode(f)
+		if !ok {
+			return Identity{}, false
+		}
+		parts[i] = part
+	}
+	id := Identity{GroupID: parts[0], UserID: parts[1], RoleID: parts[2]}
+	if id.IsZero() {
+		return Identity{}, false
+	}
+	return id, true
+}
+
+// Field 单个字段在 session_id 中的写法，用于按字段匹配结构化的 session_id
+func Field(part string) string {
+	var b strings.Builder
+	encode(&b, part)
+	return b.String()
+}
+
+// IsStructured 是否为 New 生成的格式
+func IsStructured(sessionID string) bool {
+	_, ok := Parse(sessionID)
+	return ok
+}
+
+// plain 原样保留的字符
+func plain(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_'
+}
+
+func encode(b *strings.Builder, s string) {
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if plain(c) {
+			b.WriteByte(c)
+			continue
+		}
+		b.WriteByte(escape)
+		b.WriteByte(hexDigits[c>>4])
+		b.WriteByte(hexDigits[c&0x0f])
+	}
+}
+
+// decode encode 的逆过程，只接受 encode 的输出（转义必须是大写十六进制，不能转义 plain 字符），保证一个字段只有一种写法
+func decode(s string) (string, bool) {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if plain(c) {
+			b.WriteByte(c)
+			continue
+		}
+		if c != escape || i+2 >= len(s) {
+			return "", false
+		}
+		hi, lo := strings.IndexByte(hexDigits, s[i+1]), strings.IndexByte(hexDigits, s[i+2])
+		if hi < 0 || lo < 0 {
+			return "", false
+		}
+		v := byte(hi<<4 | lo)
+		if plain(v) {
+			return "", false
+		}
+		b.WriteByte(v)
+		i += 2
+	}
+	return b.String(), true
+}
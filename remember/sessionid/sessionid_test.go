@@ -0,0 +1,146 @@
+package sessionid
+
+import "testing"
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		id   Identity
+		want string
+	}{
+		{Identity{GroupID: "a_b", UserID: "c"}, "s2.a_b.c."},
+		{Identity{GroupID: "a", UserID: "b_c"}, "s2.a.b_c."},
+		{Identity{UserID: "u1", RoleID: "r1"}, "s2..u1.r1"},
+		{Identity{GroupID: "g1", UserID: "u1"}, "s2.g1.u1."},
+		{Identity{GroupID: "a.b", UserID: "c~d"}, "s2.a~2Eb.c~7Ed."},
+		{Identity{UserID: "x y/z"}, "s2..x~20y~2Fz."},
+		{Identity{UserID: "用户"}, "s2..~E7~94~A8~E6~88~B7."},
+	}
+	for _, tt := range tests {
+		got, err := New(tt.id)
+		if err != nil {
+			t.Errorf("New(%+v): %v", tt.id, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("New(%+v) = %q, want %q", tt.id, got, tt.want)
+		}
+	}
+
+	if _, err := New(Identity{}); err != ErrEmpty {
+		t.Errorf("New(empty) err = %v, want ErrEmpty", err)
+	}
+}
+
+func TestParseRoundTrip(t *testing.T) {
+	for _, id := range []Identity{
+		{GroupID: "g1", UserID: "u1", RoleID: "r1"},
+		{UserID: "u1"},
+		{RoleID: "r1"},
+		{GroupID: "a.b.c", UserID: "~", RoleID: "~7E"},
+		{GroupID: "s2", UserID: ".", RoleID: ".."},
+		{UserID: "用户-1_x"},
+		{GroupID: "\x00\xff", UserID: "%2E"},
+	} {
+		sessionID, err := New(id)
+		if err != nil {
+			t.Fatalf("New(%+v): %v", id, err)
+		}
+		got, ok := Parse(sessionID)
+		if !ok || got != id {
+			t.Errorf("Parse(%q) = %+v, %v, want %+v", sessionID, got, ok, id)
+		}
+		if !IsStructured(sessionID) {
+			t.Errorf("IsStructured(%q) = false", sessionID)
+		}
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	for _, sessionID := range []string{
+		"",
+		"g1_u1_r1", // 旧格式
+		"s2",
+		"s2.g1.u1",        // 字段数不对
+		"s2.g1.u1.r1.x",   // 字段数不对
+		"s1.g1.u1.r1",     // 版本不对
+		"s2...",           // 全为空
+		"s2.a b.u1.",      // 未转义
+		"s2.a~2e.u1.",     // 小写十六进制
+		"s2.a~41.u1.",     // 转义了原样保留的字符
+		"s2.a~2.u1.",      // 转义不完整
+		"s2.a~.u1.",       // 转义不完整
+		"s2.a~ZZ.u1.",     // 不是十六进制
+		"S2.g1.u1.r1",     // 前缀大小写
+		"s2.g1.u1.r1~2E~", // 末尾转义不完整
+	} {
+		if id, ok := Parse(sessionID); ok {
+			t.Errorf("Parse(%q) = %+v, want invalid", sessionID, id)
+		}
+	}
+}
+
+// TestNoCollisions 旧格式中相同的组合，新格式各不相同
+func TestNoCollisions(t *testing.T) {
+	ids := []Identity{
+		{GroupID: "a_b", UserID: "c"},
+		{GroupID: "a", UserID: "b_c"},
+		{GroupID: "a", UserID: "b", RoleID: "c"},
+		{GroupID: "a_b_c"},
+		{UserID: "a_b_c"},
+		{RoleID: "a_b_c"},
+		{GroupID: "a.b", UserID: "c"},
+		{GroupID: "a", UserID: "b.c"},
+		{GroupID: "a~2Eb", UserID: "c"},
+	}
+	seen := map[string]Identity{}
+	for _, id := range ids {
+		sessionID, err := New(id)
+		if err != nil {
+			t.Fatalf("New(%+v): %v", id, err)
+		}
+		if prev, ok := seen[sessionID]; ok {
+			t.Errorf("New(%+v) = New(%+v) = %q", id, prev, sessionID)
+		}
+		seen[sessionID] = id
+	}
+}
+
+func TestLegacy(t *testing.T) {
+	tests := []struct {
+		id   Identity
+		want string
+	}{
+		{Identity{GroupID: "g1", UserID: "u1", RoleID: "r1"}, "g1_u1_r1"},
+		{Identity{UserID: "u1", RoleID: "r1"}, "u1_r1"},
+		{Identity{GroupID: "a_b", UserID: "c"}, "a_b_c"},
+		{Identity{GroupID: "a", UserID: "b_c"}, "a_b_c"}, // 旧格式会冲突
+		{Identity{RoleID: "r1"}, "r1"},
+	}
+	for _, tt := range tests {
+		got, err := Legacy(tt.id)
+		if err != nil || got != tt.want {
+			t.Errorf("Legacy(%+v) = %q, %v, want %q", tt.id, got, err, tt.want)
+		}
+		if IsStructured(got) {
+			t.Errorf("IsStructured(%q) = true for legacy id", got)
+		}
+	}
+	if _, err := Legacy(Identity{}); err != ErrEmpty {
+		t.Errorf("Legacy(empty) err = %v, want ErrEmpty", err)
+	}
+}
+
+func TestField(t *testing.T) {
+	tests := map[string]string{
+		"":      "",
+		"u1":    "u1",
+		"a.b":   "a~2Eb",
+		"~":     "~7E",
+		"a-b_c": "a-b_c",
+	}
+	for in, want := range tests {
+		if got := Field(in); got != want {
+			t.Errorf("Field(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package taskqueue
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// --------------------- 任务完成通知：任务成功或进入死信后通知 session_messages 更新消息的任务状态，见 session_messages/completion.go -----------------------------
+
+// 完成通知的状态
+const (
+	CompletionDone   = "done"   // 任务成功
+	CompletionFailed = "failed" // 任务进入死信
+)
+
+// CompletionEvent 写入完成通知 Stream 的消息，与 session_messages 中的结构一致
+type CompletionEvent struct {
+	SessionID string `json:"session_id"`
+	Extractor string `json:"extractor"`
+	ClaimID   string `json:"claim_id"`
+	Status    string `json:"status"` // done / failed
+	Error     string `json:"error,omitempty"`
+	TaskID    string `json:"task_id,omitempty"`
+}
+
+// CompletionReporter 上报抽取器的任务结果
+type CompletionReporter struct {
+	Redis     *redis.Client
+	Stream    string // 完成通知 Stream，由 session_messages 消费
+	MaxLen    int64  // Stream 近似最大长度
+	Extractor string // 本服务在 session_messages 中的抽取器名称
+}
+
+// Report 上报任务结果，失败只记录日志，消息由 session_messages 在认领超时后重新触发；
+// 没有 claim_id 的任务（直接调用上传接口提交的任务）不上报
+func (c *CompletionReporter) Report(ctx context.Context, sessionID, claimID, taskID, status string, taskErr error) {
+	if claimID == "" {
+		return
+	}
+
+	ev := CompletionEvent{
+		SessionID: sessionID,
+		Extractor: c.Extractor,
+		ClaimID:   claimID,
+		Status:    status,
+		TaskID:    taskID,
+	}
+	if taskErr != nil {
+		ev.Error = taskErr.Error()
+	}
+	payload, _ := json.Marshal(ev)
+
+	err := c.Redis.XAdd(ctx, &redis.XAddArgs{
+		Stream: c.Stream,
+		MaxLen: c.MaxLen,
+		Approx: true,
+		Values: map[string]interface{}{"data": string(payload)},
+	}).Err()
+	if err != nil {
+		log.Printf("⚠️ Report completion failed, session_id=%s, claim_id=%s, err=%v", sessionID, claimID, err)
+	}
+}
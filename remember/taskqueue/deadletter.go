@@ -0,0 +1,253 @@
+package taskqueue
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ---------------------------------------------------------------------------------------------
+// 死信队列：超过重试次数的任务连同原始消息、最后一次错误和重试记录写入 MongoDB，
+// 运维可以通过 /dead_letter/* 接口查看、重放（单条 / 按会话 / 全部）或清除。
+// T 为各服务的队列消息类型，重放时由 Requeue 重新入队。
+// ---------------------------------------------------------------------------------------------
+
+// DeadLetter 死信记录
+type DeadLetter[T any] struct {
+	ID        string        `bson:"_id" json:"id"`
+	TaskID    string        `bson:"task_id" json:"task_id"`
+	SessionID string        `bson:"session_id" json:"session_id"`
+	Payload   T             `bson:"payload" json:"payload"`       // 原始任务
+	LastError string        `bson:"last_error" json:"last_error"` // 最后一次错误
+	History   []RetryRecord `bson:"history" json:"history"`       // 每次失败的记录
+	CreatedAt time.Time     `bson:"created_at" json:"created_at"`
+}
+
+// DeadLetterFilter 重放 / 清除的范围，id、session_id、all 三选一
+type DeadLetterFilter struct {
+	ID        string `json:"id"`
+	SessionID string `json:"session_id"`
+	All       bool   `json:"all"`
+}
+
+func (f DeadLetterFilter) toBSON() (bson.M, error) {
+	switch {
+	case f.ID != "":
+		return bson.M{"_id": f.ID}, nil
+	case f.SessionID != "":
+		return bson.M{"session_id": f.SessionID}, nil
+	case f.All:
+		return bson.M{}, nil
+	default:
+		return nil, errors.New("one of id, session_id or all is required")
+	}
+}
+
+// DeadLetterClient 死信集合操作
+type DeadLetterClient[T any] struct {
+	Collection *mongo.Collection
+	Name       string                                  // 服务名，用于日志
+	Requeue    func(ctx context.Context, task T) error // 重放时将任务重新入队（重试次数清零）
+}
+
+// NewDeadLetterClient 创建 DeadLetterClient
+func NewDeadLetterClient[T any](db *mongo.Database, collection, name string, requeue func(ctx context.Context, task T) error) *DeadLetterClient[T] {
+	return &DeadLetterClient[T]{
+		Collection: db.Collection(collection),
+		Name:       name,
+		Requeue:    requeue,
+	}
+}
+
+// Add 写入死信，payload 为原始任务
+func (dc *DeadLetterClient[T]) Add(ctx context.Context, taskID, sessionID string, payload T, history []RetryRecord, lastErr error) error {
+	record := DeadLetter[T]{
+		ID:        uuid.New().String(),
+		TaskID:    taskID,
+		SessionID: sessionID,
+		Payload:   payload,
+		LastError: lastErr.Error(),
+		History:   history,
+		CreatedAt: time.Now().UTC(),
+	}
+	_, err := dc.Collection.InsertOne(ctx, record)
+	return err
+}
+
+// List 按创建时间倒序列出死信，sessionID 为空时列出全部
+func (dc *DeadLetterClient[T]) List(ctx context.Context, sessionID string, limit, skip int64) ([]DeadLetter[T], int64, error) {
+	filter := bson.M{}
+	if sessionID != "" {
+		filter["session_id"] = sessionID
+	}
+
+	total, err := dc.Collection.CountDocuments(ctx, filter)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	opts := options.Find().SetSort(bson.M{"created_at": -1}).SetLimit(limit).SetSkip(skip)
+	cur, err := dc.Collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer cur.Close(ctx)
+
+	records := []DeadLetter[T]{}
+	if err := cur.All(ctx, &records); err != nil {
+		return nil, 0, err
+	}
+	return records, total, nil
+}
+
+// Get 获取单条死信
+func (dc *DeadLetterClient[T]) Get(ctx context.Context, id string) (*DeadLetter[T], error) {
+	var record DeadLetter[T]
+	if err := dc.Collection.FindOne(ctx, bson.M{"_id": id}).Decode(&record); err != nil {
+		return nil, err
+	}
+	return &record, nil
+}
+
+// Replay 将死信重新放入任务队列，入队成功后删除死信，返回重放数量
+func (dc *DeadLetterClient[T]) Replay(ctx context.Context, f DeadLetterFilter) (int, error) {
+	filter, err := f.toBSON()
+	if err != nil {
+		return 0, err
+	}
+
+	cur, err := dc.Collection.Find(ctx, filter, options.Find().SetSort(bson.M{"created_at": 1}))
+	if err != nil {
+		return 0, err
+	}
+	defer cur.Close(ctx)
+
+	replayed := 0
+	for cur.Next(ctx) {
+		var record DeadLetter[T]
+		if err := cur.Decode(&record); err != nil {
+			return replayed, err
+		}
+
+		if err := dc.Requeue(ctx, record.Payload); err != nil {
+			return replayed, fmt.Errorf("enqueue task %s failed: %w", record.TaskID, err)
+		}
+		if _, err := dc.Collection.DeleteOne(ctx, bson.M{"_id": record.ID}); err != nil {
+			return replayed, err
+		}
+		replayed++
+	}
+	return replayed, cur.Err()
+}
+
+// Purge 删除死信，返回删除数量
+func (dc *DeadLetterClient[T]) Purge(ctx context.Context, f DeadLetterFilter) (int64, error) {
+	filter, err := f.toBSON()
+	if err != nil {
+		return 0, err
+	}
+	result, err := dc.Collection.DeleteMany(ctx, filter)
+	if err != nil {
+		return 0, err
+	}
+	return result.DeletedCount, nil
+}
+
+// ------------------------------------ 管理接口 ------------------------------------
+
+// DeadLetterResponse 死信接口响应
+type DeadLetterResponse struct {
+	Code int         `json:"code"` // 0 成功, -1 失败
+	Msg  string      `json:"msg"`
+	Data interface{} `json:"data"`
+}
+
+// RegisterRoutes 注册死信管理接口，prefix 为服务的路由前缀
+func (dc *DeadLetterClient[T]) RegisterRoutes(r chi.Router, prefix string) {
+	r.Get(prefix+"/dead_letter/list", dc.listHandler)      // 列表，?session_id=&limit=&skip=
+	r.Get(prefix+"/dead_letter/get/{id}", dc.getHandler)   // 详情
+	r.Post(prefix+"/dead_letter/replay", dc.replayHandler) // 重放
+	r.Post(prefix+"/dead_letter/purge", dc.purgeHandler)   // 清除
+}
+
+func writeDeadLetterResponse(w http.ResponseWriter, resp DeadLetterResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+func (dc *DeadLetterClient[T]) listHandler(w http.ResponseWriter, r *http.Request) {
+	limit, skip := int64(20), int64(0)
+	if v, err := strconv.ParseInt(r.URL.Query().Get("limit"), 10, 64); err == nil && v > 0 && v <= 200 {
+		limit = v
+	}
+	if v, err := strconv.ParseInt(r.URL.Query().Get("skip"), 10, 64); err == nil && v > 0 {
+		skip = v
+	}
+
+	records, total, err := dc.List(r.Context(), r.URL.Query().Get("session_id"), limit, skip)
+	if err != nil {
+		writeDeadLetterResponse(w, DeadLetterResponse{Code: -1, Msg: "failed to list dead letters: " + err.Error(), Data: struct{}{}})
+		return
+	}
+	writeDeadLetterResponse(w, DeadLetterResponse{
+		Code: 0,
+		Msg:  "success",
+		Data: map[string]interface{}{"total": total, "items": records},
+	})
+}
+
+func (dc *DeadLetterClient[T]) getHandler(w http.ResponseWriter, r *http.Request) {
+	record, err := dc.Get(r.Context(), chi.URLParam(r, "id"))
+	if err != nil {
+		writeDeadLetterResponse(w, DeadLetterResponse{Code: -1, Msg: "failed to get dead letter: " + err.Error(), Data: struct{}{}})
+		return
+	}
+	writeDeadLetterResponse(w, DeadLetterResponse{Code: 0, Msg: "success", Data: record})
+}
+
+func (dc *DeadLetterClient[T]) replayHandler(w http.ResponseWriter, r *http.Request) {
+	var req DeadLetterFilter
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeDeadLetterResponse(w, DeadLetterResponse{Code: -1, Msg: "invalid request body: " + err.Error(), Data: struct{}{}})
+		return
+	}
+
+	replayed, err := dc.Replay(r.Context(), req)
+	if err != nil {
+		writeDeadLetterResponse(w, DeadLetterResponse{
+			Code: -1,
+			Msg:  "failed to replay dead letters: " + err.Error(),
+			Data: map[string]int{"replayed": replayed},
+		})
+		return
+	}
+	log.Printf("✅ INFO: %s replayed %d dead letters", dc.Name, replayed)
+	writeDeadLetterResponse(w, DeadLetterResponse{Code: 0, Msg: "success", Data: map[string]int{"replayed": replayed}})
+}
+
+func (dc *DeadLetterClient[T]) purgeHandler(w http.ResponseWriter, r *http.Request) {
+	var req DeadLetterFilter
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeDeadLetterResponse(w, DeadLetterResponse{Code: -1, Msg: "invalid request body: " + err.Error(), Data: struct{}{}})
+		return
+	}
+
+	purged, err := dc.Purge(r.Context(), req)
+	if err != nil {
+		writeDeadLetterResponse(w, DeadLetterResponse{Code: -1, Msg: "failed to purge dead letters: " + err.Error(), Data: struct{}{}})
+		return
+	}
+	log.Printf("✅ INFO: %s purged %d dead letters", dc.Name, purged)
+	writeDeadLetterResponse(w, DeadLetterResponse{Code: 0, Msg: "success", Data: map[string]int64{"purged": purged}})
+}
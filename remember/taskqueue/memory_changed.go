@@ -0,0 +1,43 @@
+package taskqueue
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// --------------------- 记忆变更通知：会话数据写入后使主服务的 apply 缓存失效，并通知主服务在后台重建 -----------------------------
+
+// MemoryChangedEvent 发布到变更通知频道的消息
+type MemoryChangedEvent struct {
+	SessionID string `json:"session_id"`
+	Source    string `json:"source"`
+}
+
+// MemoryNotifier 记忆变更通知，key 前缀和频道与主服务的 apply 缓存一致
+type MemoryNotifier struct {
+	Redis       *redis.Client
+	GenPrefix   string        // 会话记忆版本号 key 前缀
+	CachePrefix string        // apply 缓存 key 前缀
+	Channel     string        // 变更通知频道
+	GenTTL      time.Duration // 版本号保留时间
+}
+
+// Notify 递增会话记忆版本号、删除 apply 缓存并发布变更通知，source 为记忆名称；
+// 失败只记录日志，缓存最迟在 TTL 后过期
+func (n *MemoryNotifier) Notify(ctx context.Context, sessionID, source string) {
+	payload, _ := json.Marshal(MemoryChangedEvent{SessionID: sessionID, Source: source})
+	_, err := n.Redis.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Incr(ctx, n.GenPrefix+sessionID)
+		pipe.Expire(ctx, n.GenPrefix+sessionID, n.GenTTL)
+		pipe.Del(ctx, n.CachePrefix+sessionID)
+		pipe.Publish(ctx, n.Channel, payload)
+		return nil
+	})
+	if err != nil {
+		log.Printf("⚠️ Notify memory changed failed, session_id=%s, err=%v", sessionID, err)
+	}
+}
@@ -0,0 +1,69 @@
+package taskqueue
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// MigrateList 将旧版 List 队列 queue 中的任务逐条交给 add 写入新队列，返回迁移数量
+// 旧 key 先 RENAMENX 到 :legacy，逐条写入成功后再 LPOP，进程中途退出时下次启动会继续迁移（最多重复一条，不会丢失）；
+// 迁移期间持有 :migrating 锁（owner 为持有者，lockTTL 后过期），多个进程同时启动时只有一个进程执行迁移
+func MigrateList(ctx context.Context, rdb *redis.Client, queue, owner string, lockTTL time.Duration, add func(ctx context.Context, raw string) error) (int, error) {
+	lock := queue + ":migrating"
+	ok, err := rdb.SetNX(ctx, lock, owner, lockTTL).Result()
+	if err != nil {
+		return 0, err
+	}
+	if !ok {
+		return 0, nil // 其他进程正在迁移
+	}
+	defer rdb.Del(context.Background(), lock)
+
+	legacy := queue + ":legacy"
+	// 上次未迁移完的数据
+	migrated, err := drainList(ctx, rdb, legacy, add)
+	if err != nil {
+		return migrated, err
+	}
+
+	keyType, err := rdb.Type(ctx, queue).Result()
+	if err != nil {
+		return migrated, err
+	}
+	if keyType != "list" {
+		return migrated, nil
+	}
+	renamed, err := rdb.RenameNX(ctx, queue, legacy).Result()
+	if err != nil {
+		return migrated, fmt.Errorf("rename %s failed: %w", queue, err)
+	}
+	if !renamed {
+		return migrated, fmt.Errorf("rename %s failed: %s already exists", queue, legacy)
+	}
+	n, err := drainList(ctx, rdb, legacy, add)
+	return migrated + n, err
+}
+
+// drainList 按顺序取出 List 中的任务写入新队列
+func drainList(ctx context.Context, rdb *redis.Client, key string, add func(ctx context.Context, raw string) error) (int, error) {
+	migrated := 0
+	for {
+		raw, err := rdb.LIndex(ctx, key, 0).Result()
+		if err == redis.Nil {
+			return migrated, nil
+		}
+		if err != nil {
+			return migrated, err
+		}
+		if err := add(ctx, raw); err != nil {
+			return migrated, err
+		}
+		if err := rdb.LPop(ctx, key).Err(); err != nil {
+			return migrated, err
+		}
+		migrated++
+	}
+}
@@ -0,0 +1,34 @@
+package taskqueue
+
+import (
+	"context"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// --------------------- 已清除的批次：消息被修改后，主服务按 claim_id 删除该批次抽取出的记忆并重新抽取 -----------------------------
+//
+// 删除时该批次的任务可能仍在队列中或正在执行，执行完成后不能再写入旧内容抽取出的记忆，
+// 因此删除的同时记下 claim_id，Worker 写入前检查
+
+// PurgedClaims 已清除的 claim_id
+type PurgedClaims struct {
+	Redis  *redis.Client
+	Prefix string        // key 前缀
+	TTL    time.Duration // 保留时间，应大于任务在队列中停留的最长时间
+}
+
+// Mark 记录 claim_id 已清除
+func (p *PurgedClaims) Mark(ctx context.Context, claimID string) error {
+	return p.Redis.Set(ctx, p.Prefix+claimID, 1, p.TTL).Err()
+}
+
+// Purged claim_id 是否已清除，claimID 为空时返回 false
+func (p *PurgedClaims) Purged(ctx context.Context, claimID string) (bool, error) {
+	if claimID == "" {
+		return false, nil
+	}
+	n, err := p.Redis.Exists(ctx, p.Prefix+claimID).Result()
+	return n > 0, err
+}
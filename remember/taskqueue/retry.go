@@ -0,0 +1,71 @@
+package taskqueue
+
+import (
+	"errors"
+	"math/rand"
+	"net/http"
+	"time"
+
+	"github.com/openai/openai-go/v2"
+)
+
+// RetryRecord 一次失败的记录
+type RetryRecord struct {
+	Retry    int    `json:"retry" bson:"retry"`
+	Error    string `json:"error" bson:"error"`
+	FailedAt int64  `json:"failed_at" bson:"failed_at"`
+}
+
+// PermanentError 不可重试的错误（例如修复后仍无法解析的 JSON、校验失败），重试也不会成功，直接进入死信队列
+type PermanentError struct {
+	Err error
+}
+
+func (e *PermanentError) Error() string { return e.Err.Error() }
+func (e *PermanentError) Unwrap() error { return e.Err }
+
+// Permanent 将错误标记为不可重试
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &PermanentError{Err: err}
+}
+
+// IsPermanent 错误是否被标记为不可重试
+func IsPermanent(err error) bool {
+	var permanent *PermanentError
+	return errors.As(err, &permanent)
+}
+
+// IsRetryable 判断模型调用的错误是否值得重试：超时、限流(429)、5xx 及未知错误重试，其余 4xx 和 PermanentError 不重试
+func IsRetryable(err error) bool {
+	if IsPermanent(err) {
+		return false
+	}
+
+	var apiErr *openai.Error
+	if errors.As(err, &apiErr) {
+		switch code := apiErr.StatusCode; {
+		case code == http.StatusRequestTimeout, code == http.StatusConflict, code == http.StatusTooManyRequests:
+			return true
+		case code >= 400 && code < 500:
+			return false
+		}
+	}
+	return true
+}
+
+// Backoff 第 retry 次失败后的等待时间：从 base 开始指数退避，不超过 max，并在 [d/2, d] 区间内随机抖动，避免大量任务同时重试
+func Backoff(retry int, base, max time.Duration) time.Duration {
+	d := base
+	for i := 0; i < retry && d < max; i++ {
+		d *= 2
+	}
+	if d > max {
+		d = max
+	}
+
+	half := d / 2
+	return half + time.Duration(rand.Int63n(int64(half)+1))
+}
@@ -0,0 +1,82 @@
+package taskqueue
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/openai/openai-go/v2"
+)
+
+func TestBackoff(t *testing.T) {
+	base, max := 10*time.Second, 600*time.Second
+	tests := []struct {
+		retry int
+		want  time.Duration // 抖动前的等待时间
+	}{
+		{0, 10 * time.Second},
+		{1, 20 * time.Second},
+		{3, 80 * time.Second},
+		{6, 600 * time.Second},
+		{20, 600 * time.Second},
+	}
+	for _, tt := range tests {
+		for i := 0; i < 20; i++ {
+			got := Backoff(tt.retry, base, max)
+			if got < tt.want/2 || got > tt.want {
+				t.Fatalf("Backoff(%d) = %s, want in [%s, %s]", tt.retry, got, tt.want/2, tt.want)
+			}
+		}
+	}
+}
+
+func TestIsRetryable(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"plain", errors.New("timeout"), true},
+		{"permanent", Permanent(errors.New("bad json")), false},
+		{"wrapped permanent", fmt.Errorf("task: %w", Permanent(errors.New("bad json"))), false},
+		{"rate limited", &openai.Error{StatusCode: 429}, true},
+		{"request timeout", &openai.Error{StatusCode: 408}, true},
+		{"bad request", &openai.Error{StatusCode: 400}, false},
+		{"server error", &openai.Error{StatusCode: 503}, true},
+	}
+	for _, tt := range tests {
+		if got := IsRetryable(tt.err); got != tt.want {
+			t.Errorf("%s: IsRetryable = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+
+	if Permanent(nil) != nil {
+		t.Error("Permanent(nil) should be nil")
+	}
+}
+
+func TestDeadLetterFilter(t *testing.T) {
+	tests := []struct {
+		f    DeadLetterFilter
+		want string
+	}{
+		{DeadLetterFilter{ID: "x", SessionID: "s"}, "_id"},
+		{DeadLetterFilter{SessionID: "s", All: true}, "session_id"},
+		{DeadLetterFilter{All: true}, ""},
+	}
+	for _, tt := range tests {
+		filter, err := tt.f.toBSON()
+		if err != nil {
+			t.Errorf("%+v: %v", tt.f, err)
+			continue
+		}
+		if tt.want == "" && len(filter) != 0 || tt.want != "" && filter[tt.want] == nil {
+			t.Errorf("%+v: filter = %v, want key %q", tt.f, filter, tt.want)
+		}
+	}
+
+	if _, err := (DeadLetterFilter{}).toBSON(); err == nil {
+		t.Error("empty filter should be rejected")
+	}
+}
@@ -0,0 +1,109 @@
+package taskqueue
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// --------------------- 任务状态：记录每个任务的执行进度，保存在 Redis Hash 中，TTL 后过期 -----------------------------
+
+// 任务状态
+const (
+	TaskQueued    = "queued"    // 已入队，等待处理
+	TaskRunning   = "running"   // 处理中
+	TaskSucceeded = "succeeded" // 处理成功
+	TaskRetrying  = "retrying"  // 本次处理失败，等待重试，retry 为下一次执行的重试次数
+	TaskFailed    = "failed"    // 重试耗尽或不可重试，已进入死信队列
+)
+
+// ErrTaskNotFound 任务不存在或状态已过期
+var ErrTaskNotFound = errors.New("task not found")
+
+// TaskStatus 任务状态
+type TaskStatus struct {
+	TaskID    string    `json:"task_id"`
+	SessionID string    `json:"session_id"`
+	Status    string    `json:"status"`
+	Retry     int       `json:"retry"`
+	LastError string    `json:"last_error,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// StatusStore 任务状态存储，每个服务使用自己的 key 前缀
+type StatusStore struct {
+	Redis  *redis.Client
+	Prefix string        // key 前缀，key 为 Prefix + task_id
+	TTL    time.Duration // 状态保留时间
+}
+
+// Key 任务状态的 key
+func (s *StatusStore) Key(taskID string) string {
+	return s.Prefix + taskID
+}
+
+// Set 更新任务状态，lastErr 为 nil 时保留之前的错误信息
+func (s *StatusStore) Set(ctx context.Context, taskID, sessionID string, retry int, status string, lastErr error) error {
+	key := s.Key(taskID)
+	now := time.Now().UTC().UnixMilli()
+
+	fields := map[string]interface{}{
+		"session_id": sessionID,
+		"status":     status,
+		"retry":      retry,
+		"updated_at": now,
+	}
+	if lastErr != nil {
+		fields["last_error"] = lastErr.Error()
+	}
+
+	_, err := s.Redis.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HSet(ctx, key, fields)
+		pipe.HSetNX(ctx, key, "created_at", now)
+		pipe.Expire(ctx, key, s.TTL)
+		return nil
+	})
+	return err
+}
+
+// Track 更新任务状态，失败只记录日志，不影响任务处理
+func (s *StatusStore) Track(ctx context.Context, taskID, sessionID string, retry int, status string, lastErr error) {
+	if err := s.Set(ctx, taskID, sessionID, retry, status, lastErr); err != nil {
+		log.Printf("⚠️ Update task status failed, task_id=%s, status=%s, err=%v", taskID, status, err)
+	}
+}
+
+// Get 获取任务状态
+func (s *StatusStore) Get(ctx context.Context, taskID string) (*TaskStatus, error) {
+	values, err := s.Redis.HGetAll(ctx, s.Key(taskID)).Result()
+	if err != nil {
+		return nil, err
+	}
+	if len(values) == 0 {
+		return nil, ErrTaskNotFound
+	}
+
+	retry, _ := strconv.Atoi(values["retry"])
+	return &TaskStatus{
+		TaskID:    taskID,
+		SessionID: values["session_id"],
+		Status:    values["status"],
+		Retry:     retry,
+		LastError: values["last_error"],
+		CreatedAt: parseMilli(values["created_at"]),
+		UpdatedAt: parseMilli(values["updated_at"]),
+	}, nil
+}
+
+func parseMilli(v string) time.Time {
+	ms, err := strconv.ParseInt(v, 10, 64)
+	if err != nil {
+		return time.Time{}
+	}
+	return time.UnixMilli(ms).UTC()
+}
@@ -4,6 +4,8 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"strconv"
+	"strings"
 	"time"
 
 	"remember/config"
@@ -68,26 +70,91 @@ func main() {
 	}
 }
 
-// clearQueue 清空指定的Redis队列
+// clearQueue 清空指定的Redis队列（Stream、主服务的分区 Stream :N、延迟重试的 :retry 及迁移遗留的 :legacy 列表）
 func clearQueue(ctx context.Context, rdb *redis.Client, queueName string) (int64, error) {
+	partitions, err := partitionKeys(ctx, rdb, queueName)
+	if err != nil {
+		return 0, fmt.Errorf("获取队列分区失败: %v", err)
+	}
+
 	// 获取队列长度
-	queueLen, err := rdb.LLen(ctx, queueName).Result()
+	var queueLen int64
+	for _, key := range append([]string{queueName}, partitions...) {
+		n, err := queueLength(ctx, rdb, key)
+		if err != nil {
+			return 0, fmt.Errorf("获取队列长度失败: %v", err)
+		}
+		queueLen += n
+	}
+	legacyLen, err := queueLength(ctx, rdb, queueName+":legacy")
 	if err != nil {
 		return 0, fmt.Errorf("获取队列长度失败: %v", err)
 	}
+	retryLen, err := queueLength(ctx, rdb, queueName+":retry")
+	if err != nil {
+		return 0, fmt.Errorf("获取队列长度失败: %v", err)
+	}
+	legacyLen += retryLen
 
-	if queueLen == 0 {
+	if queueLen+legacyLen == 0 {
 		log.Printf("ℹ️  队列 %s 已经是空的", queueName)
 		return 0, nil
 	}
 
-	log.Printf("📊 队列 %s 当前有 %d 个任务", queueName, queueLen)
+	log.Printf("📊 队列 %s 当前有 %d 个任务", queueName, queueLen+legacyLen)
 
-	// 清空队列 - 使用DEL命令删除整个列表
-	result, err := rdb.Del(ctx, queueName).Result()
+	// 清空队列 - Stream 使用 XTRIM 保留消费者组，运行中的 Worker 无需重启；未迁移的旧 List 直接删除
+	keyType, err := rdb.Type(ctx, queueName).Result()
+	if err != nil {
+		return 0, fmt.Errorf("获取队列类型失败: %v", err)
+	}
+	if keyType == "stream" {
+		err = rdb.XTrimMaxLen(ctx, queueName, 0).Err()
+	} else {
+		err = rdb.Del(ctx, queueName).Err()
+	}
 	if err != nil {
+		return 0, fmt.Errorf("清空队列失败: %v", err)
+	}
+	for _, key := range partitions {
+		if err := rdb.XTrimMaxLen(ctx, key, 0).Err(); err != nil {
+			return 0, fmt.Errorf("清空队列分区失败: %v", err)
+		}
+	}
+	if err := rdb.Del(ctx, queueName+":legacy", queueName+":retry").Err(); err != nil {
 		return 0, fmt.Errorf("删除队列失败: %v", err)
 	}
 
-	return result, nil
+	return queueLen + legacyLen, nil
+}
+
+// queueLength 按 key 类型获取队列长度
+func queueLength(ctx context.Context, rdb *redis.Client, key string) (int64, error) {
+	keyType, err := rdb.Type(ctx, key).Result()
+	if err != nil {
+		return 0, err
+	}
+	switch keyType {
+	case "stream":
+		return rdb.XLen(ctx, key).Result()
+	case "list":
+		return rdb.LLen(ctx, key).Result()
+	case "zset":
+		return rdb.ZCard(ctx, key).Result()
+	default:
+		return 0, nil
+	}
+}
+
+// partitionKeys 查找队列的分区 Stream（queueName:0、queueName:1 ...）
+func partitionKeys(ctx context.Context, rdb *redis.Client, queueName string) ([]string, error) {
+	var keys []string
+	iter := rdb.ScanType(ctx, 0, queueName+":*", 100, "stream").Iterator()
+	for iter.Next(ctx) {
+		key := iter.Val()
+		if _, err := strconv.Atoi(strings.TrimPrefix(key, queueName+":")); err == nil {
+			keys = append(keys, key)
+		}
+	}
+	return keys, iter.Err()
 }
@@ -85,6 +85,11 @@ func main() {
 			Keys:    bson.D{{Key: "session_id", Value: 1}},
 			Options: options.Index().SetName("session_id_idx").SetBackground(true),
 		},
+		{
+			// 消息被修改后按批次删除抽取出的事件
+			Keys:    bson.D{{Key: "session_id", Value: 1}, {Key: "claim_id", Value: 1}},
+			Options: options.Index().SetName("session_claim_idx").SetSparse(true).SetBackground(true),
+		},
 	}
 	for _, idx := range chatEventIndexes {
 		checkAndCreateIndex("chat_event", idx)
@@ -108,6 +113,11 @@ func main() {
 			Keys:    bson.D{{Key: "session_id", Value: 1}, {Key: "created_at", Value: 1}},
 			Options: options.Index().SetName("session_created_idx").SetBackground(true),
 		},
+		{
+			// 分页查询按 created_at、index（轮次序号）、_id 排序
+			Keys:    bson.D{{Key: "session_id", Value: 1}, {Key: "created_at", Value: 1}, {Key: "index", Value: 1}, {Key: "_id", Value: 1}},
+			Options: options.Index().SetName("session_created_index_id_idx").SetBackground(true),
+		},
 		{
 			Keys:    bson.D{{Key: "session_id", Value: 1}, {Key: "task1_id", Value: 1}, {Key: "task2_id", Value: 1}, {Key: "task3_id", Value: 1}},
 			Options: options.Index().SetName("session_tasks_idx").SetBackground(true),
@@ -168,6 +178,11 @@ printIndexes(db.Collection("topic_summary"))
 			Keys:    bson.D{{Key: "created_at", Value: 1}},
 			Options: options.Index().SetName("created_at_idx").SetBackground(true),
 		},
+		{
+			// 消息被修改后按批次删除抽取出的话题记录
+			Keys:    bson.D{{Key: "session_id", Value: 1}, {Key: "claim_id", Value: 1}},
+			Options: options.Index().SetName("session_claim_idx").SetSparse(true).SetBackground(true),
+		},
 	}
 	for _, idx := range topicSummaryIndexes {
 		checkAndCreateIndex("topic_summary", idx)
@@ -216,6 +231,30 @@ printIndexes(db.Collection("topic_summary"))
 	}
 	checkAndCreateIndex("user_portrait", userPortraitIndex)
 
+	// ==================== sessions 集合索引 ====================
+	fmt.Println("\n=== sessions 集合索引 ===")
+	sessionsIndexes := []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "last_active_at", Value: -1}},
+			Options: options.Index().SetName("last_active_at_idx").SetBackground(true),
+		},
+		{
+			Keys:    bson.D{{Key: "user_id", Value: 1}, {Key: "last_active_at", Value: -1}},
+			Options: options.Index().SetName("user_id_last_active_at_idx").SetBackground(true),
+		},
+		{
+			Keys:    bson.D{{Key: "role_id", Value: 1}, {Key: "last_active_at", Value: -1}},
+			Options: options.Index().SetName("role_id_last_active_at_idx").SetBackground(true),
+		},
+		{
+			Keys:    bson.D{{Key: "group_id", Value: 1}, {Key: "last_active_at", Value: -1}},
+			Options: options.Index().SetName("group_id_last_active_at_idx").SetBackground(true),
+		},
+	}
+	for _, idx := range sessionsIndexes {
+		checkAndCreateIndex("sessions", idx)
+	}
+
 	fmt.Println("\n🎉 所有索引检查完成！")
 }
 
@@ -0,0 +1,505 @@
+package main
+
+// 将旧格式的 session_id（用 '_' 连接 group_id/user_id/role_id 的非空字段）迁移为结构化格式（见 sessionid 包）。
+//
+// 旧 ID 无法可靠地拆分回原始字段，对应关系来自：
+//   - 主服务的 sessions 集合中 scheme 为 legacy 的记录（开启 session_id.legacy 期间上传时自动记录）
+//   - -map 指定的 JSONL 文件，每行 {"session_id": "旧ID(可选)", "group_id": "", "user_id": "", "role_id": ""}，
+//     session_id 为空时按旧规则生成
+// 多个组合对应同一个旧 ID 时（旧格式的冲突）无法区分数据归属，跳过并报告。
+//
+// 迁移内容：
+//   - MongoDB：session_messages、user_poritrait、topic_summary、topic_info、chat_event 的 session_id，
+//     各服务死信的 session_id 与 payload.session_id，sessions 集合的记录
+//   - Redis：各服务队列 Stream（主服务按新 ID 重新分区）与延迟重试队列中的任务、补齐调度、记忆块快照；
+//     apply 缓存直接删除
+//
+// 使用前停止所有服务（停止前至少以新版本启动过一次，确保旧的 List 队列已迁移为 Stream）。
+// 默认只打印迁移计划，加 -apply 执行；可重复执行，已迁移的会话不会再次处理。
+//
+//   go run migrate_session_ids.go -map sessions.jsonl          # 查看计划
+//   go run migrate_session_ids.go -map sessions.jsonl -apply   # 执行迁移
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"os"
+	"strings"
+
+	"remember/config"
+	"remember/sessionid"
+
+	"github.com/redis/go-redis/v9"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// 与各服务 static.go 一致
+const (
+	sessionsName    = "sessions"
+	mainQueue       = "remember:main:queue"
+	mainGroup       = "remember:main:workers"
+	queuePartitions = 20
+	flushIdleKey    = "remember:main:flush:idle"
+	flushStaleKey   = "remember:main:flush:stale"
+	snapshotPrefix  = "remember:main:snapshot:"
+)
+
+// 会话数据集合，unique 为 true 的集合每个会话只有一条记录，新 ID 已有数据时跳过
+var collections = []struct {
+	name   string
+	unique bool
+}{
+	{"session_messages", false},
+	{"user_poritrait", true},
+	{"topic_summary", false},
+	{"topic_info", false},
+	{"chat_event", false},
+}
+
+var deadLetterCollections = []string{
+	"main_dead_letter",
+	"user_poritrait_dead_letter",
+	"topic_summary_dead_letter",
+	"chat_event_dead_letter",
+}
+
+// 下游服务队列及消费者组
+var downstreamQueues = []struct {
+	name  string
+	group string
+}{
+	{"remember:user_poritrait:queue", "remember:user_poritrait:workers"},
+	{"remember:topic_summary:queue", "remember:topic_summary:workers"},
+	{"remember:chat_event:queue", "remember:chat_event:workers"},
+}
+
+var snapshotSections = []string{"user_portrait", "topic_summary", "chat_events", "messages"}
+
+var applyPrefixes = []string{
+	"remember:main:apply:cache:",
+	"remember:main:apply:gen:",
+	"remember:main:apply:req:",
+}
+
+// mapping 一个旧 ID 的迁移目标
+type mapping struct {
+	OldID    string
+	NewID    string
+	Identity sessionid.Identity
+}
+
+type migrator struct {
+	db     *mongo.Database
+	rdb    *redis.Client
+	apply  bool
+	byOld  map[string]*mapping
+	counts map[string]int64
+}
+
+func main() {
+	mapFile := flag.String("map", "", "旧 session_id 与原始字段的对应关系，JSONL")
+	apply := flag.Bool("apply", false, "执行迁移，默认只打印计划")
+	flag.Parse()
+
+	ctx := context.Background()
+	mongoCfg := config.Config.MongoDB
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(mongoCfg.URI))
+	if err != nil {
+		log.Fatalf("❌ 连接MongoDB失败: %v", err)
+	}
+	defer client.Disconnect(ctx)
+	if err := client.Ping(ctx, nil); err != nil {
+		log.Fatalf("❌ 无法ping通MongoDB: %v", err)
+	}
+
+	redisCfg := config.Config.Redis
+	rdb := redis.NewClient(&redis.Options{
+		Addr:     fmt.Sprintf("%s:%d", redisCfg.Host, redisCfg.Port),
+		Password: redisCfg.Password,
+		DB:       redisCfg.DB,
+	})
+	defer rdb.Close()
+	if err := rdb.Ping(ctx).Err(); err != nil {
+		log.Fatalf("❌ Redis连接失败: %v", err)
+	}
+
+	m := &migrator{
+		db:     client.Database(mongoCfg.DB),
+		rdb:    rdb,
+		apply:  *apply,
+		byOld:  map[string]*mapping{},
+		counts: map[string]int64{},
+	}
+
+	if err := m.checkLegacyQueues(ctx); err != nil {
+		log.Fatalf("❌ %v", err)
+	}
+	if err := m.loadMappings(ctx, *mapFile); err != nil {
+		log.Fatalf("❌ 读取对应关系失败: %v", err)
+	}
+	if len(m.byOld) == 0 {
+		log.Println("ℹ️  没有需要迁移的会话")
+		return
+	}
+	if !m.apply {
+		for _, mp := range m.byOld {
+			log.Printf("   %s -> %s", mp.OldID, mp.NewID)
+		}
+		log.Printf("📋 共 %d 个会话待迁移，加 -apply 执行", len(m.byOld))
+	}
+
+	for _, mp := range m.byOld {
+		if err := m.migrateMongo(ctx, mp); err != nil {
+			log.Fatalf("❌ 迁移 MongoDB 失败 session_id=%s: %v", mp.OldID, err)
+		}
+	}
+	if err := m.migrateMainQueue(ctx); err != nil {
+		log.Fatalf("❌ 迁移主服务队列失败: %v", err)
+	}
+	for _, q := range downstreamQueues {
+		if err := m.migrateStream(ctx, q.name, q.group, func(string) string { return q.name }); err != nil {
+			log.Fatalf("❌ 迁移队列 %s 失败: %v", q.name, err)
+		}
+	}
+	for _, q := range append([]string{mainQueue}, downstreamQueueNames(downstreamQueues)...) {
+		if err := m.migrateRetry(ctx, q+":retry"); err != nil {
+			log.Fatalf("❌ 迁移重试队列 %s 失败: %v", q, err)
+		}
+	}
+	for _, mp := range m.byOld {
+		if err := m.migrateRedisKeys(ctx, mp); err != nil {
+			log.Fatalf("❌ 迁移 Redis 失败 session_id=%s: %v", mp.OldID, err)
+		}
+	}
+
+	action := "待迁移"
+	if m.apply {
+		action = "已迁移"
+	}
+	log.Printf("🎉 完成，%s:", action)
+	for key, n := range m.counts {
+		log.Printf("   - %s: %d", key, n)
+	}
+}
+
+func downstreamQueueNames(queues []struct{ name, group string }) []string {
+	names := make([]string, 0, len(queues))
+	for _, q := range queues {
+		names = append(names, q.name)
+	}
+	return names
+}
+
+// checkLegacyQueues 旧的 List 队列由服务启动时迁移，存在时先启动一次服务
+func (m *migrator) checkLegacyQueues(ctx context.Context) error {
+	for _, q := range append([]string{mainQueue}, downstreamQueueNames(downstreamQueues)...) {
+		for _, key := range []string{q, q + ":legacy"} {
+			t, err := m.rdb.Type(ctx, key).Result()
+			if err != nil {
+				return err
+			}
+			if t == "list" {
+				return fmt.Errorf("队列 %s 仍是旧的 List 格式，请先启动一次服务完成队列迁移", key)
+			}
+		}
+	}
+	return nil
+}
+
+// loadMappings 汇总 sessions 集合与 -map 文件中的对应关系
+func (m *migrator) loadMappings(ctx context.Context, mapFile string) error {
+	conflicts := map[string]bool{}
+	add := func(oldID string, id sessionid.Identity) {
+		if oldID == "" || id.IsZero() {
+			return
+		}
+		newID, _ := sessionid.New(id)
+		if newID == oldID {
+			return
+		}
+		if prev, ok := m.byOld[oldID]; ok && prev.Identity != id {
+			conflicts[oldID] = true
+			return
+		}
+		m.byOld[oldID] = &mapping{OldID: oldID, NewID: newID, Identity: id}
+	}
+
+	cur, err := m.db.Collection(sessionsName).Find(ctx, bson.M{"scheme": "legacy"})
+	if err != nil {
+		return err
+	}
+	var records []struct {
+		ID                 string `bson:"_id"`
+		sessionid.Identity `bson:",inline"`
+	}
+	if err := cur.All(ctx, &records); err != nil {
+		return err
+	}
+	for _, r := range records {
+		add(r.ID, r.Identity)
+	}
+
+	if mapFile != "" {
+		f, err := os.Open(mapFile)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		scanner := bufio.NewScanner(f)
+		for line := 1; scanner.Scan(); line++ {
+			text := strings.TrimSpace(scanner.Text())
+			if text == "" {
+				continue
+			}
+			var row struct {
+				SessionID string `json:"session_id"`
+				sessionid.Identity
+			}
+			if err := json.Unmarshal([]byte(text), &row); err != nil {
+				return fmt.Errorf("第 %d 行: %v", line, err)
+			}
+			if row.SessionID == "" {
+				row.SessionID, _ = sessionid.Legacy(row.Identity)
+			}
+			add(row.SessionID, row.Identity)
+		}
+		if err := scanner.Err(); err != nil {
+			return err
+		}
+	}
+
+	for oldID := range conflicts {
+		log.Printf("⚠️  session_id=%s 对应多个组合，无法区分数据归属，跳过", oldID)
+		delete(m.byOld, oldID)
+	}
+	return nil
+}
+
+// migrateMongo 更新各集合中的 session_id
+func (m *migrator) migrateMongo(ctx context.Context, mp *mapping) error {
+	for _, c := range collections {
+		coll := m.db.Collection(c.name)
+		filter := bson.M{"session_id": mp.OldID}
+		n, err := coll.CountDocuments(ctx, filter)
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			continue
+		}
+		if c.unique {
+			exists, err := coll.CountDocuments(ctx, bson.M{"session_id": mp.NewID})
+			if err != nil {
+				return err
+			}
+			if exists > 0 {
+				log.Printf("⚠️  %s 中 session_id=%s 已有数据，跳过 %s 的 %d 条记录", c.name, mp.NewID, mp.OldID, n)
+				continue
+			}
+		}
+		if m.apply {
+			if _, err := coll.UpdateMany(ctx, filter, bson.M{"$set": bson.M{"session_id": mp.NewID}}); err != nil {
+				return err
+			}
+		}
+		m.counts[c.name] += n
+	}
+
+	for _, name := range deadLetterCollections {
+		coll := m.db.Collection(name)
+		for _, field := range []string{"session_id", "payload.session_id"} {
+			filter := bson.M{field: mp.OldID}
+			n, err := coll.CountDocuments(ctx, filter)
+			if err != nil {
+				return err
+			}
+			if n > 0 && m.apply {
+				if _, err := coll.UpdateMany(ctx, filter, bson.M{"$set": bson.M{field: mp.NewID}}); err != nil {
+					return err
+				}
+			}
+			if field == "session_id" {
+				m.counts[name] += n
+			}
+		}
+	}
+
+	// sessions 集合以 session_id 为 _id，复制为新记录后删除旧记录
+	sessions := m.db.Collection(sessionsName)
+	var record bson.M
+	err := sessions.FindOne(ctx, bson.M{"_id": mp.OldID}).Decode(&record)
+	if err == mongo.ErrNoDocuments {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	m.counts[sessionsName]++
+	if !m.apply {
+		return nil
+	}
+	record["_id"] = mp.NewID
+	record["scheme"] = sessionid.Prefix
+	record["group_id"] = mp.Identity.GroupID
+	record["user_id"] = mp.Identity.UserID
+	record["role_id"] = mp.Identity.RoleID
+	if _, err := sessions.ReplaceOne(ctx, bson.M{"_id": mp.NewID}, record, options.Replace().SetUpsert(true)); err != nil {
+		return err
+	}
+	_, err = sessions.DeleteOne(ctx, bson.M{"_id": mp.OldID})
+	return err
+}
+
+// partitionOf 与主服务 queue.go 一致
+func partitionOf(sessionID string) int {
+	h := fnv.New32a()
+	h.Write([]byte(sessionID))
+	return int(h.Sum32() % uint32(queuePartitions))
+}
+
+// migrateMainQueue 主服务的任务按新 ID 写入对应分区
+func (m *migrator) migrateMainQueue(ctx context.Context) error {
+	for p := 0; p < queuePartitions; p++ {
+		key := fmt.Sprintf("%s:%d", mainQueue, p)
+		err := m.migrateStream(ctx, key, mainGroup, func(newID string) string {
+			return fmt.Sprintf("%s:%d", mainQueue, partitionOf(newID))
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// rewrite 替换任务中的 session_id，保留其他字段；不需要迁移时返回 nil
+func (m *migrator) rewrite(raw string) (*mapping, []byte) {
+	var payload map[string]any
+	if err := json.Unmarshal([]byte(raw), &payload); err != nil {
+		return nil, nil
+	}
+	sid, _ := payload["session_id"].(string)
+	mp, ok := m.byOld[sid]
+	if !ok {
+		return nil, nil
+	}
+	payload["session_id"] = mp.NewID
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, nil
+	}
+	return mp, data
+}
+
+// migrateStream 将任务写入 target 返回的 Stream 队尾，再 ACK 并删除原任务；同一会话的任务保持原有顺序
+func (m *migrator) migrateStream(ctx context.Context, key, group string, target func(newID string) string) error {
+	entries, err := m.rdb.XRange(ctx, key, "-", "+").Result()
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		raw, _ := entry.Values["data"].(string)
+		mp, data := m.rewrite(raw)
+		if mp == nil {
+			continue
+		}
+		m.counts["queue:"+key]++
+		if !m.apply {
+			continue
+		}
+		pipe := m.rdb.TxPipeline()
+		pipe.XAdd(ctx, &redis.XAddArgs{Stream: target(mp.NewID), Values: map[string]interface{}{"data": data}})
+		pipe.XDel(ctx, key, entry.ID)
+		if _, err := pipe.Exec(ctx); err != nil {
+			return err
+		}
+		// 消费者组不存在时忽略
+		if err := m.rdb.XAck(ctx, key, group, entry.ID).Err(); err != nil && !strings.Contains(err.Error(), "NOGROUP") {
+			return err
+		}
+	}
+	return nil
+}
+
+// migrateRetry 替换延迟重试队列中的任务，保留到期时间
+func (m *migrator) migrateRetry(ctx context.Context, key string) error {
+	items, err := m.rdb.ZRangeWithScores(ctx, key, 0, -1).Result()
+	if err != nil {
+		return err
+	}
+	for _, item := range items {
+		raw, _ := item.Member.(string)
+		mp, data := m.rewrite(raw)
+		if mp == nil {
+			continue
+		}
+		m.counts["retry:"+key]++
+		if !m.apply {
+			continue
+		}
+		pipe := m.rdb.TxPipeline()
+		pipe.ZAdd(ctx, key, redis.Z{Score: item.Score, Member: data})
+		pipe.ZRem(ctx, key, raw)
+		if _, err := pipe.Exec(ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// migrateRedisKeys 补齐调度与快照改用新 ID，apply 缓存直接删除
+func (m *migrator) migrateRedisKeys(ctx context.Context, mp *mapping) error {
+	for _, key := range []string{flushIdleKey, flushStaleKey} {
+		score, err := m.rdb.ZScore(ctx, key, mp.OldID).Result()
+		if err == redis.Nil {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		m.counts["flush"]++
+		if !m.apply {
+			continue
+		}
+		pipe := m.rdb.TxPipeline()
+		pipe.ZAdd(ctx, key, redis.Z{Score: score, Member: mp.NewID})
+		pipe.ZRem(ctx, key, mp.OldID)
+		if _, err := pipe.Exec(ctx); err != nil {
+			return err
+		}
+	}
+
+	for _, section := range snapshotSections {
+		oldKey := snapshotPrefix + section + ":" + mp.OldID
+		n, err := m.rdb.Exists(ctx, oldKey).Result()
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			continue
+		}
+		m.counts["snapshot"]++
+		if m.apply {
+			if err := m.rdb.Rename(ctx, oldKey, snapshotPrefix+section+":"+mp.NewID).Err(); err != nil {
+				return err
+			}
+		}
+	}
+
+	if m.apply {
+		keys := make([]string, 0, len(applyPrefixes))
+		for _, prefix := range applyPrefixes {
+			keys = append(keys, prefix+mp.OldID)
+		}
+		if err := m.rdb.Del(ctx, keys...).Err(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
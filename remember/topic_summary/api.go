@@ -21,6 +21,25 @@ type Message struct {
 type UploadRequest struct {
 	SessionID string    `json:"session_id"`
 	Messages  []Message `json:"messages"`
+	ClaimID   string    `json:"claim_id,omitempty"` // session_messages 中认领消息的 task_id，可为空
+}
+
+// BatchSearchRequest 批量搜索接口请求体
+type BatchSearchRequest struct {
+	Sessions []TopicSearch `json:"sessions"`
+}
+
+// ImportRequest 导入接口请求体
+type ImportRequest struct {
+	SessionID string `json:"session_id"`
+	Mode      string `json:"mode"` // replace / merge / skip
+	TopicExport
+}
+
+// PurgeClaimRequest 删除批次话题接口请求体
+type PurgeClaimRequest struct {
+	SessionID string `json:"session_id"`
+	ClaimID   string `json:"claim_id"` // session_messages 中认领消息的 task_id
 }
 
 // UploadResponse 上传接口响应（统一格式）
@@ -72,7 +91,15 @@ func RegisterRoutes() http.Handler {
 	r.Post("/topic_summary/upload", uploadHandler)                // 上传接口
 	r.Get("/topic_summary/activate/{sessionID}", activateHandler) // 查询活跃话题接口
 	r.Get("/topic_summary/search/{sessionID}", searchHandler)     // 搜索接口
+	r.Post("/topic_summary/search_batch", batchSearchHandler)     // 批量搜索接口
 	r.Delete("/topic_summary/delete/{sessionID}", deleteHandler)  // 删除接口
+	r.Get("/topic_summary/task/{taskID}", taskStatusHandler)      // 任务状态查询接口
+	r.Get("/topic_summary/export/{sessionID}", exportHandler)     // 导出接口
+	r.Post("/topic_summary/import", importHandler)                // 导入接口
+	r.Post("/topic_summary/purge_claim", purgeClaimHandler)       // 删除批次抽取出的话题记录（消息被修改后由主服务调用）
+	// 死信管理接口
+	DeadLetters.RegisterRoutes(r, "/topic_summary")
+
 	return r
 }
 
@@ -93,31 +120,11 @@ func uploadHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if req.SessionID == "" || len(req.Messages) == 0 {
-		resp := UploadResponse{
-			Code: -1,
-			Msg:  fmt.Sprintf("%s session_id and messages are required", SERVER_NAME),
-			Data: struct{}{},
-		}
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(resp)
-		return
-	}
-
-	// 构造 QueueMessage 对象
-	msg := QueueMessage{
-		TaskID:    GenerateUUID(),
-		SessionID: req.SessionID,
-		Messages:  req.Messages,
-		Timestamp: time.Now().UTC().Unix(),
-		Retry:     0,
-	}
-
-	// 入队列
-	if _, err := MessageQueue.Enqueue(ctx, msg); err != nil {
+	taskID, err := SubmitTask(ctx, req.SessionID, req.ClaimID, req.Messages)
+	if err != nil {
 		resp := UploadResponse{
 			Code: -1,
-			Msg:  fmt.Sprintf("failed to %s enqueue", SERVER_NAME),
+			Msg:  err.Error(),
 			Data: struct{}{},
 		}
 		w.Header().Set("Content-Type", "application/json")
@@ -129,7 +136,7 @@ func uploadHandler(w http.ResponseWriter, r *http.Request) {
 	resp := UploadResponse{
 		Code: 0,
 		Msg:  fmt.Sprintf("messages uploaded %s successfully", SERVER_NAME),
-		Data: map[string]string{"task_id": msg.TaskID},
+		Data: map[string]string{"task_id": taskID},
 	}
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(resp)
@@ -147,13 +154,11 @@ func activateHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var topicInfo TopicInfo
-	filter := map[string]string{"session_id": sessionID}
-	err := DBClient.InfoCollection.FindOne(context.Background(), filter).Decode(&topicInfo)
+	topicInfo, err := GetTopicInfo(r.Context(), sessionID)
 	if err != nil {
 		json.NewEncoder(w).Encode(QueryResponse{
 			Code: -1,
-			Msg:  "failed to get topic info: " + err.Error(),
+			Msg:  err.Error(),
 			Data: struct{}{},
 		})
 		return
@@ -180,17 +185,6 @@ func searchHandler(w http.ResponseWriter, r *http.Request) {
 
 	query := r.URL.Query().Get("q")
 
-	// 获取活跃话题列表
-	var topicInfo TopicInfo
-	filter := map[string]string{"session_id": sessionID}
-	err := DBClient.InfoCollection.FindOne(context.Background(), filter).Decode(&topicInfo)
-	var activeTopics []string
-	if err == nil {
-		for _, topic := range topicInfo.ActiveTopics {
-			activeTopics = append(activeTopics, topic.Topic)
-		}
-	}
-
 	// 暂不启用翻译功能，直接使用原查询
 	// translatedQuery, err := TranslateQuery(query)
 	// if err != nil {
@@ -198,17 +192,13 @@ func searchHandler(w http.ResponseWriter, r *http.Request) {
 	// 	Error("Translation failed for query '%s': %v", query, err)
 	// 	translatedQuery = query
 	// }
-	// Info("Searching topics with query: original='%s', translated='%s'", query, translatedQuery)
-
-	// 直接使用原查询进行搜索
-	Info("Searching topics with query: '%s'", query)
 
-	// 搜索话题
-	results, err := DBClient.GetTopicSummary(context.Background(), sessionID, query, activeTopics)
+	// 搜索话题（活跃话题 + 关键词匹配）
+	results, err := SearchTopics(r.Context(), sessionID, query)
 	if err != nil {
 		json.NewEncoder(w).Encode(QueryResponse{
 			Code: -1,
-			Msg:  "failed to search topics: " + err.Error(),
+			Msg:  err.Error(),
 			Data: struct{}{},
 		})
 		return
@@ -221,34 +211,52 @@ func searchHandler(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
-// deleteHandler 删除 所有会话归纳、会话info、队列中任务
-func deleteHandler(w http.ResponseWriter, r *http.Request) {
-	sessionID := chi.URLParam(r, "sessionID")
-	if sessionID == "" {
+// batchSearchHandler 批量搜索话题，data 以 session_id 为 key
+func batchSearchHandler(w http.ResponseWriter, r *http.Request) {
+	var req BatchSearchRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		json.NewEncoder(w).Encode(QueryResponse{
 			Code: -1,
-			Msg:  "session_id is required",
+			Msg:  "invalid request body",
+			Data: struct{}{},
+		})
+		return
+	}
+
+	results, err := SearchTopicsBatch(r.Context(), req.Sessions)
+	if err != nil {
+		json.NewEncoder(w).Encode(QueryResponse{
+			Code: -1,
+			Msg:  err.Error(),
 			Data: struct{}{},
 		})
 		return
 	}
 
-	// 删除数据库记录（包括会话信息）
-	if err := DBClient.DeleteSessionTopics(context.Background(), sessionID); err != nil {
+	json.NewEncoder(w).Encode(QueryResponse{
+		Code: 0,
+		Msg:  "success",
+		Data: results,
+	})
+}
+
+// deleteHandler 删除 所有会话归纳、会话info、队列中任务
+func deleteHandler(w http.ResponseWriter, r *http.Request) {
+	sessionID := chi.URLParam(r, "sessionID")
+	if sessionID == "" {
 		json.NewEncoder(w).Encode(QueryResponse{
 			Code: -1,
-			Msg:  "failed to delete session topics: " + err.Error(),
+			Msg:  "session_id is required",
 			Data: struct{}{},
 		})
 		return
 	}
 
-	// 删除队列中的消息
-	ctx := context.Background()
-	if err := MessageQueue.DeleteBySession(ctx, sessionID); err != nil {
+	// 删除数据库记录（包括会话信息）及队列中的消息
+	if err := DeleteSession(r.Context(), sessionID); err != nil {
 		json.NewEncoder(w).Encode(QueryResponse{
 			Code: -1,
-			Msg:  "failed to delete messages from queue: " + err.Error(),
+			Msg:  err.Error(),
 			Data: struct{}{},
 		})
 		return
@@ -293,3 +301,110 @@ func deleteTopicHandler(w http.ResponseWriter, r *http.Request) {
 	})
 }
 */
+
+// taskStatusHandler 查询任务状态
+func taskStatusHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	taskID := chi.URLParam(r, "taskID")
+	if taskID == "" {
+		json.NewEncoder(w).Encode(QueryResponse{
+			Code: -1,
+			Msg:  "task_id is required",
+			Data: struct{}{},
+		})
+		return
+	}
+
+	status, err := GetTaskStatus(r.Context(), taskID)
+	if err != nil {
+		json.NewEncoder(w).Encode(QueryResponse{
+			Code: -1,
+			Msg:  err.Error(),
+			Data: struct{}{},
+		})
+		return
+	}
+
+	json.NewEncoder(w).Encode(QueryResponse{
+		Code: 0,
+		Msg:  "success",
+		Data: status,
+	})
+}
+
+// exportHandler 导出会话的全部话题记录及话题统计
+func exportHandler(w http.ResponseWriter, r *http.Request) {
+	data, err := ExportTopics(r.Context(), chi.URLParam(r, "sessionID"))
+	if err != nil {
+		json.NewEncoder(w).Encode(QueryResponse{
+			Code: -1,
+			Msg:  err.Error(),
+			Data: struct{}{},
+		})
+		return
+	}
+
+	json.NewEncoder(w).Encode(QueryResponse{
+		Code: 0,
+		Msg:  "success",
+		Data: data,
+	})
+}
+
+// importHandler 将话题记录及话题统计导入会话
+func importHandler(w http.ResponseWriter, r *http.Request) {
+	var req ImportRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		json.NewEncoder(w).Encode(QueryResponse{
+			Code: -1,
+			Msg:  "invalid request body",
+			Data: struct{}{},
+		})
+		return
+	}
+
+	result, err := ImportTopics(r.Context(), req.SessionID, req.Mode, req.TopicExport)
+	if err != nil {
+		json.NewEncoder(w).Encode(QueryResponse{
+			Code: -1,
+			Msg:  err.Error(),
+			Data: struct{}{},
+		})
+		return
+	}
+
+	json.NewEncoder(w).Encode(QueryResponse{
+		Code: 0,
+		Msg:  "success",
+		Data: result,
+	})
+}
+
+// purgeClaimHandler 删除 claim_id 批次抽取出的话题记录
+func purgeClaimHandler(w http.ResponseWriter, r *http.Request) {
+	var req PurgeClaimRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		json.NewEncoder(w).Encode(QueryResponse{
+			Code: -1,
+			Msg:  "invalid request body",
+			Data: struct{}{},
+		})
+		return
+	}
+
+	purged, err := PurgeClaim(r.Context(), req.SessionID, req.ClaimID)
+	if err != nil {
+		json.NewEncoder(w).Encode(QueryResponse{
+			Code: -1,
+			Msg:  err.Error(),
+			Data: struct{}{},
+		})
+		return
+	}
+
+	json.NewEncoder(w).Encode(QueryResponse{
+		Code: 0,
+		Msg:  "success",
+		Data: map[string]int64{"purged": purged},
+	})
+}
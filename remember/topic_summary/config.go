@@ -2,6 +2,7 @@ package topic_summary
 
 import (
 	"log"
+	"os"
 
 	"github.com/spf13/viper"
 )
@@ -60,6 +61,9 @@ func init() {
 	viper.SetConfigName("config") // 不要带 .yaml
 	viper.SetConfigType("yaml")
 	viper.AddConfigPath(".") // 根目录
+	if path := os.Getenv("REMEMBER_CONFIG"); path != "" {
+		viper.SetConfigFile(path) // 环境变量指定配置文件路径时不再按名称查找
+	}
 	err := viper.ReadInConfig()
 	if err != nil {
 		log.Fatalf("Error reading config file: %v", err)
@@ -59,6 +59,7 @@ func (tc *TopicClient) UploadTopicSummary(ctx context.Context, msg *QueueMessage
 			Keywords:  keywords,
 			CreatedAt: FormatTimestamp(msg.Timestamp),
 			UpdatedAt: FormatTimestamp(msg.Timestamp),
+			ClaimID:   msg.ClaimID,
 		}
 
 		_, err := tc.SummaryCollection.InsertOne(ctx, record)
@@ -289,6 +290,56 @@ func (tc *TopicClient) DeleteSessionTopics(ctx context.Context, sessionID string
 	return tc.DeleteSessionInfo(ctx, sessionID)
 }
 
+// DeleteClaimTopics 删除会话中 claim_id 批次抽取出的话题记录，返回删除的条数；
+// 删除后重新统计话题总数，并从活跃话题中移除已没有记录的话题
+func (tc *TopicClient) DeleteClaimTopics(ctx context.Context, sessionID, claimID string) (int64, error) {
+	res, err := tc.SummaryCollection.DeleteMany(ctx, bson.M{"session_id": sessionID, "claim_id": claimID})
+	if err != nil {
+		return 0, err
+	}
+	if res.DeletedCount == 0 {
+		return 0, nil
+	}
+
+	filter := bson.M{"session_id": sessionID}
+	remaining, err := tc.SummaryCollection.Distinct(ctx, "topic", filter)
+	if err != nil {
+		return res.DeletedCount, err
+	}
+	exists := make(map[string]bool, len(remaining))
+	for _, topic := range remaining {
+		if s, ok := topic.(string); ok {
+			exists[s] = true
+		}
+	}
+
+	var topicInfo TopicInfo
+	err = tc.InfoCollection.FindOne(ctx, filter).Decode(&topicInfo)
+	if err == mongo.ErrNoDocuments {
+		return res.DeletedCount, nil
+	}
+	if err != nil {
+		return res.DeletedCount, err
+	}
+	count, err := tc.SummaryCollection.CountDocuments(ctx, filter)
+	if err != nil {
+		return res.DeletedCount, err
+	}
+
+	activeTopics := make([]ActiveTopic, 0, len(topicInfo.ActiveTopics))
+	for _, t := range topicInfo.ActiveTopics {
+		if exists[t.Topic] {
+			activeTopics = append(activeTopics, t)
+		}
+	}
+	_, err = tc.InfoCollection.UpdateOne(ctx, filter, bson.M{"$set": bson.M{
+		"topic_count":   int(count),
+		"active_topics": activeTopics,
+		"updated_at":    time.Now().UTC(),
+	}})
+	return res.DeletedCount, err
+}
+
 // DeleteSessionInfo 删除指定会话的信息记录
 func (tc *TopicClient) DeleteSessionInfo(ctx context.Context, sessionID string) error {
 	filter := bson.M{"session_id": sessionID}
@@ -418,3 +469,126 @@ func (tc *TopicClient) SearchInactiveTopics(
 
 	return filtered, nil
 }
+
+// GetTopicSummaries 批量查询多个会话的话题摘要，规则与 GetTopicSummary 相同：
+// 活跃话题一次 $in 查询全取，关键词相同的会话合并为一次 $text 查询，以 session_id 为 key
+func (tc *TopicClient) GetTopicSummaries(ctx context.Context, searches []TopicSearch) (map[string][]TopicRecord, error) {
+	sessionIDs := make([]string, 0, len(searches))
+	for _, s := range searches {
+		sessionIDs = append(sessionIDs, s.SessionID)
+	}
+
+	results := make(map[string][]TopicRecord, len(searches))
+	seen := make(map[string]bool) // 去重（按 _id 唯一标识）
+	add := func(records []TopicRecord) {
+		for _, r := range records {
+			if !seen[r.ID] {
+				seen[r.ID] = true
+				results[r.SessionID] = append(results[r.SessionID], r)
+			}
+		}
+	}
+
+	// --- 第一步：取活跃话题 ---
+	activeTopics, err := tc.activeTopicsOf(ctx, sessionIDs)
+	if err != nil {
+		log.Printf("⚠️ GetTopicSummaries 获取活跃话题列表失败: %v", err)
+	}
+	or := make(bson.A, 0, len(activeTopics))
+	for sessionID, topics := range activeTopics {
+		or = append(or, bson.M{"session_id": sessionID, "topic": bson.M{"$in": topics}})
+	}
+	if len(or) > 0 {
+		activeResults, err := tc.findTopics(ctx, bson.M{"$or": or}, nil)
+		if err != nil {
+			log.Printf("⚠️ GetTopicSummaries 第一步取活跃话题失败: %v", err)
+		} else {
+			add(activeResults)
+		}
+	}
+
+	// --- 第二步：关键词搜索，关键词相同的会话一起查询 ---
+	groups := make(map[string][]string)
+	for _, s := range searches {
+		if s.Query == "" {
+			continue
+		}
+		if keywords := ExtractKeywords(s.Query); len(keywords) > 0 {
+			searchQuery := strings.Join(keywords, " ")
+			groups[searchQuery] = append(groups[searchQuery], s.SessionID)
+		}
+	}
+	searched := make(map[string]bool)
+	for searchQuery, ids := range groups {
+		inactiveResults, err := tc.searchTopicsByText(ctx, ids, searchQuery)
+		if err != nil {
+			log.Printf("⚠️ GetTopicSummaries 第二步搜索失败: query=%s err=%v", searchQuery, err)
+			continue
+		}
+		add(inactiveResults)
+		for _, id := range ids {
+			searched[id] = true
+		}
+	}
+
+	// 与 GetTopicSummary 一致：做过关键词搜索的会话按照更新时间从旧到最新排序
+	for _, sessionID := range sessionIDs {
+		records := results[sessionID]
+		if records == nil {
+			results[sessionID] = []TopicRecord{}
+			continue
+		}
+		if searched[sessionID] {
+			sort.Slice(records, func(i, j int) bool {
+				return records[i].UpdatedAt.Before(records[j].UpdatedAt)
+			})
+		}
+	}
+	return results, nil
+}
+
+// activeTopicsOf 批量获取会话的活跃话题名
+func (tc *TopicClient) activeTopicsOf(ctx context.Context, sessionIDs []string) (map[string][]string, error) {
+	cursor, err := tc.InfoCollection.Find(ctx, bson.M{"session_id": bson.M{"$in": sessionIDs}})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var infos []TopicInfo
+	if err := cursor.All(ctx, &infos); err != nil {
+		return nil, err
+	}
+
+	result := make(map[string][]string, len(infos))
+	for _, info := range infos {
+		for _, topic := range info.ActiveTopics {
+			result[info.SessionID] = append(result[info.SessionID], topic.Topic)
+		}
+	}
+	return result, nil
+}
+
+// searchTopicsByText 在多个会话中按关键词做 $text 搜索，分数过滤与 SearchInactiveTopics 一致
+func (tc *TopicClient) searchTopicsByText(ctx context.Context, sessionIDs []string, searchQuery string) ([]TopicRecord, error) {
+	filter := bson.D{
+		{Key: "$text", Value: bson.D{{Key: "$search", Value: searchQuery}}},
+		{Key: "session_id", Value: bson.M{"$in": sessionIDs}},
+	}
+	opts := options.Find().
+		SetProjection(bson.M{"score": bson.M{"$meta": "textScore"}}).
+		SetSort(bson.M{"score": bson.M{"$meta": "textScore"}})
+
+	results, err := tc.findTopics(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	filtered := make([]TopicRecord, 0, len(results))
+	for _, r := range results {
+		if r.Score >= 3 {
+			filtered = append(filtered, r)
+		}
+	}
+	return filtered, nil
+}
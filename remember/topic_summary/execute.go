@@ -5,6 +5,8 @@ import (
 	"fmt"
 	"github.com/openai/openai-go/v2"
 	"github.com/openai/openai-go/v2/option"
+
+	"remember/taskqueue"
 )
 
 // 输入参数
@@ -23,7 +25,7 @@ type ExecuteResult struct {
 // 执行函数，只会输出json结果
 func Execute(req *ExecuteRequest) (*ExecuteResult, error) {
 	if req.Client == nil {
-		return nil, fmt.Errorf("client is nil")
+		return nil, taskqueue.Permanent(fmt.Errorf("client is nil"))
 	}
 
 	ctx := context.Background()
@@ -52,7 +54,8 @@ func Execute(req *ExecuteRequest) (*ExecuteResult, error) {
 
 	jsonResult, err := Response2JSON(rawText)
 	if err != nil {
-		return nil, fmt.Errorf("failed to parse response as JSON: %w", err)
+		// 修复后仍无法解析，重试大概率得到同样结果，不再重试
+		return nil, taskqueue.Permanent(fmt.Errorf("failed to parse response as JSON: %w", err))
 	}
 
 	return &ExecuteResult{
@@ -0,0 +1,192 @@
+package topic_summary
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// --------------------- 导出与导入：主服务 /memory/export、/memory/import 按会话迁移话题记录及话题统计 -----------------------------
+
+// TopicExport 会话的全部话题记录及话题统计
+type TopicExport struct {
+	Topics []TopicRecord `json:"topics"`
+	Info   *TopicInfo    `json:"info"` // 不存在时为 null
+}
+
+// ImportResult 导入结果
+type ImportResult struct {
+	Imported int  `json:"imported"` // 写入的话题记录数
+	Skipped  bool `json:"skipped"`  // skip 模式下会话已有话题，未写入
+}
+
+// ExportTopics 导出会话的全部话题记录及话题统计
+func ExportTopics(ctx context.Context, sessionID string) (*TopicExport, error) {
+	if sessionID == "" {
+		return nil, fmt.Errorf("%s session_id is required", SERVER_NAME)
+	}
+	data, err := DBClient.exportTopics(ctx, sessionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to export topics: %w", err)
+	}
+	return data, nil
+}
+
+// ImportTopics 将话题记录及话题统计导入会话，session_id 改为目标会话并重新生成 _id，话题总数按导入后的记录重新统计
+func ImportTopics(ctx context.Context, sessionID, mode string, data TopicExport) (*ImportResult, error) {
+	if sessionID == "" {
+		return nil, fmt.Errorf("%s session_id is required", SERVER_NAME)
+	}
+	if mode != ImportReplace && mode != ImportMerge && mode != ImportSkip {
+		return nil, fmt.Errorf("%s invalid import mode: %s", SERVER_NAME, mode)
+	}
+
+	result, err := DBClient.importTopics(ctx, sessionID, mode, data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to import topics: %w", err)
+	}
+	if result.Imported > 0 || mode == ImportReplace {
+		NotifyMemoryChanged(ctx, sessionID)
+	}
+	return result, nil
+}
+
+func (tc *TopicClient) exportTopics(ctx context.Context, sessionID string) (*TopicExport, error) {
+	ctx, cancel := context.WithTimeout(ctx, ImportTimeout*time.Second)
+	defer cancel()
+
+	filter := bson.M{"session_id": sessionID}
+	topics, err := tc.findTopics(ctx, filter, options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	if topics == nil {
+		topics = []TopicRecord{}
+	}
+
+	data := &TopicExport{Topics: topics}
+	var info TopicInfo
+	err = tc.InfoCollection.FindOne(ctx, filter).Decode(&info)
+	if err == nil {
+		data.Info = &info
+	} else if err != mongo.ErrNoDocuments {
+		return nil, err
+	}
+	return data, nil
+}
+
+func (tc *TopicClient) importTopics(ctx context.Context, sessionID, mode string, data TopicExport) (*ImportResult, error) {
+	ctx, cancel := context.WithTimeout(ctx, ImportTimeout*time.Second)
+	defer cancel()
+
+	filter := bson.M{"session_id": sessionID}
+	topics := data.Topics
+	var activeTopics []ActiveTopic
+
+	switch mode {
+	case ImportSkip:
+		count, err := tc.SummaryCollection.CountDocuments(ctx, filter)
+		if err != nil {
+			return nil, err
+		}
+		if count > 0 {
+			return &ImportResult{Skipped: true}, nil
+		}
+	case ImportReplace:
+		if _, err := tc.SummaryCollection.DeleteMany(ctx, filter); err != nil {
+			return nil, err
+		}
+		if _, err := tc.InfoCollection.DeleteMany(ctx, filter); err != nil {
+			return nil, err
+		}
+	case ImportMerge:
+		// 话题名与内容都相同的记录视为已存在
+		existing, err := tc.findTopics(ctx, filter, nil)
+		if err != nil {
+			return nil, err
+		}
+		seen := make(map[string]bool, len(existing))
+		for _, t := range existing {
+			seen[t.Topic+"\x00"+t.Content] = true
+		}
+		kept := topics[:0:0]
+		for _, t := range topics {
+			if key := t.Topic + "\x00" + t.Content; !seen[key] {
+				seen[key] = true
+				kept = append(kept, t)
+			}
+		}
+		topics = kept
+
+		var info TopicInfo
+		if err := tc.InfoCollection.FindOne(ctx, filter).Decode(&info); err == nil {
+			activeTopics = info.ActiveTopics
+		} else if err != mongo.ErrNoDocuments {
+			return nil, err
+		}
+	}
+
+	if len(topics) > 0 {
+		docs := make([]interface{}, 0, len(topics))
+		for _, t := range topics {
+			t.ID = GenerateUUID()
+			t.SessionID = sessionID
+			t.Score = 0
+			docs = append(docs, t)
+		}
+		if _, err := tc.SummaryCollection.InsertMany(ctx, docs); err != nil {
+			return nil, err
+		}
+	}
+
+	// 话题统计：合并活跃话题（同名取最近活跃时间），按导入后的记录数重新统计
+	if data.Info != nil {
+		for _, t := range data.Info.ActiveTopics {
+			found := false
+			for i := range activeTopics {
+				if activeTopics[i].Topic == t.Topic {
+					if t.LastActive.After(activeTopics[i].LastActive) {
+						activeTopics[i].LastActive = t.LastActive
+					}
+					found = true
+					break
+				}
+			}
+			if !found {
+				activeTopics = append(activeTopics, t)
+			}
+		}
+	}
+	count, err := tc.SummaryCollection.CountDocuments(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	if count > 0 || len(activeTopics) > 0 {
+		sort.Slice(activeTopics, func(i, j int) bool {
+			return activeTopics[i].LastActive.After(activeTopics[j].LastActive)
+		})
+		if maxCount := ActivateTopicCount(int(count)); len(activeTopics) > maxCount {
+			activeTopics = activeTopics[:maxCount]
+		}
+		if activeTopics == nil {
+			activeTopics = []ActiveTopic{}
+		}
+		update := bson.M{"$set": bson.M{
+			"session_id":    sessionID,
+			"topic_count":   int(count),
+			"active_topics": activeTopics,
+			"updated_at":    time.Now().UTC(),
+		}}
+		if _, err := tc.InfoCollection.UpdateOne(ctx, filter, update, options.Update().SetUpsert(true)); err != nil {
+			return nil, err
+		}
+	}
+
+	Info("%s imported %d topics into session %s, mode=%s", SERVER_NAME, len(topics), sessionID, mode)
+	return &ImportResult{Imported: len(topics)}, nil
+}
@@ -12,10 +12,19 @@ type TopicRecord struct {
 	CreatedAt time.Time `bson:"created_at"` // 创建时间
 	UpdatedAt time.Time `bson:"updated_at"` // 更新时间
 
+	// 抽取该记录的批次（session_messages 中认领消息的 task_id），消息被修改后据此删除
+	ClaimID string `bson:"claim_id,omitempty" json:"claim_id,omitempty"`
+
 	// MongoDB 文本搜索返回的分数 (只在投影时使用 $meta: "textScore" 才会有值)
 	Score float64 `bson:"score,omitempty" json:"score,omitempty"`
 }
 
+// TopicSearch 批量搜索中单个会话的查询条件
+type TopicSearch struct {
+	SessionID string `json:"session_id"`
+	Query     string `json:"query"`
+}
+
 // 话题统计表
 type TopicInfo struct {
 	SessionID string `bson:"session_id"` // 会话 ID
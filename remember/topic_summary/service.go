@@ -0,0 +1,116 @@
+package topic_summary
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// --------------------- service.go 话题归纳的业务逻辑，HTTP 接口与单进程模式共用 -----------------------------
+
+// SubmitTask 将一轮对话放入任务队列，返回任务ID；claimID 为 session_messages 中认领这些消息的 task_id，可为空
+func SubmitTask(ctx context.Context, sessionID, claimID string, messages []Message) (string, error) {
+	if sessionID == "" || len(messages) == 0 {
+		return "", fmt.Errorf("%s session_id and messages are required", SERVER_NAME)
+	}
+
+	// 构造 QueueMessage 对象
+	msg := QueueMessage{
+		TaskID:    GenerateUUID(),
+		SessionID: sessionID,
+		Messages:  messages,
+		Timestamp: time.Now().UTC().Unix(),
+		Retry:     0,
+		ClaimID:   claimID,
+	}
+
+	// 入队列
+	if _, err := MessageQueue.Enqueue(ctx, msg); err != nil {
+		return "", fmt.Errorf("failed to %s enqueue", SERVER_NAME)
+	}
+	return msg.TaskID, nil
+}
+
+// GetTopicInfo 获取会话的话题统计和活跃话题
+func GetTopicInfo(ctx context.Context, sessionID string) (*TopicInfo, error) {
+	var topicInfo TopicInfo
+	filter := map[string]string{"session_id": sessionID}
+	if err := DBClient.InfoCollection.FindOne(ctx, filter).Decode(&topicInfo); err != nil {
+		return nil, fmt.Errorf("failed to get topic info: %w", err)
+	}
+	return &topicInfo, nil
+}
+
+// SearchTopics 取活跃话题，并按 query 搜索其他话题
+func SearchTopics(ctx context.Context, sessionID, query string) ([]TopicRecord, error) {
+	// 获取活跃话题列表
+	var activeTopics []string
+	if topicInfo, err := GetTopicInfo(ctx, sessionID); err == nil {
+		for _, topic := range topicInfo.ActiveTopics {
+			activeTopics = append(activeTopics, topic.Topic)
+		}
+	}
+
+	// 直接使用原查询进行搜索
+	Info("Searching topics with query: '%s'", query)
+
+	results, err := DBClient.GetTopicSummary(ctx, sessionID, query, activeTopics)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search topics: %w", err)
+	}
+	return results, nil
+}
+
+// SearchTopicsBatch 批量搜索多个会话的话题，以 session_id 为 key，规则与 SearchTopics 相同
+func SearchTopicsBatch(ctx context.Context, searches []TopicSearch) (map[string][]TopicRecord, error) {
+	if len(searches) == 0 || len(searches) > MaxBatchSessions {
+		return nil, fmt.Errorf("sessions is required, at most %d", MaxBatchSessions)
+	}
+	ids := make(map[string]bool, len(searches))
+	for _, s := range searches {
+		if s.SessionID == "" || ids[s.SessionID] {
+			return nil, fmt.Errorf("session_id is required and must be unique")
+		}
+		ids[s.SessionID] = true
+	}
+
+	results, err := DBClient.GetTopicSummaries(ctx, searches)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search topics: %w", err)
+	}
+	return results, nil
+}
+
+// DeleteSession 删除会话的全部话题、话题统计及队列中的待处理任务
+func DeleteSession(ctx context.Context, sessionID string) error {
+	// 删除数据库记录（包括会话信息）
+	if err := DBClient.DeleteSessionTopics(ctx, sessionID); err != nil {
+		return fmt.Errorf("failed to delete session topics: %w", err)
+	}
+
+	// 删除队列中的消息
+	if err := MessageQueue.DeleteBySession(ctx, sessionID); err != nil {
+		return fmt.Errorf("failed to delete messages from queue: %w", err)
+	}
+	NotifyMemoryChanged(ctx, sessionID)
+	return nil
+}
+
+// PurgeClaim 删除 claim_id 批次抽取出的话题记录，返回删除的条数；
+// 先记录批次已清除，该批次仍在队列中或正在执行的任务完成后会丢弃结果
+func PurgeClaim(ctx context.Context, sessionID, claimID string) (int64, error) {
+	if sessionID == "" || claimID == "" {
+		return 0, fmt.Errorf("%s session_id and claim_id are required", SERVER_NAME)
+	}
+	if err := purgedClaims.Mark(ctx, claimID); err != nil {
+		return 0, fmt.Errorf("failed to mark claim purged: %w", err)
+	}
+	purged, err := DBClient.DeleteClaimTopics(ctx, sessionID, claimID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to purge topics: %w", err)
+	}
+	if purged > 0 {
+		NotifyMemoryChanged(ctx, sessionID)
+	}
+	return purged, nil
+}
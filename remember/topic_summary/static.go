@@ -4,11 +4,59 @@ const (
 	DB_NAME          = "topic_summary" // 数据库名
 	DB_NAME_2        = "topic_info"
 	QUEUE_NAME       = "remember:topic_summary:queue"     // 队列名
+	QUEUE_GROUP      = "remember:topic_summary:workers"   // 队列消费者组
+	DEAD_LETTER_NAME = "topic_summary_dead_letter"        // 死信集合名
 	SERVER_NAME      = "[主题归纳]"                           // 服务名
 	User_query       = "Returns the English JSON  result" // user_query填充位
 	MaxRetry         = 3                                  // 任务执行大重试次数
+	RetryBaseDelay   = 10                                 // 首次重试前等待的秒数，之后每次翻倍
+	RetryMaxDelay    = 600                                // 重试等待的上限（秒）
+	ClaimIdle        = 300                                // 消息被领取后超过多少秒未 ACK，视为消费者已失联，可被其他 Worker 重新领取
 	Monitor_Interval = 60                                 // 监控间隔
 	Queue_MAXLEN     = 80                                 // 队列最大长度
 	MAX_TOPIC_COUNT  = 60                                 // 最大话题数量限制
 
 )
+
+// --------------------------  任务状态 -----------------------------
+const (
+	TASK_STATUS_PREFIX = "remember:topic_summary:task:" // 任务状态 key 前缀
+	TaskStatusTTL      = 7 * 24 * 3600                  // 任务状态保留时间（秒）
+)
+
+// --------------------------  记忆变更通知（与 server/static.go 一致） -----------------------------
+const (
+	APPLY_CACHE_PREFIX     = "remember:main:apply:cache:" // 主服务 apply 缓存 key 前缀
+	APPLY_GEN_PREFIX       = "remember:main:apply:gen:"   // 会话记忆版本号 key 前缀
+	MEMORY_CHANGED_CHANNEL = "remember:memory:changed"    // 会话数据变更通知频道
+	MEMORY_SOURCE          = "topic_summary"
+	ApplyGenTTL            = 7 * 24 * 3600 // 版本号保留时间（秒）
+)
+
+// --------------------------  批量查询 -----------------------------
+const (
+	MaxBatchSessions = 100 // 批量查询接口单次最多的会话数
+)
+
+// --------------------------  导出与导入 -----------------------------
+const (
+	ImportReplace = "replace" // 删除会话现有话题及统计后写入
+	ImportMerge   = "merge"   // 保留现有话题，只写入不存在的话题，合并活跃话题
+	ImportSkip    = "skip"    // 会话已有话题时跳过
+	ImportTimeout = 30        // 导出、导入的数据库超时（秒）
+)
+
+// --------------------------  任务完成通知（与 session_messages/static.go 一致） -----------------------------
+const (
+	COMPLETION_STREAM = "remember:session_messages:completions" // 完成通知 Stream，由 session_messages 消费
+	CompletionMaxLen  = 100000                                  // Stream 近似最大长度
+	CompletionDone    = "done"                                  // 任务成功
+	CompletionFailed  = "failed"                                // 任务进入死信
+	EXTRACTOR_NAME    = "topic_summary"                         // 本服务在 session_messages 中的抽取器名称（旧版 task3_id）
+)
+
+// --------------------------  消息修改后清除批次（claim_id）抽取出的话题记录 -----------------------------
+const (
+	PURGED_CLAIM_PREFIX = "remember:topic_summary:purged_claim:" // 已清除的 claim_id key 前缀
+	PurgedClaimTTL      = 7 * 24 * 3600                          // 保留时间（秒），与任务状态一致
+)
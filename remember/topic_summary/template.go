@@ -3,6 +3,8 @@ package topic_summary
 // 提示词建议使用redis存储，前期写在代码里调试
 import (
 	"fmt"
+
+	"remember/prompt"
 )
 
 var TopicSummaryPromptTemplate = `
@@ -26,10 +28,10 @@ Extract topic-related content from a user or character's short speech. Long desc
 - Entities (person names, book titles, places, brands, product categories, concepts). **The original text must be referenced in parentheses**.
 
 ## Topic Guidelines
-{topics_str}
+{{.topics_str}}
 
 ## Historical Conversations
-{messages_str}
+{{.messages_str}}
 
 ## Output Format
 - Output must be in **JSON** format. - Key = Topic (strictly adheres to topic constraints)
@@ -37,10 +39,10 @@ Extract topic-related content from a user or character's short speech. Long desc
 
 ### Example:
 
-{output_example_1}
+{{.output_example_1}}
 
 ## Language Settings
-- All output uses only {language}.
+- All output uses only {{.language}}.
 
 # Topic Summary Results
 `
@@ -64,15 +66,15 @@ var TopicLanguage = "English"
 
 //-------------------------------- 代码 -------------------------------------
 
-var TopicStaticVars = map[string]string{
+var TopicStaticVars = prompt.Vars{
 	"topics_str":       Topics,
 	"output_example_1": TopicOutputExample1,
 	"language":         TopicLanguage,
 }
 
 type TopicTemplat struct {
-	Template   string            // 静态变量已替换后的模板
-	StaticVars map[string]string // 静态变量
+	Template   string      // 模板（text/template 语法）
+	StaticVars prompt.Vars // 静态变量
 }
 
 func NewTopicSummaryTemplate() *TopicTemplat {
@@ -81,17 +83,11 @@ func NewTopicSummaryTemplate() *TopicTemplat {
 		StaticVars: TopicStaticVars,
 	}
 }
-func (t *TopicTemplat) BuildPrompt(dynamicVars map[string]string) (string, error) {
-	// 先替换静态变量
-	finalTpl, err := SystemPromptComposeStatic(t.Template, t.StaticVars)
-	if err != nil {
-		return "", fmt.Errorf("静态模板组装失败: %v", err)
-	}
-
-	// 再替换动态变量
-	finalTpl, err = SystemPromptCompose(finalTpl, dynamicVars)
+func (t *TopicTemplat) BuildPrompt(dynamicVars prompt.Vars) (string, error) {
+	// 静态变量与动态变量一起渲染，缺少变量报错
+	finalTpl, err := prompt.Compose(t.Template, t.StaticVars, dynamicVars)
 	if err != nil {
-		return "", fmt.Errorf("动态模板组装失败: %v", err)
+		return "", fmt.Errorf("模板组装失败: %v", err)
 	}
 
 	return finalTpl, nil
@@ -8,6 +8,9 @@ import (
 
 	"github.com/openai/openai-go/v2"
 	"github.com/openai/openai-go/v2/option"
+
+	"remember/prompt"
+	"remember/taskqueue"
 )
 
 // Worker 消费队列消息
@@ -63,28 +66,48 @@ func (w *Worker) processNext() {
 	}
 
 	log.Printf("Processing session_id=%s, task_id=%s, retry=%d", msg.SessionID, msg.TaskID, msg.Retry)
+	trackTask(ctx, msg, TaskRunning, nil)
 
 	if err := w.processTopicSummary(msg); err != nil {
 		log.Printf("❌ Task failed, session_id=%s, task_id=%s, retry=%d, err=%v", msg.SessionID, msg.TaskID, msg.Retry, err)
+		msg.History = append(msg.History, RetryRecord{Retry: msg.Retry, Error: err.Error(), FailedAt: time.Now().UTC().Unix()})
 
-		// 判断是否需要重试
-		if msg.Retry < MaxRetry {
+		// 判断是否需要重试：临时错误（超时、限流、5xx）延迟重试，永久错误直接进入死信
+		if msg.Retry < MaxRetry && taskqueue.IsRetryable(err) {
+			delay := RetryDelay(msg.Retry)
 			msg.Retry++
-			if _, enqueueErr := w.Queue.Enqueue(ctx, *msg); enqueueErr != nil {
-				log.Printf("❌ Re-enqueue failed, task_id=%s, err=%v", msg.TaskID, enqueueErr)
-			} else {
-				log.Printf("🔁 Task re-enqueued, session_id=%s, task_id=%s, retry=%d", msg.SessionID, msg.TaskID, msg.Retry)
+			if scheduleErr := w.Queue.ScheduleRetry(ctx, *msg, delay); scheduleErr != nil {
+				log.Printf("❌ Schedule retry failed, task_id=%s, err=%v", msg.TaskID, scheduleErr)
+				return // 不 ACK，超过 ClaimIdle 秒后由其他 Worker 重新领取
 			}
+			log.Printf("🔁 Task scheduled for retry in %s, session_id=%s, task_id=%s, retry=%d", delay, msg.SessionID, msg.TaskID, msg.Retry)
+			trackTask(ctx, msg, TaskRetrying, err)
 		} else {
-			// 超过重试次数，发送飞书报警
+			// 超过重试次数或不可重试，发送飞书报警
 			alertText := fmt.Sprintf(
 				"*Topic summary task failed after %d retries!*\nTaskID: %s\nSessionID: %s\nLastError: %v",
-				MaxRetry, msg.TaskID, msg.SessionID, err,
+				msg.Retry, msg.TaskID, msg.SessionID, err,
 			)
 			go SendFeishuMsgAsync(alertText)
 
-			log.Printf("⚠️ Task dropped after %d retries, task_id=%s, last error: %v", MaxRetry, msg.TaskID, err)
+			// 写入死信队列，写入失败时不 ACK，稍后重新领取
+			if dlErr := DeadLetters.Add(ctx, msg.TaskID, msg.SessionID, *msg, msg.History, err); dlErr != nil {
+				log.Printf("❌ Dead letter failed, task_id=%s, err=%v", msg.TaskID, dlErr)
+				return
+			}
+			log.Printf("⚠️ Task dead-lettered after %d retries, task_id=%s, last error: %v", msg.Retry, msg.TaskID, err)
+			trackTask(ctx, msg, TaskFailed, err)
+			ReportCompletion(ctx, msg, CompletionFailed, err)
 		}
+	} else {
+		trackTask(ctx, msg, TaskSucceeded, nil)
+		NotifyMemoryChanged(ctx, msg.SessionID)
+		ReportCompletion(ctx, msg, CompletionDone, nil)
+	}
+
+	// 成功、已安排重试或已进入死信的任务都需要 ACK
+	if err := w.Queue.Ack(ctx, msg); err != nil {
+		log.Printf("❌ Ack failed, task_id=%s, err=%v", msg.TaskID, err)
 	}
 }
 
@@ -94,12 +117,12 @@ func (w *Worker) processTopicSummary(msg *QueueMessage) error {
 	messagesStr := MessagesToText(msg.Messages)
 
 	// 2. 构造系统提示词
-	dynamicVars := map[string]string{
+	dynamicVars := prompt.Vars{
 		"messages_str": messagesStr,
 	}
 	systemPrompt, err := w.Template.BuildPrompt(dynamicVars)
 	if err != nil {
-		return fmt.Errorf("%s 生成系统提示词失败: %w", SERVER_NAME, err)
+		return taskqueue.Permanent(fmt.Errorf("%s 生成系统提示词失败: %w", SERVER_NAME, err))
 	}
 
 	// 3. 执行模型
@@ -115,6 +138,14 @@ func (w *Worker) processTopicSummary(msg *QueueMessage) error {
 	}
 
 	log.Printf("✅ 生成话题摘要成功, task_id=%s", msg.TaskID)
+
+	// 重试时先删除同一批次上次写入的话题记录
+	if msg.ClaimID != "" {
+		if _, err := w.DBClient.DeleteClaimTopics(context.Background(), msg.SessionID, msg.ClaimID); err != nil {
+			return fmt.Errorf("%s 删除批次旧话题失败: %w", SERVER_NAME, err)
+		}
+	}
+
 	if len(result.JSON) == 0 {
 		log.Printf("%s task_id=%s 话题摘要为空, 跳过上传", SERVER_NAME, msg.TaskID)
 		return nil
@@ -127,6 +158,18 @@ func (w *Worker) processTopicSummary(msg *QueueMessage) error {
 
 	log.Printf("✅ 上传话题摘要成功, session_id=%s, task_id=%s, topics_count=%d",
 		msg.SessionID, msg.TaskID, len(result.JSON))
+
+	// 5. 执行期间消息被修改、批次已被清除时，删除刚写入的话题记录
+	purged, err := purgedClaims.Purged(context.Background(), msg.ClaimID)
+	if err != nil {
+		return fmt.Errorf("%s 查询批次状态失败: %w", SERVER_NAME, err)
+	}
+	if purged {
+		if _, err := w.DBClient.DeleteClaimTopics(context.Background(), msg.SessionID, msg.ClaimID); err != nil {
+			return fmt.Errorf("%s 删除已清除批次的话题失败: %w", SERVER_NAME, err)
+		}
+		log.Printf("%s task_id=%s 批次 %s 已清除, 丢弃抽取结果", SERVER_NAME, msg.TaskID, msg.ClaimID)
+	}
 	return nil
 }
 
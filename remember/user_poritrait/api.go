@@ -21,6 +21,19 @@ type Message struct {
 type UploadRequest struct {
 	SessionID string    `json:"session_id"`
 	Messages  []Message `json:"messages"`
+	ClaimID   string    `json:"claim_id,omitempty"` // session_messages 中认领消息的 task_id，可为空
+}
+
+// BatchQueryRequest 批量查询接口请求体
+type BatchQueryRequest struct {
+	SessionIDs []string `json:"session_ids"`
+}
+
+// ImportRequest 导入接口请求体
+type ImportRequest struct {
+	SessionID string        `json:"session_id"`
+	Mode      string        `json:"mode"` // replace / merge / skip
+	Portrait  *UserPortrait `json:"portrait"`
 }
 
 // UploadResponse 上传接口响应（统一格式）
@@ -71,7 +84,14 @@ func RegisterRoutes() http.Handler {
 
 	r.Post("/user_poritrait/upload", uploadHandler)               // 上传接口
 	r.Get("/user_poritrait/get/{sessionID}", queryHandler)        // 查询接口
+	r.Post("/user_poritrait/get_batch", batchQueryHandler)        // 批量查询接口
 	r.Delete("/user_poritrait/delete/{sessionID}", deleteHandler) // 删除接口
+	r.Get("/user_poritrait/task/{taskID}", taskStatusHandler)     // 任务状态查询接口
+	r.Get("/user_poritrait/export/{sessionID}", exportHandler)    // 导出接口
+	r.Post("/user_poritrait/import", importHandler)               // 导入接口
+	// 死信管理接口
+	DeadLetters.RegisterRoutes(r, "/user_poritrait")
+
 	return r
 }
 
@@ -92,31 +112,11 @@ func uploadHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if req.SessionID == "" || len(req.Messages) == 0 {
-		resp := UploadResponse{
-			Code: -1,
-			Msg:  fmt.Sprintf("%s session_id and messages are required", SERVER_NAME),
-			Data: struct{}{},
-		}
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(resp)
-		return
-	}
-
-	// 构造 QueueMessage 对象
-	msg := QueueMessage{
-		TaskID:    GenerateUUID(),
-		SessionID: req.SessionID,
-		Messages:  req.Messages,
-		Timestamp: time.Now().UTC().Unix(),
-		Retry:     0,
-	}
-
-	// 入队列
-	if _, err := MessageQueue.Enqueue(ctx, msg); err != nil {
+	taskID, err := SubmitTask(ctx, req.SessionID, req.ClaimID, req.Messages)
+	if err != nil {
 		resp := UploadResponse{
 			Code: -1,
-			Msg:  fmt.Sprintf("failed to %s enqueue", SERVER_NAME),
+			Msg:  err.Error(),
 			Data: struct{}{},
 		}
 		w.Header().Set("Content-Type", "application/json")
@@ -128,7 +128,7 @@ func uploadHandler(w http.ResponseWriter, r *http.Request) {
 	resp := UploadResponse{
 		Code: 0,
 		Msg:  fmt.Sprintf("messages uploaded %s successfully", SERVER_NAME),
-		Data: map[string]string{"task_id": msg.TaskID},
+		Data: map[string]string{"task_id": taskID},
 	}
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(resp)
@@ -146,11 +146,11 @@ func queryHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	userPortrait, err := DBClient.GetUserPortrait(sessionID)
+	userPortrait, err := GetPortrait(sessionID)
 	if err != nil {
 		json.NewEncoder(w).Encode(QueryResponse{
 			Code: -1,
-			Msg:  "failed to get user portrait: " + err.Error(),
+			Msg:  err.Error(),
 			Data: struct{}{},
 		})
 		return
@@ -163,6 +163,35 @@ func queryHandler(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// batchQueryHandler 批量查询用户画像，data 以 session_id 为 key
+func batchQueryHandler(w http.ResponseWriter, r *http.Request) {
+	var req BatchQueryRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		json.NewEncoder(w).Encode(QueryResponse{
+			Code: -1,
+			Msg:  "invalid request body",
+			Data: struct{}{},
+		})
+		return
+	}
+
+	portraits, err := GetPortraits(req.SessionIDs)
+	if err != nil {
+		json.NewEncoder(w).Encode(QueryResponse{
+			Code: -1,
+			Msg:  err.Error(),
+			Data: struct{}{},
+		})
+		return
+	}
+
+	json.NewEncoder(w).Encode(QueryResponse{
+		Code: 0,
+		Msg:  "success",
+		Data: portraits,
+	})
+}
+
 func deleteHandler(w http.ResponseWriter, r *http.Request) {
 	sessionID := chi.URLParam(r, "sessionID")
 	if sessionID == "" {
@@ -174,22 +203,60 @@ func deleteHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// 删除数据库记录
-	if err := DBClient.DeleteUserPortrait(sessionID); err != nil {
+	// 删除数据库记录及队列中的消息
+	if err := DeleteSession(r.Context(), sessionID); err != nil {
+		json.NewEncoder(w).Encode(QueryResponse{
+			Code: -1,
+			Msg:  err.Error(),
+			Data: struct{}{},
+		})
+		return
+	}
+
+	json.NewEncoder(w).Encode(QueryResponse{
+		Code: 0,
+		Msg:  "user portrait and queue messages deleted successfully",
+		Data: struct{}{},
+	})
+}
+
+// taskStatusHandler 查询任务状态
+func taskStatusHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	taskID := chi.URLParam(r, "taskID")
+	if taskID == "" {
+		json.NewEncoder(w).Encode(QueryResponse{
+			Code: -1,
+			Msg:  "task_id is required",
+			Data: struct{}{},
+		})
+		return
+	}
+
+	status, err := GetTaskStatus(r.Context(), taskID)
+	if err != nil {
 		json.NewEncoder(w).Encode(QueryResponse{
 			Code: -1,
-			Msg:  "failed to delete user portrait: " + err.Error(),
+			Msg:  err.Error(),
 			Data: struct{}{},
 		})
 		return
 	}
 
-	// 删除队列中的消息
-	ctx := context.Background()
-	if err := MessageQueue.DeleteBySession(ctx, sessionID); err != nil {
+	json.NewEncoder(w).Encode(QueryResponse{
+		Code: 0,
+		Msg:  "success",
+		Data: status,
+	})
+}
+
+// exportHandler 导出用户画像，不存在时 data 为 null
+func exportHandler(w http.ResponseWriter, r *http.Request) {
+	portrait, err := ExportPortrait(chi.URLParam(r, "sessionID"))
+	if err != nil {
 		json.NewEncoder(w).Encode(QueryResponse{
 			Code: -1,
-			Msg:  "failed to delete messages from queue: " + err.Error(),
+			Msg:  err.Error(),
 			Data: struct{}{},
 		})
 		return
@@ -197,7 +264,36 @@ func deleteHandler(w http.ResponseWriter, r *http.Request) {
 
 	json.NewEncoder(w).Encode(QueryResponse{
 		Code: 0,
-		Msg:  "user portrait and queue messages deleted successfully",
-		Data: struct{}{},
+		Msg:  "success",
+		Data: portrait,
+	})
+}
+
+// importHandler 将用户画像导入会话
+func importHandler(w http.ResponseWriter, r *http.Request) {
+	var req ImportRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		json.NewEncoder(w).Encode(QueryResponse{
+			Code: -1,
+			Msg:  "invalid request body",
+			Data: struct{}{},
+		})
+		return
+	}
+
+	result, err := ImportPortrait(req.SessionID, req.Mode, req.Portrait)
+	if err != nil {
+		json.NewEncoder(w).Encode(QueryResponse{
+			Code: -1,
+			Msg:  err.Error(),
+			Data: struct{}{},
+		})
+		return
+	}
+
+	json.NewEncoder(w).Encode(QueryResponse{
+		Code: 0,
+		Msg:  "success",
+		Data: result,
 	})
 }
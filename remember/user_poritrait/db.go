@@ -88,6 +88,41 @@ func (uc *UserClient) GetUserPortrait(sessionID string) (*UserPortrait, error) {
 	return &result, nil
 }
 
+// GetUserPortraits 批量获取用户画像，一次 $in 查询，不存在的会话返回空画像
+func (uc *UserClient) GetUserPortraits(sessionIDs []string) (map[string]*UserPortrait, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	filter := bson.M{"session_id": bson.M{"$in": sessionIDs}}
+	cursor, err := uc.Collection.Find(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var records []UserPortrait
+	if err := cursor.All(ctx, &records); err != nil {
+		return nil, err
+	}
+
+	result := make(map[string]*UserPortrait, len(sessionIDs))
+	for i := range records {
+		result[records[i].SessionID] = &records[i]
+	}
+	for _, sessionID := range sessionIDs {
+		if _, ok := result[sessionID]; !ok {
+			result[sessionID] = &UserPortrait{
+				ID:           GenerateUUID(),
+				SessionID:    sessionID,
+				UserPortrait: make(map[string]interface{}),
+				CreatedAt:    time.Now().UTC(),
+				UpdatedAt:    time.Now().UTC(),
+			}
+		}
+	}
+	return result, nil
+}
+
 // DeleteUserPortrait 删除指定 sessionID 的用户画像
 func (uc *UserClient) DeleteUserPortrait(sessionID string) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
@@ -0,0 +1,128 @@
+package user_poritrait
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// --------------------- 导出与导入：主服务 /memory/export、/memory/import 按会话迁移用户画像 -----------------------------
+
+// ImportResult 导入结果
+type ImportResult struct {
+	Imported int  `json:"imported"` // 写入的画像数（0 或 1）
+	Skipped  bool `json:"skipped"`  // skip 模式下会话已有画像，未写入
+}
+
+// ExportPortrait 导出用户画像，不存在时返回 nil
+func ExportPortrait(sessionID string) (*UserPortrait, error) {
+	if sessionID == "" {
+		return nil, fmt.Errorf("%s session_id is required", SERVER_NAME)
+	}
+	portrait, err := DBClient.findUserPortrait(sessionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to export user portrait: %w", err)
+	}
+	return portrait, nil
+}
+
+// ImportPortrait 将用户画像导入会话，portrait 为 nil 时 replace 模式删除现有画像
+func ImportPortrait(sessionID, mode string, portrait *UserPortrait) (*ImportResult, error) {
+	if sessionID == "" {
+		return nil, fmt.Errorf("%s session_id is required", SERVER_NAME)
+	}
+	if mode != ImportReplace && mode != ImportMerge && mode != ImportSkip {
+		return nil, fmt.Errorf("%s invalid import mode: %s", SERVER_NAME, mode)
+	}
+
+	result, err := DBClient.importUserPortrait(sessionID, mode, portrait)
+	if err != nil {
+		return nil, fmt.Errorf("failed to import user portrait: %w", err)
+	}
+	if result.Imported > 0 || mode == ImportReplace {
+		NotifyMemoryChanged(context.Background(), sessionID)
+	}
+	return result, nil
+}
+
+// findUserPortrait 查询用户画像，不存在时返回 nil
+func (uc *UserClient) findUserPortrait(sessionID string) (*UserPortrait, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), ImportTimeout*time.Second)
+	defer cancel()
+
+	var result UserPortrait
+	err := uc.Collection.FindOne(ctx, bson.M{"session_id": sessionID}).Decode(&result)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+func (uc *UserClient) importUserPortrait(sessionID, mode string, portrait *UserPortrait) (*ImportResult, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), ImportTimeout*time.Second)
+	defer cancel()
+
+	filter := bson.M{"session_id": sessionID}
+	if portrait == nil || len(portrait.UserPortrait) == 0 {
+		if mode == ImportReplace {
+			if _, err := uc.Collection.DeleteOne(ctx, filter); err != nil {
+				return nil, err
+			}
+		}
+		return &ImportResult{}, nil
+	}
+
+	existing, err := uc.findUserPortrait(sessionID)
+	if err != nil {
+		return nil, err
+	}
+	fields := portrait.UserPortrait
+	updatedAt := portrait.UpdatedAt
+	if existing != nil {
+		switch mode {
+		case ImportSkip:
+			return &ImportResult{Skipped: true}, nil
+		case ImportMerge:
+			// 现有字段优先，导入的画像只补充缺少的一级字段
+			fields = make(map[string]interface{}, len(portrait.UserPortrait)+len(existing.UserPortrait))
+			for k, v := range portrait.UserPortrait {
+				fields[k] = v
+			}
+			for k, v := range existing.UserPortrait {
+				fields[k] = v
+			}
+			updatedAt = time.Now().UTC()
+		}
+	}
+	if updatedAt.IsZero() {
+		updatedAt = time.Now().UTC()
+	}
+	createdAt := portrait.CreatedAt
+	if createdAt.IsZero() {
+		createdAt = updatedAt
+	}
+
+	update := bson.M{
+		"$set": bson.M{
+			"user_portrait": fields,
+			"updated_at":    updatedAt,
+		},
+		"$setOnInsert": bson.M{
+			"_id":        GenerateUUID(),
+			"session_id": sessionID,
+			"created_at": createdAt,
+		},
+	}
+	if _, err := uc.Collection.UpdateOne(ctx, filter, update, options.Update().SetUpsert(true)); err != nil {
+		return nil, err
+	}
+	Info("%s imported user portrait into session %s, mode=%s", SERVER_NAME, sessionID, mode)
+	return &ImportResult{Imported: 1}, nil
+}
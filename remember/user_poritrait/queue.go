@@ -3,24 +3,45 @@ package user_poritrait
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
 	"time"
 
 	"github.com/redis/go-redis/v9"
+
+	"remember/taskqueue"
 )
 
+// ---------------------------------------------------------------------------------------------
+// 队列基于 Redis Stream + 消费者组：
+//   - Dequeue 通过 XREADGROUP 领取消息，消息进入 pending 列表，处理成功后必须调用 Ack
+//   - Worker 崩溃或被杀时未 ACK 的消息，超过 ClaimIdle 秒后由其他消费者通过 XAUTOCLAIM 重新领取
+//   - 失败需要重试的任务写入延迟队列（Sorted Set，score 为到期时间毫秒），到期后移回 Stream
+//   - 启动时会把旧版 List 队列中的任务迁移到 Stream
+// ---------------------------------------------------------------------------------------------
+
 // QueueMessage 队列消息结构
 type QueueMessage struct {
-	TaskID    string    `json:"task_id"`
-	SessionID string    `json:"session_id"`
-	Messages  []Message `json:"messages"`
-	Timestamp int64     `json:"timestamp"`
-	Retry     int       `json:"retry"`
+	TaskID    string        `json:"task_id" bson:"task_id"`
+	SessionID string        `json:"session_id" bson:"session_id"`
+	Messages  []Message     `json:"messages" bson:"messages"`
+	Timestamp int64         `json:"timestamp" bson:"timestamp"`
+	Retry     int           `json:"retry" bson:"retry"`
+	History   []RetryRecord `json:"history,omitempty" bson:"history,omitempty"`   // 每次失败的记录
+	ClaimID   string        `json:"claim_id,omitempty" bson:"claim_id,omitempty"` // session_messages 中认领消息的 task_id，任务成功或进入死信后据此上报
+
+	StreamID string `json:"-" bson:"-"` // Redis Stream 消息ID，Ack 时使用
 }
 
 // QueueClient 封装队列操作
 type QueueClient struct {
 	RedisClient *redis.Client
-	QueueName   string
+	QueueName   string // Stream key
+	RetryName   string // 延迟重试 Sorted Set key
+	Group       string // 消费者组
+	Consumer    string // 当前进程的消费者名
 }
 
 var MessageQueue *QueueClient
@@ -28,6 +49,14 @@ var MessageQueue *QueueClient
 func init() {
 	MessageQueue = NewQueueClient()
 
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := MessageQueue.migrateLegacyList(ctx); err != nil {
+		Error("%s migrate legacy list queue failed: %v", SERVER_NAME, err)
+	}
+	if err := MessageQueue.ensureGroup(ctx); err != nil {
+		Error("%s create consumer group failed: %v", SERVER_NAME, err)
+	}
 }
 
 // NewQueueClient 创建 QueueClient
@@ -35,7 +64,47 @@ func NewQueueClient() *QueueClient {
 	return &QueueClient{
 		RedisClient: RedisClient,
 		QueueName:   QUEUE_NAME,
+		RetryName:   QUEUE_NAME + ":retry",
+		Group:       QUEUE_GROUP,
+		Consumer:    consumerName(),
+	}
+}
+
+// consumerName 生成当前进程的消费者名：hostname-pid-随机串
+func consumerName() string {
+	host, err := os.Hostname()
+	if err != nil || host == "" {
+		host = "unknown"
+	}
+	return fmt.Sprintf("%s-%d-%s", host, os.Getpid(), GenerateUUID()[:8])
+}
+
+// ensureGroup 创建消费者组（已存在时忽略）
+func (q *QueueClient) ensureGroup(ctx context.Context) error {
+	err := q.RedisClient.XGroupCreateMkStream(ctx, q.QueueName, q.Group, "0").Err()
+	if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		return err
+	}
+	return nil
+}
+
+// migrateLegacyList 将旧版 List 队列中的任务迁移到 Stream，迁移过程（加锁、RENAMENX、逐条写入）见 taskqueue.MigrateList
+func (q *QueueClient) migrateLegacyList(ctx context.Context) error {
+	migrated, err := taskqueue.MigrateList(ctx, q.RedisClient, q.QueueName, q.Consumer, ClaimIdle*time.Second, func(ctx context.Context, raw string) error {
+		return q.add(ctx, []byte(raw))
+	})
+	if migrated > 0 {
+		Info("%s migrated %d tasks from list %s to stream", SERVER_NAME, migrated, q.QueueName)
 	}
+	return err
+}
+
+// add 写入 Stream
+func (q *QueueClient) add(ctx context.Context, data []byte) error {
+	return q.RedisClient.XAdd(ctx, &redis.XAddArgs{
+		Stream: q.QueueName,
+		Values: map[string]interface{}{"data": data},
+	}).Err()
 }
 
 // Enqueue 入队列
@@ -44,10 +113,6 @@ func (q *QueueClient) Enqueue(ctx context.Context, msg QueueMessage) (string, er
 	if msg.TaskID == "" {
 		msg.TaskID = GenerateUUID()
 	}
-	// 初始化重试次数
-	if msg.Retry == 0 {
-		msg.Retry = 0
-	}
 	// 设置时间戳
 	if msg.Timestamp == 0 {
 		msg.Timestamp = time.Now().UTC().Unix()
@@ -58,35 +123,117 @@ func (q *QueueClient) Enqueue(ctx context.Context, msg QueueMessage) (string, er
 		return msg.TaskID, err
 	}
 
-	if err := q.RedisClient.RPush(ctx, q.QueueName, data).Err(); err != nil {
+	if err := q.add(ctx, data); err != nil {
 		return msg.TaskID, err
 	}
 
 	Info("%s Enqueued message for session_id=%s, task_id=%s, retry=%d", SERVER_NAME, msg.SessionID, msg.TaskID, msg.Retry)
+	trackTask(ctx, &msg, TaskQueued, nil)
 	return msg.TaskID, nil
 }
 
-// Dequeue 出队列
-func (q *QueueClient) Dequeue(ctx context.Context) (*QueueMessage, error) {
-	result, err := q.RedisClient.LPop(ctx, q.QueueName).Result()
+// ScheduleRetry 将任务放入延迟队列，delay 后重新进入 Stream
+func (q *QueueClient) ScheduleRetry(ctx context.Context, msg QueueMessage, delay time.Duration) error {
+	msg.StreamID = ""
+	data, err := json.Marshal(msg)
 	if err != nil {
+		return err
+	}
+
+	due := time.Now().Add(delay).UnixMilli()
+	return q.RedisClient.ZAdd(ctx, q.RetryName, redis.Z{Score: float64(due), Member: data}).Err()
+}
+
+// promoteScript 原子地把到期的重试任务移回 Stream
+var promoteScript = redis.NewScript(`
+local items = redis.call('ZRANGEBYSCORE', KEYS[1], '-inf', ARGV[1], 'LIMIT', 0, tonumber(ARGV[2]))
+for _, item in ipairs(items) do
+	redis.call('XADD', KEYS[2], '*', 'data', item)
+	redis.call('ZREM', KEYS[1], item)
+end
+return #items
+`)
+
+// promoteDueRetries 将到期的重试任务移回 Stream
+func (q *QueueClient) promoteDueRetries(ctx context.Context) error {
+	now := time.Now().UnixMilli()
+	return promoteScript.Run(ctx, q.RedisClient, []string{q.RetryName, q.QueueName}, now, 100).Err()
+}
+
+// Dequeue 领取一条消息：优先重新领取超时未 ACK 的消息，其次读取新消息；队列为空时返回 redis.Nil
+func (q *QueueClient) Dequeue(ctx context.Context) (*QueueMessage, error) {
+	if err := q.promoteDueRetries(ctx); err != nil {
+		Error("%s promote due retries failed: %v", SERVER_NAME, err)
+	}
+
+	claimed, _, err := q.RedisClient.XAutoClaim(ctx, &redis.XAutoClaimArgs{
+		Stream:   q.QueueName,
+		Group:    q.Group,
+		Consumer: q.Consumer,
+		MinIdle:  ClaimIdle * time.Second,
+		Start:    "0-0",
+		Count:    1,
+	}).Result()
+	if err != nil && err != redis.Nil {
 		return nil, err
 	}
+	if len(claimed) > 0 {
+		Info("%s reclaimed pending message %s", SERVER_NAME, claimed[0].ID)
+		return q.decode(ctx, claimed[0])
+	}
 
-	var msg QueueMessage
-	if err := json.Unmarshal([]byte(result), &msg); err != nil {
+	streams, err := q.RedisClient.XReadGroup(ctx, &redis.XReadGroupArgs{
+		Group:    q.Group,
+		Consumer: q.Consumer,
+		Streams:  []string{q.QueueName, ">"},
+		Count:    1,
+		Block:    -1, // 不阻塞，由 Worker 控制轮询间隔
+	}).Result()
+	if err != nil {
 		return nil, err
 	}
+	if len(streams) == 0 || len(streams[0].Messages) == 0 {
+		return nil, redis.Nil
+	}
+	return q.decode(ctx, streams[0].Messages[0])
+}
 
+// decode 解析 Stream 消息；无法解析的消息直接 ACK 丢弃，避免反复被领取
+func (q *QueueClient) decode(ctx context.Context, entry redis.XMessage) (*QueueMessage, error) {
+	raw, _ := entry.Values["data"].(string)
+
+	var msg QueueMessage
+	if err := json.Unmarshal([]byte(raw), &msg); err != nil {
+		q.ackID(ctx, entry.ID)
+		return nil, fmt.Errorf("invalid queue message %s: %w", entry.ID, err)
+	}
+	msg.StreamID = entry.ID
 	return &msg, nil
 }
 
-// Length 获取队列长度
+// Ack 确认消息已处理（成功、已重新入队或已放弃），并从 Stream 中删除
+func (q *QueueClient) Ack(ctx context.Context, msg *QueueMessage) error {
+	if msg.StreamID == "" {
+		return errors.New("queue message has no stream id")
+	}
+	return q.ackID(ctx, msg.StreamID)
+}
+
+func (q *QueueClient) ackID(ctx context.Context, id string) error {
+	_, err := q.RedisClient.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.XAck(ctx, q.QueueName, q.Group, id)
+		pipe.XDel(ctx, q.QueueName, id)
+		return nil
+	})
+	return err
+}
+
+// Length 获取队列长度（未处理 + 处理中，不含等待重试的任务）
 func (q *QueueClient) Length() (int64, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
 	defer cancel()
 
-	length, err := q.RedisClient.LLen(ctx, q.QueueName).Result()
+	length, err := q.RedisClient.XLen(ctx, q.QueueName).Result()
 	if err != nil {
 		return 0, err
 	}
@@ -96,20 +243,39 @@ func (q *QueueClient) Length() (int64, error) {
 // DeleteBySession 删除队列中指定 sessionID 的消息
 func (q *QueueClient) DeleteBySession(ctx context.Context, sessionID string) error {
 	// 获取整个队列
-	messages, err := q.RedisClient.LRange(ctx, q.QueueName, 0, -1).Result()
+	entries, err := q.RedisClient.XRange(ctx, q.QueueName, "-", "+").Result()
 	if err != nil {
 		return err
 	}
 
-	for _, raw := range messages {
+	for _, entry := range entries {
+		raw, _ := entry.Values["data"].(string)
+
 		var msg QueueMessage
 		if err := json.Unmarshal([]byte(raw), &msg); err != nil {
 			continue // 出错就跳过
 		}
 
 		if msg.SessionID == sessionID {
-			// 从队列中删除该条消息
-			if err := q.RedisClient.LRem(ctx, q.QueueName, 1, raw).Err(); err != nil {
+			// 从队列中删除该条消息（包括已被领取但未 ACK 的）
+			if err := q.ackID(ctx, entry.ID); err != nil {
+				return err
+			}
+		}
+	}
+
+	// 删除延迟队列中的消息
+	retries, err := q.RedisClient.ZRange(ctx, q.RetryName, 0, -1).Result()
+	if err != nil {
+		return err
+	}
+	for _, raw := range retries {
+		var msg QueueMessage
+		if err := json.Unmarshal([]byte(raw), &msg); err != nil {
+			continue
+		}
+		if msg.SessionID == sessionID {
+			if err := q.RedisClient.ZRem(ctx, q.RetryName, raw).Err(); err != nil {
 				return err
 			}
 		}
@@ -0,0 +1,68 @@
+package user_poritrait
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// --------------------- service.go 用户画像的业务逻辑，HTTP 接口与单进程模式共用 -----------------------------
+
+// SubmitTask 将一轮对话放入任务队列，返回任务ID；claimID 为 session_messages 中认领这些消息的 task_id，可为空
+func SubmitTask(ctx context.Context, sessionID, claimID string, messages []Message) (string, error) {
+	if sessionID == "" || len(messages) == 0 {
+		return "", fmt.Errorf("%s session_id and messages are required", SERVER_NAME)
+	}
+
+	// 构造 QueueMessage 对象
+	msg := QueueMessage{
+		TaskID:    GenerateUUID(),
+		SessionID: sessionID,
+		Messages:  messages,
+		Timestamp: time.Now().UTC().Unix(),
+		Retry:     0,
+		ClaimID:   claimID,
+	}
+
+	// 入队列
+	if _, err := MessageQueue.Enqueue(ctx, msg); err != nil {
+		return "", fmt.Errorf("failed to %s enqueue", SERVER_NAME)
+	}
+	return msg.TaskID, nil
+}
+
+// GetPortrait 获取用户画像，不存在时返回空画像
+func GetPortrait(sessionID string) (*UserPortrait, error) {
+	userPortrait, err := DBClient.GetUserPortrait(sessionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user portrait: %w", err)
+	}
+	return userPortrait, nil
+}
+
+// GetPortraits 批量获取用户画像，以 session_id 为 key，不存在时返回空画像
+func GetPortraits(sessionIDs []string) (map[string]*UserPortrait, error) {
+	if len(sessionIDs) == 0 || len(sessionIDs) > MaxBatchSessions {
+		return nil, fmt.Errorf("session_ids is required, at most %d", MaxBatchSessions)
+	}
+	portraits, err := DBClient.GetUserPortraits(sessionIDs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user portraits: %w", err)
+	}
+	return portraits, nil
+}
+
+// DeleteSession 删除用户画像及队列中的待处理任务
+func DeleteSession(ctx context.Context, sessionID string) error {
+	// 删除数据库记录
+	if err := DBClient.DeleteUserPortrait(sessionID); err != nil {
+		return fmt.Errorf("failed to delete user portrait: %w", err)
+	}
+
+	// 删除队列中的消息
+	if err := MessageQueue.DeleteBySession(ctx, sessionID); err != nil {
+		return fmt.Errorf("failed to delete messages from queue: %w", err)
+	}
+	NotifyMemoryChanged(ctx, sessionID)
+	return nil
+}
@@ -3,10 +3,52 @@ package user_poritrait
 const (
 	DB_NAME          = "user_poritrait"                   // 数据库名
 	QUEUE_NAME       = "remember:user_poritrait:queue"    // 队列名
+	QUEUE_GROUP      = "remember:user_poritrait:workers"  // 队列消费者组
+	DEAD_LETTER_NAME = "user_poritrait_dead_letter"       // 死信集合名
 	SERVER_NAME      = "[用户画像]"                           // 服务名
 	User_query       = "Returns the English JSON  result" // user_query填充位
 	MaxRetry         = 3                                  // 任务执行大重试次数
+	RetryBaseDelay   = 10                                 // 首次重试前等待的秒数，之后每次翻倍
+	RetryMaxDelay    = 600                                // 重试等待的上限（秒）
+	ClaimIdle        = 300                                // 消息被领取后超过多少秒未 ACK，视为消费者已失联，可被其他 Worker 重新领取
 	Monitor_Interval = 60                                 // 监控间隔
 	Queue_MAXLEN     = 80                                 // 队列最大长度
 
 )
+
+// --------------------------  任务状态 -----------------------------
+const (
+	TASK_STATUS_PREFIX = "remember:user_poritrait:task:" // 任务状态 key 前缀
+	TaskStatusTTL      = 7 * 24 * 3600                   // 任务状态保留时间（秒）
+)
+
+// --------------------------  记忆变更通知（与 server/static.go 一致） -----------------------------
+const (
+	APPLY_CACHE_PREFIX     = "remember:main:apply:cache:" // 主服务 apply 缓存 key 前缀
+	APPLY_GEN_PREFIX       = "remember:main:apply:gen:"   // 会话记忆版本号 key 前缀
+	MEMORY_CHANGED_CHANNEL = "remember:memory:changed"    // 会话数据变更通知频道
+	MEMORY_SOURCE          = "user_portrait"
+	ApplyGenTTL            = 7 * 24 * 3600 // 版本号保留时间（秒）
+)
+
+// --------------------------  批量查询 -----------------------------
+const (
+	MaxBatchSessions = 100 // 批量查询接口单次最多的会话数
+)
+
+// --------------------------  导出与导入 -----------------------------
+const (
+	ImportReplace = "replace" // 用导入的画像覆盖现有画像
+	ImportMerge   = "merge"   // 保留现有画像字段，只补充不存在的一级字段
+	ImportSkip    = "skip"    // 会话已有画像时跳过
+	ImportTimeout = 30        // 导出、导入的数据库超时（秒）
+)
+
+// --------------------------  任务完成通知（与 session_messages/static.go 一致） -----------------------------
+const (
+	COMPLETION_STREAM = "remember:session_messages:completions" // 完成通知 Stream，由 session_messages 消费
+	CompletionMaxLen  = 100000                                  // Stream 近似最大长度
+	CompletionDone    = "done"                                  // 任务成功
+	CompletionFailed  = "failed"                                // 任务进入死信
+	EXTRACTOR_NAME    = "user_poritrait"                        // 本服务在 session_messages 中的抽取器名称（旧版 task1_id）
+)
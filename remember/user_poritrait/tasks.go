@@ -0,0 +1,74 @@
+package user_poritrait
+
+import (
+	"context"
+	"time"
+
+	"remember/taskqueue"
+)
+
+// --------------------- 死信、重试、任务状态、完成通知和记忆变更通知的实现见 remember/taskqueue，这里按本服务的集合名和 key 创建 -----------------------------
+
+type (
+	RetryRecord      = taskqueue.RetryRecord
+	DeadLetterFilter = taskqueue.DeadLetterFilter
+	TaskStatus       = taskqueue.TaskStatus
+)
+
+// 任务状态
+const (
+	TaskQueued    = taskqueue.TaskQueued
+	TaskRunning   = taskqueue.TaskRunning
+	TaskSucceeded = taskqueue.TaskSucceeded
+	TaskRetrying  = taskqueue.TaskRetrying
+	TaskFailed    = taskqueue.TaskFailed
+)
+
+var (
+	DeadLetters    *taskqueue.DeadLetterClient[QueueMessage]
+	TaskStatuses   *taskqueue.StatusStore
+	memoryNotifier *taskqueue.MemoryNotifier
+	completions    *taskqueue.CompletionReporter
+)
+
+func init() {
+	DeadLetters = taskqueue.NewDeadLetterClient(MongoDB, DEAD_LETTER_NAME, SERVER_NAME, func(ctx context.Context, msg QueueMessage) error {
+		msg.Retry = 0
+		_, err := MessageQueue.Enqueue(ctx, msg)
+		return err
+	})
+	TaskStatuses = &taskqueue.StatusStore{Redis: RedisClient, Prefix: TASK_STATUS_PREFIX, TTL: TaskStatusTTL * time.Second}
+	memoryNotifier = &taskqueue.MemoryNotifier{
+		Redis:       RedisClient,
+		GenPrefix:   APPLY_GEN_PREFIX,
+		CachePrefix: APPLY_CACHE_PREFIX,
+		Channel:     MEMORY_CHANGED_CHANNEL,
+		GenTTL:      ApplyGenTTL * time.Second,
+	}
+	completions = &taskqueue.CompletionReporter{Redis: RedisClient, Stream: COMPLETION_STREAM, MaxLen: CompletionMaxLen, Extractor: EXTRACTOR_NAME}
+}
+
+// RetryDelay 第 retry 次失败后的等待时间
+func RetryDelay(retry int) time.Duration {
+	return taskqueue.Backoff(retry, RetryBaseDelay*time.Second, RetryMaxDelay*time.Second)
+}
+
+// trackTask 更新任务状态，失败只记录日志，不影响任务处理
+func trackTask(ctx context.Context, msg *QueueMessage, status string, lastErr error) {
+	TaskStatuses.Track(ctx, msg.TaskID, msg.SessionID, msg.Retry, status, lastErr)
+}
+
+// GetTaskStatus 获取任务状态
+func GetTaskStatus(ctx context.Context, taskID string) (*TaskStatus, error) {
+	return TaskStatuses.Get(ctx, taskID)
+}
+
+// NotifyMemoryChanged 本服务写入会话数据后通知主服务
+func NotifyMemoryChanged(ctx context.Context, sessionID string) {
+	memoryNotifier.Notify(ctx, sessionID, MEMORY_SOURCE)
+}
+
+// ReportCompletion 上报任务结果，没有 claim_id 的任务不上报
+func ReportCompletion(ctx context.Context, msg *QueueMessage, status string, taskErr error) {
+	completions.Report(ctx, msg.SessionID, msg.ClaimID, msg.TaskID, status, taskErr)
+}
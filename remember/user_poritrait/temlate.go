@@ -4,6 +4,8 @@ package user_poritrait
 import (
 	"fmt"
 	"strings"
+
+	"remember/prompt"
 )
 
 // -------------------------- 基础模版 ---------------------------
@@ -29,9 +31,9 @@ You are required to accurately identify relevant information about the user in "
 - Pay attention to the nouns related to user information used in the original text
 
 ## User Profile Overview
-1. User Basic Information Field Name: {basic_information_list}
-2. User Followed Topics Field Name: {topic_list}
-3. User Sexual Orientation Field Name: {sexual_list}
+1. User Basic Information Field Name: {{.basic_information_list}}
+2. User Followed Topics Field Name: {{.topic_list}}
+3. User Sexual Orientation Field Name: {{.sexual_list}}
 
 ## User Profile Description Requirements
 1. Language should be descriptive. The output will be displayed directly to end users, so keep the language natural, fluent, and rich.
@@ -40,37 +42,37 @@ You are required to accurately identify relevant information about the user in "
 ## Profile
 ## Existing Memories
 
-{current_user_portrait}
+{{.current_user_portrait}}
 
 ## New Conversation
 ### Current Conversation History
 
-{messages_str}
+{{.messages_str}}
 
 # Current Time
-{current_time}
+{{.current_time}}
 
 # Output Format Example
 The output must be in JSON format, with the key being the field name and the value being the updated/merged information.
 
 Note: If the merged value is empty or None, the field is skipped and not output.
 
-{format_example}
+{{.format_example}}
 
 # Output Example 1
 
-{output_example_1}
+{{.output_example_1}}
 
 # Output Example 2
 
-{output_example_2}
+{{.output_example_2}}
 
 # Output Example 3
 
-{output_example_3}
+{{.output_example_3}}
 
 # Language Settings
-- Your working language is only {language}
+- Your working language is only {{.language}}
 
 # If no updates were made, the update JSON result will be {}
 
@@ -222,7 +224,7 @@ var UserProfilelanguage = "English"
 
 // ------------------------- 代码 -----------------------------
 
-var UserProfileStaticVars = map[string]string{
+var UserProfileStaticVars = prompt.Vars{
 	"basic_information_list": strings.Join(BasicInformationList, ", "),
 	"topic_list":             strings.Join(TopicList, ", "),
 	"sexual_list":            strings.Join(SexualList, ", "),
@@ -241,8 +243,8 @@ type UserProfileDynamicVars struct {
 }
 
 type UserProfileTemplate struct {
-	Template   string            // 静态变量已替换后的模板
-	StaticVars map[string]string // 静态变量
+	Template   string      // 模板（text/template 语法）
+	StaticVars prompt.Vars // 静态变量
 }
 
 // ---------------------------
@@ -263,24 +265,17 @@ func NewUserProfileTemplate() *UserProfileTemplate {
 }
 
 func (u *UserProfileTemplate) BuildPrompt(dynamicVars *UserProfileDynamicVars) (string, error) {
-	// 先替换静态变量
-	finalTpl, err := SystemPromptComposeStatic(u.Template, u.StaticVars)
-	if err != nil {
-		return "", fmt.Errorf("静态模板组装失败: %v", err)
-	}
-
-	// 转成map[string]string 供systempromptCompose使用
-
-	dynMap := map[string]string{
+	// 转成 prompt.Vars 与静态变量一起渲染
+	dynMap := prompt.Vars{
 		"current_user_portrait": dynamicVars.CurrentUserPortrait,
 		"messages_str":          dynamicVars.MesssagesStr,
 		"current_time":          dynamicVars.CurrentTime,
 	}
 
-	// 再替换动态变量
-	finalTpl, err = SystemPromptCompose(finalTpl, dynMap)
+	// 缺少变量报错
+	finalTpl, err := prompt.Compose(u.Template, u.StaticVars, dynMap)
 	if err != nil {
-		return "", fmt.Errorf("动态模板组装失败: %v", err)
+		return "", fmt.Errorf("模板组装失败: %v", err)
 	}
 
 	return finalTpl, nil
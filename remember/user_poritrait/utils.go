@@ -1,77 +1,14 @@
 package user_poritrait
 
-// 通用组装函数，支持变量插入不同的系统提示词模版，返回组装过后的系统提示词
 import (
 	"encoding/json"
 	"errors"
-	"fmt"
 	"github.com/google/uuid"
 	"regexp"
 	"strings"
 	"time"
 )
 
-/*
-
-两个函数拼装逻辑：
-1. systempromptcompose 所有占位符都要匹配到，如果缺少变量，报错
-2. systempromptcomposestatic 缺少变量跳过，不报错
-
-
-*/
-
-// 通用函数组装
-func SystemPromptCompose(template string, vars map[string]string) (string, error) {
-	// 占位符必须符合变量命名规则：字母开头，字母/数字/下划线
-	re := regexp.MustCompile(`\{([a-zA-Z_][a-zA-Z0-9_]*)\}`)
-	matches := re.FindAllStringSubmatch(template, -1)
-
-	for _, match := range matches {
-		placeholder := match[0] // {变量名}
-		varName := match[1]     // 变量名
-		value, exists := vars[varName]
-		if !exists {
-			return "", errors.New("缺少变量: " + varName)
-		}
-
-		// 转义变量值，保证 JSON 合法
-		escapedValue, err := json.Marshal(value)
-		if err != nil {
-			return "", fmt.Errorf("变量 %s 转义失败: %v", varName, err)
-		}
-
-		// 替换占位符（去掉 json.Marshal 返回的双引号）
-		template = strings.ReplaceAll(template, placeholder, string(escapedValue[1:len(escapedValue)-1]))
-	}
-
-	return template, nil
-}
-
-// 通用函数组装（缺少变量跳过，不报错）
-func SystemPromptComposeStatic(template string, vars map[string]string) (string, error) {
-	re := regexp.MustCompile(`\{(\w+)\}`)
-	matches := re.FindAllStringSubmatch(template, -1)
-
-	for _, match := range matches {
-		placeholder := match[0]
-		varName := match[1]
-
-		value, exists := vars[varName]
-		if !exists {
-			// 如果缺少变量，跳过，不报错
-			continue
-		}
-
-		escapedValue, err := json.Marshal(value)
-		if err != nil {
-			return "", fmt.Errorf("变量 %s 转义失败: %v", varName, err)
-		}
-
-		template = strings.ReplaceAll(template, placeholder, string(escapedValue[1:len(escapedValue)-1]))
-	}
-	return template, nil
-}
-
 // openai reponse 2 json 解析函数
 func Response2JSON(resp string) (map[string]interface{}, error) {
 	var m map[string]interface{}